@@ -4,6 +4,8 @@ import (
 	"embed"
 	_ "embed"
 	"github.com/spf13/cobra"
+	"io/fs"
+	"kubeall.io/api-server/pkg/infra/console"
 	"kubeall.io/api-server/pkg/server"
 	"kubeall.io/api-server/pkg/types"
 	"log"
@@ -22,6 +24,11 @@ var banner string
 //go:embed resources/locales/*
 var localeFs embed.FS
 
+// the assets of the console, they're copied from console/dist by `task console`
+//
+//go:embed all:resources/console
+var consoleFs embed.FS
+
 // the external configuration file to be used for overriding the existing configuration
 const flagName = "config"
 
@@ -67,5 +74,9 @@ func startServer(cmd *cobra.Command, args []string) {
 		CustomConfigPath: customCfg,
 		DefaultCfgPaths:  []string{},
 	}
-	server.RegisterModules(params, localeFs)
+	consoleAssets, err := fs.Sub(consoleFs, "resources/console")
+	if err != nil {
+		log.Fatal(err)
+	}
+	server.RegisterModules(params, localeFs, console.Assets{FS: consoleAssets})
 }
@@ -2,12 +2,16 @@ package controller
 
 import (
 	"context"
+	"fmt"
 	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"kubeall.io/api-server/pkg/controller/predicates"
 	kav1 "kubeall.io/api-server/pkg/generated/kubeall.io/v1"
 	lhv1beta2 "kubeall.io/api-server/pkg/generated/longhorn/apis/longhorn/v1beta2"
 	"kubeall.io/api-server/pkg/infra/apiserver"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/logger"
 	"kubeall.io/api-server/pkg/service"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
@@ -15,6 +19,7 @@ import (
 	contrl "sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sort"
 )
 
 type BackingImageReconciler struct {
@@ -22,6 +27,7 @@ type BackingImageReconciler struct {
 	manager         Manager
 	clusterResource apiserver.ClusterResource
 	imageService    service.ImageService
+	statusWriter    StatusWriter[*kav1.Image]
 }
 
 func NewBackingImageReconciler(clusterResource apiserver.ClusterResource, imageService service.ImageService) ReconcileHandler {
@@ -31,6 +37,8 @@ func NewBackingImageReconciler(clusterResource apiserver.ClusterResource, imageS
 // SetupWithManager sets up the controller with the Manager.
 func (r *BackingImageReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.Client = mgr.GetClient()
+	r.statusWriter = NewStatusWriter(mgr.GetClient(), mgr.GetEventRecorderFor("backingImageController"),
+		(*kav1.Image).DeepCopy, imageConditions)
 
 	// watch the change event of backing image's status
 	return ctrl.NewControllerManagedBy(mgr).
@@ -55,7 +63,7 @@ func (r *BackingImageReconciler) SetupWithManager(mgr ctrl.Manager) error {
 }
 
 func (r *BackingImageReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	zap.L().Info("backing image reconciler triggered", zap.String("backingImage", req.Name),
+	logger.FromContext(ctx).Info("backing image reconciler triggered", zap.String("backingImage", req.Name),
 		zap.String("namespace", req.Namespace))
 	biImage, err := r.GetResource(ctx, req)
 	if err != nil {
@@ -66,27 +74,132 @@ func (r *BackingImageReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		return ctrl.Result{}, nil
 	}
 
-	imageStatus := &kav1.ImageStatus{}
-	for _, v := range biImage.Status.DiskFileStatusMap {
-		imageStatus.Size = biImage.Status.Size
+	// only the backing image associated to an image is tracked
+	imageName, imgOk := biImage.Labels[constants.LabelImage]
+	imageNamespace, nsOk := biImage.Labels[constants.LabelImageNamespace]
+	if !imgOk || !nsOk {
+		return ctrl.Result{}, nil
+	}
+
+	logger.FromContext(ctx).Info("staus map", zap.Any("statusMap", biImage.Status.DiskFileStatusMap))
+	progress := aggregateDiskFileStatus(biImage)
+	image := &kav1.Image{ObjectMeta: metav1.ObjectMeta{Name: imageName, Namespace: imageNamespace}}
+	_, _, err = r.statusWriter.UpdateStatus(ctx, image, func(image *kav1.Image) {
+		//update its status to track the uploading progress of backing image
+		image.Status.Size = biImage.Status.Size
+		image.Status.VirtualSize = progress.VirtualSize
+		image.Status.State = progress.State
+		image.Status.Progress = progress.Progress
+		image.Status.Message = progress.Message
+		image.Status.LastStateTransitionTime = progress.LastStateTransitionTime
+		image.Status.ReadyDisks = progress.ReadyDisks
+		image.Status.TotalDisks = progress.TotalDisks
+		setImageConditions(image, progress.Condition)
+	})
+	return ctrl.Result{}, client.IgnoreNotFound(err)
+}
+
+// diskFileProgress is the progress of a backing image aggregated from all of its disks
+type diskFileProgress struct {
+	State                   string
+	Progress                int
+	Message                 string
+	LastStateTransitionTime string
+	VirtualSize             int64
+	ReadyDisks              int
+	TotalDisks              int
+	Condition               metav1.Condition
+}
+
+// aggregateDiskFileStatus aggregates the status of the backing image's files on every disk. A failure on any disk
+// fails the image, it's uploaded only when the files on all disks are ready, and the progress is the average
+// of all disks. It's pending until any disk reports its file.
+func aggregateDiskFileStatus(biImage *lhv1beta2.BackingImage) diskFileProgress {
+	result := diskFileProgress{TotalDisks: len(biImage.Status.DiskFileStatusMap)}
+
+	// iterate the disks in order, so that the message picked is stable across reconciles
+	diskIds := make([]string, 0, len(biImage.Status.DiskFileStatusMap))
+	for diskId := range biImage.Status.DiskFileStatusMap {
+		diskIds = append(diskIds, diskId)
+	}
+	sort.Strings(diskIds)
 
-		if v.State == lhv1beta2.BackingImageStateReady {
-			imageStatus.VirtualSize = biImage.Status.VirtualSize
+	var totalProgress int
+	var failed, pending *lhv1beta2.BackingImageDiskFileStatus
+	for _, diskId := range diskIds {
+		v := biImage.Status.DiskFileStatusMap[diskId]
+		if v == nil {
+			continue
 		}
 		//the progress's value 100 doesn't mean the image is finished to upload meanwhile the state is not ready
 		p := v.Progress
-		if v.State != "ready" && v.Progress == 100 {
-			p = 99
+		switch {
+		case v.State == lhv1beta2.BackingImageStateReady:
+			result.ReadyDisks++
+			p = 100
+		case v.State == lhv1beta2.BackingImageStateFailed || v.State == lhv1beta2.BackingImageStateFailedAndCleanUp:
+			if failed == nil {
+				failed = v
+			}
+		default:
+			if p == 100 {
+				p = 99
+			}
+			if pending == nil {
+				pending = v
+			}
+		}
+		totalProgress += p
+		if v.LastStateTransitionTime > result.LastStateTransitionTime {
+			result.LastStateTransitionTime = v.LastStateTransitionTime
+		}
+	}
+	if result.TotalDisks > 0 {
+		result.Progress = totalProgress / result.TotalDisks
+	}
+
+	switch {
+	case failed != nil:
+		result.State = string(failed.State)
+		result.Message = failed.Message
+		result.Condition = metav1.Condition{
+			Type:    kav1.ImageConditionUploaded,
+			Status:  metav1.ConditionFalse,
+			Reason:  kav1.ImageReasonFailed,
+			Message: fmt.Sprintf("the content of the image failed on a disk: %s", failed.Message),
+		}
+	case pending != nil:
+		result.State = string(pending.State)
+		result.Message = pending.Message
+		result.Condition = metav1.Condition{
+			Type:   kav1.ImageConditionUploaded,
+			Status: metav1.ConditionFalse,
+			Reason: kav1.ImageReasonInProgress,
+			Message: fmt.Sprintf("the content of the image is ready on %d/%d disks",
+				result.ReadyDisks, result.TotalDisks),
+		}
+	case result.ReadyDisks == 0:
+		// no file is reported yet, e.g. the backing image was just created
+		result.State = string(lhv1beta2.BackingImageStatePending)
+		result.Progress = 0
+		result.Condition = metav1.Condition{
+			Type:    kav1.ImageConditionUploaded,
+			Status:  metav1.ConditionUnknown,
+			Reason:  kav1.ImageReasonPending,
+			Message: "no disk has reported the content of the image yet",
+		}
+	default:
+		result.State = string(lhv1beta2.BackingImageStateReady)
+		result.Progress = 100
+		result.VirtualSize = biImage.Status.VirtualSize
+		result.Condition = metav1.Condition{
+			Type:    kav1.ImageConditionUploaded,
+			Status:  metav1.ConditionTrue,
+			Reason:  kav1.ImageReasonCompleted,
+			Message: fmt.Sprintf("the content of the image is ready on %d disks", result.ReadyDisks),
 		}
-		imageStatus.State = string(v.State)
-		imageStatus.Progress = p
-		imageStatus.LastStateTransitionTime = v.LastStateTransitionTime
-		imageStatus.Message = v.Message
-		break
 	}
-	zap.L().Info("staus map", zap.Any("statusMap", biImage.Status.DiskFileStatusMap))
-	err = r.imageService.UpdateStatus(ctx, imageStatus, biImage)
-	return ctrl.Result{}, err
+	return result
 }
 
 func (r *BackingImageReconciler) GetResource(ctx context.Context, req ctrl.Request) (*lhv1beta2.BackingImage, error) {
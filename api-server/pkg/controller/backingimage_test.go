@@ -0,0 +1,70 @@
+package controller
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kav1 "kubeall.io/api-server/pkg/generated/kubeall.io/v1"
+	lhv1beta2 "kubeall.io/api-server/pkg/generated/longhorn/apis/longhorn/v1beta2"
+	"testing"
+)
+
+func TestAggregateDiskFileStatus(t *testing.T) {
+	tests := map[string]struct {
+		files    map[string]*lhv1beta2.BackingImageDiskFileStatus
+		state    lhv1beta2.BackingImageState
+		progress int
+		status   metav1.ConditionStatus
+		reason   string
+	}{
+		"no disk reported": {
+			state:  lhv1beta2.BackingImageStatePending,
+			status: metav1.ConditionUnknown,
+			reason: kav1.ImageReasonPending,
+		},
+		"no file status": {
+			files:  map[string]*lhv1beta2.BackingImageDiskFileStatus{"disk1": nil},
+			state:  lhv1beta2.BackingImageStatePending,
+			status: metav1.ConditionUnknown,
+			reason: kav1.ImageReasonPending,
+		},
+		"in progress": {
+			files: map[string]*lhv1beta2.BackingImageDiskFileStatus{
+				"disk1": {State: lhv1beta2.BackingImageStateReady, Progress: 100},
+				"disk2": {State: lhv1beta2.BackingImageStateInProgress, Progress: 100},
+			},
+			state:    lhv1beta2.BackingImageStateInProgress,
+			progress: 99,
+			status:   metav1.ConditionFalse,
+			reason:   kav1.ImageReasonInProgress,
+		},
+		"failed": {
+			files: map[string]*lhv1beta2.BackingImageDiskFileStatus{
+				"disk1": {State: lhv1beta2.BackingImageStateFailed, Progress: 50},
+				"disk2": {State: lhv1beta2.BackingImageStateInProgress, Progress: 50},
+			},
+			state:    lhv1beta2.BackingImageStateFailed,
+			progress: 50,
+			status:   metav1.ConditionFalse,
+			reason:   kav1.ImageReasonFailed,
+		},
+		"ready": {
+			files: map[string]*lhv1beta2.BackingImageDiskFileStatus{
+				"disk1": {State: lhv1beta2.BackingImageStateReady},
+				"disk2": {State: lhv1beta2.BackingImageStateReady},
+			},
+			state:    lhv1beta2.BackingImageStateReady,
+			progress: 100,
+			status:   metav1.ConditionTrue,
+			reason:   kav1.ImageReasonCompleted,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			biImage := &lhv1beta2.BackingImage{Status: lhv1beta2.BackingImageStatus{DiskFileStatusMap: test.files}}
+			result := aggregateDiskFileStatus(biImage)
+			if result.State != string(test.state) || result.Progress != test.progress ||
+				result.Condition.Status != test.status || result.Condition.Reason != test.reason {
+				t.Errorf("unexpected progress %+v", result)
+			}
+		})
+	}
+}
@@ -1,21 +1,37 @@
 package controller
 
 import (
+	"context"
 	"fmt"
 	"github.com/go-logr/zapr"
+	"github.com/pkg/errors"
+	"go.uber.org/fx"
 	"go.uber.org/zap"
-	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	kav1 "kubeall.io/api-server/pkg/generated/kubeall.io/v1"
+	lhv1beta2 "kubeall.io/api-server/pkg/generated/longhorn/apis/longhorn/v1beta2"
 	"kubeall.io/api-server/pkg/infra/apiserver"
-	"os"
+	"kubeall.io/api-server/pkg/infra/metrics"
+	"kubeall.io/api-server/pkg/types"
+	kawebhook "kubeall.io/api-server/pkg/webhook"
+	kv1 "kubevirt.io/api/core/v1"
+	"net/http"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"time"
 )
 
+// the duration waiting for the informers synced while checking the readiness
+const informerSyncTimeout = time.Second
+
 type Manager interface {
-	Start()
+	// Start runs the manager in the background until Stop is called
+	Start(ctx context.Context) error
+	// Stop stops the manager and waits until the controllers and the webhook server are stopped
+	Stop(ctx context.Context) error
 	GetManager() manager.Manager
 	ClusterResource() apiserver.ClusterResource
 }
@@ -23,7 +39,13 @@ type Manager interface {
 type managerImpl struct {
 	mgr             manager.Manager
 	clusterResource apiserver.ClusterResource
+	config          *types.ServerConfig
 	logger          *zap.Logger
+	shutdowner      fx.Shutdowner
+
+	// cancel stops the manager, done is closed once it's stopped
+	cancel context.CancelFunc
+	done   chan struct{}
 }
 
 func (m *managerImpl) GetManager() manager.Manager {
@@ -34,75 +56,191 @@ func (m *managerImpl) ClusterResource() apiserver.ClusterResource {
 	return m.clusterResource
 }
 
-func NewManager(reconcilers []ReconcileHandler, clusterResource apiserver.ClusterResource, logger *zap.Logger) Manager {
-	m := &managerImpl{clusterResource: clusterResource, logger: logger}
-	m.Initialize()
-	m.injectManager(reconcilers)
-	return m
+// NewManager sets up the controllers and the webhooks, the manager is started and stopped with the app
+func NewManager(reconcilers []ReconcileHandler, webhooks []kawebhook.Handler, clusterResource apiserver.ClusterResource,
+	config types.Config, logger *zap.Logger, lifecycle fx.Lifecycle, shutdowner fx.Shutdowner) (Manager, error) {
+	m := &managerImpl{clusterResource: clusterResource, config: config.(*types.ServerConfig), logger: logger,
+		shutdowner: shutdowner}
+	if err := m.Initialize(); err != nil {
+		return nil, err
+	}
+	if err := m.injectManager(reconcilers); err != nil {
+		return nil, err
+	}
+	if err := m.injectWebhooks(webhooks); err != nil {
+		return nil, err
+	}
+	if err := m.addHealthChecks(); err != nil {
+		return nil, err
+	}
+	m.registerMetrics()
+	lifecycle.Append(fx.Hook{OnStart: m.Start, OnStop: m.Stop})
+	return m, nil
 }
 
-func (m *managerImpl) Initialize() {
-	certDir := ""
-	port := 8085
-	leaderElect := false
-	LeaseDuration := 30 * time.Second
-	RetryPeriod := 10 * time.Second
-	RenewDeadline := 5 * time.Second
-
-	webhookServer := webhook.NewServer(webhook.Options{
-		CertDir: certDir, //TODO
-		Port:    port,
-	})
+func (m *managerImpl) Initialize() error {
+	// inject to controller-runtime's logger
+	ctrl.SetLogger(zapr.NewLogger(m.logger))
+
+	restConfig := m.clusterResource.RestConfig()
+	mgr, err := manager.New(restConfig, managerOptions(m.config))
+	if err != nil {
+		zap.L().Error("failed to create controller manager", zap.Error(err))
+		return errors.Wrap(err, "failed to create controller manager")
+	}
+	if err = apiserver.AddIndexes(context.Background(), mgr.GetFieldIndexer()); err != nil {
+		return errors.Wrap(err, "failed to add indexes")
+	}
+
+	// update manager as global cluster object
+	m.clusterResource.UpdateCluster(mgr)
+	m.mgr = mgr
+	return nil
+}
+
+// managerOptions maps the config of the controller manager to the options of controller runtime
+func managerOptions(config *types.ServerConfig) ctrl.Options {
+	cmConfig := config.ControllerManager
+	if cmConfig == nil {
+		cmConfig = &types.ControllerManagerConfig{}
+	}
+
 	opts := ctrl.Options{
 		Scheme:                 apiserver.CmScheme,
-		WebhookServer:          webhookServer,
-		HealthProbeBindAddress: fmt.Sprintf(":%d", port),
+		HealthProbeBindAddress: cmConfig.HealthProbeBindAddress,
+		// the reconcile metrics are exposed by controller runtime, with the ones registered by kubeall
 		Metrics: server.Options{
-			BindAddress: "0", // 禁用 metrics 服务器
+			BindAddress: config.MetricsBindAddress(),
 		},
 	}
-
-	if leaderElect {
+	if webhookConfig := cmConfig.Webhook; webhookConfig != nil && webhookConfig.Enabled {
+		opts.WebhookServer = webhook.NewServer(webhook.Options{
+			Host:    webhookConfig.Host,
+			Port:    webhookConfig.Port,
+			CertDir: webhookConfig.CertDir,
+		})
+	}
+	if election := cmConfig.LeaderElection; election != nil && election.Enabled {
 		opts.LeaderElection = true
-		opts.LeaderElectionNamespace = "kubeall-system"
-		opts.LeaderElectionID = "kubeall-leader-election"
-		opts.LeaseDuration = &LeaseDuration
-		opts.RetryPeriod = &RetryPeriod
-		opts.RenewDeadline = &RenewDeadline
+		opts.LeaderElectionNamespace = election.Namespace
+		opts.LeaderElectionID = election.ID
+		// the lease is released while the manager stops, so that the other replicas take over immediately
+		opts.LeaderElectionReleaseOnCancel = true
+		if election.LeaseDuration > 0 {
+			opts.LeaseDuration = &election.LeaseDuration
+		}
+		if election.RenewDeadline > 0 {
+			opts.RenewDeadline = &election.RenewDeadline
+		}
+		if election.RetryPeriod > 0 {
+			opts.RetryPeriod = &election.RetryPeriod
+		}
 	}
+	return opts
+}
 
-	restConfig := m.clusterResource.RestConfig()
-	mgr, err := manager.New(restConfig, opts)
-	if err != nil {
-		zap.L().Error("failed to start controller manager")
-		os.Exit(1)
+// Start runs the manager in the background, the app is shut down if the manager fails. The context of the manager
+// isn't the one of the start hook, which is cancelled once the app is started.
+func (m *managerImpl) Start(context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.done = make(chan struct{})
+	go func() {
+		defer close(m.done)
+		if err := m.mgr.Start(ctx); err != nil {
+			zap.L().Error("failed to run manager", zap.Error(err))
+			_ = m.shutdowner.Shutdown(fx.ExitCode(1))
+		}
+	}()
+	zap.L().Info("controller manager started")
+	return nil
+}
+
+// Stop cancels the manager and waits until it's stopped or the stop hook times out
+func (m *managerImpl) Stop(ctx context.Context) error {
+	if m.cancel == nil {
+		return nil
+	}
+	m.cancel()
+	select {
+	case <-m.done:
+		zap.L().Info("controller manager stopped")
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "failed to stop controller manager")
 	}
+}
 
-	// update manager as global cluster object
-	m.clusterResource.UpdateCluster(mgr)
-	m.mgr = mgr
+// addHealthChecks registers /healthz and /readyz, the manager is ready once the informers are synced
+func (m *managerImpl) addHealthChecks() error {
+	if err := m.mgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
+		return errors.Wrap(err, "failed to add health check")
+	}
+	if err := m.mgr.AddReadyzCheck("ping", healthz.Ping); err != nil {
+		return errors.Wrap(err, "failed to add ready check")
+	}
+	if err := m.mgr.AddReadyzCheck("informers", m.informersSynced); err != nil {
+		return errors.Wrap(err, "failed to add ready check")
+	}
+	if m.webhookEnabled() {
+		if err := m.mgr.AddReadyzCheck("webhook", m.mgr.GetWebhookServer().StartedChecker()); err != nil {
+			return errors.Wrap(err, "failed to add ready check")
+		}
+	}
+	return nil
+}
 
-	logger := zapr.NewLogger(m.logger)
+// informersSynced fails until the caches of the informers are synced
+func (m *managerImpl) informersSynced(req *http.Request) error {
+	ctx, cancel := context.WithTimeout(req.Context(), informerSyncTimeout)
+	defer cancel()
+	if !m.mgr.GetCache().WaitForCacheSync(ctx) {
+		return fmt.Errorf("the informers are not synced")
+	}
+	return nil
+}
 
-	// inject to controller-runtime's logger
-	ctrl.SetLogger(logger)
+// registerMetrics reports the size of the informers watched by the controllers
+func (m *managerImpl) registerMetrics() {
+	err := metrics.RegisterCacheCollector(m.mgr.GetCache, map[string]func() client.ObjectList{
+		"images":          func() client.ObjectList { return &kav1.ImageList{} },
+		"virtualmachines": func() client.ObjectList { return &kv1.VirtualMachineList{} },
+		"backingimages":   func() client.ObjectList { return &lhv1beta2.BackingImageList{} },
+	})
+	if err != nil {
+		zap.L().Warn("failed to register metrics of informer cache", zap.Error(err))
+	}
 }
 
-func (m *managerImpl) Start() {
-	zap.L().Info("controller manager started")
-	if err := m.mgr.Start(ctrl.SetupSignalHandler()); err != nil {
-		zap.L().Error("failed to run manager", zap.Error(err))
-		os.Exit(1)
+func (m *managerImpl) webhookEnabled() bool {
+	cmConfig := m.config.ControllerManager
+	return cmConfig != nil && cmConfig.Webhook != nil && cmConfig.Webhook.Enabled
+}
+
+// injectWebhooks registers the admission webhooks, the webhook server isn't started if they're disabled
+func (m *managerImpl) injectWebhooks(webhooks []kawebhook.Handler) error {
+	if !m.webhookEnabled() {
+		zap.L().Info("webhooks are disabled")
+		return nil
+	}
+	for _, h := range webhooks {
+		if err := h.SetupWebhookWithManager(m.mgr); err != nil {
+			zap.L().Error("failed to setup webhook", zap.Error(err))
+			return errors.Wrap(err, "failed to set up webhook")
+		}
 	}
+	zap.L().Info("webhooks are set up")
+	return nil
 }
 
-func (m *managerImpl) injectManager(reconcilers []ReconcileHandler) {
+func (m *managerImpl) injectManager(reconcilers []ReconcileHandler) error {
 	for _, h := range reconcilers {
 		err := h.SetupWithManager(m.mgr)
 		if err != nil {
 			zap.L().Error("failed to setup manager", zap.Error(err))
-			utilruntime.Must(err)
+			return errors.Wrap(err, "failed to set up controller")
 		}
 	}
 	zap.L().Info("controllers are set up")
+	return nil
 }
@@ -0,0 +1,175 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+	"net/http/httptest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"testing"
+	"time"
+)
+
+func TestManagerOptions(t *testing.T) {
+	lease, renew, retry := 30*time.Second, 20*time.Second, 5*time.Second
+	tests := map[string]struct {
+		config         *types.ServerConfig
+		metrics        string
+		probe          string
+		leaderElection bool
+		webhook        *webhook.Options
+	}{
+		"defaults": {
+			config:  &types.ServerConfig{},
+			metrics: "0",
+		},
+		"configured": {
+			config: &types.ServerConfig{
+				Metrics: &types.MetricsConfig{BindAddress: ":9090"},
+				ControllerManager: &types.ControllerManagerConfig{
+					HealthProbeBindAddress: ":8081",
+					LeaderElection: &types.LeaderElectionConfig{Enabled: true, Namespace: "kubeall", ID: "cm",
+						LeaseDuration: lease, RenewDeadline: renew, RetryPeriod: retry},
+					Webhook: &types.WebhookConfig{Enabled: true, Host: "0.0.0.0", Port: 9443, CertDir: "/certs"},
+				},
+			},
+			metrics:        ":9090",
+			probe:          ":8081",
+			leaderElection: true,
+			webhook:        &webhook.Options{Host: "0.0.0.0", Port: 9443, CertDir: "/certs"},
+		},
+		"disabled": {
+			config: &types.ServerConfig{ControllerManager: &types.ControllerManagerConfig{
+				LeaderElection: &types.LeaderElectionConfig{Namespace: "kubeall", ID: "cm"},
+				Webhook:        &types.WebhookConfig{Port: 9443},
+			}},
+			metrics: "0",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			opts := managerOptions(test.config)
+			if opts.Metrics.BindAddress != test.metrics || opts.HealthProbeBindAddress != test.probe {
+				t.Errorf("unexpected bind addresses %s %s", opts.Metrics.BindAddress, opts.HealthProbeBindAddress)
+			}
+			if opts.LeaderElection != test.leaderElection {
+				t.Errorf("expected the leader election %t, got %t", test.leaderElection, opts.LeaderElection)
+			}
+			if test.leaderElection && (opts.LeaderElectionNamespace != "kubeall" || opts.LeaderElectionID != "cm" ||
+				!opts.LeaderElectionReleaseOnCancel || *opts.LeaseDuration != lease || *opts.RenewDeadline != renew ||
+				*opts.RetryPeriod != retry) {
+				t.Errorf("unexpected leader election %+v", opts)
+			}
+			if !test.leaderElection && (opts.LeaseDuration != nil || opts.RenewDeadline != nil || opts.RetryPeriod != nil) {
+				t.Errorf("expected the default leases, got %+v", opts)
+			}
+
+			server, ok := opts.WebhookServer.(*webhook.DefaultServer)
+			if (test.webhook != nil) != ok {
+				t.Fatalf("expected the webhook server %v, got %v", test.webhook, opts.WebhookServer)
+			}
+			if ok && (server.Options.Host != test.webhook.Host || server.Options.Port != test.webhook.Port ||
+				server.Options.CertDir != test.webhook.CertDir) {
+				t.Errorf("unexpected webhook server %+v", server.Options)
+			}
+		})
+	}
+}
+
+// fakeCache is synced once synced is closed
+type fakeCache struct {
+	cache.Cache
+	synced chan struct{}
+}
+
+func (f fakeCache) WaitForCacheSync(ctx context.Context) bool {
+	select {
+	case <-f.synced:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// fakeManager runs until it's cancelled or failed
+type fakeManager struct {
+	manager.Manager
+	cache   fakeCache
+	err     error
+	started chan struct{}
+}
+
+func (f *fakeManager) GetCache() cache.Cache {
+	return f.cache
+}
+
+func (f *fakeManager) Start(ctx context.Context) error {
+	close(f.started)
+	if f.err != nil {
+		return f.err
+	}
+	<-ctx.Done()
+	return nil
+}
+
+type fakeShutdowner struct {
+	shutdown chan struct{}
+}
+
+func (f fakeShutdowner) Shutdown(...fx.ShutdownOption) error {
+	close(f.shutdown)
+	return nil
+}
+
+func TestInformersSynced(t *testing.T) {
+	mgr := &fakeManager{cache: fakeCache{synced: make(chan struct{})}}
+	m := &managerImpl{mgr: mgr}
+
+	start := time.Now()
+	if err := m.informersSynced(httptest.NewRequest(http.MethodGet, "/readyz/informers", nil)); err == nil {
+		t.Error("expected not ready until the informers are synced")
+	}
+	if elapsed := time.Since(start); elapsed > 2*informerSyncTimeout {
+		t.Errorf("expected the check to wait at most %s, it took %s", informerSyncTimeout, elapsed)
+	}
+
+	close(mgr.cache.synced)
+	if err := m.informersSynced(httptest.NewRequest(http.MethodGet, "/readyz/informers", nil)); err != nil {
+		t.Errorf("expected ready once the informers are synced, got %v", err)
+	}
+}
+
+func TestManagerLifecycle(t *testing.T) {
+	for name, err := range map[string]error{"stopped": nil, "failed": errors.New("failed to elect leader")} {
+		t.Run(name, func(t *testing.T) {
+			mgr := &fakeManager{err: err, started: make(chan struct{})}
+			shutdowner := fakeShutdowner{shutdown: make(chan struct{})}
+			m := &managerImpl{mgr: mgr, logger: zap.NewNop(), shutdowner: shutdowner}
+			lifecycle := fxtest.NewLifecycle(t)
+			lifecycle.Append(fx.Hook{OnStart: m.Start, OnStop: m.Stop})
+
+			// the start hook returns while the manager is running
+			lifecycle.RequireStart()
+			<-mgr.started
+			if err != nil {
+				select {
+				case <-shutdowner.shutdown:
+				case <-time.After(time.Second):
+					t.Error("expected the app shut down while the manager fails")
+				}
+			}
+			lifecycle.RequireStop()
+			select {
+			case <-m.done:
+			default:
+				t.Error("expected the manager stopped with the app")
+			}
+		})
+	}
+}
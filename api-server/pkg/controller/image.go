@@ -4,9 +4,12 @@ import (
 	"context"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kav1 "kubeall.io/api-server/pkg/generated/kubeall.io/v1"
 	"kubeall.io/api-server/pkg/infra/apiserver"
 	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/logger"
 	"kubeall.io/api-server/pkg/service"
 	"reflect"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -14,10 +17,14 @@ import (
 	contrl "sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"time"
 )
 
 const imageControllerName = "image"
 
+// the period checking whether the image being deleted is still in use
+const imageUsageRecheckPeriod = 30 * time.Second
+
 // ImageReconciler reconciles a Image object
 type ImageReconciler struct {
 	ReconcileHook[*kav1.Image]
@@ -25,7 +32,7 @@ type ImageReconciler struct {
 	manager         Manager
 	clusterResource apiserver.ClusterResource
 	imageService    service.ImageService
-	reconciler      Reconciler
+	reconciler      *DefaultReconciler[*kav1.Image]
 }
 
 func NewImageReconciler(clusterResource apiserver.ClusterResource, imageService service.ImageService) ReconcileHandler {
@@ -35,7 +42,7 @@ func NewImageReconciler(clusterResource apiserver.ClusterResource, imageService
 // SetupWithManager sets up the controller with the Manager.
 func (r *ImageReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.Client = mgr.GetClient()
-	r.reconciler = DefaultReconciler[*kav1.Image]{hook: r, Client: mgr.GetClient()}
+	r.reconciler = NewDefaultReconciler[*kav1.Image](mgr, imageControllerName, r)
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&kav1.Image{}).
 		Named(imageControllerName).
@@ -49,7 +56,7 @@ func (r *ImageReconciler) SetupWithManager(mgr ctrl.Manager) error {
 
 				//if status not changed that means the image needs to update
 				if statusNotChanged {
-					zap.L().Info("image will be reconciled", zap.String("old", oldImage.Name))
+					logger.Named(logger.ControllerLogger).Info("image will be reconciled", zap.String("old", oldImage.Name))
 				}
 				return statusNotChanged
 			},
@@ -85,22 +92,86 @@ func (r *ImageReconciler) Finalizer() string {
 	return constants.DefaultFinalizer
 }
 
+// OnRemove deletes the backing image and the storage class once the image isn't used by any pvc, unless it's
+// forced to delete
 func (r *ImageReconciler) OnRemove(ctx context.Context, req ctrl.Request, obj *kav1.Image) (ctrl.Result, error) {
+	if !service.IsForceDeleted(obj) {
+		usage, err := r.imageService.ComputeUsage(ctx, obj)
+		if err != nil {
+			return ctrl.Result{}, errors.Wrap(err, "failed to compute usage of image "+obj.Name)
+		}
+		if usage.InUse {
+			_, _, err = r.reconciler.SetConditions(ctx, obj, metav1.Condition{
+				Type:    kav1.ImageConditionDeletionBlocked,
+				Status:  metav1.ConditionTrue,
+				Reason:  kav1.ImageReasonInUse,
+				Message: "the image is used by " + service.DescribeConsumers(usage.Consumers),
+			})
+			if err != nil {
+				return ctrl.Result{}, errors.Wrap(err, "failed to update status for image "+obj.Name)
+			}
+			logger.FromContext(ctx).Info("the deletion of image is blocked", zap.String("name", obj.Name),
+				zap.Int("consumers", len(usage.Consumers)))
+			// the consumers' deletion doesn't trigger the reconciler, check it periodically
+			return ctrl.Result{RequeueAfter: imageUsageRecheckPeriod}, nil
+		}
+	}
+
 	if err := r.imageService.DeleteImageResources(ctx, obj); err != nil {
 		return ctrl.Result{}, errors.Wrap(err, "failed clear related resources for image"+obj.Name)
 	}
-	zap.L().Info("image is removed", zap.String("name", obj.Name))
+	logger.FromContext(ctx).Info("image is removed", zap.String("name", obj.Name))
 	return ctrl.Result{}, nil
 }
 
+// OnChange ensures the backing image and the storage class of the image exist, and reports the result
+// as the image's conditions
 func (r *ImageReconciler) OnChange(ctx context.Context, obj *kav1.Image) error {
-	if err := r.imageService.EnsureImageResources(ctx, obj); err != nil {
-		return errors.Wrap(err, "failed to ensure related resource created for image "+obj.Name)
+	biImage, err := r.imageService.EnsureBackingImage(ctx, obj)
+	conditions := []metav1.Condition{
+		newImageCondition(kav1.ImageConditionBackingImageReady, err, kav1.ImageReasonCreated,
+			"the backing image is created"),
+	}
+	if err != nil {
+		err = errors.Wrap(err, "failed to ensure backing image created for image "+obj.Name)
+	} else {
+		err = r.imageService.EnsureStorageClass(ctx, obj, biImage)
+		conditions = append(conditions, newImageCondition(kav1.ImageConditionStorageClassReady, err,
+			kav1.ImageReasonCreated, "the storage class is created"))
+		if err != nil {
+			err = errors.Wrap(err, "failed to ensure storage class created for image "+obj.Name)
+		}
+	}
+
+	_, _, statusErr := r.reconciler.UpdateStatus(ctx, obj, func(image *kav1.Image) {
+		// the content is reported by the backing image controller later
+		if meta.FindStatusCondition(image.Status.Conditions, kav1.ImageConditionUploaded) == nil {
+			meta.SetStatusCondition(&image.Status.Conditions, metav1.Condition{
+				Type:               kav1.ImageConditionUploaded,
+				Status:             metav1.ConditionFalse,
+				Reason:             kav1.ImageReasonPending,
+				Message:            "waiting for the content of the image",
+				ObservedGeneration: image.Generation,
+			})
+		}
+		setImageConditions(image, conditions...)
+		image.Status.ObservedGeneration = image.Generation
+	})
+
+	if err != nil {
+		return err
+	}
+	if statusErr != nil {
+		return errors.Wrap(statusErr, "failed to update status for image "+obj.Name)
 	}
-	zap.L().Info("image is reconciled", zap.String("name", obj.Name))
+	logger.FromContext(ctx).Info("image is reconciled", zap.String("name", obj.Name))
 	return nil
 }
 
+func (r *ImageReconciler) GetConditions(obj *kav1.Image) *[]metav1.Condition {
+	return imageConditions(obj)
+}
+
 func (r *ImageReconciler) DeepCopy(obj *kav1.Image) *kav1.Image {
 	return obj.DeepCopy()
 }
@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kav1 "kubeall.io/api-server/pkg/generated/kubeall.io/v1"
+)
+
+// the conditions that must be true before the image is ready
+var imageReadyDependencies = []string{
+	kav1.ImageConditionBackingImageReady,
+	kav1.ImageConditionStorageClassReady,
+	kav1.ImageConditionUploaded,
+}
+
+// imageConditions returns the conditions of the image for the status writer
+func imageConditions(image *kav1.Image) *[]metav1.Condition {
+	return &image.Status.Conditions
+}
+
+// setImageConditions sets the conditions on the image and recomputes the Ready condition
+func setImageConditions(image *kav1.Image, conditions ...metav1.Condition) {
+	for _, cond := range conditions {
+		cond.ObservedGeneration = image.Generation
+		meta.SetStatusCondition(&image.Status.Conditions, cond)
+	}
+	setImageReadyCondition(image)
+}
+
+// setImageReadyCondition sets Ready to true while all its dependencies are true, otherwise it reflects
+// the first dependency that isn't true
+func setImageReadyCondition(image *kav1.Image) {
+	ready := metav1.Condition{
+		Type:    kav1.ImageConditionReady,
+		Status:  metav1.ConditionTrue,
+		Reason:  kav1.ImageReasonCompleted,
+		Message: "the image is ready to use",
+	}
+	for _, condType := range imageReadyDependencies {
+		cond := meta.FindStatusCondition(image.Status.Conditions, condType)
+		if cond == nil {
+			ready.Status = metav1.ConditionFalse
+			ready.Reason = kav1.ImageReasonPending
+			ready.Message = condType + " is not reported yet"
+			break
+		}
+		if cond.Status != metav1.ConditionTrue {
+			ready.Status = metav1.ConditionFalse
+			ready.Reason = cond.Reason
+			ready.Message = cond.Message
+			break
+		}
+	}
+	ready.ObservedGeneration = image.Generation
+	meta.SetStatusCondition(&image.Status.Conditions, ready)
+}
+
+func newImageCondition(condType string, err error, reason, message string) metav1.Condition {
+	if err != nil {
+		return metav1.Condition{
+			Type:    condType,
+			Status:  metav1.ConditionFalse,
+			Reason:  kav1.ImageReasonCreateFailed,
+			Message: err.Error(),
+		}
+	}
+	return metav1.Condition{
+		Type:    condType,
+		Status:  metav1.ConditionTrue,
+		Reason:  reason,
+		Message: message,
+	}
+}
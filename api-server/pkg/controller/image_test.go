@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"context"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	kav1 "kubeall.io/api-server/pkg/generated/kubeall.io/v1"
+	"kubeall.io/api-server/pkg/infra/apiserver"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/service"
+	"kubeall.io/api-server/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sync"
+	"testing"
+)
+
+// fakeImageService reports the consumers of the images and records the images whose resources are deleted
+type fakeImageService struct {
+	service.ImageService
+	consumers []types.ImageConsumer
+	deleted   []string
+}
+
+func (f *fakeImageService) ComputeUsage(_ context.Context, image *kav1.Image) (*types.ImageUsage, error) {
+	return &types.ImageUsage{Namespace: image.Namespace, Name: image.Name, InUse: len(f.consumers) > 0,
+		Consumers: f.consumers}, nil
+}
+
+func (f *fakeImageService) DeleteImageResources(_ context.Context, image *kav1.Image) error {
+	f.deleted = append(f.deleted, image.Name)
+	return nil
+}
+
+func TestImageOnRemove(t *testing.T) {
+	consumers := []types.ImageConsumer{{Namespace: "ns1", PvcName: "disk1", VmName: "vm1"}}
+	tests := map[string]struct {
+		consumers []types.ImageConsumer
+		force     bool
+		blocked   bool
+	}{
+		"in use":     {consumers: consumers, blocked: true},
+		"not in use": {},
+		"forced":     {consumers: consumers, force: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			image := &kav1.Image{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "win10"}}
+			if test.force {
+				image.Annotations = map[string]string{constants.AnnotationForceDelete: "true"}
+			}
+			c := fake.NewClientBuilder().WithScheme(apiserver.ServerScheme).WithObjects(image).
+				WithStatusSubresource(image).Build()
+			imageService := &fakeImageService{consumers: test.consumers}
+			r := &ImageReconciler{Client: c, imageService: imageService}
+			r.reconciler = &DefaultReconciler[*kav1.Image]{Client: c, hook: r, failures: &sync.Map{},
+				status: NewStatusWriter(c, record.NewFakeRecorder(10), (*kav1.Image).DeepCopy, imageConditions)}
+
+			result, err := r.OnRemove(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(image)},
+				image)
+			if err != nil {
+				t.Fatal(err)
+			}
+			latest := &kav1.Image{}
+			if err = c.Get(context.Background(), client.ObjectKeyFromObject(image), latest); err != nil {
+				t.Fatal(err)
+			}
+			blocked := meta.FindStatusCondition(latest.Status.Conditions, kav1.ImageConditionDeletionBlocked)
+			if !test.blocked {
+				if result != (ctrl.Result{}) || len(imageService.deleted) != 1 || blocked != nil {
+					t.Errorf("expected the resources deleted, got %+v %v %v", result, imageService.deleted, blocked)
+				}
+				return
+			}
+			// the deletion is checked again later since the consumers' deletion doesn't trigger the reconciler
+			if result.RequeueAfter != imageUsageRecheckPeriod || len(imageService.deleted) != 0 {
+				t.Errorf("expected the deletion requeued after %s, got %+v %v", imageUsageRecheckPeriod, result,
+					imageService.deleted)
+			}
+			if blocked == nil || blocked.Status != metav1.ConditionTrue || blocked.Reason != kav1.ImageReasonInUse ||
+				blocked.Message != "the image is used by ns1/disk1(vm vm1)" {
+				t.Errorf("expected the deletion blocked, got %+v", blocked)
+			}
+		})
+	}
+}
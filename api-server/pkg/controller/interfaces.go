@@ -2,6 +2,7 @@ package controller
 
 import (
 	"context"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -12,6 +13,8 @@ type ReconcileHandler interface {
 	SetupWithManager(mgr ctrl.Manager) error
 }
 
+// ReconcileHook is implemented by the reconcilers built on DefaultReconciler. OnChange and OnRemove can return
+// RequeueAfter or TerminalError to control how the resource is requeued.
 type ReconcileHook[T client.Object] interface {
 	GetResource(ctx context.Context, req ctrl.Request) (T, error)
 	GetClient() client.Client
@@ -21,3 +24,9 @@ type ReconcileHook[T client.Object] interface {
 	OnChange(ctx context.Context, obj T) error
 	DeepCopy(T) T
 }
+
+// ConditionsHook is optionally implemented by the hooks whose resources report conditions in their status,
+// the conditions can be set through DefaultReconciler.SetConditions then.
+type ConditionsHook[T client.Object] interface {
+	GetConditions(obj T) *[]metav1.Condition
+}
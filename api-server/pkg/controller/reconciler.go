@@ -4,10 +4,19 @@ import (
 	"context"
 	"fmt"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/logger"
+	"kubeall.io/api-server/pkg/infra/tracing"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	contrl "sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sync"
 )
 
 type Reconciler interface {
@@ -16,12 +25,53 @@ type Reconciler interface {
 
 type DefaultReconciler[T client.Object] struct {
 	client.Client
-	hook ReconcileHook[T]
+	hook     ReconcileHook[T]
+	recorder record.EventRecorder
+	status   StatusWriter[T]
+	// the last failure recorded for each resource, it's kept until the resource is reconciled
+	failures *sync.Map
 }
 
-func (d DefaultReconciler[T]) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+// NewDefaultReconciler creates a reconciler for the hook, events are recorded under the controller's name.
+// The conditions are maintained by the status writer if the hook implements ConditionsHook.
+func NewDefaultReconciler[T client.Object](mgr ctrl.Manager, name string, hook ReconcileHook[T]) *DefaultReconciler[T] {
+	var conditions func(T) *[]metav1.Condition
+	if conditionsHook, ok := hook.(ConditionsHook[T]); ok {
+		conditions = conditionsHook.GetConditions
+	}
+	recorder := mgr.GetEventRecorderFor(name)
+	return &DefaultReconciler[T]{
+		Client:   mgr.GetClient(),
+		hook:     hook,
+		recorder: recorder,
+		status:   NewStatusWriter(mgr.GetClient(), recorder, hook.DeepCopy, conditions),
+		failures: &sync.Map{},
+	}
+}
+
+// Reconcile reconciles the resource in a span, so that the calls of the hooks are traced as its children, and the
+// logger carrying the resource and the reconcile id is stored in the context for the hooks
+func (d DefaultReconciler[T]) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, err error) {
+	resourceType := fmt.Sprintf("%T", *new(T))
+	ctx, span := tracing.Start(ctx, "DefaultReconciler.Reconcile", attribute.String("type", resourceType),
+		attribute.String("namespace", req.Namespace), attribute.String("name", req.Name))
+	defer func() { tracing.End(span, err) }()
+
+	fields := []zap.Field{zap.String("type", resourceType), zap.String("namespace", req.Namespace),
+		zap.String("name", req.Name), zap.String("reconcileId", string(contrl.ReconcileIDFromContext(ctx)))}
+	if span.SpanContext().HasTraceID() {
+		fields = append(fields, zap.String("traceId", span.SpanContext().TraceID().String()))
+	}
+	ctx = logger.NewContext(ctx, logger.Named(logger.ControllerLogger).With(fields...))
+	return d.reconcile(ctx, req)
+}
+
+func (d DefaultReconciler[T]) reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	resource, err := d.hook.GetResource(ctx, req)
 	if err != nil {
+		if client.IgnoreNotFound(err) == nil {
+			d.failures.Delete(req.NamespacedName)
+		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
@@ -39,12 +89,56 @@ func (d DefaultReconciler[T]) Reconcile(ctx context.Context, req ctrl.Request) (
 		if err = d.hook.OnChange(ctx, resource); err != nil {
 			msg := fmt.Sprintf("failed to ensure related resource created for %s %s ",
 				resource.GetObjectKind(), resource.GetNamespace())
-			return ctrl.Result{}, errors.Wrap(err, msg)
+			return d.handleError(ctx, resource, err, msg)
 		}
+		d.failures.Delete(req.NamespacedName)
 	}
 	return ctrl.Result{}, nil
 }
 
+// UpdateStatus applies the mutation to the latest version of the resource and patches its status
+func (d DefaultReconciler[T]) UpdateStatus(ctx context.Context, obj T, mutate func(T)) (T, []metav1.Condition, error) {
+	return d.status.UpdateStatus(ctx, obj, mutate)
+}
+
+// SetConditions sets the conditions of the resource, an event is recorded for every transition
+func (d DefaultReconciler[T]) SetConditions(ctx context.Context, obj T, conditions ...metav1.Condition) (T, []metav1.Condition, error) {
+	return d.status.SetConditions(ctx, obj, conditions...)
+}
+
+// Event records an event for the resource
+func (d DefaultReconciler[T]) Event(obj T, eventType, reason, message string) {
+	d.recorder.Event(obj, eventType, reason, message)
+}
+
+// handleError converts the error returned by hooks into the result, the failures are recorded as events
+func (d DefaultReconciler[T]) handleError(ctx context.Context, resource T, err error, msg string) (ctrl.Result, error) {
+	var requeueErr *RequeueAfterError
+	if errors.As(err, &requeueErr) {
+		if requeueErr.Err != nil {
+			d.recordFailure(resource, requeueErr.Err)
+		}
+		logger.FromContext(ctx).Info("resource will be reconciled later", zap.String("name", resource.GetName()),
+			zap.String("namespace", resource.GetNamespace()), zap.Duration("after", requeueErr.After),
+			zap.Error(requeueErr.Err))
+		// the duration of requeue is ignored by controller runtime while an error is returned
+		return ctrl.Result{RequeueAfter: requeueErr.After}, nil
+	}
+
+	// terminal errors are still terminal after wrapping
+	d.recordFailure(resource, err)
+	return ctrl.Result{}, errors.Wrap(err, msg)
+}
+
+// recordFailure records the failure as an event unless it's the last failure recorded for the resource, so that
+// a resource failing persistently doesn't emit an event every time it's requeued
+func (d DefaultReconciler[T]) recordFailure(resource T, err error) {
+	if last, ok := d.failures.Swap(client.ObjectKeyFromObject(resource), err.Error()); ok && last == err.Error() {
+		return
+	}
+	d.recorder.Event(resource, corev1.EventTypeWarning, ReasonReconcileFailed, err.Error())
+}
+
 func (d DefaultReconciler[T]) addFinalizer(ctx context.Context, resource T) (ctrl.Result, error) {
 	newResource := d.hook.DeepCopy(resource)
 	controllerutil.AddFinalizer(newResource, constants.DefaultFinalizer)
@@ -60,7 +154,11 @@ func (d DefaultReconciler[T]) deleteResource(ctx context.Context, req ctrl.Reque
 	if controllerutil.ContainsFinalizer(resource, constants.DefaultFinalizer) {
 		// firstly, remove finalizer
 		if result, err := d.hook.OnRemove(ctx, req, resource); err != nil {
-			return result, err
+			msg := fmt.Sprintf("failed to remove related resources for %s %s ",
+				resource.GetObjectKind(), resource.GetNamespace())
+			return d.handleError(ctx, resource, err, msg)
+		} else if !result.IsZero() {
+			return result, nil
 		}
 
 		// remove finalizer
@@ -71,6 +169,7 @@ func (d DefaultReconciler[T]) deleteResource(ctx context.Context, req ctrl.Reque
 				newResource.GetObjectKind(), newResource.GetNamespace())
 			return ctrl.Result{}, errors.Wrap(err, msg)
 		}
+		d.failures.Delete(req.NamespacedName)
 	}
 	return ctrl.Result{}, nil
 }
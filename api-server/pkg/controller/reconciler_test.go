@@ -0,0 +1,170 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	kav1 "kubeall.io/api-server/pkg/generated/kubeall.io/v1"
+	"kubeall.io/api-server/pkg/infra/apiserver"
+	"kubeall.io/api-server/pkg/infra/constants"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeImageHook fails to reconcile the images with the errors in turn
+type fakeImageHook struct {
+	ReconcileHook[*kav1.Image]
+	client client.Client
+	errs   []error
+}
+
+func (f *fakeImageHook) GetResource(ctx context.Context, req ctrl.Request) (*kav1.Image, error) {
+	image := &kav1.Image{}
+	return image, f.client.Get(ctx, req.NamespacedName, image)
+}
+
+func (f *fakeImageHook) OnChange(context.Context, *kav1.Image) error {
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+	return err
+}
+
+func (f *fakeImageHook) DeepCopy(obj *kav1.Image) *kav1.Image {
+	return obj.DeepCopy()
+}
+
+// events drains the events recorded by the fake recorder
+func events(recorder *record.FakeRecorder) []string {
+	var recorded []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			recorded = append(recorded, event)
+		default:
+			return recorded
+		}
+	}
+}
+
+func TestReconcileFailures(t *testing.T) {
+	image := &kav1.Image{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "win10",
+		Finalizers: []string{constants.DefaultFinalizer}}}
+	c := fake.NewClientBuilder().WithScheme(apiserver.ServerScheme).WithObjects(image).Build()
+	failed, other := errors.New("backing image unavailable"), errors.New("storage class unavailable")
+	hook := &fakeImageHook{client: c}
+	recorder := record.NewFakeRecorder(10)
+	reconciler := DefaultReconciler[*kav1.Image]{Client: c, hook: hook, recorder: recorder, failures: &sync.Map{}}
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(image)}
+
+	tests := []struct {
+		name       string
+		err        error
+		result     ctrl.Result
+		failed     bool
+		terminal   bool
+		reportedBy string
+	}{
+		{name: "failed", err: failed, failed: true, reportedBy: failed.Error()},
+		{name: "failed again", err: failed, failed: true},
+		{name: "requeued with the same failure", err: RequeueAfter(time.Minute, failed),
+			result: ctrl.Result{RequeueAfter: time.Minute}},
+		{name: "another failure", err: TerminalError(other), failed: true, terminal: true,
+			reportedBy: TerminalError(other).Error()},
+		{name: "requeued without failure", err: RequeueAfter(time.Minute, nil),
+			result: ctrl.Result{RequeueAfter: time.Minute}},
+		{name: "reconciled"},
+		{name: "failed after reconciled", err: failed, failed: true, reportedBy: failed.Error()},
+	}
+	for _, test := range tests {
+		hook.errs = append(hook.errs, test.err)
+		result, err := reconciler.Reconcile(context.Background(), req)
+		if result != test.result || (err != nil) != test.failed ||
+			errors.Is(err, reconcile.TerminalError(nil)) != test.terminal {
+			t.Errorf("%s: unexpected result %+v %v", test.name, result, err)
+		}
+
+		var expected []string
+		if test.reportedBy != "" {
+			expected = []string{fmt.Sprintf("%s %s %s", corev1.EventTypeWarning, ReasonReconcileFailed, test.reportedBy)}
+		}
+		if recorded := events(recorder); fmt.Sprint(recorded) != fmt.Sprint(expected) {
+			t.Errorf("%s: expected the events %v, got %v", test.name, expected, recorded)
+		}
+	}
+}
+
+func TestUpdateStatus(t *testing.T) {
+	image := &kav1.Image{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "win10"}}
+	conflicts := 1
+	var patches int
+	c := fake.NewClientBuilder().WithScheme(apiserver.ServerScheme).WithObjects(image).
+		WithStatusSubresource(image).WithInterceptorFuncs(interceptor.Funcs{
+		SubResourcePatch: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object,
+			patch client.Patch, opts ...client.SubResourcePatchOption) error {
+			patches++
+			// another writer updates the image between the get and the patch
+			if conflicts > 0 {
+				conflicts--
+				return k8serrors.NewConflict(schema.GroupResource{Group: kav1.GroupVersion.Group, Resource: "images"},
+					obj.GetName(), errors.New("the object has been modified"))
+			}
+			return c.SubResource(subResourceName).Patch(ctx, obj, patch, opts...)
+		},
+	}).Build()
+	recorder := record.NewFakeRecorder(10)
+	writer := NewStatusWriter(c, recorder, (*kav1.Image).DeepCopy, imageConditions)
+
+	// the image is read again while retrying, the stale copy passed in doesn't matter
+	stale := image.DeepCopy()
+	stale.ResourceVersion = "0"
+	ready := metav1.Condition{Type: kav1.ImageConditionUploaded, Status: metav1.ConditionTrue,
+		Reason: kav1.ImageReasonCompleted, Message: "uploaded"}
+	updated, transitions, err := writer.SetConditions(context.Background(), stale, ready)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if patches != 2 || len(transitions) != 1 || transitions[0].Type != ready.Type {
+		t.Errorf("expected the conflict retried and the condition transitioned, got %d patches %v", patches, transitions)
+	}
+	latest := &kav1.Image{}
+	if err = c.Get(context.Background(), client.ObjectKeyFromObject(image), latest); err != nil {
+		t.Fatal(err)
+	}
+	if cond := latest.Status.Conditions; len(cond) != 1 || cond[0].Status != metav1.ConditionTrue ||
+		updated.Status.Conditions[0].Reason != kav1.ImageReasonCompleted {
+		t.Errorf("unexpected conditions %v", cond)
+	}
+	expected := fmt.Sprintf("%s %s %s is %s: %s", corev1.EventTypeNormal, ready.Reason, ready.Type, ready.Status,
+		ready.Message)
+	if recorded := events(recorder); len(recorded) != 1 || recorded[0] != expected {
+		t.Errorf("expected the event %s, got %v", expected, recorded)
+	}
+
+	// nothing is patched or recorded if the status isn't changed
+	if _, transitions, err = writer.SetConditions(context.Background(), latest, ready); err != nil {
+		t.Fatal(err)
+	}
+	if patches != 2 || len(transitions) != 0 || len(events(recorder)) != 0 {
+		t.Errorf("expected the status left alone, got %d patches %v", patches, transitions)
+	}
+
+	// the conflicts are retried a limited number of times
+	conflicts = 100
+	_, _, err = writer.UpdateStatus(context.Background(), latest, func(image *kav1.Image) {
+		image.Status.Conditions = nil
+	})
+	if !k8serrors.IsConflict(err) {
+		t.Errorf("expected the conflict returned, got %v", err)
+	}
+}
@@ -2,7 +2,6 @@ package controller
 
 import (
 	"go.uber.org/fx"
-	"go.uber.org/zap"
 )
 
 func AsReconciler(f any) any {
@@ -22,11 +21,9 @@ var CtrlModule = fx.Module("controllers",
 		//receive group resources
 		fx.Annotate(
 			NewManager,
-			fx.ParamTags(`group:"reconcilers"`),
+			fx.ParamTags(`group:"reconcilers"`, `group:"webhooks"`),
 		),
 	),
-	// Invoke the provided function after the module is fully initialized to register routes
-	fx.Invoke(func(mgr Manager, logger *zap.Logger) {
-		mgr.Start()
-	}),
+	// the manager is started and stopped by its lifecycle hooks once it's created
+	fx.Invoke(func(Manager) {}),
 )
@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"fmt"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"time"
+)
+
+const (
+	// ReasonReconcileFailed is the reason of the event recorded while a hook fails to reconcile the resource
+	ReasonReconcileFailed = "ReconcileFailed"
+	// ReasonFailedSuffix is the suffix of the conditions' reasons which indicate failures
+	ReasonFailedSuffix = "Failed"
+)
+
+// RequeueAfterError asks the reconciler to reconcile the resource again after a while instead of the
+// exponential backoff. Err is optional, it's reported as a failure if present.
+type RequeueAfterError struct {
+	After time.Duration
+	Err   error
+}
+
+func (r *RequeueAfterError) Error() string {
+	if r.Err == nil {
+		return fmt.Sprintf("requeue after %s", r.After)
+	}
+	return fmt.Sprintf("requeue after %s: %s", r.After, r.Err.Error())
+}
+
+func (r *RequeueAfterError) Unwrap() error {
+	return r.Err
+}
+
+// RequeueAfter returns an error reconciling the resource again after the duration
+func RequeueAfter(after time.Duration, err error) error {
+	return &RequeueAfterError{After: after, Err: err}
+}
+
+// TerminalError marks the error as unrecoverable, the resource isn't requeued until it's changed again
+func TerminalError(err error) error {
+	return reconcile.TerminalError(err)
+}
@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
+)
+
+// StatusWriter patches the status of resources and records an event for every transition of their conditions
+type StatusWriter[T client.Object] struct {
+	client     client.Client
+	recorder   record.EventRecorder
+	deepCopy   func(T) T
+	conditions func(T) *[]metav1.Condition
+}
+
+// NewStatusWriter creates a status writer, conditions can be nil if the resource doesn't report any condition
+func NewStatusWriter[T client.Object](c client.Client, recorder record.EventRecorder, deepCopy func(T) T,
+	conditions func(T) *[]metav1.Condition) StatusWriter[T] {
+	return StatusWriter[T]{
+		client:     c,
+		recorder:   recorder,
+		deepCopy:   deepCopy,
+		conditions: conditions,
+	}
+}
+
+// UpdateStatus applies the mutation to the latest version of the resource and patches its status. The patch is
+// guarded by the resource version, it's retried with the latest version while conflicting with other writers.
+// The updated resource and the transitioned conditions are returned.
+func (w StatusWriter[T]) UpdateStatus(ctx context.Context, obj T, mutate func(T)) (T, []metav1.Condition, error) {
+	var updated T
+	var transitions []metav1.Condition
+	key := client.ObjectKeyFromObject(obj)
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest := w.deepCopy(obj)
+		if err := w.client.Get(ctx, key, latest); err != nil {
+			return err
+		}
+
+		newObj := w.deepCopy(latest)
+		mutate(newObj)
+		transitions = nil
+		if w.conditions != nil {
+			transitions = ConditionTransitions(*w.conditions(latest), *w.conditions(newObj))
+		}
+		if equality.Semantic.DeepEqual(latest, newObj) {
+			updated = latest
+			return nil
+		}
+		if err := w.client.Status().Patch(ctx, newObj,
+			client.MergeFromWithOptions(latest, client.MergeFromWithOptimisticLock{})); err != nil {
+			return err
+		}
+		updated = newObj
+		return nil
+	})
+	if err != nil {
+		var zero T
+		return zero, nil, err
+	}
+
+	for _, cond := range transitions {
+		w.recorder.Event(updated, ConditionEventType(cond), cond.Reason,
+			fmt.Sprintf("%s is %s: %s", cond.Type, cond.Status, cond.Message))
+	}
+	return updated, transitions, nil
+}
+
+// SetConditions sets the conditions on the latest version of the resource
+func (w StatusWriter[T]) SetConditions(ctx context.Context, obj T, conditions ...metav1.Condition) (T, []metav1.Condition, error) {
+	if w.conditions == nil {
+		var zero T
+		return zero, nil, fmt.Errorf("the resource %s doesn't report conditions", client.ObjectKeyFromObject(obj))
+	}
+	return w.UpdateStatus(ctx, obj, func(newObj T) {
+		for _, cond := range conditions {
+			cond.ObservedGeneration = newObj.GetGeneration()
+			meta.SetStatusCondition(w.conditions(newObj), cond)
+		}
+	})
+}
+
+// ConditionTransitions returns the conditions whose status or reason changed
+func ConditionTransitions(previous, current []metav1.Condition) []metav1.Condition {
+	var transitions []metav1.Condition
+	for _, cond := range current {
+		old := meta.FindStatusCondition(previous, cond.Type)
+		if old == nil || old.Status != cond.Status || old.Reason != cond.Reason {
+			transitions = append(transitions, cond)
+		}
+	}
+	return transitions
+}
+
+// ConditionEventType returns the type of the event for a condition's transition, by convention the reasons
+// of failures end with "Failed"
+func ConditionEventType(cond metav1.Condition) string {
+	if strings.HasSuffix(cond.Reason, ReasonFailedSuffix) {
+		return corev1.EventTypeWarning
+	}
+	return corev1.EventTypeNormal
+}
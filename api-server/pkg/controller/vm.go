@@ -2,6 +2,8 @@ package controller
 
 import (
 	"context"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
 	"kubeall.io/api-server/pkg/infra/apiserver"
 	"kubeall.io/api-server/pkg/infra/constants"
 	"kubeall.io/api-server/pkg/service"
@@ -14,7 +16,11 @@ import (
 	"time"
 )
 
-const vmControllerName = "virtualMachine"
+const (
+	vmControllerName   = "virtualMachine"
+	reasonDisksCreated = "DisksCreated"
+	reasonDisksDeleted = "DisksDeleted"
+)
 
 // VmReconciler reconciles a virtual machine object
 type VmReconciler struct {
@@ -23,7 +29,7 @@ type VmReconciler struct {
 	manager         Manager
 	clusterResource apiserver.ClusterResource
 	vmService       service.VmService
-	reconciler      Reconciler
+	reconciler      *DefaultReconciler[*kv1.VirtualMachine]
 }
 
 func NewVmReconciler(clusterResource apiserver.ClusterResource, vmService service.VmService) ReconcileHandler {
@@ -32,7 +38,7 @@ func NewVmReconciler(clusterResource apiserver.ClusterResource, vmService servic
 
 func (v *VmReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	v.Client = mgr.GetClient()
-	v.reconciler = DefaultReconciler[*kv1.VirtualMachine]{hook: v, Client: mgr.GetClient()}
+	v.reconciler = NewDefaultReconciler[*kv1.VirtualMachine](mgr, vmControllerName, v)
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&kv1.VirtualMachine{}).
 		Named(vmControllerName).
@@ -67,16 +73,20 @@ func (v *VmReconciler) Finalizer() string {
 
 func (v *VmReconciler) OnRemove(ctx context.Context, req ctrl.Request, obj *kv1.VirtualMachine) (ctrl.Result, error) {
 	if err := v.vmService.DeleteDisks(ctx, obj); err != nil {
-		return ctrl.Result{RequeueAfter: 2 * time.Second}, err
+		return ctrl.Result{}, RequeueAfter(2*time.Second, errors.Wrap(err, "failed to delete disks of vm "+obj.Name))
 	}
-
+	v.reconciler.Event(obj, corev1.EventTypeNormal, reasonDisksDeleted, "the disks of the vm are deleted")
 	return ctrl.Result{}, nil
 }
 
 func (v *VmReconciler) OnChange(ctx context.Context, obj *kv1.VirtualMachine) error {
-	//ensure pvc created
-	if err := v.vmService.CreateDisks(ctx, obj); err != nil {
-		return err
+	//ensure pvc created, the event is emitted only if any of them is created by this reconcile
+	created, err := v.vmService.CreateDisks(ctx, obj)
+	if err != nil {
+		return errors.Wrap(err, "failed to create disks of vm "+obj.Name)
+	}
+	if created {
+		v.reconciler.Event(obj, corev1.EventTypeNormal, reasonDisksCreated, "the disks of the vm are created")
 	}
 	return nil
 }
@@ -47,6 +47,31 @@ const (
 	ImageSourceTypeExportVolume ImageSourceType = "export-from-volume"
 )
 
+// The condition types of an image
+const (
+	// ImageConditionBackingImageReady is true once the backing image of the image is created
+	ImageConditionBackingImageReady = "BackingImageReady"
+	// ImageConditionStorageClassReady is true once the storage class provisioning volumes from the image is created
+	ImageConditionStorageClassReady = "StorageClassReady"
+	// ImageConditionUploaded is true once the content of the image is uploaded(or downloaded) to all disks
+	ImageConditionUploaded = "Uploaded"
+	// ImageConditionReady is true while all the other conditions are true, the image can be used by vms then
+	ImageConditionReady = "Ready"
+	// ImageConditionDeletionBlocked is true while the image is being deleted but still used by pvcs
+	ImageConditionDeletionBlocked = "DeletionBlocked"
+)
+
+// The reasons of the image's conditions
+const (
+	ImageReasonCreated      = "Created"
+	ImageReasonCreateFailed = "CreateFailed"
+	ImageReasonPending      = "Pending"
+	ImageReasonInProgress   = "InProgress"
+	ImageReasonCompleted    = "Completed"
+	ImageReasonFailed       = "Failed"
+	ImageReasonInUse        = "InUse"
+)
+
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
@@ -63,9 +88,11 @@ type ImageSpec struct {
 	// +kubebuilder:validation:Enum=iso;disk
 	ImageType ImageType `json:"imageType"`
 
+	// the existing storage class whose parameters are inherited by the storage class of the image
 	// +optional
 	StorageClassName string `json:"storageClassName,omitempty"`
 
+	// the name of the storage class provisioning volumes from the image, it's the image's name by default
 	// +optional
 	// +kubebuilder:validation:Optional
 	ImageStorageClassName string `json:"imageStorageClassName,omitempty"`
@@ -79,6 +106,10 @@ type ImageSpec struct {
 	// +kubebuilder:validation:Enum=download;upload;restore;export-from-volume;clone
 	ImageFrom ImageSourceType `json:"imageFrom"`
 
+	// the url of the image's content, it's required while the image is downloaded
+	// +optional
+	Url string `json:"url,omitempty"`
+
 	// +optional
 	SourceStorageClassName string `json:"sourceStorageClassName,omitempty"`
 
@@ -106,6 +137,23 @@ type ImageStatus struct {
 
 	// +optional
 	LastStateTransitionTime string `json:"lastStateTransitionTime,omitempty"`
+
+	// the number of disks that the image's content is ready on
+	// +optional
+	ReadyDisks int `json:"readyDisks,omitempty"`
+
+	// the number of disks that the image's content is scheduled to
+	// +optional
+	TotalDisks int `json:"totalDisks,omitempty"`
+
+	// the generation of the spec observed by the controller
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 // +kubebuilder:object:root=true
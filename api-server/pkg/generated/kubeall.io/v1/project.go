@@ -0,0 +1,127 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +enum
+type ProjectRole string
+
+const (
+	// ProjectRoleOwner manages the project's resources
+	ProjectRoleOwner ProjectRole = "owner"
+	// ProjectRoleMember creates and manages vms and images in the project's namespaces
+	ProjectRoleMember ProjectRole = "member"
+	// ProjectRoleViewer only lists the resources of the project's namespaces
+	ProjectRoleViewer ProjectRole = "viewer"
+)
+
+// ProjectMember a user and its role in the project
+type ProjectMember struct {
+	// the user name set by the authenticating proxy
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// +optional
+	// +kubebuilder:default=member
+	// +kubebuilder:validation:Enum=owner;member;viewer
+	Role ProjectRole `json:"role,omitempty"`
+}
+
+// ProjectQuota the limits of the resources in the project's namespaces, a resource isn't limited if its quota isn't set
+type ProjectQuota struct {
+	// the number of vms
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	Vms *int32 `json:"vms,omitempty"`
+
+	// the total cpu cores of the vms
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	Cpu *int32 `json:"cpu,omitempty"`
+
+	// the total guest memory of the vms, e.g. 64Gi
+	// +optional
+	Memory *resource.Quantity `json:"memory,omitempty"`
+
+	// the total requested storage of the pvcs, e.g. 1Ti
+	// +optional
+	Storage *resource.Quantity `json:"storage,omitempty"`
+
+	// the number of images
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	Images *int32 `json:"images,omitempty"`
+}
+
+// ProjectSpec defines the desired state of Project.
+type ProjectSpec struct {
+	// +optional
+	DisplayName string `json:"displayName,omitempty"`
+
+	// +optional
+	Description string `json:"description,omitempty"`
+
+	// the namespaces grouped by the project, a namespace belongs to one project at most
+	// +optional
+	// +listType=set
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Members []ProjectMember `json:"members,omitempty"`
+
+	// +optional
+	Quota ProjectQuota `json:"quota,omitempty"`
+}
+
+// ProjectStatus defines the observed state of Project.
+type ProjectStatus struct {
+	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
+	// Important: Run "make" to regenerate code after modifying this file
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster
+
+// Project is the Schema for the projects API.
+type Project struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ProjectSpec   `json:"spec,omitempty"`
+	Status ProjectStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ProjectList contains a list of Project.
+type ProjectList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Project `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Project{}, &ProjectList{})
+}
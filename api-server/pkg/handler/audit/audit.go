@@ -0,0 +1,55 @@
+package audit
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	basehandler "kubeall.io/api-server/pkg/handler/base"
+	"kubeall.io/api-server/pkg/handler/route"
+	"kubeall.io/api-server/pkg/infra/audit"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/logger"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+)
+
+type AuditHandler interface {
+	route.Route
+	Query(ctx *gin.Context)
+}
+
+type auditHandlerImpl struct {
+	auditor audit.Auditor
+}
+
+func NewAuditHandler(auditor audit.Auditor) AuditHandler {
+	return &auditHandlerImpl{auditor}
+}
+
+// Query lists the audit events filtered by the time range(RFC3339) and the user, the latest ones are returned first
+func (a auditHandlerImpl) Query(ctx *gin.Context) {
+	var query types.AuditQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		logger.FromContext(ctx).Warn("invalid audit query", zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), http.StatusBadRequest)
+		return
+	}
+
+	events, err := a.auditor.Query(ctx, query)
+	if errors.Is(err, audit.ErrNotQueryable) {
+		result := types.FailWithErrorCode(ctx, constants.CodeAuditNotQueryable, nil)
+		result.StatusCode = http.StatusNotImplemented
+		basehandler.AbortRequest(ctx, result, 0)
+		return
+	}
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to query audit events", zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	ctx.JSON(http.StatusOK, events)
+}
+
+func (a auditHandlerImpl) RegisterRoutes(rootGroup *gin.RouterGroup, _ *gin.RouterGroup, _ *gin.RouterGroup) {
+	rootGroup.GET(constants.ResourceAuditUri, a.Query)
+}
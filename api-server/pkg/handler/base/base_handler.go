@@ -5,8 +5,11 @@ import (
 	"go.uber.org/zap"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"kubeall.io/api-server/pkg/handler/route"
+	"kubeall.io/api-server/pkg/infra/config"
 	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/logger"
 	"kubeall.io/api-server/pkg/infra/validator_resource"
+	kaservice "kubeall.io/api-server/pkg/service"
 	service "kubeall.io/api-server/pkg/service/base"
 	"kubeall.io/api-server/pkg/types"
 	"net/http"
@@ -23,17 +26,24 @@ type BaseHandler interface {
 }
 
 type baseHandlerImpl struct {
-	gvkResource *constants.GvkResource
-	baseService service.BaseService
-	translator  validator_resource.ValidatorTranslator
+	gvkResource     *constants.GvkResource
+	baseService     service.BaseService
+	settingsService kaservice.SettingsService
+	projectService  kaservice.ProjectService
+	translator      validator_resource.ValidatorTranslator
+	watcher         config.Watcher
 }
 
-func NewBaseHandler(baseService service.BaseService,
-	gvkResource *constants.GvkResource, translator validator_resource.ValidatorTranslator) BaseHandler {
+func NewBaseHandler(baseService service.BaseService, settingsService kaservice.SettingsService,
+	projectService kaservice.ProjectService, gvkResource *constants.GvkResource,
+	translator validator_resource.ValidatorTranslator, watcher config.Watcher) BaseHandler {
 	return &baseHandlerImpl{
-		gvkResource: gvkResource,
-		baseService: baseService,
-		translator:  translator,
+		gvkResource:     gvkResource,
+		baseService:     baseService,
+		settingsService: settingsService,
+		projectService:  projectService,
+		translator:      translator,
+		watcher:         watcher,
 	}
 }
 
@@ -49,42 +59,35 @@ func (b baseHandlerImpl) RegisterRoutes(_ *gin.RouterGroup, namespaceGroup *gin.
 	clusterGroup.GET(constants.ResourceNameUri, b.Get)
 	clusterGroup.PUT(constants.ResourceNameUri, b.Update)
 	clusterGroup.DELETE(constants.ResourceNameUri, b.Delete)
-}
 
-func (b baseHandlerImpl) List(ctx *gin.Context) {
-	HandleList(ctx, b.gvkResource, b.translator, b.baseService)
+	// the namespace group shadows /:resource/:name for the namespaces, so they're routed explicitly
+	clusterGroup.GET(constants.NamespaceNameUri, b.withNamespaceParams(b.Get))
+	clusterGroup.PUT(constants.NamespaceNameUri, b.withNamespaceParams(b.Update))
+	clusterGroup.DELETE(constants.NamespaceNameUri, b.withNamespaceParams(b.Delete))
 }
 
-func (b baseHandlerImpl) Get(ctx *gin.Context) {
-	var gvkRes *schema.GroupVersionKind
-	var resourceType types.ResourceType
-	var err error
-	var name = ctx.Param("name")
-
-	if gvkRes, resourceType, err = CheckResourceType(ctx, b.gvkResource); err != nil {
-		zap.L().Warn("failed to get resources", zap.Error(err))
-		return
+// withNamespaceParams maps the :namespace param to the params of a cluster resource named by it
+func (b baseHandlerImpl) withNamespaceParams(handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Params = append(ctx.Params,
+			gin.Param{Key: constants.ResourceParam, Value: constants.NamespaceResourceParam},
+			gin.Param{Key: "name", Value: ctx.Param(constants.NamespaceParam)})
+		handler(ctx)
 	}
+}
 
-	if err = CheckName(ctx, b.translator); err != nil {
-		zap.L().Warn("failed to delete resources", zap.Error(err), zap.String("name", name))
+func (b baseHandlerImpl) List(ctx *gin.Context) {
+	if !b.checkNamespace(ctx, ctx.Param(constants.NamespaceParam)) {
 		return
 	}
+	HandleList(ctx, b.gvkResource, b.translator, b.baseService, b.settingsService, b.watcher)
+}
 
-	obj, err := b.baseService.Get(ctx, *gvkRes, resourceType, name)
-	if err != nil {
-		zap.L().Warn("failed to get resource", zap.String("resource", gvkRes.Kind), zap.String("name", name),
-			zap.Error(err))
-		AbortRequest(ctx, types.Fail(err), 0)
-		return
-	}
-	if obj == nil {
-		zap.L().Warn("failed to get target resource", zap.String("resource", gvkRes.Kind),
-			zap.String("name", name))
-		ctx.AbortWithStatus(http.StatusNotFound)
+func (b baseHandlerImpl) Get(ctx *gin.Context) {
+	if !b.checkNamespace(ctx, ctx.Param(constants.NamespaceParam)) {
 		return
 	}
-	ctx.JSON(http.StatusOK, obj)
+	HandleGet(ctx, b.gvkResource, b.translator, b.baseService)
 }
 
 func (b baseHandlerImpl) Create(ctx *gin.Context) {
@@ -94,7 +97,7 @@ func (b baseHandlerImpl) Create(ctx *gin.Context) {
 	}
 
 	if err := b.baseService.Create(ctx, obj); err != nil {
-		zap.L().Warn("failed to create resource", zap.Any("error", err))
+		logger.FromContext(ctx).Warn("failed to create resource", zap.Any("error", err))
 		AbortRequest(ctx, types.Fail(err), 0)
 		return
 	}
@@ -109,7 +112,7 @@ func (b baseHandlerImpl) Update(ctx *gin.Context) {
 	}
 
 	if err := b.baseService.Update(ctx, obj); err != nil {
-		zap.L().Warn("failed to update resource", zap.Any("error", err))
+		logger.FromContext(ctx).Warn("failed to update resource", zap.Any("error", err))
 		AbortRequest(ctx, types.Fail(err), 0)
 		return
 	}
@@ -123,18 +126,21 @@ func (b baseHandlerImpl) Delete(ctx *gin.Context) {
 	var name = ctx.Param("name")
 
 	if gvkRes, resourceType, err = CheckResourceType(ctx, b.gvkResource); err != nil {
-		zap.L().Warn("failed to delete resources", zap.Error(err), zap.String("name", name))
+		logger.FromContext(ctx).Warn("failed to delete resources", zap.Error(err), zap.String("name", name))
 		return
 	}
 
 	if err = CheckName(ctx, b.translator); err != nil {
-		zap.L().Warn("failed to delete resources", zap.Error(err), zap.String("name", name))
+		logger.FromContext(ctx).Warn("failed to delete resources", zap.Error(err), zap.String("name", name))
+		return
+	}
+	if !b.checkNamespace(ctx, ctx.Param(constants.NamespaceParam)) {
 		return
 	}
 
 	err = b.baseService.Delete(ctx, *gvkRes, resourceType, name)
 	if err != nil {
-		zap.L().Warn("failed to get resource", zap.String("resource", gvkRes.Kind), zap.String("name", name),
+		logger.FromContext(ctx).Warn("failed to get resource", zap.String("resource", gvkRes.Kind), zap.String("name", name),
 			zap.Error(err))
 		AbortRequest(ctx, err, 0)
 		return
@@ -143,6 +149,17 @@ func (b baseHandlerImpl) Delete(ctx *gin.Context) {
 	ctx.Status(http.StatusOK)
 }
 
+// checkNamespace aborts the request if the namespace isn't in the caller's projects
+func (b baseHandlerImpl) checkNamespace(ctx *gin.Context, namespace string) bool {
+	if err := CheckNamespace(ctx, b.projectService, namespace); err != nil {
+		logger.FromContext(ctx).Warn("the namespace isn't accessible", zap.String("namespace", namespace),
+			zap.Error(err))
+		AbortRequest(ctx, types.Fail(err), 0)
+		return false
+	}
+	return true
+}
+
 func (b baseHandlerImpl) parseBody(ctx *gin.Context) client.Object {
 	var obj client.Object
 	var gvkRes *schema.GroupVersionKind
@@ -150,18 +167,18 @@ func (b baseHandlerImpl) parseBody(ctx *gin.Context) client.Object {
 
 	format := ctx.DefaultQuery("format", "json")
 	if format != constants.JsonFormat && format != constants.YamlFormat {
-		zap.L().Warn("invalid format to unmarshall resource", zap.Any("format", format))
+		logger.FromContext(ctx).Warn("invalid format to unmarshall resource", zap.Any("format", format))
 		AbortRequest(ctx, types.FailWithErrorCode(ctx, constants.CodeInvalidParam, map[string]string{"name": "format"}), http.StatusBadRequest)
 		return nil
 	}
 
 	if gvkRes, _, err = CheckResourceType(ctx, b.gvkResource); err != nil {
-		zap.L().Warn("failed to check resource type", zap.Error(err))
+		logger.FromContext(ctx).Warn("failed to check resource type", zap.Error(err))
 		return nil
 	}
 
 	if obj, err = b.baseService.CreateObject(*gvkRes); err != nil {
-		zap.L().Warn("failed to check resource type", zap.Error(err))
+		logger.FromContext(ctx).Warn("failed to check resource type", zap.Error(err))
 		AbortRequest(ctx, types.FailWithErrorCode(ctx, constants.CodeInvalidData, nil), http.StatusBadRequest)
 		return nil
 	}
@@ -171,8 +188,16 @@ func (b baseHandlerImpl) parseBody(ctx *gin.Context) client.Object {
 	}
 
 	if err != nil {
-		zap.L().Warn("failed to unmarshall json", zap.String("format", format), zap.Any("error", err))
+		logger.FromContext(ctx).Warn("failed to unmarshall json", zap.String("format", format), zap.Any("error", err))
 		AbortRequest(ctx, types.Fail(err), http.StatusBadRequest)
+		return nil
+	}
+
+	// the namespace of the object in the body is checked as well as the one in the path
+	for _, namespace := range []string{ctx.Param(constants.NamespaceParam), obj.GetNamespace()} {
+		if !b.checkNamespace(ctx, namespace) {
+			return nil
+		}
 	}
 	return obj
 }
@@ -0,0 +1,140 @@
+package basehandler
+
+import (
+	"context"
+	"encoding/json"
+	ginI18n "github.com/gin-contrib/i18n"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/validator_resource"
+	kaservice "kubeall.io/api-server/pkg/service"
+	service "kubeall.io/api-server/pkg/service/base"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+	"net/http/httptest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
+	"testing"
+)
+
+// fakeBaseService records the operations reaching the service
+type fakeBaseService struct {
+	service.BaseService
+	calls []string
+}
+
+func (f *fakeBaseService) Get(_ context.Context, _ schema.GroupVersionKind, resType types.ResourceType,
+	name string) (client.Object, error) {
+	f.calls = append(f.calls, "get "+resType.Namespace()+"/"+name)
+	return &corev1.ConfigMap{}, nil
+}
+
+func (f *fakeBaseService) Delete(_ context.Context, _ schema.GroupVersionKind, resType types.ResourceType,
+	name string) error {
+	f.calls = append(f.calls, "delete "+resType.Namespace()+"/"+name)
+	return nil
+}
+
+func (f *fakeBaseService) Create(_ context.Context, obj client.Object) error {
+	f.calls = append(f.calls, "create "+obj.GetNamespace()+"/"+obj.GetName())
+	return nil
+}
+
+func (f *fakeBaseService) Update(_ context.Context, obj client.Object) error {
+	f.calls = append(f.calls, "update "+obj.GetNamespace()+"/"+obj.GetName())
+	return nil
+}
+
+func (f *fakeBaseService) CreateObject(schema.GroupVersionKind) (client.Object, error) {
+	return &corev1.ConfigMap{}, nil
+}
+
+// fakeProjectService restricts the users to the namespace ns1 except admin
+type fakeProjectService struct {
+	kaservice.ProjectService
+}
+
+func (f fakeProjectService) User(ctx context.Context) string {
+	ginCtx, _ := types.GinContext(ctx)
+	return ginCtx.GetHeader(constants.DefaultUserHeader)
+}
+
+func (f fakeProjectService) AccessibleNamespaces(ctx context.Context) ([]string, bool, error) {
+	return []string{"ns1"}, f.User(ctx) == "admin", nil
+}
+
+func TestNamespaceAccess(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(ginI18n.Localize(ginI18n.WithBundle(&ginI18n.BundleCfg{
+		DefaultLanguage:  language.English,
+		FormatBundleFile: constants.ResourceBundleFormat,
+		AcceptLanguage:   []language.Tag{language.English},
+		RootPath:         "../../../cmd/server/resources/locales",
+		UnmarshalFunc:    json.Unmarshal,
+	})))
+	clusterGroup := engine.Group("/clusters/:cluster", func(ctx *gin.Context) {
+		ctx.Set(constants.ResourceType, types.NewResourceType(true, ""))
+	})
+	namespaceGroup := engine.Group("/clusters/:cluster/namespaces/:namespace", func(ctx *gin.Context) {
+		ctx.Set(constants.ResourceType, types.NewResourceType(false, ctx.Param(constants.NamespaceParam)))
+	})
+	baseService := &fakeBaseService{}
+	NewBaseHandler(baseService, nil, fakeProjectService{}, constants.NewGvkResource(),
+		validator_resource.NewValidatorTranslator(), nil).RegisterRoutes(nil, namespaceGroup, clusterGroup)
+
+	tests := map[string]struct {
+		method string
+		path   string
+		body   string
+		user   string
+		call   string
+	}{
+		"get": {method: http.MethodGet, path: "/clusters/local/namespaces/ns1/configmaps/cm1", user: "alice",
+			call: "get ns1/cm1"},
+		"get other namespace": {method: http.MethodGet, path: "/clusters/local/namespaces/ns2/configmaps/cm1",
+			user: "alice"},
+		"get by admin": {method: http.MethodGet, path: "/clusters/local/namespaces/ns2/configmaps/cm1",
+			user: "admin", call: "get ns2/cm1"},
+		"list other namespace": {method: http.MethodGet, path: "/clusters/local/namespaces/ns2/configmaps",
+			user: "alice"},
+		"get other namespace itself": {method: http.MethodGet, path: "/clusters/local/namespaces/ns2",
+			user: "alice"},
+		"create": {method: http.MethodPost, path: "/clusters/local/namespaces/ns1/configmaps", user: "alice",
+			body: `{"metadata":{"namespace":"ns1","name":"cm1"}}`, call: "create ns1/cm1"},
+		"create in other namespace": {method: http.MethodPost, path: "/clusters/local/namespaces/ns2/configmaps",
+			user: "alice", body: `{"metadata":{"namespace":"ns2","name":"cm1"}}`},
+		// the object in the body is checked as well as the path
+		"create other namespace in body": {method: http.MethodPost, path: "/clusters/local/namespaces/ns1/configmaps",
+			user: "alice", body: `{"metadata":{"namespace":"ns2","name":"cm1"}}`},
+		"update other namespace": {method: http.MethodPut, path: "/clusters/local/namespaces/ns2/configmaps/cm1",
+			user: "alice", body: `{"metadata":{"namespace":"ns2","name":"cm1"}}`},
+		"delete": {method: http.MethodDelete, path: "/clusters/local/namespaces/ns1/configmaps/cm1", user: "alice",
+			call: "delete ns1/cm1"},
+		"delete other namespace": {method: http.MethodDelete, path: "/clusters/local/namespaces/ns2/configmaps/cm1",
+			user: "alice"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			baseService.calls = nil
+			req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+			req.Header.Set(constants.DefaultUserHeader, test.user)
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, req)
+
+			if test.call == "" {
+				if recorder.Code != http.StatusForbidden || len(baseService.calls) > 0 ||
+					!strings.Contains(recorder.Body.String(), "isn't allowed to access the namespace ns2") {
+					t.Errorf("expected forbidden, got %d %s %v", recorder.Code, recorder.Body.String(), baseService.calls)
+				}
+				return
+			}
+			if recorder.Code != http.StatusOK || len(baseService.calls) != 1 || baseService.calls[0] != test.call {
+				t.Errorf("expected %s, got %d %s %v", test.call, recorder.Code, recorder.Body.String(), baseService.calls)
+			}
+		})
+	}
+}
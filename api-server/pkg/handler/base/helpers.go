@@ -6,11 +6,15 @@ import (
 	"go.uber.org/zap"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"kubeall.io/api-server/pkg/handler/validators"
+	"kubeall.io/api-server/pkg/infra/config"
 	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/logger"
 	"kubeall.io/api-server/pkg/infra/validator_resource"
+	kaservice "kubeall.io/api-server/pkg/service"
 	service "kubeall.io/api-server/pkg/service/base"
 	"kubeall.io/api-server/pkg/types"
 	"net/http"
+	"slices"
 	"strconv"
 )
 
@@ -28,25 +32,19 @@ func GetHttpCode(err error, code int) int {
 	return http.StatusInternalServerError
 }
 
+// AbortRequest responds the error translated by types.ToResult, the status code is overridden by customStatusCode
+// if it's set and the error isn't from the kubernetes api
 func AbortRequest(ctx *gin.Context, err error, customStatusCode int) {
-	code := GetHttpCode(err, customStatusCode)
-	if code == http.StatusNotFound {
-		ctx.AbortWithStatus(code)
-	} else {
-		ctx.AbortWithStatusJSON(code, types.Fail(err))
-	}
+	result := types.ToResult(ctx, err, customStatusCode)
+	ctx.AbortWithStatusJSON(result.StatusCode, result)
 }
 
 func AbortRequestWithMessage(ctx *gin.Context, message string, customStatusCode int) {
-	if customStatusCode == http.StatusNotFound {
-		ctx.AbortWithStatus(customStatusCode)
-	} else {
-		ctx.AbortWithStatusJSON(customStatusCode, &types.Result{
-			Message:    message,
-			ErrorCode:  constants.CodeInvalidParam,
-			StatusCode: http.StatusBadRequest,
-		})
-	}
+	AbortRequest(ctx, &types.Result{
+		Message:    message,
+		ErrorCode:  constants.CodeInvalidParam,
+		StatusCode: customStatusCode,
+	}, 0)
 }
 
 func CheckResourceType(ctx *gin.Context, gvkResource *constants.GvkResource) (*schema.GroupVersionKind,
@@ -59,6 +57,22 @@ func CheckResourceType(ctx *gin.Context, gvkResource *constants.GvkResource) (*s
 	}
 }
 
+// CheckNamespace makes sure the namespace is in the caller's projects, the empty namespace and namespaces/all are
+// skipped since the cluster resources aren't restricted and the lists of all the namespaces are filtered
+func CheckNamespace(ctx *gin.Context, projectService kaservice.ProjectService, namespace string) error {
+	if namespace == "" || namespace == constants.NamespaceAll {
+		return nil
+	}
+	namespaces, all, err := projectService.AccessibleNamespaces(ctx)
+	if err != nil || all || slices.Contains(namespaces, namespace) {
+		return err
+	}
+	result := types.FailWithErrorCode(ctx, constants.CodeNamespaceForbidden,
+		map[string]string{"user": projectService.User(ctx), "namespace": namespace})
+	result.StatusCode = http.StatusForbidden
+	return result
+}
+
 func CheckName(ctx *gin.Context, translator validator_resource.ValidatorTranslator) error {
 	if err, msg := validators.ValidateNow(ctx, ctx.Param("name"),
 		"required", translator); err != nil {
@@ -72,7 +86,7 @@ func ConvertIntValue(ctx *gin.Context, field, defaultValue string) (int, error)
 	page := ctx.DefaultQuery(field, defaultValue)
 	intValue, err := strconv.Atoi(page)
 	if err != nil {
-		zap.L().Warn("invalid"+field, zap.String(field, page))
+		logger.FromContext(ctx).Warn("invalid"+field, zap.String(field, page))
 		AbortRequest(ctx, types.FailWithErrorCode(ctx, constants.CodeInvalidParam,
 			map[string]string{"name": field}), http.StatusBadRequest)
 		return 0, err
@@ -80,13 +94,55 @@ func ConvertIntValue(ctx *gin.Context, field, defaultValue string) (int, error)
 	return intValue, nil
 }
 
-func HandleList(ctx *gin.Context, gvkResource *constants.GvkResource,
+// defaultPageSize returns the default page size of the settings, or the first accepted page size if it's not accepted
+// any more, e.g. the page sizes are reloaded after the settings are saved
+func defaultPageSize(pageSize int, pageSizes []int) int {
+	if len(pageSizes) == 0 || slices.Contains(pageSizes, pageSize) {
+		return pageSize
+	}
+	return pageSizes[0]
+}
+
+func HandleGet(ctx *gin.Context, gvkResource *constants.GvkResource,
 	translator validator_resource.ValidatorTranslator, baseService service.BaseService) {
 	var gvkRes *schema.GroupVersionKind
 	var resourceType types.ResourceType
 	var err error
+	var name = ctx.Param("name")
+
 	if gvkRes, resourceType, err = CheckResourceType(ctx, gvkResource); err != nil {
-		zap.L().Warn("failed to list the resources", zap.Error(err))
+		logger.FromContext(ctx).Warn("failed to get resources", zap.Error(err))
+		return
+	}
+
+	if err = CheckName(ctx, translator); err != nil {
+		logger.FromContext(ctx).Warn("failed to delete resources", zap.Error(err), zap.String("name", name))
+		return
+	}
+
+	obj, err := baseService.Get(ctx, *gvkRes, resourceType, name)
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to get resource", zap.String("resource", gvkRes.Kind), zap.String("name", name),
+			zap.Error(err))
+		AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	if obj == nil {
+		logger.FromContext(ctx).Warn("failed to get target resource", zap.String("resource", gvkRes.Kind),
+			zap.String("name", name))
+		AbortRequest(ctx, types.FailWithStatusCode(http.StatusNotFound), 0)
+		return
+	}
+	ctx.JSON(http.StatusOK, obj)
+}
+
+func HandleList(ctx *gin.Context, gvkResource *constants.GvkResource, translator validator_resource.ValidatorTranslator,
+	baseService service.BaseService, settingsService kaservice.SettingsService, watcher config.Watcher) {
+	var gvkRes *schema.GroupVersionKind
+	var resourceType types.ResourceType
+	var err error
+	if gvkRes, resourceType, err = CheckResourceType(ctx, gvkResource); err != nil {
+		logger.FromContext(ctx).Warn("failed to list the resources", zap.Error(err))
 		return
 	}
 
@@ -94,7 +150,15 @@ func HandleList(ctx *gin.Context, gvkResource *constants.GvkResource,
 	if err != nil {
 		return
 	}
-	pageSizeInt, err := ConvertIntValue(ctx, constants.PageSizeQueryField, constants.DefaultPageSize)
+	settings, err := settingsService.Get(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to get the global settings", zap.Error(err))
+		AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	pageSizes := watcher.Current().Limits.PageSizes
+	pageSizeInt, err := ConvertIntValue(ctx, constants.PageSizeQueryField,
+		strconv.Itoa(defaultPageSize(settings.DefaultPageSize, pageSizes)))
 	if err != nil {
 		return
 	}
@@ -104,7 +168,7 @@ func HandleList(ctx *gin.Context, gvkResource *constants.GvkResource,
 
 	filterMap, err := validators.ValidFilter(ctx)
 	if err != nil {
-		zap.L().Warn("failed to unmarshal filter", zap.String("filter",
+		logger.FromContext(ctx).Warn("failed to unmarshal filter", zap.String("filter",
 			ctx.Query(constants.FilterField)), zap.Error(err))
 		AbortRequest(ctx, types.Fail(err), http.StatusBadRequest)
 		return
@@ -119,16 +183,16 @@ func HandleList(ctx *gin.Context, gvkResource *constants.GvkResource,
 		SortBy:    sortBy,
 		Filters:   filterMap,
 	}
-	result := validators.ValidateListParams(ctx, translator, query)
+	result := validators.ValidateListParams(ctx, translator, query, pageSizes)
 	if result != nil {
-		zap.L().Warn("failed to list resources", zap.Any("result", result))
+		logger.FromContext(ctx).Warn("failed to list resources", zap.Any("result", result))
 		AbortRequest(ctx, result, http.StatusBadRequest)
 		return
 	}
 
 	objList, err := baseService.List(ctx, *gvkRes, resourceType.(types.ResourceType), query, true)
 	if err != nil {
-		zap.L().Warn("failed to list resources", zap.String("resource", gvkRes.Kind), zap.Error(err))
+		logger.FromContext(ctx).Warn("failed to list resources", zap.String("resource", gvkRes.Kind), zap.Error(err))
 		AbortRequest(ctx, types.Fail(err), 0)
 		return
 	}
@@ -0,0 +1,22 @@
+package basehandler
+
+import "testing"
+
+func TestDefaultPageSize(t *testing.T) {
+	tests := map[string]struct {
+		pageSize  int
+		pageSizes []int
+		expected  int
+	}{
+		"accepted":     {pageSize: 20, pageSizes: []int{10, 20, 50}, expected: 20},
+		"not accepted": {pageSize: 100, pageSizes: []int{10, 20, 50}, expected: 10},
+		"no limits":    {pageSize: 100, expected: 100},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if pageSize := defaultPageSize(test.pageSize, test.pageSizes); pageSize != test.expected {
+				t.Errorf("expected %d, got %d", test.expected, pageSize)
+			}
+		})
+	}
+}
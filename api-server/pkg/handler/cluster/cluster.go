@@ -0,0 +1,105 @@
+package cluster
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	basehandler "kubeall.io/api-server/pkg/handler/base"
+	"kubeall.io/api-server/pkg/handler/route"
+	"kubeall.io/api-server/pkg/infra/apiserver"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/logger"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+	"strconv"
+)
+
+type ClusterHandler interface {
+	route.Route
+	List(ctx *gin.Context)
+	Get(ctx *gin.Context)
+	Add(ctx *gin.Context)
+	Remove(ctx *gin.Context)
+}
+
+type clusterHandlerImpl struct {
+	registry apiserver.ClusterRegistry
+}
+
+func NewClusterHandler(registry apiserver.ClusterRegistry) ClusterHandler {
+	return &clusterHandlerImpl{registry}
+}
+
+// List returns all the clusters, their health is checked if ?health=true
+func (c clusterHandlerImpl) List(ctx *gin.Context) {
+	withHealth, _ := strconv.ParseBool(ctx.Query("health"))
+	clusters, err := c.registry.List(ctx, withHealth)
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to list clusters", zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	ctx.JSON(http.StatusOK, clusters)
+}
+
+// Get returns the cluster with its health
+func (c clusterHandlerImpl) Get(ctx *gin.Context) {
+	name := ctx.Param(constants.ClusterParam)
+	info, err := c.registry.Info(ctx, name)
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to get cluster", zap.String("cluster", name), zap.Error(err))
+		abortWithClusterError(ctx, name, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, info)
+}
+
+// Add adds or replaces a member cluster by its kubeconfig, it's connected at the first time it's used
+func (c clusterHandlerImpl) Add(ctx *gin.Context) {
+	var req types.ClusterRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		logger.FromContext(ctx).Warn("invalid cluster request", zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), http.StatusBadRequest)
+		return
+	}
+	if err := c.registry.Add(ctx, &req); err != nil {
+		logger.FromContext(ctx).Warn("failed to add cluster", zap.String("cluster", req.Name), zap.Error(err))
+		abortWithClusterError(ctx, req.Name, err)
+		return
+	}
+	ctx.Status(http.StatusCreated)
+}
+
+func (c clusterHandlerImpl) Remove(ctx *gin.Context) {
+	name := ctx.Param(constants.ClusterParam)
+	if err := c.registry.Remove(ctx, name); err != nil {
+		logger.FromContext(ctx).Warn("failed to remove cluster", zap.String("cluster", name), zap.Error(err))
+		abortWithClusterError(ctx, name, err)
+		return
+	}
+	ctx.Status(http.StatusOK)
+}
+
+func abortWithClusterError(ctx *gin.Context, name string, err error) {
+	params := map[string]string{"name": name, "error": err.Error()}
+	var result *types.Result
+	switch {
+	case errors.Is(err, apiserver.ErrClusterNotFound):
+		result = types.FailWithErrorCode(ctx, constants.CodeClusterNotFound, params)
+		result.StatusCode = http.StatusNotFound
+	case errors.Is(err, apiserver.ErrClusterReadOnly):
+		result = types.FailWithErrorCode(ctx, constants.CodeClusterReadOnly, params)
+		result.StatusCode = http.StatusForbidden
+	default:
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	basehandler.AbortRequest(ctx, result, 0)
+}
+
+func (c clusterHandlerImpl) RegisterRoutes(rootGroup *gin.RouterGroup, _ *gin.RouterGroup, _ *gin.RouterGroup) {
+	rootGroup.GET(constants.ClustersUri, c.List)
+	rootGroup.POST(constants.ClustersUri, c.Add)
+	rootGroup.GET(constants.ClusterNameUri, c.Get)
+	rootGroup.DELETE(constants.ClusterNameUri, c.Remove)
+}
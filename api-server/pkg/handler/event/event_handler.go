@@ -0,0 +1,150 @@
+package event
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	basehandler "kubeall.io/api-server/pkg/handler/base"
+	"kubeall.io/api-server/pkg/handler/route"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/logger"
+	"kubeall.io/api-server/pkg/infra/validator_resource"
+	"kubeall.io/api-server/pkg/service"
+	baseservice "kubeall.io/api-server/pkg/service/base"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+)
+
+// EventHandler lists the events of a resource and its children
+type EventHandler interface {
+	route.Route
+	List(ctx *gin.Context)
+	ListNodeEvents(ctx *gin.Context)
+}
+
+type eventHandlerImpl struct {
+	gvkResource    *constants.GvkResource
+	baseService    baseservice.BaseService
+	eventService   service.EventService
+	projectService service.ProjectService
+	translator     validator_resource.ValidatorTranslator
+}
+
+func NewEventHandler(gvkResource *constants.GvkResource, baseService baseservice.BaseService,
+	eventService service.EventService, projectService service.ProjectService,
+	translator validator_resource.ValidatorTranslator) EventHandler {
+	return &eventHandlerImpl{
+		gvkResource:    gvkResource,
+		baseService:    baseService,
+		eventService:   eventService,
+		projectService: projectService,
+		translator:     translator,
+	}
+}
+
+// List responds the events of the resource, the latest ones come first. While watching, the events are sent as the
+// server-sent events: the list event with the current events, the added or modified events, and the end event once
+// the watches are closed by the api server.
+func (e eventHandlerImpl) List(ctx *gin.Context) {
+	var query types.EventQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		logger.FromContext(ctx).Warn("invalid event query", zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), http.StatusBadRequest)
+		return
+	}
+	gvk, resourceType, err := basehandler.CheckResourceType(ctx, e.gvkResource)
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to list the events", zap.Error(err))
+		return
+	}
+	name := ctx.Param("name")
+	if err = basehandler.CheckName(ctx, e.translator); err != nil {
+		logger.FromContext(ctx).Warn("failed to list the events", zap.Error(err), zap.String("name", name))
+		return
+	}
+	if err = e.checkNamespace(ctx, resourceType); err != nil {
+		logger.FromContext(ctx).Warn("failed to list the events", zap.String("namespace", resourceType.Namespace()),
+			zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	obj, err := e.baseService.Get(ctx, *gvk, resourceType, name)
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to get resource", zap.String("resource", gvk.Kind),
+			zap.String("name", name), zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+
+	if !query.Watch {
+		events, err := e.eventService.List(ctx, *gvk, obj)
+		if err != nil {
+			logger.FromContext(ctx).Warn("failed to list the events", zap.String("resource", gvk.Kind),
+				zap.String("name", name), zap.Error(err))
+			basehandler.AbortRequest(ctx, types.Fail(err), 0)
+			return
+		}
+		ctx.JSON(http.StatusOK, filterEvents(events, query.Type))
+		return
+	}
+
+	events, changes, err := e.eventService.Watch(ctx, *gvk, obj)
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to watch the events", zap.String("resource", gvk.Kind),
+			zap.String("name", name), zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+	ctx.SSEvent("list", filterEvents(events, query.Type))
+	ctx.Writer.Flush()
+	for change := range changes {
+		if query.Type != "" && change.Event.Type != query.Type {
+			continue
+		}
+		ctx.SSEvent(change.Type, change.Event)
+		ctx.Writer.Flush()
+	}
+	// the changes are closed once the client disconnects as well
+	if ctx.Request.Context().Err() == nil {
+		ctx.SSEvent("end", "")
+		ctx.Writer.Flush()
+	}
+}
+
+// ListNodeEvents responds the events of the node like List, the node routes are static so that they take precedence
+// over the resource routes
+func (e eventHandlerImpl) ListNodeEvents(ctx *gin.Context) {
+	ctx.AddParam(constants.ResourceParam, constants.NodeResourceParam)
+	e.List(ctx)
+}
+
+// checkNamespace makes sure the namespace of the namespaced resource is in the caller's projects
+func (e eventHandlerImpl) checkNamespace(ctx *gin.Context, resourceType types.ResourceType) error {
+	if resourceType.ClusterResource() {
+		return nil
+	}
+	return basehandler.CheckNamespace(ctx, e.projectService, resourceType.Namespace())
+}
+
+func (e eventHandlerImpl) RegisterRoutes(_ *gin.RouterGroup, namespaceGroup *gin.RouterGroup,
+	clusterGroup *gin.RouterGroup) {
+	namespaceGroup.GET(constants.ResourceEventsUri, e.List)
+	clusterGroup.GET(constants.ResourceEventsUri, e.List)
+	clusterGroup.GET(constants.ResourceNodeEventsUri, e.ListNodeEvents)
+}
+
+func filterEvents(events []types.ResourceEvent, eventType string) []types.ResourceEvent {
+	if eventType == "" {
+		return events
+	}
+	filtered := make([]types.ResourceEvent, 0, len(events))
+	for _, event := range events {
+		if event.Type == eventType {
+			filtered = append(filtered, event)
+		}
+	}
+	return filtered
+}
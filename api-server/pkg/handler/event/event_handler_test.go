@@ -0,0 +1,191 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	ginI18n "github.com/gin-contrib/i18n"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/validator_resource"
+	"kubeall.io/api-server/pkg/service"
+	baseservice "kubeall.io/api-server/pkg/service/base"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+	"net/http/httptest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeBaseService returns an object of the kind named after the request
+type fakeBaseService struct {
+	baseservice.BaseService
+}
+
+func (f fakeBaseService) Get(_ context.Context, gvk schema.GroupVersionKind, resType types.ResourceType,
+	name string) (client.Object, error) {
+	obj := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: resType.Namespace(), Name: name}}
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+	return obj, nil
+}
+
+// fakeEventService returns a normal and a warning event of the object, a warning is added while watching
+type fakeEventService struct {
+	service.EventService
+	kinds []string
+}
+
+func (f *fakeEventService) events(gvk schema.GroupVersionKind, obj client.Object) []types.ResourceEvent {
+	f.kinds = append(f.kinds, gvk.Kind)
+	ref := types.EventObjectRef{Kind: gvk.Kind, Namespace: obj.GetNamespace(), Name: obj.GetName()}
+	return []types.ResourceEvent{
+		{Uid: "1", Type: corev1.EventTypeWarning, Reason: "BackOff", Object: ref},
+		{Uid: "2", Type: corev1.EventTypeNormal, Reason: "Started", Object: ref},
+	}
+}
+
+func (f *fakeEventService) List(_ context.Context, gvk schema.GroupVersionKind,
+	obj client.Object) ([]types.ResourceEvent, error) {
+	return f.events(gvk, obj), nil
+}
+
+func (f *fakeEventService) Watch(_ context.Context, gvk schema.GroupVersionKind,
+	obj client.Object) ([]types.ResourceEvent, <-chan types.WatchedEvent, error) {
+	changes := make(chan types.WatchedEvent, 2)
+	changes <- types.WatchedEvent{Type: "added", Event: types.ResourceEvent{Uid: "3", Type: corev1.EventTypeNormal}}
+	changes <- types.WatchedEvent{Type: "added", Event: types.ResourceEvent{Uid: "4", Type: corev1.EventTypeWarning}}
+	close(changes)
+	return f.events(gvk, obj), changes, nil
+}
+
+// fakeProjectService restricts the users to the namespace ns1 except admin
+type fakeProjectService struct {
+	service.ProjectService
+}
+
+func (f fakeProjectService) User(ctx context.Context) string {
+	ginCtx, _ := types.GinContext(ctx)
+	return ginCtx.GetHeader(constants.DefaultUserHeader)
+}
+
+func (f fakeProjectService) AccessibleNamespaces(ctx context.Context) ([]string, bool, error) {
+	return []string{"ns1"}, f.User(ctx) == "admin", nil
+}
+
+func newEventEngine(eventService service.EventService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(ginI18n.Localize(ginI18n.WithBundle(&ginI18n.BundleCfg{
+		DefaultLanguage:  language.English,
+		FormatBundleFile: constants.ResourceBundleFormat,
+		AcceptLanguage:   []language.Tag{language.English},
+		RootPath:         "../../../cmd/server/resources/locales",
+		UnmarshalFunc:    json.Unmarshal,
+	})))
+	clusterGroup := engine.Group("/clusters/:cluster", func(ctx *gin.Context) {
+		ctx.Set(constants.ResourceType, types.NewResourceType(true, ""))
+	})
+	namespaceGroup := engine.Group("/clusters/:cluster/namespaces/:namespace", func(ctx *gin.Context) {
+		ctx.Set(constants.ResourceType, types.NewResourceType(false, ctx.Param(constants.NamespaceParam)))
+	})
+	// the static node routes of the node handler
+	clusterGroup.GET(constants.ResourceNodeNameUri, func(ctx *gin.Context) { ctx.Status(http.StatusTeapot) })
+
+	handler := NewEventHandler(constants.NewGvkResource(), fakeBaseService{}, eventService, fakeProjectService{},
+		validator_resource.NewValidatorTranslator())
+	handler.RegisterRoutes(nil, namespaceGroup, clusterGroup)
+	return engine
+}
+
+func serve(engine *gin.Engine, path, user string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if user != "" {
+		req.Header.Set(constants.DefaultUserHeader, user)
+	}
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestList(t *testing.T) {
+	eventService := &fakeEventService{}
+	engine := newEventEngine(eventService)
+
+	tests := map[string]struct {
+		path string
+		user string
+		code int
+		uids []string
+	}{
+		"pod": {path: "/clusters/local/namespaces/ns1/pods/web/events", user: "alice", code: http.StatusOK,
+			uids: []string{"1", "2"}},
+		"warnings": {path: "/clusters/local/namespaces/ns1/pods/web/events?type=Warning", user: "alice",
+			code: http.StatusOK, uids: []string{"1"}},
+		"invalid type": {path: "/clusters/local/namespaces/ns1/pods/web/events?type=Error", user: "alice",
+			code: http.StatusBadRequest},
+		"node": {path: "/clusters/local/nodes/node1/events", user: "alice", code: http.StatusOK,
+			uids: []string{"1", "2"}},
+		"other namespace": {path: "/clusters/local/namespaces/ns2/pods/web/events", user: "alice",
+			code: http.StatusForbidden},
+		"admin": {path: "/clusters/local/namespaces/ns2/pods/web/events", user: "admin", code: http.StatusOK,
+			uids: []string{"1", "2"}},
+		"anonymous": {path: "/clusters/local/namespaces/ns2/pods/web/events", code: http.StatusForbidden},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			recorder := serve(engine, test.path, test.user)
+			if recorder.Code != test.code {
+				t.Fatalf("expected %d, got %d %s", test.code, recorder.Code, recorder.Body.String())
+			}
+			if test.code != http.StatusOK {
+				return
+			}
+			var events []types.ResourceEvent
+			if err := json.Unmarshal(recorder.Body.Bytes(), &events); err != nil {
+				t.Fatal(err)
+			}
+			var uids []string
+			for _, event := range events {
+				uids = append(uids, event.Uid)
+			}
+			if !slices.Equal(uids, test.uids) {
+				t.Errorf("expected the events %v, got %v", test.uids, uids)
+			}
+		})
+	}
+	if !slices.Contains(eventService.kinds, "Node") {
+		t.Errorf("expected the events of the node listed, got the kinds %v", eventService.kinds)
+	}
+	if code := serve(engine, "/clusters/local/nodes/node1", "alice").Code; code != http.StatusTeapot {
+		t.Errorf("expected the node routed to the node handler, got %d", code)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	engine := newEventEngine(&fakeEventService{})
+	recorder := serve(engine, "/clusters/local/namespaces/ns1/pods/web/events?watch=true&type=Warning", "alice")
+	if recorder.Code != http.StatusOK || !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("unexpected response %d %v", recorder.Code, recorder.Header())
+	}
+
+	// the list event comes first, the normal event added is filtered out, and the end event comes last
+	body := recorder.Body.String()
+	var names []string
+	for _, line := range strings.Split(body, "\n") {
+		if name, ok := strings.CutPrefix(line, "event:"); ok {
+			names = append(names, name)
+		}
+	}
+	if !slices.Equal(names, []string{"list", "added", "end"}) {
+		t.Fatalf("unexpected events %v in %s", names, body)
+	}
+	if !strings.Contains(body, `"uid":"4"`) || strings.Contains(body, `"uid":"3"`) ||
+		strings.Contains(body, `"uid":"2"`) {
+		t.Errorf("unexpected events of the type %s", body)
+	}
+}
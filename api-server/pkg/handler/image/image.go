@@ -3,47 +3,58 @@ package image
 import (
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
+	kav1 "kubeall.io/api-server/pkg/generated/kubeall.io/v1"
 	basehandler "kubeall.io/api-server/pkg/handler/base"
 	"kubeall.io/api-server/pkg/handler/route"
 	"kubeall.io/api-server/pkg/handler/validators"
+	"kubeall.io/api-server/pkg/infra/apiserver"
+	"kubeall.io/api-server/pkg/infra/config"
 	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/logger"
 	"kubeall.io/api-server/pkg/infra/validator_resource"
 	"kubeall.io/api-server/pkg/service"
 	baseservice "kubeall.io/api-server/pkg/service/base"
 	"kubeall.io/api-server/pkg/types"
 	"net/http"
+	"strconv"
 )
 
 type ImageHandler interface {
 	route.Route
+	Create(ctx *gin.Context)
 	Upload(ctx *gin.Context)
 	ListImages(ctx *gin.Context)
+	GetImage(ctx *gin.Context)
+	GetUsage(ctx *gin.Context)
+	Delete(ctx *gin.Context)
 }
 
 type imageHandlerImpl struct {
-	baseService  baseservice.BaseService
-	imageService service.ImageService
-	gvkResource  *constants.GvkResource
-	translator   validator_resource.ValidatorTranslator
+	baseService     baseservice.BaseService
+	imageService    service.ImageService
+	settingsService service.SettingsService
+	gvkResource     *constants.GvkResource
+	translator      validator_resource.ValidatorTranslator
+	watcher         config.Watcher
 }
 
 func (i imageHandlerImpl) ListImages(ctx *gin.Context) {
 	imageType := ctx.Query("type")
 	if imageType == "" {
 		ctx.Params = append(ctx.Params, gin.Param{Key: constants.ResourceParam, Value: constants.ImageResourceParam})
-		basehandler.HandleList(ctx, i.gvkResource, i.translator, i.baseService)
+		basehandler.HandleList(ctx, i.gvkResource, i.translator, i.baseService, i.settingsService, i.watcher)
 		return
 	}
 	err, _ := validators.ValidateNow(ctx, imageType, constants.ValidateImageType, i.translator)
 	if err != nil {
-		zap.L().Warn("invalid imageType", zap.String("imageType", imageType), zap.Error(err))
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, types.FailWithErrorCode(ctx,
-			constants.CodeInvalidParam, map[string]string{"name": "type"}))
+		logger.FromContext(ctx).Warn("invalid imageType", zap.String("imageType", imageType), zap.Error(err))
+		basehandler.AbortRequest(ctx, types.FailWithErrorCode(ctx,
+			constants.CodeInvalidParam, map[string]string{"name": "type"}), http.StatusBadRequest)
 		return
 	}
 	images, err := i.imageService.ListImagesByType(ctx, ctx.Param("namespace"), imageType)
 	if err != nil {
-		zap.L().Warn("failed to get images", zap.String("type", imageType),
+		logger.FromContext(ctx).Warn("failed to get images", zap.String("type", imageType),
 			zap.Error(err))
 		basehandler.AbortRequest(ctx, err, 0)
 		return
@@ -51,42 +62,117 @@ func (i imageHandlerImpl) ListImages(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, images)
 }
 
-func NewImageHandler(baseService baseservice.BaseService, imageService service.ImageService, gvkResource *constants.GvkResource,
-	translator validator_resource.ValidatorTranslator) ImageHandler {
+func NewImageHandler(baseService baseservice.BaseService, imageService service.ImageService,
+	settingsService service.SettingsService, gvkResource *constants.GvkResource, translator validator_resource.ValidatorTranslator,
+	watcher config.Watcher) ImageHandler {
 	return &imageHandlerImpl{
-		baseService, imageService, gvkResource, translator,
+		baseService, imageService, settingsService, gvkResource, translator, watcher,
 	}
 }
 
+// Create creates the image in the namespace of the path if the quota of its project isn't exceeded
+func (i imageHandlerImpl) Create(ctx *gin.Context) {
+	image := &kav1.Image{}
+	if err := ctx.ShouldBindJSON(image); err != nil {
+		logger.FromContext(ctx).Warn("failed to unmarshall image", zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), http.StatusBadRequest)
+		return
+	}
+	namespace := ctx.Param("namespace")
+	if image.Namespace != "" && image.Namespace != namespace {
+		logger.FromContext(ctx).Warn("the namespace of the image doesn't match the path",
+			zap.String("namespace", image.Namespace), zap.String("path", namespace))
+		basehandler.AbortRequest(ctx, types.FailWithErrorCode(ctx, constants.CodeInvalidParam,
+			map[string]string{"name": "metadata.namespace"}), http.StatusBadRequest)
+		return
+	}
+	image.Namespace = namespace
+	// the quota of the project is checked by the admission of the base service
+	if err := i.baseService.Create(ctx, image); err != nil {
+		logger.FromContext(ctx).Warn("failed to create image", zap.String("name", image.Name), zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	ctx.Status(http.StatusOK)
+}
+
 // Upload a vm image. meanwhile engine.MaxMultipartMemory is set to 32MB
 func (i imageHandlerImpl) Upload(ctx *gin.Context) {
-	imageName := ctx.Param("imageName")
+	imageName := ctx.Param("name")
 	err, errMsg := validators.ValidateNow(ctx, imageName, "required", i.translator)
 	if err != nil {
-		zap.L().Warn("invalid image name", zap.String("name", imageName), zap.Error(err),
+		logger.FromContext(ctx).Warn("invalid image name", zap.String("name", imageName), zap.Error(err),
 			zap.String("errMsg", errMsg))
 		basehandler.AbortRequestWithMessage(ctx, "name"+errMsg, http.StatusBadRequest)
 		return
 	}
+	// reserve the slot before receiving the content
+	release, err := i.imageService.AcquireUpload(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Warn("too many uploads in progress", zap.String("name", imageName), zap.Error(err))
+		apiserver.AbortTooManyRequests(ctx, err, constants.UploadRetryAfter)
+		return
+	}
+	defer release()
+
 	file, header, err := ctx.Request.FormFile("file")
 	if err != nil {
-		zap.L().Warn("failed get file from from", zap.String("name", imageName), zap.Error(err))
+		logger.FromContext(ctx).Warn("failed get file from from", zap.String("name", imageName), zap.Error(err))
 		basehandler.AbortRequest(ctx, types.Fail(err), http.StatusBadRequest)
 		return
 	}
 	fileSize := header.Size
-	zap.L().Info("the image to upload", zap.String("name", imageName),
+	logger.FromContext(ctx).Info("the image to upload", zap.String("name", imageName),
 		zap.Int64("size", fileSize))
 
 	if err = i.imageService.Upload(ctx, imageName, file, fileSize, ctx.Request); err != nil {
-		zap.L().Warn("failed to upload image", zap.Error(err))
+		logger.FromContext(ctx).Warn("failed to upload image", zap.Error(err))
 		basehandler.AbortRequest(ctx, err, http.StatusInternalServerError)
 		return
 	}
 	ctx.Status(http.StatusOK)
 }
 
+// GetImage is registered since the static routes of images take precedence over the generic ones
+func (i imageHandlerImpl) GetImage(ctx *gin.Context) {
+	ctx.Params = append(ctx.Params, gin.Param{Key: constants.ResourceParam, Value: constants.ImageResourceParam})
+	basehandler.HandleGet(ctx, i.gvkResource, i.translator, i.baseService)
+}
+
+// GetUsage returns the pvcs and vms provisioned from the image
+func (i imageHandlerImpl) GetUsage(ctx *gin.Context) {
+	if err := basehandler.CheckName(ctx, i.translator); err != nil {
+		return
+	}
+	usage, err := i.imageService.GetUsage(ctx, ctx.Param("namespace"), ctx.Param("name"))
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to get usage of image", zap.String("name", ctx.Param("name")), zap.Error(err))
+		basehandler.AbortRequest(ctx, err, 0)
+		return
+	}
+	ctx.JSON(http.StatusOK, usage)
+}
+
+// Delete deletes the image if it isn't in use, the consumers are returned otherwise. The image is deleted
+// regardless of its consumers if force=true is specified.
+func (i imageHandlerImpl) Delete(ctx *gin.Context) {
+	if err := basehandler.CheckName(ctx, i.translator); err != nil {
+		return
+	}
+	force, _ := strconv.ParseBool(ctx.Query("force"))
+	if err := i.imageService.Delete(ctx, ctx.Param("namespace"), ctx.Param("name"), force); err != nil {
+		logger.FromContext(ctx).Warn("failed to delete image", zap.String("name", ctx.Param("name")), zap.Error(err))
+		basehandler.AbortRequest(ctx, err, 0)
+		return
+	}
+	ctx.Status(http.StatusOK)
+}
+
 func (b imageHandlerImpl) RegisterRoutes(_ *gin.RouterGroup, namespaceGroup *gin.RouterGroup, _ *gin.RouterGroup) {
+	namespaceGroup.POST(constants.ResourceImageUri, b.Create)
 	namespaceGroup.POST(constants.ResourceImageUploadUri, b.Upload)
 	namespaceGroup.GET(constants.ResourceImageUri, b.ListImages)
+	namespaceGroup.GET(constants.ResourceImageNameUri, b.GetImage)
+	namespaceGroup.GET(constants.ResourceImageUsageUri, b.GetUsage)
+	namespaceGroup.DELETE(constants.ResourceImageNameUri, b.Delete)
 }
@@ -0,0 +1,84 @@
+package logging
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	basehandler "kubeall.io/api-server/pkg/handler/base"
+	"kubeall.io/api-server/pkg/handler/route"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/logger"
+	"kubeall.io/api-server/pkg/service"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+)
+
+// LoggingHandler changes the log levels at runtime, the levels are reset by restarting
+type LoggingHandler interface {
+	route.Route
+	List(ctx *gin.Context)
+	Update(ctx *gin.Context)
+}
+
+type loggingHandlerImpl struct {
+	projectService service.ProjectService
+}
+
+func NewLoggingHandler(projectService service.ProjectService) LoggingHandler {
+	return &loggingHandlerImpl{projectService: projectService}
+}
+
+// List returns the levels of the root logger and the named loggers
+func (l loggingHandlerImpl) List(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, logger.Levels())
+}
+
+// Update sets the level of the logger, the named logger follows the root logger again if the level is empty. Only the
+// cluster admins and the project owners are allowed to change the levels.
+func (l loggingHandlerImpl) Update(ctx *gin.Context) {
+	name := ctx.Param("name")
+	user := l.projectService.User(ctx)
+	admin, err := l.projectService.IsAdmin(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to check the admin", zap.String("user", user), zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	if !admin {
+		logger.FromContext(ctx).Warn("the user isn't allowed to change the log levels", zap.String("user", user),
+			zap.String("logger", name))
+		result := types.FailWithErrorCode(ctx, constants.CodeLoggerForbidden, map[string]string{"user": user})
+		result.StatusCode = http.StatusForbidden
+		basehandler.AbortRequest(ctx, result, 0)
+		return
+	}
+
+	var req types.LoggerLevel
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		logger.FromContext(ctx).Warn("invalid logger level", zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), http.StatusBadRequest)
+		return
+	}
+
+	level, err := logger.SetLevel(name, req.Level)
+	switch {
+	case errors.Is(err, logger.ErrLoggerNotFound):
+		result := types.FailWithErrorCode(ctx, constants.CodeNotFound, map[string]string{"name": name})
+		result.StatusCode = http.StatusNotFound
+		basehandler.AbortRequest(ctx, result, 0)
+		return
+	case errors.Is(err, logger.ErrInvalidLevel):
+		result := types.FailWithErrorCode(ctx, constants.CodeInvalidParam, map[string]string{"name": "level"})
+		result.StatusCode = http.StatusBadRequest
+		basehandler.AbortRequest(ctx, result, 0)
+		return
+	}
+	logger.FromContext(ctx).Info("the log level is changed by the user", zap.String("user", user),
+		zap.String("logger", name), zap.String("level", level.Level))
+	ctx.JSON(http.StatusOK, level)
+}
+
+func (l loggingHandlerImpl) RegisterRoutes(rootGroup *gin.RouterGroup, _ *gin.RouterGroup, _ *gin.RouterGroup) {
+	rootGroup.GET(constants.LoggersUri, l.List)
+	rootGroup.PUT(constants.LoggerNameUri, l.Update)
+}
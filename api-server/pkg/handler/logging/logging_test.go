@@ -0,0 +1,81 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	ginI18n "github.com/gin-contrib/i18n"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/fx/fxtest"
+	"golang.org/x/text/language"
+	"kubeall.io/api-server/pkg/infra/audit"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/logger"
+	"kubeall.io/api-server/pkg/service"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeProjectService treats the users in admins as the admins
+type fakeProjectService struct {
+	service.ProjectService
+	admins map[string]bool
+}
+
+func (f fakeProjectService) IsAdmin(ctx context.Context) (bool, error) {
+	return f.admins[f.User(ctx)], nil
+}
+
+func (f fakeProjectService) User(ctx context.Context) string {
+	return ctx.Value(gin.ContextKey).(*gin.Context).GetHeader(constants.DefaultUserHeader)
+}
+
+func TestUpdate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	lifecycle := fxtest.NewLifecycle(t)
+	auditor := audit.NewAuditor(&types.ServerConfig{Audit: &types.AuditConfig{Enabled: true,
+		File: &types.AuditFileConfig{Enabled: true, FileName: filepath.Join(t.TempDir(), "audit.log")}}}, lifecycle)
+	lifecycle.RequireStart()
+	defer lifecycle.RequireStop()
+
+	engine := gin.New()
+	engine.Use(ginI18n.Localize(ginI18n.WithBundle(&ginI18n.BundleCfg{
+		DefaultLanguage:  language.English,
+		FormatBundleFile: constants.ResourceBundleFormat,
+		AcceptLanguage:   []language.Tag{language.English},
+		RootPath:         "../../../cmd/server/resources/locales",
+		UnmarshalFunc:    json.Unmarshal,
+	})), audit.GinMiddleware(auditor))
+	NewLoggingHandler(fakeProjectService{admins: map[string]bool{"admin": true}}).
+		RegisterRoutes(engine.Group(constants.RootUri), nil, nil)
+
+	for user, code := range map[string]int{"alice": http.StatusForbidden, "admin": http.StatusOK} {
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/loggers/"+logger.RequestLogger,
+			strings.NewReader(`{"level":"debug"}`))
+		req.Header.Set(constants.DefaultUserHeader, user)
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, req)
+		if recorder.Code != code || (code == http.StatusForbidden &&
+			!strings.Contains(recorder.Body.String(), "The user alice isn't allowed to change the log levels")) {
+			t.Errorf("expected %d for %s, got %d %s", code, user, recorder.Code, recorder.Body.String())
+		}
+	}
+	defer func() { _, _ = logger.SetLevel(logger.RequestLogger, "") }()
+
+	// both the rejected and the accepted changes are audited
+	events, err := auditor.Query(context.Background(), types.AuditQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 audit events, got %v", events)
+	}
+	for _, event := range events {
+		if event.Verb != http.MethodPut || event.Resource != "loggers" || event.Name != logger.RequestLogger {
+			t.Errorf("unexpected audit event %+v", event)
+		}
+	}
+}
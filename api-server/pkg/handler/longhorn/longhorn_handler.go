@@ -0,0 +1,165 @@
+package longhorn
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	basehandler "kubeall.io/api-server/pkg/handler/base"
+	"kubeall.io/api-server/pkg/handler/route"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/logger"
+	"kubeall.io/api-server/pkg/infra/validator_resource"
+	"kubeall.io/api-server/pkg/service"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+)
+
+type LonghornHandler interface {
+	route.Route
+	CreateSupportBundle(ctx *gin.Context)
+	GetSupportBundle(ctx *gin.Context)
+	DownloadSupportBundle(ctx *gin.Context)
+	DeleteSupportBundle(ctx *gin.Context)
+	ListSystemBackups(ctx *gin.Context)
+	CreateSystemBackup(ctx *gin.Context)
+	ListSystemRestores(ctx *gin.Context)
+	CreateSystemRestore(ctx *gin.Context)
+}
+
+type longhornHandlerImpl struct {
+	longhornService service.LonghornService
+	translator      validator_resource.ValidatorTranslator
+}
+
+func NewLonghornHandler(longhornService service.LonghornService, translator validator_resource.ValidatorTranslator) LonghornHandler {
+	return &longhornHandlerImpl{
+		longhornService, translator,
+	}
+}
+
+// CreateSupportBundle creates a support bundle, the caller polls the bundle until its state is ready and downloads it
+func (l longhornHandlerImpl) CreateSupportBundle(ctx *gin.Context) {
+	var request types.SupportBundleRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		logger.FromContext(ctx).Warn("failed to unmarshall support bundle request", zap.Any("error", err))
+		basehandler.AbortRequest(ctx, types.Fail(err), http.StatusBadRequest)
+		return
+	}
+
+	bundle, err := l.longhornService.CreateSupportBundle(ctx, request)
+	if err != nil {
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	ctx.JSON(http.StatusCreated, bundle)
+}
+
+func (l longhornHandlerImpl) GetSupportBundle(ctx *gin.Context) {
+	if err := basehandler.CheckName(ctx, l.translator); err != nil {
+		return
+	}
+	bundle, err := l.longhornService.GetSupportBundle(ctx, ctx.Param("name"))
+	if err != nil {
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	ctx.JSON(http.StatusOK, bundle)
+}
+
+// DownloadSupportBundle streams the archive of a generated support bundle to the caller, 409 is returned while the
+// bundle is still being generated
+func (l longhornHandlerImpl) DownloadSupportBundle(ctx *gin.Context) {
+	if err := basehandler.CheckName(ctx, l.translator); err != nil {
+		return
+	}
+	name := ctx.Param("name")
+	archive, err := l.longhornService.DownloadSupportBundle(ctx, name)
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to download support bundle", zap.String("name", name), zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	defer func() { _ = archive.Content.Close() }()
+
+	fileName := archive.FileName
+	if fileName == "" {
+		fileName = name + ".zip"
+	}
+	ctx.DataFromReader(http.StatusOK, archive.Size, "application/zip", archive.Content, map[string]string{
+		"Content-Disposition": fmt.Sprintf(`attachment; filename="%s"`, fileName),
+	})
+	logger.FromContext(ctx).Info("support bundle is downloaded", zap.String("name", name), zap.Int64("size", archive.Size))
+}
+
+func (l longhornHandlerImpl) DeleteSupportBundle(ctx *gin.Context) {
+	if err := basehandler.CheckName(ctx, l.translator); err != nil {
+		return
+	}
+	if err := l.longhornService.DeleteSupportBundle(ctx, ctx.Param("name")); err != nil {
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	ctx.Status(http.StatusOK)
+}
+
+func (l longhornHandlerImpl) ListSystemBackups(ctx *gin.Context) {
+	backups, err := l.longhornService.ListSystemBackups(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to list system backups", zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	ctx.JSON(http.StatusOK, backups)
+}
+
+func (l longhornHandlerImpl) CreateSystemBackup(ctx *gin.Context) {
+	var request types.SystemBackupRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		logger.FromContext(ctx).Warn("failed to unmarshall system backup request", zap.Any("error", err))
+		basehandler.AbortRequest(ctx, types.Fail(err), http.StatusBadRequest)
+		return
+	}
+	backup, err := l.longhornService.CreateSystemBackup(ctx, request)
+	if err != nil {
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	ctx.JSON(http.StatusCreated, backup)
+}
+
+func (l longhornHandlerImpl) ListSystemRestores(ctx *gin.Context) {
+	restores, err := l.longhornService.ListSystemRestores(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to list system restores", zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	ctx.JSON(http.StatusOK, restores)
+}
+
+func (l longhornHandlerImpl) CreateSystemRestore(ctx *gin.Context) {
+	var request types.SystemRestoreRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		logger.FromContext(ctx).Warn("failed to unmarshall system restore request", zap.Any("error", err))
+		basehandler.AbortRequest(ctx, types.Fail(err), http.StatusBadRequest)
+		return
+	}
+	restore, err := l.longhornService.CreateSystemRestore(ctx, request)
+	if err != nil {
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	ctx.JSON(http.StatusCreated, restore)
+}
+
+func (l longhornHandlerImpl) RegisterRoutes(_ *gin.RouterGroup, _ *gin.RouterGroup, clusterGroup *gin.RouterGroup) {
+	clusterGroup.POST(constants.ResourceSupportBundleUri, l.CreateSupportBundle)
+	clusterGroup.GET(constants.ResourceSupportBundleNameUri, l.GetSupportBundle)
+	clusterGroup.DELETE(constants.ResourceSupportBundleNameUri, l.DeleteSupportBundle)
+	clusterGroup.GET(constants.ResourceSupportBundleDownloadUri, l.DownloadSupportBundle)
+
+	clusterGroup.GET(constants.ResourceSystemBackupUri, l.ListSystemBackups)
+	clusterGroup.POST(constants.ResourceSystemBackupUri, l.CreateSystemBackup)
+	clusterGroup.GET(constants.ResourceSystemRestoreUri, l.ListSystemRestores)
+	clusterGroup.POST(constants.ResourceSystemRestoreUri, l.CreateSystemRestore)
+}
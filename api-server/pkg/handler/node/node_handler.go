@@ -0,0 +1,161 @@
+package node
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	basehandler "kubeall.io/api-server/pkg/handler/base"
+	"kubeall.io/api-server/pkg/handler/route"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/logger"
+	"kubeall.io/api-server/pkg/infra/validator_resource"
+	"kubeall.io/api-server/pkg/service"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+)
+
+type NodeHandler interface {
+	route.Route
+	List(ctx *gin.Context)
+	Get(ctx *gin.Context)
+	Cordon(ctx *gin.Context)
+	Uncordon(ctx *gin.Context)
+	SetNodeTags(ctx *gin.Context)
+	RequestEviction(ctx *gin.Context)
+	SetDiskScheduling(ctx *gin.Context)
+	SetDiskTags(ctx *gin.Context)
+}
+
+type nodeHandlerImpl struct {
+	nodeService service.NodeService
+	translator  validator_resource.ValidatorTranslator
+}
+
+func NewNodeHandler(nodeService service.NodeService, translator validator_resource.ValidatorTranslator) NodeHandler {
+	return &nodeHandlerImpl{
+		nodeService, translator,
+	}
+}
+
+func (n nodeHandlerImpl) List(ctx *gin.Context) {
+	nodes, err := n.nodeService.List(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to list nodes", zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	ctx.JSON(http.StatusOK, nodes)
+}
+
+func (n nodeHandlerImpl) Get(ctx *gin.Context) {
+	if err := basehandler.CheckName(ctx, n.translator); err != nil {
+		return
+	}
+	node, err := n.nodeService.Get(ctx, ctx.Param("name"))
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to get node", zap.String("name", ctx.Param("name")), zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	ctx.JSON(http.StatusOK, node)
+}
+
+func (n nodeHandlerImpl) Cordon(ctx *gin.Context) {
+	n.cordon(ctx, true)
+}
+
+func (n nodeHandlerImpl) Uncordon(ctx *gin.Context) {
+	n.cordon(ctx, false)
+}
+
+func (n nodeHandlerImpl) cordon(ctx *gin.Context, unschedulable bool) {
+	if err := basehandler.CheckName(ctx, n.translator); err != nil {
+		return
+	}
+	if err := n.nodeService.Cordon(ctx, ctx.Param("name"), unschedulable); err != nil {
+		logger.FromContext(ctx).Warn("failed to change node's scheduling", zap.String("name", ctx.Param("name")),
+			zap.Bool("unschedulable", unschedulable), zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	ctx.Status(http.StatusOK)
+}
+
+func (n nodeHandlerImpl) SetNodeTags(ctx *gin.Context) {
+	var request types.TagsRequest
+	if !n.bindRequest(ctx, &request) {
+		return
+	}
+	if err := n.nodeService.SetNodeTags(ctx, ctx.Param("name"), request.Tags); err != nil {
+		logger.FromContext(ctx).Warn("failed to set node's tags", zap.String("name", ctx.Param("name")), zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	ctx.Status(http.StatusOK)
+}
+
+func (n nodeHandlerImpl) RequestEviction(ctx *gin.Context) {
+	var request types.EvictionRequest
+	if !n.bindRequest(ctx, &request) {
+		return
+	}
+	if err := n.nodeService.RequestEviction(ctx, ctx.Param("name"), request); err != nil {
+		logger.FromContext(ctx).Warn("failed to request eviction", zap.String("name", ctx.Param("name")),
+			zap.String("disk", request.Disk), zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	ctx.Status(http.StatusOK)
+}
+
+func (n nodeHandlerImpl) SetDiskScheduling(ctx *gin.Context) {
+	var request types.SchedulingRequest
+	if !n.bindRequest(ctx, &request) {
+		return
+	}
+	if err := n.nodeService.SetDiskScheduling(ctx, ctx.Param("name"), ctx.Param("disk"),
+		*request.AllowScheduling); err != nil {
+		logger.FromContext(ctx).Warn("failed to change disk's scheduling", zap.String("name", ctx.Param("name")),
+			zap.String("disk", ctx.Param("disk")), zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	ctx.Status(http.StatusOK)
+}
+
+func (n nodeHandlerImpl) SetDiskTags(ctx *gin.Context) {
+	var request types.TagsRequest
+	if !n.bindRequest(ctx, &request) {
+		return
+	}
+	if err := n.nodeService.SetDiskTags(ctx, ctx.Param("name"), ctx.Param("disk"), request.Tags); err != nil {
+		logger.FromContext(ctx).Warn("failed to set disk's tags", zap.String("name", ctx.Param("name")),
+			zap.String("disk", ctx.Param("disk")), zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	ctx.Status(http.StatusOK)
+}
+
+// bindRequest validates the node's name and unmarshalls the request body, the request is aborted if it fails
+func (n nodeHandlerImpl) bindRequest(ctx *gin.Context, request any) bool {
+	if err := basehandler.CheckName(ctx, n.translator); err != nil {
+		return false
+	}
+	if err := ctx.ShouldBindJSON(request); err != nil {
+		logger.FromContext(ctx).Warn("failed to unmarshall node request", zap.Any("error", err))
+		basehandler.AbortRequest(ctx, types.Fail(err), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func (n nodeHandlerImpl) RegisterRoutes(_ *gin.RouterGroup, _ *gin.RouterGroup, clusterGroup *gin.RouterGroup) {
+	clusterGroup.GET(constants.ResourceNodeUri, n.List)
+	clusterGroup.GET(constants.ResourceNodeNameUri, n.Get)
+	clusterGroup.POST(constants.ResourceNodeCordonUri, n.Cordon)
+	clusterGroup.POST(constants.ResourceNodeUncordonUri, n.Uncordon)
+	clusterGroup.PUT(constants.ResourceNodeTagsUri, n.SetNodeTags)
+	clusterGroup.POST(constants.ResourceNodeEvictUri, n.RequestEviction)
+	clusterGroup.PUT(constants.ResourceDiskSchedulingUri, n.SetDiskScheduling)
+	clusterGroup.PUT(constants.ResourceDiskTagsUri, n.SetDiskTags)
+}
@@ -0,0 +1,111 @@
+package openapi
+
+import (
+	"embed"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"html/template"
+	"io/fs"
+	basehandler "kubeall.io/api-server/pkg/handler/base"
+	"kubeall.io/api-server/pkg/handler/route"
+	"kubeall.io/api-server/pkg/infra/apiserver"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/logger"
+	"kubeall.io/api-server/pkg/infra/openapi"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+	"path"
+	"strconv"
+)
+
+const swaggerUiBundle = "swagger-ui-bundle.js"
+
+//go:embed swagger-ui/index.html
+var swaggerUiPage string
+
+// swaggerUiDist the assets of swagger-ui-dist, they're downloaded by `task swagger-ui`
+//
+//go:embed all:swagger-ui/dist
+var swaggerUiDist embed.FS
+
+var swaggerUiTemplate = template.Must(template.New("swagger-ui").Parse(swaggerUiPage))
+
+// OpenApiHandler serves the OpenAPI document of the api server and the Swagger UI rendering it
+type OpenApiHandler interface {
+	route.Route
+	Document(ctx *gin.Context)
+	SwaggerUi(ctx *gin.Context)
+}
+
+type openApiHandlerImpl struct {
+	builder    openapi.Builder
+	restServer apiserver.RestServer
+	config     types.OpenApiConfig
+	basePath   string
+	// assets the embedded swagger-ui-dist, they're served unless SwaggerUiDir or SwaggerUiUrl is set
+	assets fs.FS
+}
+
+func NewOpenApiHandler(config types.Config, builder openapi.Builder, restServer apiserver.RestServer) OpenApiHandler {
+	h := &openApiHandlerImpl{builder: builder, restServer: restServer}
+	if cfg := config.(*types.ServerConfig).OpenApi; cfg != nil {
+		h.config = *cfg
+	}
+	h.assets, _ = fs.Sub(swaggerUiDist, "swagger-ui/dist")
+	return h
+}
+
+// Document returns the OpenAPI document, it's rebuilt with the schemas discovered again if refresh is true
+func (o *openApiHandlerImpl) Document(ctx *gin.Context) {
+	refresh, _ := strconv.ParseBool(ctx.Query("refresh"))
+	document, err := o.builder.Build(ctx, o.restServer.GetEngine().Routes(), refresh)
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to build the openapi document", zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	ctx.JSON(http.StatusOK, document)
+}
+
+// SwaggerUi renders the page of the Swagger UI loading the document
+func (o *openApiHandlerImpl) SwaggerUi(ctx *gin.Context) {
+	ctx.Header("Content-Type", "text/html; charset=utf-8")
+	ctx.Status(http.StatusOK)
+	err := swaggerUiTemplate.Execute(ctx.Writer, map[string]string{
+		"AssetsUrl":   o.config.SwaggerUiUrl,
+		"DocumentUrl": path.Join(o.basePath, constants.OpenApiUri),
+	})
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to render the swagger ui", zap.Error(err))
+	}
+}
+
+func (o *openApiHandlerImpl) RegisterRoutes(rootGroup *gin.RouterGroup, _ *gin.RouterGroup, _ *gin.RouterGroup) {
+	if !o.config.Enabled {
+		return
+	}
+	o.basePath = rootGroup.BasePath()
+	rootGroup.GET(constants.OpenApiUri, o.Document)
+
+	// the assets of swagger-ui-dist are served from the mounted directory, or loaded from the configured url, or
+	// served from the embedded ones
+	switch {
+	case o.config.SwaggerUiDir != "":
+		rootGroup.Static(constants.SwaggerUiAssetsUri, o.config.SwaggerUiDir)
+		o.config.SwaggerUiUrl = path.Join(o.basePath, constants.SwaggerUiAssetsUri)
+	case o.config.SwaggerUiUrl != "":
+	case o.assets != nil && isFile(o.assets, swaggerUiBundle):
+		rootGroup.StaticFS(constants.SwaggerUiAssetsUri, http.FS(o.assets))
+		o.config.SwaggerUiUrl = path.Join(o.basePath, constants.SwaggerUiAssetsUri)
+	default:
+		zap.L().Warn("the swagger ui isn't served since swagger-ui-dist isn't embedded, run `task swagger-ui` " +
+			"before the build or mount it at openApi.swaggerUiDir")
+		return
+	}
+	rootGroup.GET(constants.SwaggerUiUri, o.SwaggerUi)
+}
+
+func isFile(assets fs.FS, name string) bool {
+	info, err := fs.Stat(assets, name)
+	return err == nil && !info.IsDir()
+}
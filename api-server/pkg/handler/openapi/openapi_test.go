@@ -0,0 +1,181 @@
+package openapi
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/rest"
+	"kubeall.io/api-server/pkg/infra/apiserver"
+	"kubeall.io/api-server/pkg/infra/clients"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/openapi"
+	"kubeall.io/api-server/pkg/types"
+	kv1 "kubevirt.io/api/core/v1"
+	"net/http"
+	"net/http/httptest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const vmSchema = "io.kubevirt.v1.VirtualMachine"
+
+// fakeCluster serves the OpenAPI v3 discovery of the fake api server, only the vms and the cluster roles are mapped
+type fakeCluster struct {
+	apiserver.ClusterResource
+	client        clients.ApiClient
+	runtimeClient client.Client
+}
+
+func (f fakeCluster) Client() clients.ApiClient {
+	return f.client
+}
+
+func (f fakeCluster) RuntimeClient() client.Client {
+	return f.runtimeClient
+}
+
+func newFakeCluster(t *testing.T) fakeCluster {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/openapi/v3":
+			_, _ = w.Write([]byte(`{"paths":{"apis/kubevirt.io/v1":{"serverRelativeURL":"/openapi/v3/apis/kubevirt.io/v1?hash=1"}}}`))
+		case "/openapi/v3/apis/kubevirt.io/v1":
+			_, _ = w.Write([]byte(`{"components":{"schemas":{
+				"` + vmSchema + `":{"type":"object","properties":{"metadata":{"$ref":"#/components/schemas/meta.ObjectMeta"}},
+					"x-kubernetes-group-version-kind":[{"group":"kubevirt.io","version":"v1","kind":"VirtualMachine"}]},
+				"meta.ObjectMeta":{"type":"object"},
+				"io.kubevirt.v1.KubeVirt":{"type":"object"}}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	apiClient, err := clients.NewClientsForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(kv1.SchemeGroupVersion.WithKind("VirtualMachine"), meta.RESTScopeNamespace)
+	mapper.Add(rbacv1.SchemeGroupVersion.WithKind("ClusterRole"), meta.RESTScopeRoot)
+	return fakeCluster{client: apiClient, runtimeClient: fake.NewClientBuilder().WithRESTMapper(mapper).Build()}
+}
+
+// restServer serves the routes of the engine
+type restServer struct {
+	apiserver.RestServer
+	engine *gin.Engine
+}
+
+func (r restServer) GetEngine() *gin.Engine {
+	return r.engine
+}
+
+func newEngine(t *testing.T, config *types.OpenApiConfig, setup func(h *openApiHandlerImpl)) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	builder := openapi.NewBuilder(newFakeCluster(t), constants.NewGvkResource())
+	h := NewOpenApiHandler(&types.ServerConfig{OpenApi: config}, builder, restServer{engine: engine}).(*openApiHandlerImpl)
+	if setup != nil {
+		setup(h)
+	}
+
+	rootGroup := engine.Group(constants.RootUri)
+	clusterGroup := engine.Group(constants.ClusterGroupUri)
+	namespaceGroup := engine.Group(constants.NamespaceGroupUri)
+	noop := func(ctx *gin.Context) {}
+	namespaceGroup.GET(constants.ResourceUri, noop)
+	namespaceGroup.POST(constants.ResourceUri, noop)
+	namespaceGroup.GET(constants.ResourceNameUri, noop)
+	clusterGroup.GET(constants.ResourceUri, noop)
+	clusterGroup.GET(constants.ResourceNodeNameUri, noop)
+	h.RegisterRoutes(rootGroup, namespaceGroup, clusterGroup)
+	return engine
+}
+
+func serve(engine *gin.Engine, path string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	return recorder
+}
+
+func TestDocument(t *testing.T) {
+	engine := newEngine(t, &types.OpenApiConfig{Enabled: true}, nil)
+	recorder := serve(engine, constants.RootUri+constants.OpenApiUri)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("got %d %s", recorder.Code, recorder.Body.String())
+	}
+	var document struct {
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	}
+
+	vms := "/api/v1/clusters/{cluster}/namespaces/{namespace}/vms"
+	for path, methods := range map[string][]string{
+		vms:             {"get", "post"},
+		vms + "/{name}": {"get"},
+		"/api/v1/clusters/{cluster}/clusterroles": {"get"},
+		"/api/v1/clusters/{cluster}/nodes/{name}": {"get"},
+		"/api/v1" + constants.OpenApiUri:          {"get"},
+	} {
+		for _, method := range methods {
+			if _, ok := document.Paths[path][method]; !ok {
+				t.Errorf("expected %s %s in the document", method, path)
+			}
+		}
+	}
+	// the namespaced resources aren't expanded for the cluster routes, and the resources not served are skipped
+	for _, path := range []string{"/api/v1/clusters/{cluster}/vms", "/api/v1/clusters/{cluster}/namespaces/{namespace}/pods"} {
+		if _, ok := document.Paths[path]; ok {
+			t.Errorf("unexpected path %s", path)
+		}
+	}
+	if !strings.Contains(string(document.Paths[vms+"/{name}"]["get"]), "#/components/schemas/"+vmSchema) {
+		t.Errorf("expected the vm schema referenced, got %s", document.Paths[vms+"/{name}"]["get"])
+	}
+	// the schemas referenced by the vm are copied, the others aren't
+	for name, expected := range map[string]bool{vmSchema: true, "meta.ObjectMeta": true, "io.kubevirt.v1.KubeVirt": false} {
+		if _, ok := document.Components.Schemas[name]; ok != expected {
+			t.Errorf("expected the schema %s in the document: %t", name, expected)
+		}
+	}
+}
+
+func TestSwaggerUi(t *testing.T) {
+	assets := fstest.MapFS{swaggerUiBundle: {Data: []byte("bundle")}, "swagger-ui.css": {Data: []byte("css")}}
+	engine := newEngine(t, &types.OpenApiConfig{Enabled: true}, func(h *openApiHandlerImpl) { h.assets = assets })
+
+	page := serve(engine, constants.RootUri+constants.SwaggerUiUri)
+	if page.Code != http.StatusOK || !strings.Contains(page.Body.String(), `src="/api/v1/docs/assets/swagger-ui-bundle.js"`) ||
+		!strings.Contains(page.Body.String(), `url: "\/api\/v1\/openapi.json"`) {
+		t.Errorf("unexpected page %d %s", page.Code, page.Body.String())
+	}
+	if bundle := serve(engine, "/api/v1/docs/assets/"+swaggerUiBundle); bundle.Code != http.StatusOK ||
+		bundle.Body.String() != "bundle" {
+		t.Errorf("unexpected bundle %d %s", bundle.Code, bundle.Body.String())
+	}
+
+	// the configured url takes precedence over the embedded assets
+	engine = newEngine(t, &types.OpenApiConfig{Enabled: true, SwaggerUiUrl: "https://assets.example.com/swagger-ui"},
+		func(h *openApiHandlerImpl) { h.assets = assets })
+	if page = serve(engine, constants.RootUri+constants.SwaggerUiUri); !strings.Contains(page.Body.String(),
+		`src="https://assets.example.com/swagger-ui/swagger-ui-bundle.js"`) {
+		t.Errorf("unexpected page of the configured url %s", page.Body.String())
+	}
+
+	// the page isn't served without the assets
+	engine = newEngine(t, &types.OpenApiConfig{Enabled: true}, func(h *openApiHandlerImpl) { h.assets = fstest.MapFS{} })
+	if code := serve(engine, constants.RootUri+constants.SwaggerUiUri).Code; code != http.StatusNotFound {
+		t.Errorf("got %d of the page without the assets", code)
+	}
+}
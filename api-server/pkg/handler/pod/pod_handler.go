@@ -0,0 +1,214 @@
+package pod
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+	"io"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/remotecommand"
+	basehandler "kubeall.io/api-server/pkg/handler/base"
+	"kubeall.io/api-server/pkg/handler/route"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/logger"
+	"kubeall.io/api-server/pkg/service"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+const eventStream = "text/event-stream"
+
+// PodHandler streams the logs of the pods and opens the terminals of their containers
+type PodHandler interface {
+	route.Route
+	Log(ctx *gin.Context)
+	Exec(ctx *gin.Context)
+}
+
+type podHandlerImpl struct {
+	podService service.PodService
+	upgrader   websocket.Upgrader
+}
+
+func NewPodHandler(config types.Config, podService service.PodService) PodHandler {
+	var allowedOrigins []string
+	if cfg := config.(*types.ServerConfig).Http; cfg != nil && cfg.Cors != nil && cfg.Cors.Enabled {
+		allowedOrigins = cfg.Cors.AllowedOrigins
+	}
+	return &podHandlerImpl{
+		podService: podService,
+		upgrader: websocket.Upgrader{
+			// the websockets aren't restricted by the CORS, the origins are checked against its config instead
+			CheckOrigin: func(req *http.Request) bool {
+				return checkOrigin(req, allowedOrigins)
+			},
+		},
+	}
+}
+
+// Log streams the logs of the container as plain text, or as the server-sent events while they're accepted, each line
+// is an event then and the end event is sent once the logs end
+func (p podHandlerImpl) Log(ctx *gin.Context) {
+	var query types.PodLogQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		logger.FromContext(ctx).Warn("invalid pod log query", zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), http.StatusBadRequest)
+		return
+	}
+	namespace, name := ctx.Param(constants.NamespaceParam), ctx.Param("name")
+	if err := p.podService.Authorize(ctx, namespace, name, constants.PodLogSubresource); err != nil {
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	stream, err := p.podService.Logs(ctx, namespace, name, query.LogOptions())
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to stream the logs of pod", zap.String("namespace", namespace),
+			zap.String("name", name), zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	defer stream.Close()
+
+	// the proxies shouldn't buffer the logs being followed
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("X-Accel-Buffering", "no")
+	if strings.Contains(ctx.GetHeader("Accept"), eventStream) {
+		err = streamEvents(ctx, stream)
+	} else {
+		ctx.Header("Content-Type", "text/plain; charset=utf-8")
+		ctx.Status(http.StatusOK)
+		err = streamText(ctx, stream)
+	}
+	// the logs are cut off once the client disconnects
+	if err != nil && !errors.Is(err, context.Canceled) {
+		logger.FromContext(ctx).Warn("the logs of pod are cut off", zap.String("namespace", namespace),
+			zap.String("name", name), zap.Error(err))
+	}
+}
+
+// Exec upgrades the request to a websocket and runs the command in the container with a tty by default, the shell of
+// the config is run if the command isn't specified
+func (p podHandlerImpl) Exec(ctx *gin.Context) {
+	var query types.PodExecQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		logger.FromContext(ctx).Warn("invalid pod exec query", zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), http.StatusBadRequest)
+		return
+	}
+	namespace, name := ctx.Param(constants.NamespaceParam), ctx.Param("name")
+	if err := p.podService.Authorize(ctx, namespace, name, constants.PodExecSubresource); err != nil {
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+
+	conn, err := p.upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		// the upgrader has responded the error
+		logger.FromContext(ctx).Warn("failed to upgrade the exec request", zap.Error(err))
+		return
+	}
+	command := query.Command
+	if len(command) == 0 {
+		command = p.podService.Shell()
+	}
+	tty := query.Tty == nil || *query.Tty
+
+	// the hijacked connection doesn't cancel the request, the command is canceled once the websocket is closed
+	execCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	session := newTerminalSession(conn, cancel)
+	streams := remotecommand.StreamOptions{Stdin: session, Stdout: session, Tty: tty}
+	if tty {
+		streams.TerminalSizeQueue = session
+	} else {
+		streams.Stderr = session
+	}
+	logger.FromContext(ctx).Info("the terminal of pod is opened", zap.String("namespace", namespace),
+		zap.String("name", name), zap.String("container", query.Container), zap.Strings("command", command))
+	err = p.podService.Exec(execCtx, namespace, name, &corev1.PodExecOptions{
+		Container: query.Container,
+		Command:   command,
+		Stdin:     true,
+		Stdout:    true,
+		Stderr:    !tty,
+		TTY:       tty,
+	}, streams)
+	session.Close(err)
+	logger.FromContext(ctx).Info("the terminal of pod is closed", zap.String("namespace", namespace),
+		zap.String("name", name), zap.NamedError("reason", err))
+}
+
+func (p podHandlerImpl) RegisterRoutes(_ *gin.RouterGroup, namespaceGroup *gin.RouterGroup, _ *gin.RouterGroup) {
+	namespaceGroup.GET(constants.ResourcePodLogUri, p.Log)
+	namespaceGroup.GET(constants.ResourcePodExecUri, p.Exec)
+}
+
+// streamText copies the logs to the response, they're flushed once they're read
+func streamText(ctx *gin.Context, stream io.Reader) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := stream.Read(buf)
+		if n > 0 {
+			if _, writeErr := ctx.Writer.Write(buf[:n]); writeErr != nil {
+				return writeErr
+			}
+			ctx.Writer.Flush()
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// streamEvents sends each line of the logs as a message event, the end event or the error event is sent at last
+func streamEvents(ctx *gin.Context, stream io.Reader) error {
+	ctx.Header("Content-Type", eventStream)
+	ctx.Status(http.StatusOK)
+	reader := bufio.NewReader(stream)
+	for {
+		line, err := reader.ReadString('\n')
+		if line = strings.TrimRight(line, "\r\n"); line != "" || err == nil {
+			ctx.SSEvent("message", line)
+			ctx.Writer.Flush()
+		}
+		if errors.Is(err, io.EOF) {
+			ctx.SSEvent("end", "")
+			ctx.Writer.Flush()
+			return nil
+		}
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				ctx.SSEvent("error", err.Error())
+				ctx.Writer.Flush()
+			}
+			return err
+		}
+	}
+}
+
+// checkOrigin accepts the requests of the same origin or the origins allowed by the CORS
+func checkOrigin(req *http.Request, allowedOrigins []string) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, req.Host) {
+		return true
+	}
+	return slices.ContainsFunc(allowedOrigins, func(allowed string) bool {
+		return allowed == "*" || strings.EqualFold(allowed, origin)
+	})
+}
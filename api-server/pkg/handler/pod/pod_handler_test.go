@@ -0,0 +1,142 @@
+package pod
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"io"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/remotecommand"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/service"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakePodService echoes the input of the terminal in upper case and returns the logs as is
+type fakePodService struct {
+	service.PodService
+	logs    string
+	options *corev1.PodExecOptions
+	sizes   chan remotecommand.TerminalSize
+}
+
+func (f *fakePodService) Authorize(context.Context, string, string, string) error {
+	return nil
+}
+
+func (f *fakePodService) Logs(context.Context, string, string, *corev1.PodLogOptions) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(f.logs)), nil
+}
+
+func (f *fakePodService) Shell() []string {
+	return []string{constants.DefaultShell}
+}
+
+func (f *fakePodService) Exec(_ context.Context, _, _ string, options *corev1.PodExecOptions,
+	streams remotecommand.StreamOptions) error {
+	f.options = options
+	go func() {
+		if size := streams.TerminalSizeQueue.Next(); size != nil {
+			f.sizes <- *size
+		}
+	}()
+	buf := make([]byte, 64)
+	n, err := streams.Stdin.Read(buf)
+	if err != nil {
+		return err
+	}
+	_, err = streams.Stdout.Write([]byte(strings.ToUpper(string(buf[:n]))))
+	return err
+}
+
+func newPodEngine(podService service.PodService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	handler := NewPodHandler(&types.ServerConfig{}, podService)
+	handler.RegisterRoutes(nil, engine.Group("/namespaces/:namespace"), nil)
+	return engine
+}
+
+func TestLog(t *testing.T) {
+	engine := newPodEngine(&fakePodService{logs: "first\nsecond\n"})
+
+	req := httptest.NewRequest(http.MethodGet, "/namespaces/default/pods/web/log?follow=true&tailLines=2", nil)
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "first\nsecond\n" {
+		t.Errorf("unexpected plain logs %d %q", recorder.Code, recorder.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/namespaces/default/pods/web/log", nil)
+	req.Header.Set("Accept", eventStream)
+	recorder = httptest.NewRecorder()
+	engine.ServeHTTP(recorder, req)
+	expected := "event:message\ndata:first\n\nevent:message\ndata:second\n\nevent:end\ndata:\n\n"
+	if recorder.Body.String() != expected {
+		t.Errorf("unexpected events %q", recorder.Body.String())
+	}
+}
+
+func TestExec(t *testing.T) {
+	podService := &fakePodService{sizes: make(chan remotecommand.TerminalSize, 1)}
+	server := httptest.NewServer(newPodEngine(podService))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/namespaces/default/pods/web/exec?container=app"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err = conn.WriteJSON(types.TerminalMessage{Type: resizeMessage, Cols: 120, Rows: 40}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case size := <-podService.sizes:
+		if size.Width != 120 || size.Height != 40 {
+			t.Errorf("unexpected terminal size %v", size)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the terminal isn't resized")
+	}
+	if err = conn.WriteJSON(types.TerminalMessage{Type: stdinMessage, Data: "ls\n"}); err != nil {
+		t.Fatal(err)
+	}
+
+	messageType, data, err := conn.ReadMessage()
+	if err != nil || messageType != websocket.BinaryMessage || string(data) != "LS\n" {
+		t.Fatalf("unexpected output %d %q %v", messageType, data, err)
+	}
+	var exit types.TerminalMessage
+	if err = conn.ReadJSON(&exit); err != nil || exit.Type != exitMessage || exit.Data != "" {
+		t.Errorf("unexpected exit message %v %v", exit, err)
+	}
+	if podService.options.Container != "app" || !podService.options.TTY ||
+		strings.Join(podService.options.Command, " ") != constants.DefaultShell {
+		t.Errorf("unexpected exec options %v", podService.options)
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://kubeall.example.com/api/v1/exec", nil)
+	allowed := []string{"https://console.example.com"}
+	tests := map[string]bool{
+		"":                             true,
+		"http://kubeall.example.com":   true,
+		"https://console.example.com":  true,
+		"https://evil.example.com":     false,
+		"https://console.example.com.": false,
+	}
+	for origin, expected := range tests {
+		req.Header.Set("Origin", origin)
+		if checkOrigin(req, allowed) != expected {
+			t.Errorf("expected origin %q to be %v", origin, expected)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package pod
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"k8s.io/client-go/tools/remotecommand"
+	"kubeall.io/api-server/pkg/types"
+	"sync"
+	"time"
+)
+
+const (
+	stdinMessage  = "stdin"
+	resizeMessage = "resize"
+	exitMessage   = "exit"
+
+	// the connections idle longer than pongWait are closed, the pings keep the ones of the idle terminals alive
+	pongWait     = 60 * time.Second
+	pingPeriod   = pongWait * 9 / 10
+	writeTimeout = 10 * time.Second
+)
+
+// terminalSession bridges the websocket of the console and the streams of the command, the input and the resizes are
+// read from the text messages, and the output is written as the binary messages
+type terminalSession struct {
+	conn   *websocket.Conn
+	cancel context.CancelFunc
+	sizes  chan remotecommand.TerminalSize
+	done   chan struct{}
+	// pending the input read but not consumed by the command yet
+	pending []byte
+
+	writeLock sync.Mutex
+	closeOnce sync.Once
+}
+
+func newTerminalSession(conn *websocket.Conn, cancel context.CancelFunc) *terminalSession {
+	t := &terminalSession{
+		conn:   conn,
+		cancel: cancel,
+		sizes:  make(chan remotecommand.TerminalSize, 1),
+		done:   make(chan struct{}),
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	go t.ping()
+	return t
+}
+
+// Read returns the input of the console, the command is canceled once the websocket is closed
+func (t *terminalSession) Read(p []byte) (int, error) {
+	for len(t.pending) == 0 {
+		_, data, err := t.conn.ReadMessage()
+		if err != nil {
+			t.cancel()
+			return 0, err
+		}
+		_ = t.conn.SetReadDeadline(time.Now().Add(pongWait))
+		var message types.TerminalMessage
+		if err = json.Unmarshal(data, &message); err != nil {
+			continue
+		}
+		switch message.Type {
+		case stdinMessage:
+			t.pending = []byte(message.Data)
+		case resizeMessage:
+			// only the latest size matters
+			select {
+			case <-t.sizes:
+			default:
+			}
+			t.sizes <- remotecommand.TerminalSize{Width: message.Cols, Height: message.Rows}
+		}
+	}
+	n := copy(p, t.pending)
+	t.pending = t.pending[n:]
+	return n, nil
+}
+
+// Write sends the output of the command, the stdout and the stderr are written concurrently without a tty
+func (t *terminalSession) Write(p []byte) (int, error) {
+	t.writeLock.Lock()
+	defer t.writeLock.Unlock()
+	_ = t.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err := t.conn.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Next returns the size of the terminal resized by the console, nil is returned once the session is closed
+func (t *terminalSession) Next() *remotecommand.TerminalSize {
+	select {
+	case size := <-t.sizes:
+		return &size
+	case <-t.done:
+		return nil
+	}
+}
+
+// Close sends the exit message with the error of the command, and closes the websocket
+func (t *terminalSession) Close(err error) {
+	t.closeOnce.Do(func() {
+		close(t.done)
+		message := types.TerminalMessage{Type: exitMessage}
+		if err != nil {
+			message.Data = err.Error()
+		}
+		t.writeLock.Lock()
+		defer t.writeLock.Unlock()
+		_ = t.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		_ = t.conn.WriteJSON(message)
+		_ = t.conn.WriteMessage(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		_ = t.conn.Close()
+	})
+}
+
+func (t *terminalSession) ping() {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+			// the control messages can be written concurrently with the others
+			if err := t.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				t.cancel()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package project
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	basehandler "kubeall.io/api-server/pkg/handler/base"
+	"kubeall.io/api-server/pkg/handler/route"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/logger"
+	"kubeall.io/api-server/pkg/infra/validator_resource"
+	"kubeall.io/api-server/pkg/service"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+)
+
+// ProjectHandler serves the projects visible to the caller, they're created, updated and deleted by the generic
+// routes of the cluster resources
+type ProjectHandler interface {
+	route.Route
+	List(ctx *gin.Context)
+	Get(ctx *gin.Context)
+	GetUsage(ctx *gin.Context)
+}
+
+type projectHandlerImpl struct {
+	projectService service.ProjectService
+	translator     validator_resource.ValidatorTranslator
+}
+
+func NewProjectHandler(projectService service.ProjectService, translator validator_resource.ValidatorTranslator) ProjectHandler {
+	return &projectHandlerImpl{projectService, translator}
+}
+
+// List returns the projects which the caller is a member of
+func (p projectHandlerImpl) List(ctx *gin.Context) {
+	projects, err := p.projectService.List(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to list projects", zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	ctx.JSON(http.StatusOK, projects)
+}
+
+// Get is registered since the static routes of projects take precedence over the generic ones
+func (p projectHandlerImpl) Get(ctx *gin.Context) {
+	if err := basehandler.CheckName(ctx, p.translator); err != nil {
+		return
+	}
+	project, err := p.projectService.Get(ctx, ctx.Param("name"))
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to get project", zap.String("name", ctx.Param("name")), zap.Error(err))
+		basehandler.AbortRequest(ctx, err, 0)
+		return
+	}
+	ctx.JSON(http.StatusOK, project)
+}
+
+// GetUsage returns the quota of the project and the resources used in its namespaces
+func (p projectHandlerImpl) GetUsage(ctx *gin.Context) {
+	if err := basehandler.CheckName(ctx, p.translator); err != nil {
+		return
+	}
+	usage, err := p.projectService.Usage(ctx, ctx.Param("name"))
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to get usage of project", zap.String("name", ctx.Param("name")), zap.Error(err))
+		basehandler.AbortRequest(ctx, err, 0)
+		return
+	}
+	ctx.JSON(http.StatusOK, usage)
+}
+
+func (p projectHandlerImpl) RegisterRoutes(_ *gin.RouterGroup, _ *gin.RouterGroup, clusterGroup *gin.RouterGroup) {
+	clusterGroup.GET(constants.ResourceProjectUri, p.List)
+	clusterGroup.GET(constants.ResourceProjectNameUri, p.Get)
+	clusterGroup.GET(constants.ResourceProjectUsageUri, p.GetUsage)
+}
@@ -2,9 +2,20 @@ package handler
 
 import (
 	"go.uber.org/fx"
+	"kubeall.io/api-server/pkg/handler/audit"
 	basehandler "kubeall.io/api-server/pkg/handler/base"
+	"kubeall.io/api-server/pkg/handler/cluster"
+	"kubeall.io/api-server/pkg/handler/event"
 	"kubeall.io/api-server/pkg/handler/image"
+	"kubeall.io/api-server/pkg/handler/logging"
+	"kubeall.io/api-server/pkg/handler/longhorn"
+	"kubeall.io/api-server/pkg/handler/node"
+	"kubeall.io/api-server/pkg/handler/openapi"
+	"kubeall.io/api-server/pkg/handler/pod"
+	"kubeall.io/api-server/pkg/handler/project"
+	"kubeall.io/api-server/pkg/handler/related"
 	"kubeall.io/api-server/pkg/handler/route"
+	"kubeall.io/api-server/pkg/handler/settings"
 	"kubeall.io/api-server/pkg/handler/vm"
 )
 
@@ -13,6 +24,17 @@ var Module = fx.Module("md_handler",
 		route.AsRoute(basehandler.NewBaseHandler),
 		route.AsRoute(image.NewImageHandler),
 		route.AsRoute(vm.NewVmHandler),
+		route.AsRoute(node.NewNodeHandler),
+		route.AsRoute(longhorn.NewLonghornHandler),
+		route.AsRoute(settings.NewSettingsHandler),
+		route.AsRoute(audit.NewAuditHandler),
+		route.AsRoute(cluster.NewClusterHandler),
+		route.AsRoute(project.NewProjectHandler),
+		route.AsRoute(openapi.NewOpenApiHandler),
+		route.AsRoute(logging.NewLoggingHandler),
+		route.AsRoute(pod.NewPodHandler),
+		route.AsRoute(event.NewEventHandler),
+		route.AsRoute(related.NewRelatedHandler),
 
 		// Register routes to the route manager
 		//进行注解，表明接收包含“routes”组内容的切片
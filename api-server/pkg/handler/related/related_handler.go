@@ -0,0 +1,73 @@
+package related
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	basehandler "kubeall.io/api-server/pkg/handler/base"
+	"kubeall.io/api-server/pkg/handler/route"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/logger"
+	"kubeall.io/api-server/pkg/infra/validator_resource"
+	"kubeall.io/api-server/pkg/service"
+	baseservice "kubeall.io/api-server/pkg/service/base"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+)
+
+// RelatedHandler responds the topology of a resource for the console
+type RelatedHandler interface {
+	route.Route
+	Graph(ctx *gin.Context)
+}
+
+type relatedHandlerImpl struct {
+	gvkResource    *constants.GvkResource
+	baseService    baseservice.BaseService
+	relatedService service.RelatedService
+	translator     validator_resource.ValidatorTranslator
+}
+
+func NewRelatedHandler(gvkResource *constants.GvkResource, baseService baseservice.BaseService,
+	relatedService service.RelatedService, translator validator_resource.ValidatorTranslator) RelatedHandler {
+	return &relatedHandlerImpl{
+		gvkResource:    gvkResource,
+		baseService:    baseService,
+		relatedService: relatedService,
+		translator:     translator,
+	}
+}
+
+func (r relatedHandlerImpl) Graph(ctx *gin.Context) {
+	gvk, resourceType, err := basehandler.CheckResourceType(ctx, r.gvkResource)
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to resolve the related resources", zap.Error(err))
+		return
+	}
+	name := ctx.Param("name")
+	if err = basehandler.CheckName(ctx, r.translator); err != nil {
+		logger.FromContext(ctx).Warn("failed to resolve the related resources", zap.Error(err),
+			zap.String("name", name))
+		return
+	}
+	obj, err := r.baseService.Get(ctx, *gvk, resourceType, name)
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to get resource", zap.String("resource", gvk.Kind),
+			zap.String("name", name), zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	graph, err := r.relatedService.Graph(ctx, *gvk, obj)
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to resolve the related resources", zap.String("resource", gvk.Kind),
+			zap.String("name", name), zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	ctx.JSON(http.StatusOK, graph)
+}
+
+func (r relatedHandlerImpl) RegisterRoutes(_ *gin.RouterGroup, namespaceGroup *gin.RouterGroup,
+	clusterGroup *gin.RouterGroup) {
+	namespaceGroup.GET(constants.ResourceRelatedUri, r.Graph)
+	clusterGroup.GET(constants.ResourceRelatedUri, r.Graph)
+}
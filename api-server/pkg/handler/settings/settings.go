@@ -0,0 +1,79 @@
+package settings
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	kav1 "kubeall.io/api-server/pkg/generated/kubeall.io/v1"
+	basehandler "kubeall.io/api-server/pkg/handler/base"
+	"kubeall.io/api-server/pkg/handler/route"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/logger"
+	"kubeall.io/api-server/pkg/service"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+)
+
+type SettingsHandler interface {
+	route.Route
+	Get(ctx *gin.Context)
+	Update(ctx *gin.Context)
+}
+
+type settingsHandlerImpl struct {
+	settingsService service.SettingsService
+	projectService  service.ProjectService
+}
+
+func NewSettingsHandler(settingsService service.SettingsService, projectService service.ProjectService) SettingsHandler {
+	return &settingsHandlerImpl{settingsService: settingsService, projectService: projectService}
+}
+
+// Get returns the global settings, the missing fields are filled with the defaults
+func (s settingsHandlerImpl) Get(ctx *gin.Context) {
+	settings, err := s.settingsService.Get(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to get the global settings", zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	ctx.JSON(http.StatusOK, settings)
+}
+
+// Update replaces the global settings with the spec in the body. Only the cluster admins and the project owners are
+// allowed to change the settings.
+func (s settingsHandlerImpl) Update(ctx *gin.Context) {
+	user := s.projectService.User(ctx)
+	admin, err := s.projectService.IsAdmin(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to check the admin", zap.String("user", user), zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	if !admin {
+		logger.FromContext(ctx).Warn("the user isn't allowed to change the global settings", zap.String("user", user))
+		result := types.FailWithErrorCode(ctx, constants.CodeSettingsForbidden, map[string]string{"user": user})
+		result.StatusCode = http.StatusForbidden
+		basehandler.AbortRequest(ctx, result, 0)
+		return
+	}
+
+	var spec kav1.GlobalSettingsSpec
+	if err := ctx.ShouldBindJSON(&spec); err != nil {
+		logger.FromContext(ctx).Warn("failed to unmarshall the global settings", zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), http.StatusBadRequest)
+		return
+	}
+	settings, err := s.settingsService.Update(ctx, &spec)
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to update the global settings", zap.Error(err))
+		basehandler.AbortRequest(ctx, types.Fail(err), 0)
+		return
+	}
+	logger.FromContext(ctx).Info("the global settings are updated by the user", zap.String("user", user))
+	ctx.JSON(http.StatusOK, settings)
+}
+
+func (s settingsHandlerImpl) RegisterRoutes(_ *gin.RouterGroup, _ *gin.RouterGroup, clusterGroup *gin.RouterGroup) {
+	clusterGroup.GET(constants.ResourceSettingsUri, s.Get)
+	clusterGroup.PUT(constants.ResourceSettingsUri, s.Update)
+}
@@ -0,0 +1,84 @@
+package settings
+
+import (
+	"context"
+	"encoding/json"
+	ginI18n "github.com/gin-contrib/i18n"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
+	kav1 "kubeall.io/api-server/pkg/generated/kubeall.io/v1"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/service"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeProjectService treats the users in admins as the admins
+type fakeProjectService struct {
+	service.ProjectService
+	admins map[string]bool
+}
+
+func (f fakeProjectService) IsAdmin(ctx context.Context) (bool, error) {
+	return f.admins[f.User(ctx)], nil
+}
+
+func (f fakeProjectService) User(ctx context.Context) string {
+	return ctx.Value(gin.ContextKey).(*gin.Context).GetHeader(constants.DefaultUserHeader)
+}
+
+// fakeSettingsService keeps the settings in memory
+type fakeSettingsService struct {
+	spec *kav1.GlobalSettingsSpec
+}
+
+func (f *fakeSettingsService) Get(context.Context) (*kav1.GlobalSettingsSpec, error) {
+	return f.spec, nil
+}
+
+func (f *fakeSettingsService) Update(_ context.Context, spec *kav1.GlobalSettingsSpec) (*kav1.GlobalSettingsSpec, error) {
+	f.spec = spec
+	return spec, nil
+}
+
+func TestUpdate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(ginI18n.Localize(ginI18n.WithBundle(&ginI18n.BundleCfg{
+		DefaultLanguage:  language.English,
+		FormatBundleFile: constants.ResourceBundleFormat,
+		AcceptLanguage:   []language.Tag{language.English},
+		RootPath:         "../../../cmd/server/resources/locales",
+		UnmarshalFunc:    json.Unmarshal,
+	})))
+	settingsService := &fakeSettingsService{spec: &kav1.GlobalSettingsSpec{OsTypes: []string{"Ubuntu"}}}
+	NewSettingsHandler(settingsService, fakeProjectService{admins: map[string]bool{"admin": true}}).
+		RegisterRoutes(nil, nil, engine.Group(constants.RootUri))
+
+	for _, user := range []string{"alice", "admin"} {
+		req := httptest.NewRequest(http.MethodGet, constants.RootUri+constants.ResourceSettingsUri, nil)
+		req.Header.Set(constants.DefaultUserHeader, user)
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, req)
+		if recorder.Code != http.StatusOK {
+			t.Errorf("expected the settings readable by %s, got %d %s", user, recorder.Code, recorder.Body.String())
+		}
+	}
+
+	for user, code := range map[string]int{"alice": http.StatusForbidden, "admin": http.StatusOK} {
+		req := httptest.NewRequest(http.MethodPut, constants.RootUri+constants.ResourceSettingsUri,
+			strings.NewReader(`{"osTypes":["Windows"],"longhornUploadUrl":"http://`+user+`.example.com"}`))
+		req.Header.Set(constants.DefaultUserHeader, user)
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, req)
+		if recorder.Code != code || (code == http.StatusForbidden &&
+			!strings.Contains(recorder.Body.String(), "The user alice isn't allowed to change the global settings")) {
+			t.Errorf("expected %d for %s, got %d %s", code, user, recorder.Code, recorder.Body.String())
+		}
+	}
+	if settingsService.spec.LonghornUploadUrl != "http://admin.example.com" {
+		t.Errorf("expected the settings changed by the admin only, got %+v", settingsService.spec)
+	}
+}
@@ -2,6 +2,7 @@ package validators
 
 import (
 	"encoding/json"
+	ginI18n "github.com/gin-contrib/i18n"
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
 	ut "github.com/go-playground/universal-translator"
@@ -13,10 +14,12 @@ import (
 	"slices"
 )
 
-// GetTranslator retrieves the Chinese translator from the provided ValidatorTranslator.
+// GetTranslator retrieves the translator of the request's language, it falls back to its base language and then to
+// the default language.
 func GetTranslator(ctx *gin.Context, translator validator_resource.ValidatorTranslator) ut.Translator {
-	//TODO: choose correct language
-	return translator.Zh()
+	current := ginI18n.GetCurrentLanguage(ctx)
+	base, _ := current.Base()
+	return translator.Find(current.String(), base.String(), ginI18n.GetDefaultLanguage(ctx).String())
 }
 
 func GetValidate() *validator.Validate {
@@ -43,16 +46,16 @@ func ValidateResourceType(ctx *gin.Context, gvkResource *constants.GvkResource)
 	return gvkRes, resourceType, nil
 }
 
+// ValidateListParams validates the page and the page size, which must be one of the page sizes
 func ValidateListParams(ctx *gin.Context, translator validator_resource.ValidatorTranslator,
-	query types.Query) error {
+	query types.Query, pageSizes []int) error {
 	result := ValidateParam(ctx, constants.PageQueryField, query.Pagination.Page, translator)
 	if result != nil {
 		return result
 	}
 
-	result = ValidateParam(ctx, constants.PageSizeQueryField, query.Pagination.PageSize, translator)
-	if result != nil {
-		return result
+	if !slices.Contains(pageSizes, int(query.Pagination.PageSize)) {
+		return types.FailWithErrorCode(ctx, constants.CodeInvalidParam, map[string]string{"name": "pageSize"})
 	}
 
 	return nil
@@ -0,0 +1,360 @@
+package apiserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/types"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrClusterNotFound    = errors.New("cluster not found")
+	ErrClusterUnavailable = errors.New("cluster unavailable")
+	// ErrClusterReadOnly the local cluster and the clusters in the config file can't be changed by the api
+	ErrClusterReadOnly = errors.New("cluster is read only")
+)
+
+// ClusterRegistry manages the local cluster and the member clusters, the clients and cache of a member cluster are
+// created at the first time it's used
+type ClusterRegistry interface {
+	Get(ctx context.Context, name string) (ClusterResource, error)
+	List(ctx context.Context, withHealth bool) ([]types.ClusterInfo, error)
+	Info(ctx context.Context, name string) (*types.ClusterInfo, error)
+	// Add stores the kubeconfig of the cluster in a secret, the cluster is reconnected if it exists
+	Add(ctx context.Context, req *types.ClusterRequest) error
+	Remove(ctx context.Context, name string) error
+}
+
+type clusterRegistryImpl struct {
+	config         *types.ServerConfig
+	local          ClusterResource
+	schemeType     types.SchemeType
+	namespace      string
+	configClusters map[string]string
+
+	// cacheSyncTimeout the member clusters whose informers aren't synced in the duration are evicted
+	cacheSyncTimeout time.Duration
+
+	lock       sync.Mutex
+	clusters   map[string]*clusterResourceImpl
+	connecting singleflight.Group
+}
+
+func NewClusterRegistry(config types.Config, local ClusterResource, schemeType types.SchemeType,
+	lifecycle fx.Lifecycle) ClusterRegistry {
+	cfg := config.(*types.ServerConfig)
+	r := &clusterRegistryImpl{
+		config:           cfg,
+		local:            local,
+		schemeType:       schemeType,
+		namespace:        constants.DefaultClusterNamespace,
+		configClusters:   map[string]string{},
+		cacheSyncTimeout: constants.DefaultCacheSyncTimeout,
+		clusters:         map[string]*clusterResourceImpl{},
+	}
+	if cfg.Http != nil && cfg.Http.CacheSyncTimeout > 0 {
+		r.cacheSyncTimeout = cfg.Http.CacheSyncTimeout
+	}
+	if cfg.MultiCluster != nil {
+		if cfg.MultiCluster.SecretNamespace != "" {
+			r.namespace = cfg.MultiCluster.SecretNamespace
+		}
+		for _, c := range cfg.MultiCluster.Clusters {
+			r.configClusters[c.Name] = c.KubeConfig
+		}
+	}
+	lifecycle.Append(fx.Hook{
+		OnStop: func(context.Context) error {
+			r.disconnectAll()
+			return nil
+		},
+	})
+	return r
+}
+
+// Get returns the connected cluster, or connects it. The clusters are connected apart from the lock, so that a slow
+// cluster doesn't block the others, and the concurrent requests of a cluster share the same connection. The
+// connection isn't bound to the request starting it, a cancelled request only stops waiting for it.
+func (r *clusterRegistryImpl) Get(ctx context.Context, name string) (ClusterResource, error) {
+	if name == constants.LocalClusterName {
+		return r.local, nil
+	}
+	if cls := r.connected(name); cls != nil {
+		return cls, nil
+	}
+	connecting := r.connecting.DoChan(name, func() (any, error) {
+		if cls := r.connected(name); cls != nil {
+			return cls, nil
+		}
+		connectCtx, cancel := context.WithTimeout(context.Background(), constants.ClusterConnectTimeout)
+		defer cancel()
+		return r.connect(connectCtx, name)
+	})
+	select {
+	case result := <-connecting:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		return result.Val.(ClusterResource), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (r *clusterRegistryImpl) connected(name string) *clusterResourceImpl {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.clusters[name]
+}
+
+// connect creates the clients and the cache of the cluster, the cluster is evicted if its cache fails to start or sync
+func (r *clusterRegistryImpl) connect(ctx context.Context, name string) (*clusterResourceImpl, error) {
+	restConfig, err := r.loadRestConfig(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	cls, err := newClusterResourceForConfig(r.config, restConfig, r.schemeType)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrClusterUnavailable, err.Error())
+	}
+	cls.start(func(err error) {
+		r.evict(name, cls, err)
+	})
+	go func() {
+		syncCtx, cancel := context.WithTimeout(context.Background(), r.cacheSyncTimeout)
+		defer cancel()
+		if !cls.ClusterCache().WaitForCacheSync(syncCtx) {
+			r.evict(name, cls, errors.New("the informers aren't synced"))
+		}
+	}()
+
+	r.lock.Lock()
+	r.clusters[name] = cls
+	r.lock.Unlock()
+	zap.L().Info("member cluster is connected", zap.String("cluster", name), zap.String("host", restConfig.Host))
+	return cls, nil
+}
+
+// evict stops and forgets the cluster if it's still the connected one, it's reconnected at the next time it's used
+func (r *clusterRegistryImpl) evict(name string, cls *clusterResourceImpl, reason error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.clusters[name] != cls {
+		return
+	}
+	cls.stop()
+	delete(r.clusters, name)
+	zap.L().Warn("member cluster is evicted", zap.String("cluster", name), zap.Error(reason))
+}
+
+func (r *clusterRegistryImpl) List(ctx context.Context, withHealth bool) ([]types.ClusterInfo, error) {
+	sources := map[string]types.ClusterSource{constants.LocalClusterName: types.ClusterSourceLocal}
+	for name := range r.configClusters {
+		sources[name] = types.ClusterSourceConfig
+	}
+	secrets, err := r.local.Client().K8sClient().CoreV1().Secrets(r.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: constants.LabelClusterKubeConfig,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, secret := range secrets.Items {
+		if name := secret.Labels[constants.LabelClusterKubeConfig]; name != "" {
+			if _, ok := sources[name]; !ok {
+				sources[name] = types.ClusterSourceSecret
+			}
+		}
+	}
+
+	clusters := make([]types.ClusterInfo, 0, len(sources))
+	for name, source := range sources {
+		info := types.ClusterInfo{Name: name, Source: source}
+		if withHealth {
+			info.Health = r.health(ctx, name)
+		}
+		info.Connected = r.isConnected(name)
+		clusters = append(clusters, info)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i].Name < clusters[j].Name
+	})
+	return clusters, nil
+}
+
+func (r *clusterRegistryImpl) Info(ctx context.Context, name string) (*types.ClusterInfo, error) {
+	source, err := r.sourceOf(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	health := r.health(ctx, name)
+	return &types.ClusterInfo{Name: name, Source: source, Connected: r.isConnected(name), Health: health}, nil
+}
+
+func (r *clusterRegistryImpl) Add(ctx context.Context, req *types.ClusterRequest) error {
+	if err := r.checkWritable(req.Name); err != nil {
+		return err
+	}
+	if _, err := clientcmd.RESTConfigFromKubeConfig([]byte(req.KubeConfig)); err != nil {
+		return fmt.Errorf("invalid kubeconfig: %w", err)
+	}
+
+	secrets := r.local.Client().K8sClient().CoreV1().Secrets(r.namespace)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      constants.ClusterSecretPrefix + req.Name,
+			Namespace: r.namespace,
+			Labels:    map[string]string{constants.LabelClusterKubeConfig: req.Name},
+		},
+		Data: map[string][]byte{constants.ClusterKubeConfigKey: []byte(req.KubeConfig)},
+	}
+	existing, err := secrets.Get(ctx, secret.Name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		_, err = secrets.Create(ctx, secret, metav1.CreateOptions{})
+	} else if err == nil {
+		existing.Labels = secret.Labels
+		existing.Data = secret.Data
+		_, err = secrets.Update(ctx, existing, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return err
+	}
+
+	// reconnect with the new kubeconfig at the next time it's used
+	r.disconnect(req.Name)
+	zap.L().Info("member cluster is added", zap.String("cluster", req.Name))
+	return nil
+}
+
+func (r *clusterRegistryImpl) Remove(ctx context.Context, name string) error {
+	if err := r.checkWritable(name); err != nil {
+		return err
+	}
+	err := r.local.Client().K8sClient().CoreV1().Secrets(r.namespace).
+		Delete(ctx, constants.ClusterSecretPrefix+name, metav1.DeleteOptions{})
+	if k8serrors.IsNotFound(err) {
+		return fmt.Errorf("%w: %s", ErrClusterNotFound, name)
+	}
+	if err != nil {
+		return err
+	}
+	r.disconnect(name)
+	zap.L().Info("member cluster is removed", zap.String("cluster", name))
+	return nil
+}
+
+func (r *clusterRegistryImpl) checkWritable(name string) error {
+	if _, ok := r.configClusters[name]; ok || name == constants.LocalClusterName {
+		return fmt.Errorf("%w: %s", ErrClusterReadOnly, name)
+	}
+	return nil
+}
+
+func (r *clusterRegistryImpl) isConnected(name string) bool {
+	if name == constants.LocalClusterName {
+		return true
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	_, ok := r.clusters[name]
+	return ok
+}
+
+// disconnect stops the cache of the cluster and forgets it
+func (r *clusterRegistryImpl) disconnect(name string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	// the connection in flight isn't shared with the requests after the cluster changes
+	r.connecting.Forget(name)
+	if cls, ok := r.clusters[name]; ok {
+		cls.stop()
+		delete(r.clusters, name)
+	}
+}
+
+// disconnectAll stops the caches of the member clusters while the app stops
+func (r *clusterRegistryImpl) disconnectAll() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for name, cls := range r.clusters {
+		cls.stop()
+		delete(r.clusters, name)
+	}
+}
+
+func (r *clusterRegistryImpl) sourceOf(ctx context.Context, name string) (types.ClusterSource, error) {
+	if name == constants.LocalClusterName {
+		return types.ClusterSourceLocal, nil
+	}
+	if _, ok := r.configClusters[name]; ok {
+		return types.ClusterSourceConfig, nil
+	}
+	if _, err := r.getSecret(ctx, name); err != nil {
+		return "", err
+	}
+	return types.ClusterSourceSecret, nil
+}
+
+// health checks the readiness of the cluster's api server, the clusters not connected are probed by a discovery
+// client, so that the checks don't connect them
+func (r *clusterRegistryImpl) health(ctx context.Context, name string) *types.ClusterHealth {
+	ctx, cancel := context.WithTimeout(ctx, constants.ClusterHealthCheckTimeout)
+	defer cancel()
+
+	var client discovery.DiscoveryInterface
+	if cls := r.connected(name); cls != nil {
+		client = cls.Client().K8sClient().Discovery()
+	} else if name == constants.LocalClusterName {
+		client = r.local.Client().K8sClient().Discovery()
+	} else {
+		restConfig, err := r.loadRestConfig(ctx, name)
+		if err != nil {
+			return &types.ClusterHealth{Message: err.Error()}
+		}
+		restConfig.Timeout = constants.ClusterHealthCheckTimeout
+		if client, err = discovery.NewDiscoveryClientForConfig(restConfig); err != nil {
+			return &types.ClusterHealth{Message: err.Error()}
+		}
+	}
+
+	if _, err := client.RESTClient().Get().AbsPath("/readyz").Do(ctx).Raw(); err != nil {
+		return &types.ClusterHealth{Message: err.Error()}
+	}
+	health := &types.ClusterHealth{Healthy: true}
+	if version, err := client.ServerVersion(); err == nil {
+		health.Version = version.GitVersion
+	}
+	return health
+}
+
+func (r *clusterRegistryImpl) loadRestConfig(ctx context.Context, name string) (*rest.Config, error) {
+	if kubeConfig, ok := r.configClusters[name]; ok {
+		return clientcmd.BuildConfigFromFlags("", kubeConfig)
+	}
+	secret, err := r.getSecret(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return clientcmd.RESTConfigFromKubeConfig(secret.Data[constants.ClusterKubeConfigKey])
+}
+
+func (r *clusterRegistryImpl) getSecret(ctx context.Context, name string) (*corev1.Secret, error) {
+	secret, err := r.local.Client().K8sClient().CoreV1().Secrets(r.namespace).
+		Get(ctx, constants.ClusterSecretPrefix+name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) || (err == nil && secret.Labels[constants.LabelClusterKubeConfig] != name) {
+		return nil, fmt.Errorf("%w: %s", ErrClusterNotFound, name)
+	}
+	return secret, err
+}
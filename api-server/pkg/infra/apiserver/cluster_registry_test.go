@@ -0,0 +1,230 @@
+package apiserver
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/fx/fxtest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"kubeall.io/api-server/pkg/infra/clients"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const secretsPath = "/api/v1/namespaces/" + constants.DefaultClusterNamespace + "/secrets"
+
+// fakeApiServer serves the probes and the secrets of the clusters, the secret of the slow cluster is served once
+// release is closed
+func fakeApiServer(t *testing.T, release chan struct{}) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/readyz":
+			_, _ = w.Write([]byte("ok"))
+		case "/version":
+			_, _ = w.Write([]byte(`{"gitVersion":"v1.33.1"}`))
+		// no resource is discovered, the indexes of the clusters are skipped
+		case "/api":
+			_, _ = w.Write([]byte(`{"kind":"APIVersions","versions":["v1"]}`))
+		case "/api/v1":
+			_, _ = w.Write([]byte(`{"kind":"APIResourceList","groupVersion":"v1","resources":[]}`))
+		case "/apis":
+			_, _ = w.Write([]byte(`{"kind":"APIGroupList","apiVersion":"v1","groups":[]}`))
+		case secretsPath:
+			_ = json.NewEncoder(w).Encode(corev1.SecretList{TypeMeta: metav1.TypeMeta{Kind: "SecretList", APIVersion: "v1"}})
+		case secretsPath + "/" + constants.ClusterSecretPrefix + "slow":
+			<-release
+			_ = json.NewEncoder(w).Encode(corev1.Secret{
+				TypeMeta: metav1.TypeMeta{Kind: "Secret", APIVersion: "v1"},
+				ObjectMeta: metav1.ObjectMeta{Name: constants.ClusterSecretPrefix + "slow",
+					Labels: map[string]string{constants.LabelClusterKubeConfig: "slow"}},
+				Data: map[string][]byte{constants.ClusterKubeConfigKey: []byte(kubeConfig(server.URL))},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func kubeConfig(server string) string {
+	return fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: member
+  cluster:
+    server: %s
+contexts:
+- name: member
+  context:
+    cluster: member
+current-context: member
+`, server)
+}
+
+func newTestRegistry(t *testing.T, server string) *clusterRegistryImpl {
+	file := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(file, []byte(kubeConfig(server)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	apiClient, err := clients.NewClientsForConfig(&rest.Config{Host: server})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &types.ServerConfig{MultiCluster: &types.MultiClusterConfig{
+		Clusters: []types.ClusterConfig{{Name: "member", KubeConfig: file}},
+	}}
+	lifecycle := fxtest.NewLifecycle(t)
+	registry := NewClusterRegistry(config, &clusterResourceImpl{client: apiClient}, types.ApiServerScheme, lifecycle)
+	t.Cleanup(lifecycle.RequireStop)
+	return registry.(*clusterRegistryImpl)
+}
+
+func TestClusterRegistryGet(t *testing.T) {
+	release := make(chan struct{})
+	server := fakeApiServer(t, release)
+	registry := newTestRegistry(t, server.URL)
+
+	// the slow cluster doesn't block the others
+	slowCtx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan error, 1)
+	go func() {
+		_, err := registry.Get(slowCtx, "slow")
+		cancelled <- err
+	}()
+	slow := make(chan error, 1)
+	go func() {
+		_, err := registry.Get(context.Background(), "slow")
+		slow <- err
+	}()
+	done := make(chan ClusterResource, 1)
+	go func() {
+		cls, err := registry.Get(context.Background(), "member")
+		if err != nil {
+			t.Error(err)
+		}
+		done <- cls
+	}()
+	var member ClusterResource
+	select {
+	case member = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the member cluster is blocked by the slow one")
+	}
+	// the request giving up doesn't fail the connection shared with the others
+	cancel()
+	if err := <-cancelled; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the cancelled request returned, got %v", err)
+	}
+	close(release)
+	if err := <-slow; err != nil {
+		t.Fatal(err)
+	}
+
+	if cls, _ := registry.Get(context.Background(), "member"); cls != member {
+		t.Error("expected the connected cluster to be reused")
+	}
+	if _, err := registry.Get(context.Background(), "unknown"); !errors.Is(err, ErrClusterNotFound) {
+		t.Errorf("expected the unknown cluster not found, got %v", err)
+	}
+
+	// the failed cluster is evicted and reconnected at the next time
+	registry.evict("member", member.(*clusterResourceImpl), errors.New("failed"))
+	if registry.isConnected("member") {
+		t.Fatal("expected the failed cluster to be evicted")
+	}
+	if cls, _ := registry.Get(context.Background(), "member"); cls == member {
+		t.Error("expected the evicted cluster to be reconnected")
+	}
+}
+
+func TestClusterRegistryHealth(t *testing.T) {
+	registry := newTestRegistry(t, fakeApiServer(t, nil).URL)
+
+	clusters, err := registry.List(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clusters) != 2 {
+		t.Fatalf("expected the local and the member clusters, got %v", clusters)
+	}
+	for _, cluster := range clusters {
+		if cluster.Health == nil || !cluster.Health.Healthy || cluster.Health.Version != "v1.33.1" {
+			t.Errorf("unexpected health of %s: %v", cluster.Name, cluster.Health)
+		}
+	}
+	// the health checks don't connect the clusters
+	if registry.isConnected("member") {
+		t.Error("expected the member cluster not connected by the health check")
+	}
+}
+
+func TestLegacyPaths(t *testing.T) {
+	registry := newTestRegistry(t, fakeApiServer(t, nil).URL)
+	gin.SetMode(gin.TestMode)
+	r := &restServerImpl{engine: gin.New(), registry: registry, gvkResource: constants.NewGvkResource()}
+	r.engine.Use(localize(&types.ServerConfig{I18n: &types.I18nConfig{
+		Languages: []string{"en"},
+		BundleDir: "../../../cmd/server/resources/locales",
+	}}, embed.FS{}))
+	r.rootGroup = r.engine.Group(constants.RootUri)
+	r.clusterGroup = r.engine.Group(constants.ClusterGroupUri, r.selectCluster)
+	r.namespaceGroup = r.clusterGroup.Group(constants.NamespaceNameUri)
+
+	route := func(ctx *gin.Context) {
+		cls := ClusterFrom(ctx, nil)
+		name := "member"
+		if cls == registry.local {
+			name = constants.LocalClusterName
+		}
+		ctx.String(http.StatusOK, name+" "+ctx.FullPath())
+	}
+	r.rootGroup.GET(constants.LoggersUri, func(ctx *gin.Context) { ctx.String(http.StatusOK, "root") })
+	r.clusterGroup.GET(constants.ResourceNodeNameUri, route)
+	r.clusterGroup.GET(constants.ResourceSettingsUri, route)
+	r.clusterGroup.GET(constants.ResourceUri, route)
+	r.namespaceGroup.GET(constants.ResourceNameUri, route)
+
+	tests := map[string]string{
+		"/api/v1/nodes/node1":                          "local /api/v1/clusters/:cluster/nodes/:name",
+		"/api/v1/settings":                             "local /api/v1/clusters/:cluster/settings",
+		"/api/v1/storageclasses":                       "local /api/v1/clusters/:cluster/:resource",
+		"/api/v1/namespaces/default/vms/vm1":           "local /api/v1/clusters/:cluster/namespaces/:namespace/:resource/:name",
+		"/api/v1/clusters/member/nodes/node1":          "member /api/v1/clusters/:cluster/nodes/:name",
+		"/api/v1/clusters/member/namespaces/ns/vms/vm": "member /api/v1/clusters/:cluster/namespaces/:namespace/:resource/:name",
+		"/api/v1/loggers":                              "root",
+		// the legacy cluster-scoped paths are told from the clusters by the resources
+		"/api/v1/clusters/globalsettings":     "local /api/v1/clusters/:cluster/:resource",
+		"/api/v1/clusters/settings":           "local /api/v1/clusters/:cluster/settings",
+		"/api/v1/clusters/nodes/node1":        "local /api/v1/clusters/:cluster/nodes/:name",
+		"/api/v1/clusters/member/settings":    "member /api/v1/clusters/:cluster/settings",
+		"/api/v1/clusters/local/clusterroles": "local /api/v1/clusters/:cluster/:resource",
+	}
+	for path, expected := range tests {
+		recorder := httptest.NewRecorder()
+		r.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		if recorder.Code != http.StatusOK || recorder.Body.String() != expected {
+			t.Errorf("%s: expected %q, got %d %q", path, expected, recorder.Code, recorder.Body.String())
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	r.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/clusters/unknown/nodes/node1", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("expected the unknown cluster not found, got %d", recorder.Code)
+	}
+}
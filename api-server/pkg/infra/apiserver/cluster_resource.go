@@ -2,10 +2,13 @@ package apiserver
 
 import (
 	"context"
+	"fmt"
+	"go.uber.org/fx"
 	"go.uber.org/zap"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/rest"
 	"kubeall.io/api-server/pkg/infra/clients"
+	"kubeall.io/api-server/pkg/infra/constants"
 	"kubeall.io/api-server/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -13,7 +16,6 @@ import (
 )
 
 type ClusterResource interface {
-	RestServer() RestServer
 	RestConfig() *rest.Config
 	ClusterCache() cache.Cache
 	Cluster() cluster.Cluster
@@ -24,29 +26,59 @@ type ClusterResource interface {
 
 type clusterResourceImpl struct {
 	config        *types.ServerConfig
-	restServer    RestServer
 	restConfig    *rest.Config
 	clusterCache  cache.Cache
 	cluster       cluster.Cluster
 	client        clients.ApiClient
 	runTimeClient client.Client
+	cancel        context.CancelFunc
 }
 
-// NewClusterResource creates and returns a new Server instance.
-func NewClusterResource(config types.Config, logger *zap.Logger,
-	restServer RestServer, apiClient clients.ApiClient, schemeType types.SchemeType) ClusterResource {
+// NewClusterResource creates the cluster resource of the local cluster, its informers are started and stopped with
+// the app
+func NewClusterResource(config types.Config, logger *zap.Logger, lifecycle fx.Lifecycle,
+	apiClient clients.ApiClient, schemeType types.SchemeType) (ClusterResource, error) {
 	cfg := config.(*types.ServerConfig)
 	cls := &clusterResourceImpl{
 		config:     cfg,
-		restServer: restServer,
 		restConfig: apiClient.RestConfig(),
 		client:     apiClient,
 	}
-	if err := cls.initCluster(context.Background(), schemeType); err != nil {
+	if err := cls.initCluster(schemeType); err != nil {
 		zap.L().Error("failed to initialize cluster", zap.Error(err))
-		panic(err)
+		return nil, err
 	}
-	return cls
+	lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			cls.start(nil)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			cls.stop()
+			zap.L().Info("informers are stopped")
+			return nil
+		},
+	})
+	return cls, nil
+}
+
+// newClusterResourceForConfig creates the clients and the cache of a member cluster, the cache is started by start()
+// and stopped by stop()
+func newClusterResourceForConfig(config *types.ServerConfig, restConfig *rest.Config,
+	schemeType types.SchemeType) (*clusterResourceImpl, error) {
+	apiClient, err := clients.NewClientsForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	cls := &clusterResourceImpl{
+		config:     config,
+		restConfig: restConfig,
+		client:     apiClient,
+	}
+	if err = cls.initCluster(schemeType); err != nil {
+		return nil, err
+	}
+	return cls, nil
 }
 
 // NewClusterResourceForCm the rest server is not required for controller mananger
@@ -63,16 +95,12 @@ func NewClusterResourceForCm(config types.Config, logger *zap.Logger,
 	return cls
 }
 
-// initCluster initializes the Kubernetes cluster client and starts the cluster.
-// It sets up the necessary schemes, creates a new cluster client, and starts
-// the cluster in a separate goroutine.
-//
-// Parameters:
-//   - ctx: A context.Context that can be used to cancel the cluster initialization.
+// initCluster initializes the Kubernetes cluster client.
+// It sets up the necessary schemes and creates a new cluster client, the cluster is started by start.
 //
 // Returns:
 //   - error: An error if cluster initialization fails, nil otherwise.
-func (s *clusterResourceImpl) initCluster(ctx context.Context, schemeType types.SchemeType) error {
+func (s *clusterResourceImpl) initCluster(schemeType types.SchemeType) error {
 	var sch *runtime.Scheme
 	if schemeType == types.ApiServerScheme {
 		sch = ServerScheme
@@ -81,7 +109,7 @@ func (s *clusterResourceImpl) initCluster(ctx context.Context, schemeType types.
 		sch = CmScheme
 	}
 	if sch == nil {
-		panic("")
+		return fmt.Errorf("unknown scheme type %s", schemeType)
 	}
 
 	zap.L().Info("current scheme initialized is " + string(schemeType))
@@ -91,20 +119,29 @@ func (s *clusterResourceImpl) initCluster(ctx context.Context, schemeType types.
 	if err != nil {
 		return err
 	}
+	if err = AddIndexes(context.Background(), c.GetFieldIndexer()); err != nil {
+		return err
+	}
 	s.cluster = c
 	s.clusterCache = c.GetCache()
 	s.runTimeClient = c.GetClient()
+	return nil
+}
 
-	ctx, cancel := context.WithCancel(ctx)
+// start runs the informers of the cluster in the background until stop is called, onFailure is called if they fail
+func (s *clusterResourceImpl) start(onFailure func(error)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
 	go func() {
 		zap.S().Info("starts a background job for informers")
-		err = s.cluster.Start(ctx)
-		if err != nil {
+		if err := s.cluster.Start(ctx); err != nil {
 			zap.L().Error("failed to start cluster", zap.Error(err))
 			cancel()
+			if onFailure != nil {
+				onFailure(err)
+			}
 		}
 	}()
-	return nil
 }
 
 // UpdateCluster update related resources by controller manager
@@ -114,9 +151,6 @@ func (s *clusterResourceImpl) UpdateCluster(cls cluster.Cluster) {
 	s.runTimeClient = cls.GetClient()
 }
 
-func (s *clusterResourceImpl) RestServer() RestServer {
-	return s.restServer
-}
 func (s *clusterResourceImpl) RestConfig() *rest.Config {
 	return s.restConfig
 }
@@ -133,3 +167,18 @@ func (s *clusterResourceImpl) Client() clients.ApiClient {
 func (s *clusterResourceImpl) RuntimeClient() client.Client {
 	return s.runTimeClient
 }
+
+// stop stops the informers of the cluster
+func (s *clusterResourceImpl) stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
+// ClusterFrom returns the cluster selected by the request, it's the fallback if no cluster is selected
+func ClusterFrom(ctx context.Context, fallback ClusterResource) ClusterResource {
+	if cls, ok := ctx.Value(constants.ClusterKey).(ClusterResource); ok {
+		return cls
+	}
+	return fallback
+}
@@ -0,0 +1,57 @@
+package apiserver
+
+import (
+	"github.com/gin-gonic/gin"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const allOrigins = "*"
+
+// cors allows the console hosted apart from the api server to call it, the preflight requests are answered before
+// they're limited or audited
+func cors(config *types.CorsConfig) gin.HandlerFunc {
+	methods := strings.Join(config.AllowedMethods, ", ")
+	headers := strings.Join(config.AllowedHeaders, ", ")
+	exposedHeaders := strings.Join(config.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(config.MaxAge.Seconds()))
+	anyOrigin := slices.Contains(config.AllowedOrigins, allOrigins)
+
+	return func(ctx *gin.Context) {
+		origin := ctx.GetHeader("Origin")
+		if origin == "" {
+			return
+		}
+		ctx.Writer.Header().Add("Vary", "Origin")
+		if !anyOrigin && !slices.ContainsFunc(config.AllowedOrigins, func(allowed string) bool {
+			return strings.EqualFold(allowed, origin)
+		}) {
+			// the browser blocks the response without the allowed origin
+			return
+		}
+
+		ctx.Header("Access-Control-Allow-Origin", origin)
+		if config.AllowCredentials {
+			ctx.Header("Access-Control-Allow-Credentials", "true")
+		}
+		if ctx.Request.Method != http.MethodOptions || ctx.GetHeader("Access-Control-Request-Method") == "" {
+			if exposedHeaders != "" {
+				ctx.Header("Access-Control-Expose-Headers", exposedHeaders)
+			}
+			return
+		}
+
+		// preflight
+		ctx.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+		ctx.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+		ctx.Header("Access-Control-Allow-Methods", methods)
+		ctx.Header("Access-Control-Allow-Headers", headers)
+		if config.MaxAge > 0 {
+			ctx.Header("Access-Control-Max-Age", maxAge)
+		}
+		ctx.AbortWithStatus(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,67 @@
+package apiserver
+
+import (
+	"github.com/gin-gonic/gin"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(cors(&types.CorsConfig{
+		AllowedOrigins:   []string{"https://console.example.com"},
+		AllowedMethods:   constants.DefaultCorsMethods,
+		AllowedHeaders:   constants.DefaultCorsHeaders,
+		ExposedHeaders:   constants.DefaultCorsExposedHeaders,
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}))
+	engine.GET("/vms", func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+
+	serve := func(method, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/vms", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", http.MethodDelete)
+		}
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	recorder := serve(http.MethodOptions, "https://console.example.com")
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("expected the preflight to be answered, got %d", recorder.Code)
+	}
+	if recorder.Header().Get("Access-Control-Allow-Origin") != "https://console.example.com" ||
+		recorder.Header().Get("Access-Control-Allow-Credentials") != "true" ||
+		recorder.Header().Get("Access-Control-Max-Age") != "600" ||
+		recorder.Header().Get("Access-Control-Allow-Methods") == "" {
+		t.Errorf("unexpected preflight headers %v", recorder.Header())
+	}
+
+	recorder = serve(http.MethodGet, "https://console.example.com")
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Access-Control-Allow-Origin") == "" ||
+		recorder.Header().Get("Access-Control-Expose-Headers") == "" {
+		t.Errorf("unexpected response %d %v", recorder.Code, recorder.Header())
+	}
+
+	recorder = serve(http.MethodOptions, "https://evil.example.com")
+	if recorder.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("expected the origin to be rejected, got %v", recorder.Header())
+	}
+
+	recorder = serve(http.MethodGet, "")
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Vary") != "" {
+		t.Errorf("expected the same-origin request to be passed as is, got %v", recorder.Header())
+	}
+}
@@ -0,0 +1,135 @@
+package apiserver
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	ginI18n "github.com/gin-contrib/i18n"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/text/language"
+	"io/fs"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/types"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// localize returns the i18n middleware, the language of a request is negotiated from the lang query param and the
+// Accept-Language header
+func localize(config *types.ServerConfig, localeFs embed.FS) gin.HandlerFunc {
+	languages := constants.DefaultLanguages
+	loader := &bundleLoader{fs: localeFs}
+	if cfg := config.I18n; cfg != nil {
+		if len(cfg.Languages) > 0 {
+			languages = cfg.Languages
+		}
+		loader.dir = cfg.BundleDir
+	}
+
+	tags := make([]language.Tag, 0, len(languages))
+	for _, lang := range languages {
+		tags = append(tags, language.Make(lang))
+	}
+	loader.defaultLanguage = tags[0]
+
+	return ginI18n.Localize(
+		ginI18n.WithBundle(&ginI18n.BundleCfg{
+			DefaultLanguage:  tags[0],
+			FormatBundleFile: constants.ResourceBundleFormat,
+			AcceptLanguage:   tags,
+			RootPath:         constants.ResourceRootDir,
+			UnmarshalFunc:    json.Unmarshal,
+			Loader:           loader,
+		}),
+		ginI18n.WithGetLngHandle(negotiateLanguage(tags)),
+	)
+}
+
+// negotiateLanguage matches the lang query param first and then the Accept-Language header against the languages,
+// the result is cached in the context since it's read for every message
+func negotiateLanguage(tags []language.Tag) ginI18n.GetLngHandler {
+	matcher := language.NewMatcher(tags)
+	return func(ctx *gin.Context, defaultLng string) string {
+		if ctx == nil || ctx.Request == nil {
+			return defaultLng
+		}
+		if lang := ctx.GetString(constants.LanguageKey); lang != "" {
+			return lang
+		}
+
+		var preferred []language.Tag
+		if lang := ctx.Query(constants.LangQueryField); lang != "" {
+			preferred, _, _ = language.ParseAcceptLanguage(lang)
+		}
+		accepted, _, _ := language.ParseAcceptLanguage(ctx.GetHeader("Accept-Language"))
+		preferred = append(preferred, accepted...)
+
+		lang := defaultLng
+		if _, index, confidence := matcher.Match(preferred...); confidence != language.No {
+			lang = tags[index].String()
+		}
+		ctx.Set(constants.LanguageKey, lang)
+		return lang
+	}
+}
+
+// bundleLoader loads the bundle of a language with the missing messages filled by its base language and then by the
+// default language, since the localizer of gin-i18n returns nothing while it falls back to the default language
+type bundleLoader struct {
+	fs              embed.FS
+	dir             string
+	defaultLanguage language.Tag
+}
+
+func (b *bundleLoader) LoadMessage(src string) ([]byte, error) {
+	ext := path.Ext(src)
+	tag := language.Make(path.Base(src)[:len(path.Base(src))-len(ext)])
+	messages, err := b.read(tag.String() + ext)
+	if err != nil {
+		return nil, err
+	}
+
+	base, _ := tag.Base()
+	for _, fallback := range []string{base.String(), b.defaultLanguage.String()} {
+		if fallback == tag.String() {
+			continue
+		}
+		fallbackMessages, err := b.read(fallback + ext)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for id, message := range fallbackMessages {
+			if _, ok := messages[id]; !ok {
+				messages[id] = message
+			}
+		}
+	}
+	return json.Marshal(messages)
+}
+
+// read reads the bundle from the bundle dir if it exists there, otherwise from the embedded locales
+func (b *bundleLoader) read(name string) (map[string]any, error) {
+	var data []byte
+	var err error
+	if b.dir != "" {
+		data, err = os.ReadFile(filepath.Join(b.dir, name))
+	}
+	if b.dir == "" || errors.Is(err, fs.ErrNotExist) {
+		data, err = b.fs.ReadFile(path.Join(constants.ResourceRootDir, name))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	messages := map[string]any{}
+	if err = json.Unmarshal(data, &messages); err != nil {
+		zap.L().Warn("invalid bundle", zap.String("name", name), zap.Error(err))
+		return nil, err
+	}
+	return messages, nil
+}
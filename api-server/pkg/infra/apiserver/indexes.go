@@ -0,0 +1,76 @@
+package apiserver
+
+import (
+	"context"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	lhv1beta2 "kubeall.io/api-server/pkg/generated/longhorn/apis/longhorn/v1beta2"
+	kv1 "kubevirt.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// IndexPvcStorageClass indexes the pvcs by their storage class
+	IndexPvcStorageClass = "spec.storageClassName"
+	// IndexVolumeBackingImage indexes the longhorn volumes by their backing image
+	IndexVolumeBackingImage = "spec.backingImage"
+	// IndexVmClaimName indexes the vms by the pvcs and the data volumes in their volumes
+	IndexVmClaimName = "spec.template.spec.volumes.claimName"
+)
+
+// Index is a field index of the informers, the objects are listed by client.MatchingFields with the field
+type Index struct {
+	Object  client.Object
+	Field   string
+	Extract client.IndexerFunc
+}
+
+// Indexes are the field indexes of the clusters, so that the images' usage is found without scanning all the
+// pvcs, volumes and vms
+var Indexes = []Index{
+	{Object: &corev1.PersistentVolumeClaim{}, Field: IndexPvcStorageClass, Extract: func(obj client.Object) []string {
+		if storageClass := obj.(*corev1.PersistentVolumeClaim).Spec.StorageClassName; storageClass != nil {
+			return []string{*storageClass}
+		}
+		return nil
+	}},
+	{Object: &lhv1beta2.Volume{}, Field: IndexVolumeBackingImage, Extract: func(obj client.Object) []string {
+		if backingImage := obj.(*lhv1beta2.Volume).Spec.BackingImage; backingImage != "" {
+			return []string{backingImage}
+		}
+		return nil
+	}},
+	{Object: &kv1.VirtualMachine{}, Field: IndexVmClaimName, Extract: func(obj client.Object) []string {
+		vm := obj.(*kv1.VirtualMachine)
+		if vm.Spec.Template == nil {
+			return nil
+		}
+		var claimNames []string
+		for _, volume := range vm.Spec.Template.Spec.Volumes {
+			switch {
+			case volume.PersistentVolumeClaim != nil:
+				claimNames = append(claimNames, volume.PersistentVolumeClaim.ClaimName)
+			case volume.DataVolume != nil:
+				claimNames = append(claimNames, volume.DataVolume.Name)
+			}
+		}
+		return claimNames
+	}},
+}
+
+// AddIndexes registers the indexes to the informers before they're started, the ones of the CRDs not installed
+// are skipped
+func AddIndexes(ctx context.Context, indexer client.FieldIndexer) error {
+	for _, index := range Indexes {
+		if err := indexer.IndexField(ctx, index.Object, index.Field, index.Extract); err != nil {
+			if meta.IsNoMatchError(err) {
+				zap.L().Warn("the index is skipped, the resource isn't installed", zap.String("field", index.Field),
+					zap.Error(err))
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
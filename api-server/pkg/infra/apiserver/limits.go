@@ -0,0 +1,175 @@
+package apiserver
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"kubeall.io/api-server/pkg/infra/certs"
+	"kubeall.io/api-server/pkg/infra/config"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/logger"
+	"kubeall.io/api-server/pkg/types"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// limiterIdleTimeout the limiters of the clients idle for the duration are dropped
+	limiterIdleTimeout = 10 * time.Minute
+	// maxLimiters the limiters idle for the longest time are dropped once there are more, so that the clients with
+	// many ips don't run the server out of memory
+	maxLimiters = 10000
+)
+
+// clientLimiter the token bucket of a client in a route group
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// rateLimiter keeps the token buckets per route group and client, they're dropped while the limits are reloaded
+type rateLimiter struct {
+	watcher     config.Watcher
+	userHeaders []string
+
+	lock      sync.Mutex
+	limiters  map[string]*clientLimiter
+	lastSweep time.Time
+}
+
+// rateLimit rejects the requests of the clients running out of the tokens of their route groups by 429, the clients
+// are the users authenticated by the client certificates or the trusted proxies, or the client ips
+func rateLimit(watcher config.Watcher, userHeaders []string) gin.HandlerFunc {
+	l := &rateLimiter{watcher: watcher, userHeaders: userHeaders, limiters: map[string]*clientLimiter{}}
+	watcher.Subscribe(func(*types.ServerConfig) {
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		l.limiters = map[string]*clientLimiter{}
+	})
+	return l.handle
+}
+
+func (l *rateLimiter) handle(ctx *gin.Context) {
+	group := routeGroup(ctx.Request)
+	limit, ok := l.watcher.Current().Limits.RateLimits[group]
+	if !ok || limit.Rate <= 0 {
+		return
+	}
+	client := l.clientOf(ctx)
+	reservation := l.limiter(group, client, limit).Reserve()
+	delay := reservation.Delay()
+	if reservation.OK() && delay == 0 {
+		return
+	}
+
+	reservation.Cancel()
+	if !reservation.OK() || delay > time.Hour {
+		delay = time.Second
+	}
+	logger.FromContext(ctx).Warn("the request is rate limited", zap.String("group", group),
+		zap.String("client", client), zap.Duration("retryAfter", delay))
+	AbortTooManyRequests(ctx, types.FailWithErrorCode(ctx, constants.CodeTooManyRequests, nil), delay)
+}
+
+// clientOf returns the user of the request, it's the client ip if the user isn't authenticated, so that the clients
+// can't get more tokens by claiming other users
+func (l *rateLimiter) clientOf(ctx *gin.Context) string {
+	if !certs.Authenticated(ctx.Request.Context()) {
+		return "ip:" + ctx.ClientIP()
+	}
+	for _, header := range l.userHeaders {
+		if user := ctx.GetHeader(header); user != "" {
+			return "user:" + user
+		}
+	}
+	return "ip:" + ctx.ClientIP()
+}
+
+func (l *rateLimiter) limiter(group, client string, limit types.RateLimit) *rate.Limiter {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := time.Now()
+	if now.Sub(l.lastSweep) > limiterIdleTimeout {
+		for key, c := range l.limiters {
+			if now.Sub(c.lastSeen) > limiterIdleTimeout {
+				delete(l.limiters, key)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	key := group + "/" + client
+	c, ok := l.limiters[key]
+	if !ok {
+		if len(l.limiters) >= maxLimiters {
+			l.evictOldest()
+		}
+		c = &clientLimiter{limiter: rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst)}
+		l.limiters[key] = c
+	}
+	c.lastSeen = now
+	return c.limiter
+}
+
+// evictOldest drops the limiter idle for the longest time
+func (l *rateLimiter) evictOldest() {
+	var oldest string
+	var lastSeen time.Time
+	for key, c := range l.limiters {
+		if oldest == "" || c.lastSeen.Before(lastSeen) {
+			oldest, lastSeen = key, c.lastSeen
+		}
+	}
+	delete(l.limiters, oldest)
+}
+
+// routeGroup returns the rate limit group of the request
+func routeGroup(req *http.Request) string {
+	path := strings.TrimSuffix(req.URL.Path, "/")
+	for _, suffix := range constants.ConsoleUriSuffixes {
+		if strings.HasSuffix(path, suffix) {
+			return constants.RateLimitConsole
+		}
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return constants.RateLimitList
+	}
+	if strings.HasSuffix(path, "/upload") {
+		return constants.RateLimitUpload
+	}
+	return constants.RateLimitMutate
+}
+
+// limitBody rejects the bodies larger than the limit by 413, the bodies without the content length are cut off at the
+// limit. The multipart bodies, i.e. the uploads of the images, aren't limited.
+func limitBody(watcher config.Watcher) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.ContentType() == gin.MIMEMultipartPOSTForm {
+			return
+		}
+		limit := watcher.Current().Limits.MaxBodyBytes()
+		if ctx.Request.ContentLength > limit {
+			logger.FromContext(ctx).Warn("the request body is too large", zap.Int64("size", ctx.Request.ContentLength),
+				zap.Int64("limit", limit))
+			result := types.FailWithErrorCode(ctx, constants.CodeRequestTooLarge,
+				map[string]string{"limit": resource.NewQuantity(limit, resource.BinarySI).String()})
+			result.StatusCode = http.StatusRequestEntityTooLarge
+			ctx.AbortWithStatusJSON(result.StatusCode, types.ToResult(ctx, result, 0))
+			return
+		}
+		ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, limit)
+	}
+}
+
+// AbortTooManyRequests responds the error by 429, the client retries after the delay
+func AbortTooManyRequests(ctx *gin.Context, err error, retryAfter time.Duration) {
+	ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	result := types.ToResult(ctx, err, http.StatusTooManyRequests)
+	ctx.AbortWithStatusJSON(result.StatusCode, result)
+}
@@ -0,0 +1,177 @@
+package apiserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"embed"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"kubeall.io/api-server/pkg/infra/certs"
+	"kubeall.io/api-server/pkg/infra/config"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// staticWatcher returns the config as is, the subscribers are notified by reload
+type staticWatcher struct {
+	config.Watcher
+	config      *types.ServerConfig
+	subscribers []config.Subscriber
+}
+
+func (w *staticWatcher) Current() *types.ServerConfig {
+	return w.config
+}
+
+func (w *staticWatcher) Subscribe(subscriber config.Subscriber) {
+	w.subscribers = append(w.subscribers, subscriber)
+}
+
+func (w *staticWatcher) reload(limits *types.LimitsConfig) {
+	w.config = &types.ServerConfig{Limits: limits}
+	for _, subscriber := range w.subscribers {
+		subscriber(w.config)
+	}
+}
+
+func newLimitedEngine(watcher config.Watcher) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(localize(&types.ServerConfig{I18n: &types.I18nConfig{
+		Languages: []string{"en"},
+		BundleDir: "../../../cmd/server/resources/locales",
+	}}, embed.FS{}))
+	engine.Use(rateLimit(watcher, []string{constants.DefaultUserHeader}), limitBody(watcher))
+	handle := func(ctx *gin.Context) {
+		var body map[string]any
+		if ctx.Request.Method != http.MethodGet {
+			if err := ctx.ShouldBindJSON(&body); err != nil {
+				result := types.ToResult(ctx, types.Fail(err), http.StatusBadRequest)
+				ctx.AbortWithStatusJSON(result.StatusCode, result)
+				return
+			}
+		}
+		ctx.Status(http.StatusOK)
+	}
+	engine.GET("/vms", handle)
+	engine.POST("/vms", handle)
+	return engine
+}
+
+// serveRequest serves the request of the user authenticated by the client certificate
+func serveRequest(engine *gin.Engine, method, user, body string, contentLength int64) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/vms", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: user}}}}}
+	if contentLength != 0 {
+		req.ContentLength = contentLength
+	}
+	recorder := httptest.NewRecorder()
+	certs.ClientCertAuth(engine, []string{constants.DefaultUserHeader}, nil).ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestRateLimit(t *testing.T) {
+	watcher := &staticWatcher{}
+	watcher.reload(&types.LimitsConfig{RateLimits: map[string]types.RateLimit{
+		constants.RateLimitList: {Rate: 0.001, Burst: 2},
+	}})
+	engine := newLimitedEngine(watcher)
+
+	for i := 0; i < 2; i++ {
+		if code := serveRequest(engine, http.MethodGet, "alice", "", 0).Code; code != http.StatusOK {
+			t.Fatalf("got %d of the request %d", code, i)
+		}
+	}
+	recorder := serveRequest(engine, http.MethodGet, "alice", "", 0)
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") == "" {
+		t.Errorf("got %d, Retry-After %q", recorder.Code, recorder.Header().Get("Retry-After"))
+	}
+	var result types.Result
+	err := json.Unmarshal(recorder.Body.Bytes(), &result)
+	if err != nil || result.ErrorCode != constants.CodeTooManyRequests || result.Message == "" {
+		t.Errorf("got result %+v, %v", result, err)
+	}
+
+	// the buckets are per user and per route group
+	if code := serveRequest(engine, http.MethodGet, "bob", "", 0).Code; code != http.StatusOK {
+		t.Errorf("got %d of another user", code)
+	}
+	if code := serveRequest(engine, http.MethodPost, "alice", "{}", 0).Code; code != http.StatusOK {
+		t.Errorf("got %d of another route group", code)
+	}
+
+	// the users claimed by the clients themselves share the bucket of their ip
+	for _, user := range []string{"carol", "dave"} {
+		req := httptest.NewRequest(http.MethodGet, "/vms", nil)
+		req.Header.Set(constants.DefaultUserHeader, user)
+		recorder = httptest.NewRecorder()
+		engine.ServeHTTP(recorder, req)
+		if recorder.Code != http.StatusOK {
+			t.Errorf("got %d of the unauthenticated user %s", recorder.Code, user)
+		}
+	}
+	req := httptest.NewRequest(http.MethodGet, "/vms", nil)
+	req.Header.Set(constants.DefaultUserHeader, "erin")
+	recorder = httptest.NewRecorder()
+	engine.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Errorf("got %d of another unauthenticated user from the same ip", recorder.Code)
+	}
+
+	// the buckets are dropped while the limits are reloaded
+	watcher.reload(&types.LimitsConfig{})
+	if code := serveRequest(engine, http.MethodGet, "alice", "", 0).Code; code != http.StatusOK {
+		t.Errorf("got %d after the limit is removed", code)
+	}
+}
+
+func TestLimitBody(t *testing.T) {
+	watcher := &staticWatcher{}
+	watcher.reload(&types.LimitsConfig{MaxBodySize: "16"})
+	engine := newLimitedEngine(watcher)
+
+	if code := serveRequest(engine, http.MethodPost, "alice", `{"a": 1}`, 0).Code; code != http.StatusOK {
+		t.Errorf("got %d of the small body", code)
+	}
+	large := `{"name": "a large body"}`
+	recorder := serveRequest(engine, http.MethodPost, "alice", large, 0)
+	var result types.Result
+	_ = json.Unmarshal(recorder.Body.Bytes(), &result)
+	if recorder.Code != http.StatusRequestEntityTooLarge || result.Message != "The request body exceeds the limit of 16" {
+		t.Errorf("got %d %q of the large body", recorder.Code, result.Message)
+	}
+	// the body without the content length is cut off while it's read
+	if code := serveRequest(engine, http.MethodPost, "alice", large, -1).Code; code != http.StatusRequestEntityTooLarge {
+		t.Errorf("got %d of the chunked body", code)
+	}
+	// the body without the content type is limited as well
+	req := httptest.NewRequest(http.MethodPost, "/vms", strings.NewReader(large))
+	req.ContentLength = -1
+	recorder = httptest.NewRecorder()
+	engine.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("got %d of the body without the content type", recorder.Code)
+	}
+}
+
+func TestMaxLimiters(t *testing.T) {
+	l := &rateLimiter{limiters: map[string]*clientLimiter{}, lastSweep: time.Now()}
+	limit := types.RateLimit{Rate: 1, Burst: 1}
+	for i := 0; i <= maxLimiters; i++ {
+		l.limiter(constants.RateLimitList, "ip:"+strconv.Itoa(i), limit)
+	}
+	if len(l.limiters) != maxLimiters {
+		t.Errorf("expected %d limiters, got %d", maxLimiters, len(l.limiters))
+	}
+	if _, ok := l.limiters[constants.RateLimitList+"/ip:0"]; ok {
+		t.Error("expected the oldest limiter dropped")
+	}
+}
@@ -0,0 +1,24 @@
+package apiserver
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"kubeall.io/api-server/pkg/infra/constants"
+)
+
+// maxRequestIdLength the request ids set by the clients or the proxies longer than it are replaced
+const maxRequestIdLength = 128
+
+// requestId sets the id of the request to the context and the response header, the one set by the client or the
+// proxy is kept so that the requests can be traced across them
+func requestId(ctx *gin.Context) {
+	id := ctx.GetHeader(constants.RequestIdHeader)
+	if id == "" || len(id) > maxRequestIdLength {
+		id = string(uuid.NewUUID())
+	}
+	ctx.Set(constants.RequestIdKey, id)
+	ctx.Header(constants.RequestIdHeader, id)
+	trace.SpanFromContext(ctx.Request.Context()).SetAttributes(attribute.String("request.id", id))
+}
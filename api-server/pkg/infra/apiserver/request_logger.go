@@ -0,0 +1,39 @@
+package apiserver
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"kubeall.io/api-server/pkg/infra/audit"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/logger"
+)
+
+// requestLogger stores the logger of the request in its context, the logs of a request are correlated by the request
+// id and the trace id, and the logger is read by logger.FromContext in the handlers and the services
+func requestLogger(userHeader string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		fields := []zap.Field{
+			zap.String("requestId", ctx.GetString(constants.RequestIdKey)),
+			zap.String("method", ctx.Request.Method),
+			zap.String("path", ctx.Request.URL.Path),
+		}
+		if user := ctx.GetHeader(userHeader); user != "" {
+			fields = append(fields, zap.String("user", user))
+		}
+		for _, param := range []string{constants.ClusterParam, constants.NamespaceParam, "name"} {
+			if value := ctx.Param(param); value != "" {
+				fields = append(fields, zap.String(param, value))
+			}
+		}
+		if resource := audit.ResourceOf(ctx); resource != "" {
+			fields = append(fields, zap.String("resource", resource))
+		}
+		if spanCtx := trace.SpanContextFromContext(ctx.Request.Context()); spanCtx.HasTraceID() {
+			fields = append(fields, zap.String("traceId", spanCtx.TraceID().String()))
+		}
+
+		l := logger.Named(logger.RequestLogger).With(fields...)
+		ctx.Request = ctx.Request.WithContext(logger.NewContext(ctx.Request.Context(), l))
+	}
+}
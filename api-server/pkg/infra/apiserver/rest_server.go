@@ -2,16 +2,20 @@ package apiserver
 
 import (
 	"embed"
-	"encoding/json"
-	ginI18n "github.com/gin-contrib/i18n"
+	"errors"
 	ginzap "github.com/gin-contrib/zap"
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
 	"go.uber.org/zap"
-	"golang.org/x/text/language"
+	"kubeall.io/api-server/pkg/infra/audit"
+	"kubeall.io/api-server/pkg/infra/config"
 	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/metrics"
+	"kubeall.io/api-server/pkg/infra/tracing"
 	"kubeall.io/api-server/pkg/types"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-playground/validator/v10"
@@ -21,24 +25,41 @@ import (
 type RestServer interface {
 	Init(fs embed.FS)
 	GetEngine() *gin.Engine
+	// Handler serves the engine, the legacy paths without the cluster are forwarded to the local cluster
+	Handler() http.Handler
 	RootGroup() *gin.RouterGroup
 	NamespaceGroup() *gin.RouterGroup
 	ClusterGroup() *gin.RouterGroup
 }
 
 type restServerImpl struct {
-	config *types.ServerConfig
-	engine *gin.Engine
+	config   *types.ServerConfig
+	engine   *gin.Engine
+	auditor  audit.Auditor
+	registry ClusterRegistry
+	watcher  config.Watcher
+	// gvkResource the resources of the generic routes, the legacy cluster-scoped paths are told by them
+	gvkResource *constants.GvkResource
 
 	rootGroup      *gin.RouterGroup
 	namespaceGroup *gin.RouterGroup
 	clusterGroup   *gin.RouterGroup
+
+	segmentsOnce sync.Once
+	// rootSegmentSet the first segments of the routes of the root group
+	rootSegmentSet map[string]bool
+	// resourceSegmentSet the resources routed under a cluster
+	resourceSegmentSet map[string]bool
 }
 
-func NewRestServer(config types.Config, fs embed.FS) RestServer {
-	cfg := config.(*types.ServerConfig)
+func NewRestServer(cfg types.Config, fs embed.FS, auditor audit.Auditor, registry ClusterRegistry,
+	watcher config.Watcher, gvkResource *constants.GvkResource) RestServer {
 	restServer := &restServerImpl{
-		config: cfg,
+		config:      cfg.(*types.ServerConfig),
+		auditor:     auditor,
+		registry:    registry,
+		watcher:     watcher,
+		gvkResource: gvkResource,
 	}
 	restServer.Init(fs)
 	return restServer
@@ -49,24 +70,45 @@ func (r *restServerImpl) Init(fs embed.FS) {
 	r.engine = engine
 	r.rootGroup = engine.Group(constants.RootUri)
 
-	r.namespaceGroup = engine.Group(constants.NamespaceGroupUri, func(ctx *gin.Context) {
+	r.clusterGroup = engine.Group(constants.ClusterGroupUri, r.selectCluster, func(ctx *gin.Context) {
+		// set resource type for current request
+		ctx.Set(constants.ResourceType, types.NewResourceType(true, ""))
+	})
+
+	r.namespaceGroup = r.clusterGroup.Group(constants.NamespaceNameUri, func(ctx *gin.Context) {
 		// validate namespace is provided as expected
 		namespace := ctx.Param("namespace")
 		validate := binding.Validator.Engine().(*validator.Validate)
 		err := validate.Var(namespace, "required")
 		if err != nil {
 			zap.L().Warn("namespace is required", zap.Error(err))
-			ctx.AbortWithStatusJSON(http.StatusBadRequest,
-				types.FailWithErrorCode(ctx, constants.CodeRequired, map[string]string{"name": "namespace"}))
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, types.ToResult(ctx,
+				types.FailWithErrorCode(ctx, constants.CodeRequired, map[string]string{"name": "namespace"}), 0))
 		}
 		// set resource type for current request
 		ctx.Set(constants.ResourceType, types.NewResourceType(false, namespace))
 	})
+}
 
-	r.clusterGroup = engine.Group(constants.ClusterGroupUri, func(ctx *gin.Context) {
-		// set resource type for current request
-		ctx.Set(constants.ResourceType, types.NewResourceType(true, ""))
-	})
+// selectCluster sets the cluster resource of the :cluster param to the context, services read it by ClusterFrom
+func (r *restServerImpl) selectCluster(ctx *gin.Context) {
+	name := ctx.Param(constants.ClusterParam)
+	cls, err := r.registry.Get(ctx, name)
+	if err != nil {
+		zap.L().Warn("failed to select cluster", zap.String("cluster", name), zap.Error(err))
+		params := map[string]string{"name": name, "error": err.Error()}
+		if errors.Is(err, ErrClusterNotFound) {
+			result := types.FailWithErrorCode(ctx, constants.CodeClusterNotFound, params)
+			result.StatusCode = http.StatusNotFound
+			ctx.AbortWithStatusJSON(result.StatusCode, types.ToResult(ctx, result, 0))
+			return
+		}
+		result := types.FailWithErrorCode(ctx, constants.CodeClusterUnavailable, params)
+		result.StatusCode = http.StatusServiceUnavailable
+		ctx.AbortWithStatusJSON(result.StatusCode, types.ToResult(ctx, result, 0))
+		return
+	}
+	ctx.Set(constants.ClusterKey, cls)
 }
 
 func (r *restServerImpl) setupRestServer(fs embed.FS) *gin.Engine {
@@ -77,18 +119,23 @@ func (r *restServerImpl) setupRestServer(fs embed.FS) *gin.Engine {
 	//对于 100GB 的鏡像文件上传，内存占用可能达到数 GB 甚至更高（参考：上传 9MB 文件内存从 3MB 增到 30MB，）。这极有可能导致程序崩溃（OOM，Out of Memory）或服务器资源耗尽。
 	engine.MaxMultipartMemory = 32 << 20
 
+	// the services read the span of the request from the gin context
+	engine.ContextWithFallback = true
+	engine.Use(tracing.GinMiddleware(r.config.ApplicationName))
+
+	// set the request id before the others so that it's attached to the errors
+	engine.Use(requestId)
+
+	// allow the console hosted apart from the api server, the preflight requests aren't limited or audited
+	if cfg := r.config.Http; cfg != nil && cfg.Cors != nil && cfg.Cors.Enabled {
+		engine.Use(cors(cfg.Cors))
+	}
+
 	// apply i18n middleware
-	engine.Use(ginI18n.Localize(ginI18n.WithBundle(&ginI18n.BundleCfg{
-		DefaultLanguage:  language.Chinese,
-		FormatBundleFile: constants.ResourceBundleFormat,
-		AcceptLanguage:   []language.Tag{language.Chinese},
-		RootPath:         constants.ResourceRootDir,
-		UnmarshalFunc:    json.Unmarshal,
-
-		Loader: &ginI18n.EmbedLoader{
-			FS: fs,
-		},
-	})))
+	engine.Use(localize(r.config, fs))
+
+	// the logger of the request carries its id, user and resource
+	engine.Use(requestLogger(r.auditor.UserHeader()))
 
 	// Add a ginzap middleware, which:
 	//   - Logs all requests, like a combined access and error logger.
@@ -96,9 +143,23 @@ func (r *restServerImpl) setupRestServer(fs embed.FS) *gin.Engine {
 	//   - RFC3339 with local time format.
 	engine.Use(ginzap.Ginzap(zap.L(), time.RFC3339, constants.UtcTimeUsed))
 
+	// count requests and their latencies, it's ahead of the recovery so that the panics are counted as 500
+	engine.Use(metrics.GinMiddleware())
+
 	// Logs all panic to error logger
 	//   - stack means whether output the stack info.
 	engine.Use(ginzap.RecoveryWithZap(zap.L(), r.config.LogSetting.PrintErrorStack))
+
+	// limit the rate of the clients and the size of the bodies, the limits are reloadable
+	engine.Use(rateLimit(r.watcher, r.config.UserHeaders()), limitBody(r.watcher))
+
+	// record the mutating requests
+	engine.Use(audit.GinMiddleware(r.auditor))
+
+	// respond the unknown paths with the error body as well
+	engine.NoRoute(func(ctx *gin.Context) {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, types.ToResult(ctx, types.FailWithStatusCode(http.StatusNotFound), 0))
+	})
 	return engine
 }
 
@@ -106,6 +167,69 @@ func (r *restServerImpl) GetEngine() *gin.Engine {
 	return r.engine
 }
 
+func (r *restServerImpl) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if path, ok := r.legacyPath(req.URL.Path); ok {
+			req.URL.Path = path
+			req.URL.RawPath = ""
+		}
+		r.engine.ServeHTTP(w, req)
+	})
+}
+
+// legacyPath returns the path of the local cluster for the legacy paths without the cluster, i.e. the paths under the
+// root uri other than the ones of the root group, e.g. /api/v1/nodes is /api/v1/clusters/local/nodes. The legacy
+// cluster-scoped paths are under /api/v1/clusters as well, e.g. /api/v1/clusters/globalsettings, they're told from
+// the paths of the clusters by the resource names, which take precedence over the clusters of the same names.
+func (r *restServerImpl) legacyPath(path string) (string, bool) {
+	rest, ok := strings.CutPrefix(path, constants.RootUri+"/")
+	if !ok || rest == "" {
+		return "", false
+	}
+	rootSegments, resourceSegments := r.segments()
+	segment, resourcePath, _ := strings.Cut(rest, "/")
+	clusters := strings.TrimPrefix(constants.ClustersUri, "/")
+	if segment == clusters {
+		resource, _, _ := strings.Cut(resourcePath, "/")
+		if !resourceSegments[resource] {
+			return "", false
+		}
+		rest = resourcePath
+	} else if rootSegments[segment] {
+		return "", false
+	}
+	return constants.RootUri + constants.ClustersUri + "/" + constants.LocalClusterName + "/" + rest, true
+}
+
+// segments returns the first segments of the routes of the root group, and the resources routed under a cluster,
+// i.e. the resources of the generic routes and the first segments of the other routes of the cluster group. The
+// routes are registered once the server is initialized, so they're collected at the first request.
+func (r *restServerImpl) segments() (map[string]bool, map[string]bool) {
+	r.segmentsOnce.Do(func() {
+		r.rootSegmentSet = map[string]bool{strings.TrimPrefix(constants.ClustersUri, "/"): true}
+		r.resourceSegmentSet = map[string]bool{}
+		if r.gvkResource != nil {
+			for resource := range r.gvkResource.Resources() {
+				r.resourceSegmentSet[resource] = true
+			}
+		}
+		for _, route := range r.engine.Routes() {
+			segments := r.rootSegmentSet
+			rest, ok := strings.CutPrefix(route.Path, constants.RootUri+"/")
+			if clusterRest, cut := strings.CutPrefix(route.Path, constants.ClusterGroupUri+"/"); cut {
+				segments, rest = r.resourceSegmentSet, clusterRest
+			} else if !ok || strings.HasPrefix(route.Path, constants.ClusterGroupUri) {
+				continue
+			}
+			segment, _, _ := strings.Cut(rest, "/")
+			if segment != "" && !strings.HasPrefix(segment, ":") && !strings.HasPrefix(segment, "*") {
+				segments[segment] = true
+			}
+		}
+	})
+	return r.rootSegmentSet, r.resourceSegmentSet
+}
+
 func (r *restServerImpl) RootGroup() *gin.RouterGroup {
 	return r.rootGroup
 }
@@ -0,0 +1,58 @@
+package apiserver
+
+import (
+	"embed"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/fx/fxtest"
+	"kubeall.io/api-server/pkg/infra/audit"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+	"net/http/httptest"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+	"testing"
+)
+
+// requestCount returns the count of the requests of the route by the status code
+func requestCount(t *testing.T, route, code string) float64 {
+	families, err := ctrlmetrics.Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != "kubeall_http_requests_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["resource"] == route && labels["code"] == code {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestPanicCounted(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config := &types.ServerConfig{ApplicationName: "api-server", LogSetting: &types.LogConfig{},
+		I18n: &types.I18nConfig{Languages: []string{"en"}, BundleDir: "../../../cmd/server/resources/locales"}}
+	watcher := &staticWatcher{}
+	watcher.reload(&types.LimitsConfig{})
+	r := &restServerImpl{config: config, watcher: watcher,
+		auditor: audit.NewAuditor(&types.ServerConfig{}, fxtest.NewLifecycle(t))}
+	engine := r.setupRestServer(embed.FS{})
+	engine.GET("/panic", func(*gin.Context) { panic("boom") })
+
+	before := requestCount(t, "/panic", "500")
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	if recorder.Code != http.StatusInternalServerError {
+		t.Fatalf("got %d", recorder.Code)
+	}
+	if count := requestCount(t, "/panic", "500"); count != before+1 {
+		t.Errorf("expected the panic counted as 500, got %v", count-before)
+	}
+}
@@ -0,0 +1,111 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/types"
+)
+
+const (
+	defaultQueryLimit = 100
+	anonymousUser     = "anonymous"
+	defaultUserHeader = constants.DefaultUserHeader
+)
+
+// ErrNotQueryable is returned while querying the events without the file sink
+var ErrNotQueryable = errors.New("the audit file isn't enabled")
+
+// Sink persists the audit events
+type Sink interface {
+	Write(event *types.AuditEvent) error
+	Close() error
+}
+
+// Auditor records the mutating requests to all the sinks
+type Auditor interface {
+	Enabled() bool
+	UserHeader() string
+	Record(event *types.AuditEvent)
+	// Query returns the matched events from the file sink, the latest ones are returned first
+	Query(ctx context.Context, query types.AuditQuery) ([]types.AuditEvent, error)
+	Close() error
+}
+
+type auditorImpl struct {
+	enabled    bool
+	userHeader string
+	sinks      []Sink
+	file       *fileSink
+}
+
+// NewAuditor creates the auditor of the config, its sinks are closed with the app, so that the events in the webhook
+// queue are posted before exiting
+func NewAuditor(config types.Config, lifecycle fx.Lifecycle) Auditor {
+	cfg := config.(*types.ServerConfig).Audit
+	if cfg == nil || !cfg.Enabled {
+		return &auditorImpl{}
+	}
+
+	a := &auditorImpl{enabled: true, userHeader: cfg.UserHeader}
+	if a.userHeader == "" {
+		a.userHeader = defaultUserHeader
+	}
+	if cfg.File != nil && cfg.File.Enabled {
+		a.file = newFileSink(cfg.File)
+		a.sinks = append(a.sinks, a.file)
+	}
+	if cfg.Webhook != nil && cfg.Webhook.Enabled {
+		a.sinks = append(a.sinks, newWebhookSink(cfg.Webhook))
+	}
+	zap.L().Info("audit log is enabled", zap.Int("sinks", len(a.sinks)))
+
+	lifecycle.Append(fx.StopHook(func(ctx context.Context) error {
+		closed := make(chan error, 1)
+		go func() { closed <- a.Close() }()
+		select {
+		case err := <-closed:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}))
+	return a
+}
+
+func (a *auditorImpl) Enabled() bool {
+	return a.enabled
+}
+
+func (a *auditorImpl) UserHeader() string {
+	return a.userHeader
+}
+
+func (a *auditorImpl) Record(event *types.AuditEvent) {
+	for _, sink := range a.sinks {
+		if err := sink.Write(event); err != nil {
+			zap.L().Warn("failed to write audit event", zap.String("verb", event.Verb),
+				zap.String("path", event.Path), zap.Error(err))
+		}
+	}
+}
+
+func (a *auditorImpl) Query(ctx context.Context, query types.AuditQuery) ([]types.AuditEvent, error) {
+	if a.file == nil {
+		return nil, ErrNotQueryable
+	}
+	if query.Limit == 0 {
+		query.Limit = defaultQueryLimit
+	}
+	return a.file.Query(ctx, query)
+}
+
+func (a *auditorImpl) Close() error {
+	var errs []error
+	for _, sink := range a.sinks {
+		errs = append(errs, sink.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,106 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/natefinch/lumberjack"
+	"go.uber.org/zap"
+	"kubeall.io/api-server/pkg/infra/logger"
+	"kubeall.io/api-server/pkg/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const maxEventSize = 1024 * 1024
+
+// fileSink writes the events as json lines to a file rotated by lumberjack
+type fileSink struct {
+	writer *lumberjack.Logger
+}
+
+func newFileSink(cfg *types.AuditFileConfig) *fileSink {
+	return &fileSink{
+		writer: logger.NewRotatingWriter(cfg.FileName, cfg.MaxSizeInMB, cfg.MaxAgeInDays, cfg.MaxBackups, cfg.Compress),
+	}
+}
+
+func (f *fileSink) Write(event *types.AuditEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = f.writer.Write(append(data, '\n'))
+	return err
+}
+
+func (f *fileSink) Close() error {
+	return f.writer.Close()
+}
+
+// Query scans the current file and the uncompressed backups
+func (f *fileSink) Query(ctx context.Context, query types.AuditQuery) ([]types.AuditEvent, error) {
+	files, err := f.files()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]types.AuditEvent, 0)
+	for _, file := range files {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		matched, err := scanFile(file, query)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, matched...)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.After(events[j].Time)
+	})
+	if len(events) > query.Limit {
+		events = events[:query.Limit]
+	}
+	return events, nil
+}
+
+// files returns the current file and its backups, the backups are named as ${name}-${timestamp}${ext}
+func (f *fileSink) files() ([]string, error) {
+	name := f.writer.Filename
+	ext := filepath.Ext(name)
+	backups, err := filepath.Glob(strings.TrimSuffix(name, ext) + "-*" + ext)
+	if err != nil {
+		return nil, err
+	}
+	return append(backups, name), nil
+}
+
+func scanFile(file string, query types.AuditQuery) ([]types.AuditEvent, error) {
+	fd, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	var events []types.AuditEvent
+	scanner := bufio.NewScanner(fd)
+	scanner.Buffer(make([]byte, 64*1024), maxEventSize)
+	for scanner.Scan() {
+		var event types.AuditEvent
+		if err = json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			zap.L().Warn("skip the malformed audit event", zap.String("file", file), zap.Error(err))
+			continue
+		}
+		if query.Match(&event) {
+			events = append(events, event)
+		}
+	}
+	return events, scanner.Err()
+}
@@ -0,0 +1,54 @@
+package audit
+
+import (
+	"context"
+	"kubeall.io/api-server/pkg/types"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSinkQuery(t *testing.T) {
+	file := newFileSink(&types.AuditFileConfig{FileName: filepath.Join(t.TempDir(), "audit.log"), MaxSizeInMB: 1})
+	auditor := &auditorImpl{enabled: true, sinks: []Sink{file}, file: file}
+	defer auditor.Close()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for i, user := range []string{"alice", "bob", "alice", "alice"} {
+		auditor.Record(&types.AuditEvent{Time: now.Add(time.Duration(i) * time.Minute), User: user, Verb: "POST",
+			Path: "/api/v1/clusters/local/vms"})
+	}
+
+	tests := map[string]struct {
+		query    types.AuditQuery
+		expected []time.Duration
+	}{
+		"all":   {query: types.AuditQuery{}, expected: []time.Duration{3, 2, 1, 0}},
+		"user":  {query: types.AuditQuery{User: "alice"}, expected: []time.Duration{3, 2, 0}},
+		"limit": {query: types.AuditQuery{User: "alice", Limit: 2}, expected: []time.Duration{3, 2}},
+		"range": {
+			query:    types.AuditQuery{From: now.Add(time.Minute), To: now.Add(2 * time.Minute)},
+			expected: []time.Duration{2, 1},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			events, err := auditor.Query(context.Background(), test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != len(test.expected) {
+				t.Fatalf("expected %d events, got %v", len(test.expected), events)
+			}
+			for i, minutes := range test.expected {
+				if !events[i].Time.Equal(now.Add(minutes * time.Minute)) {
+					t.Errorf("expected the event at %s, got %s", now.Add(minutes*time.Minute), events[i].Time)
+				}
+			}
+		})
+	}
+
+	if _, err := (&auditorImpl{}).Query(context.Background(), types.AuditQuery{}); err != ErrNotQueryable {
+		t.Errorf("expected the events not queryable without the file, got %v", err)
+	}
+}
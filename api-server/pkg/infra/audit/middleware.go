@@ -0,0 +1,125 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"hash"
+	"io"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+var mutatingVerbs = map[string]bool{
+	http.MethodPost:   true,
+	http.MethodPut:    true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+// digestReader hashes the body while it's read by the handler, so that large uploads aren't buffered
+type digestReader struct {
+	io.ReadCloser
+	hash hash.Hash
+	read int64
+}
+
+func (d *digestReader) Read(p []byte) (int, error) {
+	n, err := d.ReadCloser.Read(p)
+	d.hash.Write(p[:n])
+	d.read += int64(n)
+	return n, err
+}
+
+func (d *digestReader) digest() string {
+	if d.read == 0 {
+		return ""
+	}
+	return "sha256:" + hex.EncodeToString(d.hash.Sum(nil))
+}
+
+// GinMiddleware records every mutating request and interactive session, e.g. the logs and the terminals of the pods,
+// after it's handled. The interactive sessions are recorded once they're started as well, since they may last long.
+func GinMiddleware(auditor Auditor) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !auditor.Enabled() || (!mutatingVerbs[ctx.Request.Method] && !interactive(ctx)) {
+			ctx.Next()
+			return
+		}
+
+		start := time.Now()
+		if interactive(ctx) {
+			auditor.Record(newEvent(ctx, auditor, start, types.AuditStageStarted))
+		}
+		body := &digestReader{ReadCloser: ctx.Request.Body, hash: sha256.New()}
+		if ctx.Request.Body != nil {
+			ctx.Request.Body = body
+		}
+		ctx.Next()
+
+		event := newEvent(ctx, auditor, start, types.AuditStageCompleted)
+		event.RequestDigest = body.digest()
+		event.Status = ctx.Writer.Status()
+		event.LatencyMs = time.Since(start).Milliseconds()
+		auditor.Record(event)
+	}
+}
+
+// newEvent returns the event of the request without its result
+func newEvent(ctx *gin.Context, auditor Auditor, start time.Time, stage string) *types.AuditEvent {
+	user := ctx.GetHeader(auditor.UserHeader())
+	if user == "" {
+		user = anonymousUser
+	}
+	return &types.AuditEvent{
+		Time:      start,
+		Stage:     stage,
+		RequestId: ctx.GetString(constants.RequestIdKey),
+		User:      user,
+		SourceIP:  ctx.ClientIP(),
+		Verb:      ctx.Request.Method,
+		Cluster:   ctx.Param(constants.ClusterParam),
+		Resource:  ResourceOf(ctx),
+		Namespace: ctx.Param("namespace"),
+		Name:      ctx.Param("name"),
+		Path:      ctx.Request.URL.Path,
+		Query:     ctx.Request.URL.RawQuery,
+	}
+}
+
+// interactive returns true if the route is an interactive session, whose options such as the container and the command
+// are recorded by the query
+func interactive(ctx *gin.Context) bool {
+	path := ctx.FullPath()
+	return path != "" && slices.ContainsFunc(constants.ConsoleUriSuffixes, func(suffix string) bool {
+		return strings.HasSuffix(path, suffix)
+	})
+}
+
+// ResourceOf returns the :resource param, or the first segment after the group of the matched route
+func ResourceOf(ctx *gin.Context) string {
+	if resource := ctx.Param(constants.ResourceParam); resource != "" {
+		return resource
+	}
+	path := ctx.FullPath()
+	if path == "" {
+		path = ctx.Request.URL.Path
+	}
+	// /api/v1/clusters/:cluster/namespaces/:namespace/${resource} or /api/v1/clusters/:cluster/${resource}
+	path = strings.TrimPrefix(path, constants.RootUri)
+	if cluster := strings.TrimPrefix(path, constants.ClustersUri+"/"); cluster != path {
+		if _, path, _ = strings.Cut(cluster, "/"); path == "" {
+			// the cluster itself, e.g. DELETE /api/v1/clusters/:cluster
+			path = constants.ClustersUri
+		}
+		if namespaced := strings.TrimPrefix(path, constants.NamespaceResourceParam+"/"); namespaced != path {
+			_, path, _ = strings.Cut(namespaced, "/")
+		}
+	}
+	resource, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	return resource
+}
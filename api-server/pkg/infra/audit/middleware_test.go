@@ -0,0 +1,107 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"io"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingSink keeps the events in memory
+type recordingSink struct {
+	lock   sync.Mutex
+	events []types.AuditEvent
+}
+
+func (r *recordingSink) Write(event *types.AuditEvent) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, *event)
+	return nil
+}
+
+func (r *recordingSink) Close() error {
+	return nil
+}
+
+func TestGinMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sink := &recordingSink{}
+	auditor := &auditorImpl{enabled: true, userHeader: defaultUserHeader, sinks: []Sink{sink}}
+	engine := gin.New()
+	engine.Use(GinMiddleware(auditor))
+	handler := func(ctx *gin.Context) {
+		_, _ = io.Copy(io.Discard, ctx.Request.Body)
+		ctx.Status(http.StatusCreated)
+	}
+	engine.GET(constants.ClusterGroupUri+"/namespaces/:namespace/:resource/:name", handler)
+	engine.POST(constants.ClusterGroupUri+"/namespaces/:namespace/:resource/:name", handler)
+	engine.DELETE(constants.ClusterGroupUri+"/:resource/:name", func(ctx *gin.Context) {
+		ctx.Status(http.StatusNotFound)
+	})
+
+	body := `{"kind":"VirtualMachine"}`
+	requests := []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/api/v1/clusters/local/namespaces/default/vms/vm1", nil),
+		httptest.NewRequest(http.MethodPost, "/api/v1/clusters/local/namespaces/default/vms/vm1?dryRun=true",
+			strings.NewReader(body)),
+		httptest.NewRequest(http.MethodDelete, "/api/v1/clusters/member/nodes/node1", nil),
+	}
+	requests[1].Header.Set(defaultUserHeader, "alice")
+	for _, req := range requests {
+		engine.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if len(sink.events) != 2 {
+		t.Fatalf("expected the mutating requests recorded, got %v", sink.events)
+	}
+	digest := sha256.Sum256([]byte(body))
+	create, remove := sink.events[0], sink.events[1]
+	if create.Verb != http.MethodPost || create.Status != http.StatusCreated || create.User != "alice" ||
+		create.Cluster != "local" || create.Resource != "vms" || create.Namespace != "default" ||
+		create.Name != "vm1" || create.Query != "dryRun=true" || create.Stage != types.AuditStageCompleted ||
+		create.RequestDigest != "sha256:"+hex.EncodeToString(digest[:]) {
+		t.Errorf("unexpected event of the creation %+v", create)
+	}
+	if remove.Verb != http.MethodDelete || remove.Status != http.StatusNotFound || remove.User != anonymousUser ||
+		remove.Cluster != "member" || remove.Resource != "nodes" || remove.RequestDigest != "" {
+		t.Errorf("unexpected event of the deletion %+v", remove)
+	}
+}
+
+func TestGinMiddlewareOfSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sink := &recordingSink{}
+	auditor := &auditorImpl{enabled: true, userHeader: defaultUserHeader, sinks: []Sink{sink}}
+	engine := gin.New()
+	engine.Use(GinMiddleware(auditor))
+	var started []types.AuditEvent
+	engine.GET(constants.ClusterGroupUri+"/namespaces/:namespace/pods/:name/exec", func(ctx *gin.Context) {
+		// the session is recorded before it's handled
+		sink.lock.Lock()
+		started = append(started, sink.events...)
+		sink.lock.Unlock()
+		ctx.Status(http.StatusSwitchingProtocols)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/clusters/local/namespaces/default/pods/web/exec?tty=true", nil)
+	req.Header.Set(defaultUserHeader, "alice")
+	engine.ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(started) != 1 || started[0].Stage != types.AuditStageStarted || started[0].User != "alice" ||
+		started[0].Resource != "pods" || started[0].Name != "web" || started[0].Query != "tty=true" ||
+		started[0].Status != 0 {
+		t.Fatalf("unexpected events of the started session %+v", started)
+	}
+	if len(sink.events) != 2 || sink.events[1].Stage != types.AuditStageCompleted ||
+		sink.events[1].Status != http.StatusSwitchingProtocols || !sink.events[1].Time.Equal(started[0].Time) {
+		t.Errorf("unexpected events of the session %+v", sink.events)
+	}
+}
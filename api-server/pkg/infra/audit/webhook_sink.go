@@ -0,0 +1,102 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWebhookTimeout   = 5 * time.Second
+	defaultWebhookQueueSize = 1000
+)
+
+var errQueueFull = errors.New("the audit webhook queue is full, the event is dropped")
+
+// webhookSink posts the events in the background, so that the requests aren't blocked by the webhook
+type webhookSink struct {
+	url        string
+	httpClient *http.Client
+	queue      chan *types.AuditEvent
+	stopped    chan struct{}
+	// lock guards closed, so that no event is sent to the queue once it's closed
+	lock   sync.RWMutex
+	closed bool
+}
+
+func newWebhookSink(cfg *types.AuditWebhookConfig) *webhookSink {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultWebhookQueueSize
+	}
+	w := &webhookSink{
+		url:        cfg.Url,
+		httpClient: &http.Client{Timeout: timeout},
+		queue:      make(chan *types.AuditEvent, queueSize),
+		stopped:    make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *webhookSink) Write(event *types.AuditEvent) error {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	if w.closed {
+		return nil
+	}
+	select {
+	case w.queue <- event:
+		return nil
+	default:
+		return errQueueFull
+	}
+}
+
+// Close stops accepting the events and waits until the queued ones are posted
+func (w *webhookSink) Close() error {
+	w.lock.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.lock.Unlock()
+	<-w.stopped
+	return nil
+}
+
+// run posts the events until the queue is closed and drained
+func (w *webhookSink) run() {
+	defer close(w.stopped)
+	for event := range w.queue {
+		if err := w.post(event); err != nil {
+			zap.L().Warn("failed to post audit event", zap.String("url", w.url), zap.Error(err))
+		}
+	}
+}
+
+func (w *webhookSink) post(event *types.AuditEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	resp, err := w.httpClient.Post(w.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
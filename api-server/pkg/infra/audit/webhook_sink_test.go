@@ -0,0 +1,64 @@
+package audit
+
+import (
+	"encoding/json"
+	"go.uber.org/fx/fxtest"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhookSink(t *testing.T) {
+	var lock sync.Mutex
+	var users []string
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-release
+		var event types.AuditEvent
+		if err := json.NewDecoder(req.Body).Decode(&event); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		lock.Lock()
+		users = append(users, event.User)
+		lock.Unlock()
+	}))
+	defer server.Close()
+
+	lifecycle := fxtest.NewLifecycle(t)
+	auditor := NewAuditor(&types.ServerConfig{Audit: &types.AuditConfig{
+		Enabled: true,
+		Webhook: &types.AuditWebhookConfig{Enabled: true, Url: server.URL, QueueSize: 2},
+	}}, lifecycle)
+	lifecycle.RequireStart()
+
+	// the first event is being posted, the next two are queued and the last one is dropped
+	sink := auditor.(*auditorImpl).sinks[0].(*webhookSink)
+	if err := sink.Write(&types.AuditEvent{User: "u0"}); err != nil {
+		t.Fatal(err)
+	}
+	for len(sink.queue) > 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, user := range []string{"u1", "u2"} {
+		if err := sink.Write(&types.AuditEvent{User: user}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Write(&types.AuditEvent{User: "u3"}); err != errQueueFull {
+		t.Errorf("expected the queue full, got %v", err)
+	}
+
+	// the queued events are posted before the app stops
+	close(release)
+	lifecycle.RequireStop()
+	if len(users) != 3 || users[0] != "u0" || users[1] != "u1" || users[2] != "u2" {
+		t.Errorf("expected the queued events posted, got %v", users)
+	}
+	if err := sink.Write(&types.AuditEvent{User: "u4"}); err != nil {
+		t.Errorf("expected the events dropped silently once closed, got %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package certs
+
+import (
+	"context"
+	"net/http"
+	"slices"
+)
+
+type authenticatedKey struct{}
+
+// ClientCertAuth sets the user headers to the common name of the verified client certificate, so that the user is
+// read the same as the one set by the authenticating proxy. The headers set by the trusted proxies are kept, and the
+// ones of the requests without a verified certificate are removed, so that the clients can't claim any user.
+func ClientCertAuth(next http.Handler, userHeaders []string, trustedProxies []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+			for _, header := range userHeaders {
+				req.Header.Del(header)
+			}
+			next.ServeHTTP(w, req)
+			return
+		}
+		user := req.TLS.VerifiedChains[0][0].Subject.CommonName
+		if !slices.Contains(trustedProxies, user) {
+			for _, header := range userHeaders {
+				req.Header.Set(header, user)
+			}
+		}
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), authenticatedKey{}, true)))
+	})
+}
+
+// Authenticated returns true if the user headers of the request are set by ClientCertAuth, i.e. by the verified client
+// certificate or a trusted proxy
+func Authenticated(ctx context.Context) bool {
+	authenticated, _ := ctx.Value(authenticatedKey{}).(bool)
+	return authenticated
+}
@@ -0,0 +1,183 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"go.uber.org/zap"
+	"kubeall.io/api-server/pkg/types"
+	"math/big"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// selfSignedValidity the validity of the self-signed certificate generated for development
+const selfSignedValidity = 365 * 24 * time.Hour
+
+// NewTlsConfig returns the tls config of the server, the certificate and the CA of the clients are reloaded once their
+// files are changed. The hosts are the names of the self-signed certificate generated while no certificate is
+// configured.
+func NewTlsConfig(cfg *types.TlsConfig, http2 bool, hosts ...string) (*tls.Config, error) {
+	minVersion, err := cfg.TlsMinVersion()
+	if err != nil {
+		return nil, err
+	}
+	cipherSuites, err := cfg.CipherSuiteIDs()
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{MinVersion: minVersion, CipherSuites: cipherSuites, NextProtos: []string{"http/1.1"}}
+	if http2 {
+		config.NextProtos = []string{"h2", "http/1.1"}
+	}
+
+	if cfg.CertFile == "" {
+		cert, err := GenerateSelfSigned(hosts...)
+		if err != nil {
+			return nil, err
+		}
+		zap.L().Warn("the self-signed certificate is generated, it's for development only", zap.Strings("hosts", hosts))
+		config.Certificates = []tls.Certificate{cert}
+	} else {
+		keyPair, err := newReloader(func() (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+			return &cert, err
+		}, cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return keyPair.get(), nil
+		}
+	}
+
+	if cfg.ClientAuth == nil || !cfg.ClientAuth.Enabled {
+		return config, nil
+	}
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	if cfg.ClientAuth.Required {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	clientCAs, err := newReloader(func() (*x509.CertPool, error) {
+		return loadCertPool(cfg.ClientAuth.CaFile)
+	}, cfg.ClientAuth.CaFile)
+	if err != nil {
+		return nil, err
+	}
+	config.ClientCAs = clientCAs.get()
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		c := config.Clone()
+		c.ClientCAs = clientCAs.get()
+		return c, nil
+	}
+	return config, nil
+}
+
+// GenerateSelfSigned generates the self-signed certificate of the hosts, which are the dns names or the ips
+func GenerateSelfSigned(hosts ...string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "kubeall-api-server", Organization: []string{"kubeall"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if host != "" {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificate is found in %s", caFile)
+	}
+	return pool, nil
+}
+
+// reloader loads the value again once the modification time of its files is changed, the previous value is kept if
+// it fails to load
+type reloader[T any] struct {
+	files []string
+	load  func() (T, error)
+
+	lock    sync.Mutex
+	modTime time.Time
+	value   T
+}
+
+func newReloader[T any](load func() (T, error), files ...string) (*reloader[T], error) {
+	r := &reloader[T]{files: files, load: load}
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return nil, err
+	}
+	if r.value, err = load(); err != nil {
+		return nil, err
+	}
+	r.modTime = modTime
+	return r, nil
+}
+
+func (r *reloader[T]) get() T {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	modTime, err := r.latestModTime()
+	if err != nil || modTime.Equal(r.modTime) {
+		return r.value
+	}
+	value, err := r.load()
+	if err != nil {
+		zap.L().Warn("failed to reload the certificate, the previous one is kept", zap.Strings("files", r.files),
+			zap.Error(err))
+		return r.value
+	}
+	r.value, r.modTime = value, modTime
+	zap.L().Info("the certificate is reloaded", zap.Strings("files", r.files))
+	return r.value
+}
+
+// latestModTime returns the latest modification time of the files, the symlinks of the mounted secrets are followed
+func (r *reloader[T]) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range r.files {
+		stat, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if stat.ModTime().After(latest) {
+			latest = stat.ModTime()
+		}
+	}
+	return latest, nil
+}
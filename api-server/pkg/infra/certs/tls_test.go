@@ -0,0 +1,196 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"kubeall.io/api-server/pkg/types"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testCA signs the certificates of the server and the clients
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue writes the certificate of the common name and its key to the directory
+func (ca *testCA) issue(t *testing.T, dir, cn string, serial int64, usage x509.ExtKeyUsage) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, cn+".crt"), filepath.Join(dir, cn+".key")
+	writePem(t, certFile, "CERTIFICATE", der)
+	writePem(t, keyFile, "EC PRIVATE KEY", keyDer)
+	return certFile, keyFile
+}
+
+func writePem(t *testing.T, file, blockType string, der []byte) {
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serve serves the user header over tls and returns the url
+func serve(t *testing.T, config *tls.Config, handler http.Handler) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+	server := &http.Server{Handler: handler, TLSConfig: config, Protocols: protocols}
+	go func() { _ = server.ServeTLS(listener, "", "") }()
+	t.Cleanup(func() { _ = server.Close() })
+	return "https://" + listener.Addr().String()
+}
+
+func newClient(roots *x509.CertPool, certs ...tls.Certificate) *http.Client {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+	return &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs},
+		Protocols:       protocols,
+	}}
+}
+
+func TestSelfSignedHttp2(t *testing.T) {
+	config, err := NewTlsConfig(&types.TlsConfig{Enabled: true, MinVersion: "1.3"}, true, "127.0.0.1", "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := serve(t, config, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	cert, _ := x509.ParseCertificate(config.Certificates[0].Certificate[0])
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	resp, err := newClient(roots).Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.ProtoMajor != 2 || resp.TLS.Version != tls.VersionTLS13 {
+		t.Errorf("got protocol %s, tls version %x", resp.Proto, resp.TLS.Version)
+	}
+}
+
+func TestClientCertAuth(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	caFile := filepath.Join(dir, "ca.crt")
+	writePem(t, caFile, "CERTIFICATE", ca.cert.Raw)
+	certFile, keyFile := ca.issue(t, dir, "server", 2, x509.ExtKeyUsageServerAuth)
+
+	config, err := NewTlsConfig(&types.TlsConfig{
+		Enabled:    true,
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+		ClientAuth: &types.ClientAuthConfig{Enabled: true, CaFile: caFile},
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := serve(t, config, ClientCertAuth(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte(req.Header.Get("X-Remote-User") + "|" + strconv.FormatBool(Authenticated(req.Context()))))
+	}), []string{"X-Remote-User"}, []string{"front-proxy"}))
+
+	get := func(user string, certs ...tls.Certificate) (string, *tls.ConnectionState) {
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		req.Header.Set("X-Remote-User", user)
+		resp, err := newClient(ca.pool, certs...).Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body := make([]byte, 64)
+		n, _ := resp.Body.Read(body)
+		return string(body[:n]), resp.TLS
+	}
+	loadCert := func(cn string, serial int64) tls.Certificate {
+		certFile, keyFile := ca.issue(t, dir, cn, serial, x509.ExtKeyUsageClientAuth)
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+
+	// the user of the certificate overrides the header
+	if user, _ := get("mallory", loadCert("alice", 3)); user != "alice|true" {
+		t.Errorf("got user %s of the client certificate", user)
+	}
+	// the header set by the trusted proxy is kept
+	if user, _ := get("bob", loadCert("front-proxy", 4)); user != "bob|true" {
+		t.Errorf("got user %s of the trusted proxy", user)
+	}
+	// the header claimed by the client without a certificate is removed while the certificate isn't required
+	if user, _ := get("carol"); user != "|false" {
+		t.Errorf("got user %s without the client certificate", user)
+	}
+
+	// the server certificate is reloaded once it's changed
+	ca.issue(t, dir, "server", 5, x509.ExtKeyUsageServerAuth)
+	later := time.Now().Add(time.Minute)
+	if err = os.Chtimes(certFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if _, state := get(""); state.PeerCertificates[0].SerialNumber.Int64() != 5 {
+		t.Errorf("got serial %d of the server certificate", state.PeerCertificates[0].SerialNumber.Int64())
+	}
+}
@@ -7,23 +7,24 @@ import (
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	lhclient "kubeall.io/api-server/pkg/generated/longhorn/clientset/versioned"
+	"kubeall.io/api-server/pkg/infra/tracing"
 	"kubeall.io/api-server/pkg/infra/utils"
 	"kubeall.io/api-server/pkg/types"
 	kvclient "kubevirt.io/client-go/kubevirt"
 )
 
 type ApiClient interface {
-	K8sClient() *kubernetes.Clientset
+	K8sClient() kubernetes.Interface
 	RestConfig() *rest.Config
-	LonghornClient() *lhclient.Clientset
+	LonghornClient() lhclient.Interface
 	KubevirtClient() *kvclient.Clientset
 }
 
 type apiClientsImpl struct {
 	config         types.Config
 	restConfig     *rest.Config
-	k8sClient      *kubernetes.Clientset
-	longhornClient *lhclient.Clientset
+	k8sClient      kubernetes.Interface
+	longhornClient lhclient.Interface
 	kvClient       *kvclient.Clientset
 }
 
@@ -45,24 +46,40 @@ func (a *apiClientsImpl) createClients() {
 		}
 	}
 
-	var err error
-
-	a.restConfig, err = clientcmd.BuildConfigFromFlags("", kubeConfigFile)
+	restConfig, err := clientcmd.BuildConfigFromFlags("", kubeConfigFile)
 	utilruntime.Must(err)
+	utilruntime.Must(a.createClientsForConfig(restConfig))
+}
+
+// NewClientsForConfig 根据rest配置创建集群的各类客户端, 用于多集群
+func NewClientsForConfig(restConfig *rest.Config) (ApiClient, error) {
+	apiClient := &apiClientsImpl{}
+	if err := apiClient.createClientsForConfig(restConfig); err != nil {
+		return nil, err
+	}
+	return apiClient, nil
+}
+
+func (a *apiClientsImpl) createClientsForConfig(restConfig *rest.Config) error {
+	var err error
+	tracing.WrapConfig(restConfig)
+	a.restConfig = restConfig
 
 	// k8s
-	a.k8sClient, err = kubernetes.NewForConfig(a.restConfig)
-	utilruntime.Must(err)
+	if a.k8sClient, err = kubernetes.NewForConfig(restConfig); err != nil {
+		return err
+	}
 
-	a.longhornClient, err = lhclient.NewForConfig(a.restConfig)
-	utilruntime.Must(err)
+	if a.longhornClient, err = lhclient.NewForConfig(restConfig); err != nil {
+		return err
+	}
 
 	// kubevirt client
-	a.kvClient = kvclient.NewForConfigOrDie(a.restConfig)
-
+	a.kvClient, err = kvclient.NewForConfig(restConfig)
+	return err
 }
 
-func (a *apiClientsImpl) K8sClient() *kubernetes.Clientset {
+func (a *apiClientsImpl) K8sClient() kubernetes.Interface {
 	return a.k8sClient
 }
 
@@ -70,7 +87,7 @@ func (a *apiClientsImpl) RestConfig() *rest.Config {
 	return a.restConfig
 }
 
-func (a *apiClientsImpl) LonghornClient() *lhclient.Clientset {
+func (a *apiClientsImpl) LonghornClient() lhclient.Interface {
 	return a.longhornClient
 }
 
@@ -1,29 +1,57 @@
 package config
 
 import (
+	"fmt"
 	"github.com/knadh/koanf/parsers/yaml"
 	"github.com/knadh/koanf/providers/file"
 	"github.com/knadh/koanf/providers/rawbytes"
 	"github.com/knadh/koanf/v2"
+	"kubeall.io/api-server/pkg/infra/constants"
 	"kubeall.io/api-server/pkg/infra/utils"
 	"kubeall.io/api-server/pkg/types"
+	"os"
+	"reflect"
+	"strings"
 )
 
-// Global koanf instance. Use "." as the key path delimiter. This can be "/" or any character.
-var k = koanf.New(".")
-
 func NewServerConfig(params *types.StartupParams) (types.Config, error) {
-	cfg := &types.ServerConfig{}
+	cfg, err := loadServerConfig(params)
+	if err != nil {
+		println("error occurs while loading config file:", err.Error())
+		return nil, err
+	}
+	return cfg, nil
+}
 
-	if err := loadConfig(params.InternalConfig, cfg, &params.CustomConfigPath, params.DefaultCfgPaths); err != nil {
-		println("error occurs while loading config file: %s", err.Error())
+// loadServerConfig loads the config, fills its defaults and validates it
+func loadServerConfig(params *types.StartupParams) (*types.ServerConfig, error) {
+	cfg := &types.ServerConfig{}
+	if err := loadConfig(params.InternalConfig, cfg, configPaths(params)); err != nil {
 		return nil, err
 	}
+	if err := cfg.Complete(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
 	return cfg, nil
 }
 
-// loadConfig loads the configuration files
-func loadConfig(internalCfg []byte, config types.Config, extraConfigFilePath *string, defaultCfgPaths []string) error {
+// configPaths returns the external config files, the custom one overrides the default ones
+func configPaths(params *types.StartupParams) []string {
+	cfgPaths := append([]string{}, params.DefaultCfgPaths...)
+	if params.CustomConfigPath != "" {
+		cfgPaths = append(cfgPaths, params.CustomConfigPath)
+	}
+	return cfgPaths
+}
+
+// loadConfig loads the configuration files and then the environment variables, a new koanf instance is used for
+// every loading so that the settings removed from the files are reset while reloading
+func loadConfig(internalCfg []byte, config types.Config, cfgPaths []string) error {
+	// Use "." as the key path delimiter
+	k := koanf.New(".")
 
 	//load internal config
 	if internalCfg != nil {
@@ -32,14 +60,6 @@ func loadConfig(internalCfg []byte, config types.Config, extraConfigFilePath *st
 		}
 	}
 
-	cfgPaths := defaultCfgPaths
-	if cfgPaths == nil {
-		cfgPaths = []string{}
-	}
-	if extraConfigFilePath != nil {
-		cfgPaths = append(cfgPaths, *extraConfigFilePath)
-	}
-
 	// load external configs
 	for _, f := range cfgPaths {
 		if exists, err := utils.IsFileExists(f); err != nil {
@@ -51,9 +71,76 @@ func loadConfig(internalCfg []byte, config types.Config, extraConfigFilePath *st
 		}
 	}
 
-	if err := k.Unmarshal("", config); err != nil {
+	if err := loadEnv(k, config); err != nil {
 		return err
 	}
+	return k.Unmarshal("", config)
+}
+
+// envKey the key path of a setting overridden by an environment variable
+type envKey struct {
+	path string
+	list bool
+}
+
+// loadEnv overrides the settings by the environment variables prefixed with KUBEALL_, the variable of a setting is its
+// key path in upper case joined by "_", e.g. KUBEALL_LOGCONFIG_LOGLEVEL for logConfig.logLevel. The items of a list
+// are separated by ",", and the maps and the lists of objects can only be set in the files.
+func loadEnv(k *koanf.Koanf, config types.Config) error {
+	keys := map[string]envKey{}
+	collectEnvKeys(reflect.TypeOf(config), "", keys)
 
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		if !strings.HasPrefix(name, constants.ConfigEnvPrefix) {
+			continue
+		}
+		key, ok := keys[strings.TrimPrefix(name, constants.ConfigEnvPrefix)]
+		if !ok {
+			println("unknown config environment variable:", name)
+			continue
+		}
+
+		var v any = value
+		if key.list {
+			v = strings.Split(value, ",")
+		}
+		if err := k.Set(key.path, v); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// collectEnvKeys collects the key paths of the settings from the koanf tags, they're indexed by their variable names
+func collectEnvKeys(t reflect.Type, prefix string, keys map[string]envKey) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("koanf")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		path := tag
+		if prefix != "" {
+			path = prefix + "." + tag
+		}
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		switch {
+		case fieldType.Kind() == reflect.Struct:
+			collectEnvKeys(fieldType, path, keys)
+		case fieldType.Kind() == reflect.Map,
+			fieldType.Kind() == reflect.Slice && fieldType.Elem().Kind() == reflect.Struct:
+			continue
+		default:
+			name := strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+			keys[name] = envKey{path: path, list: fieldType.Kind() == reflect.Slice}
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"go.uber.org/fx/fxtest"
+	"kubeall.io/api-server/pkg/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const internalConfig = `
+applicationName: api-server
+http:
+  address: 0.0.0.0
+  port: 8080
+logConfig:
+  logLevel: DEBUG
+limits:
+  pageSizes: [10, 20]
+  rateLimits:
+    list: {rate: 1.5}
+`
+
+// writeConfig writes the external config file and returns the startup params loading it
+func writeConfig(t *testing.T, content string) *types.StartupParams {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return &types.StartupParams{InternalConfig: []byte(internalConfig), CustomConfigPath: path}
+}
+
+func TestLoadServerConfig(t *testing.T) {
+	params := writeConfig(t, "http:\n  port: 8081\n")
+	t.Setenv("KUBEALL_LOGCONFIG_LOGLEVEL", "warn")
+	t.Setenv("KUBEALL_LIMITS_PAGESIZES", "5,15")
+	t.Setenv("KUBEALL_TRACING_ENABLED", "false")
+
+	cfg, err := loadServerConfig(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Http.Port != 8081 || cfg.Http.Address != "0.0.0.0" {
+		t.Errorf("got http %+v", cfg.Http)
+	}
+	if cfg.LogSetting.LogLevel != "WARN" {
+		t.Errorf("got log level %s", cfg.LogSetting.LogLevel)
+	}
+	if !reflect.DeepEqual(cfg.Limits.PageSizes, []int{5, 15}) || cfg.Limits.UploadTimeout != 30*time.Minute ||
+		cfg.Limits.MaxBodyBytes() != 4<<20 {
+		t.Errorf("got limits %+v", cfg.Limits)
+	}
+	// the burst defaults to the rate rounded up
+	if limit := cfg.Limits.RateLimits["list"]; limit.Rate != 1.5 || limit.Burst != 2 {
+		t.Errorf("got rate limit %+v", limit)
+	}
+}
+
+func TestLoadServerConfigInvalid(t *testing.T) {
+	params := writeConfig(t, "http:\n  port: 0\n  tls:\n    enabled: true\n    minVersion: \"1.1\"\n"+
+		"logConfig:\n  logLevel: verbose\nkubeConfig: /not/exist\n")
+
+	_, err := loadServerConfig(params)
+	if err == nil {
+		t.Fatal("the invalid config is loaded")
+	}
+	for _, path := range []string{"http.port", "http.tls.minVersion", "logConfig.logLevel", "kubeConfig"} {
+		if !strings.Contains(err.Error(), path) {
+			t.Errorf("%s isn't reported in %v", path, err)
+		}
+	}
+}
+
+func TestWatcherReload(t *testing.T) {
+	params := writeConfig(t, "")
+	cfg, err := loadServerConfig(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	watcher := NewWatcher(cfg, params, fxtest.NewLifecycle(t))
+	var notified []*types.ServerConfig
+	watcher.Subscribe(func(config *types.ServerConfig) {
+		notified = append(notified, config)
+	})
+
+	// the invalid config is dropped
+	if err = os.WriteFile(params.CustomConfigPath, []byte("logConfig:\n  logLevel: verbose\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = watcher.Reload(); err == nil || len(notified) != 0 {
+		t.Fatalf("the invalid config is reloaded: %v", err)
+	}
+
+	// only the reloadable settings are applied
+	content := "http:\n  port: 9000\nlogConfig:\n  logLevel: error\nlimits:\n  uploadTimeout: 1h\n"
+	if err = os.WriteFile(params.CustomConfigPath, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = watcher.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	current := watcher.Current()
+	if len(notified) != 1 || notified[0] != current {
+		t.Fatalf("got %d notifications", len(notified))
+	}
+	if current.LogSetting.LogLevel != "ERROR" || current.Limits.UploadTimeout != time.Hour || current.Http.Port != 8080 {
+		t.Errorf("got log level %s, limits %+v, port %d", current.LogSetting.LogLevel, current.Limits, current.Http.Port)
+	}
+	if cfg.LogSetting.LogLevel != "DEBUG" {
+		t.Errorf("the startup config is changed")
+	}
+
+	// nothing is notified if the reloadable settings aren't changed
+	if err = watcher.Reload(); err != nil || len(notified) != 1 {
+		t.Errorf("got %d notifications, %v", len(notified), err)
+	}
+}
+
+func TestLoadEmbeddedConfig(t *testing.T) {
+	internal, err := os.ReadFile(filepath.Join("..", "..", "..", "cmd", "server", "resources", "internal_conf.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := writeConfig(t, "")
+	params.InternalConfig = internal
+
+	// the kubeconfig isn't checked while it's empty, the in-cluster config is used
+	cfg, err := loadServerConfig(params)
+	if err != nil {
+		t.Fatalf("expected the embedded config valid in any directory, got %v", err)
+	}
+	if cfg.KubeConfig != "" {
+		t.Errorf("expected the in-cluster config by default, got %s", cfg.KubeConfig)
+	}
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"context"
+	"github.com/knadh/koanf/providers/file"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"kubeall.io/api-server/pkg/infra/utils"
+	"kubeall.io/api-server/pkg/types"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// Subscriber is notified with the current config once the reloadable settings are changed
+type Subscriber func(config *types.ServerConfig)
+
+// Watcher reloads the config while the external config files are changed. Only the settings reloadable at runtime,
+// see types.ServerConfig.Reload, are applied, and the reloaded config is dropped if it's invalid.
+type Watcher interface {
+	// Current returns the config with the reloaded settings, the injected config keeps the startup ones
+	Current() *types.ServerConfig
+	Subscribe(subscriber Subscriber)
+	// Reload reloads the config files and notifies the subscribers if the reloadable settings are changed
+	Reload() error
+}
+
+type watcherImpl struct {
+	params  *types.StartupParams
+	current atomic.Pointer[types.ServerConfig]
+	// lock serializes the reloads and the subscriptions
+	lock        sync.Mutex
+	subscribers []Subscriber
+	files       []*file.File
+}
+
+func NewWatcher(config types.Config, params *types.StartupParams, lifecycle fx.Lifecycle) Watcher {
+	w := &watcherImpl{params: params}
+	w.current.Store(config.(*types.ServerConfig))
+	lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			w.watch()
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			w.unwatch()
+			return nil
+		},
+	})
+	return w
+}
+
+func (w *watcherImpl) Current() *types.ServerConfig {
+	return w.current.Load()
+}
+
+func (w *watcherImpl) Subscribe(subscriber Subscriber) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.subscribers = append(w.subscribers, subscriber)
+}
+
+func (w *watcherImpl) Reload() error {
+	reloaded, err := loadServerConfig(w.params)
+	if err != nil {
+		return err
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	current := w.current.Load()
+	next := current.Reload(reloaded)
+	if !reflect.DeepEqual(current, reloaded.Reload(current)) {
+		zap.L().Warn("the changed settings except the log level and the limits take effect after restarting")
+	}
+	if reflect.DeepEqual(current, next) {
+		return nil
+	}
+
+	w.current.Store(next)
+	zap.L().Info("config is reloaded", zap.String("logLevel", next.LogSetting.LogLevel),
+		zap.Any("limits", next.Limits))
+	for _, subscriber := range w.subscribers {
+		subscriber(next)
+	}
+	return nil
+}
+
+// watch watches the existing config files, the directories are watched by fsnotify so that the files mounted from
+// the config maps, which are replaced by symlinks, are watched as well
+func (w *watcherImpl) watch() {
+	for _, path := range configPaths(w.params) {
+		if exists, _ := utils.IsFileExists(path); !exists {
+			continue
+		}
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			zap.L().Warn("failed to watch the config file", zap.String("path", path), zap.Error(err))
+			continue
+		}
+
+		f := file.Provider(absPath)
+		err = f.Watch(func(_ any, err error) {
+			if err != nil {
+				zap.L().Warn("stopped watching the config file", zap.String("path", absPath), zap.Error(err))
+				return
+			}
+			if err = w.Reload(); err != nil {
+				zap.L().Warn("failed to reload the config, the current one is kept", zap.String("path", absPath),
+					zap.Error(err))
+			}
+		})
+		if err != nil {
+			zap.L().Warn("failed to watch the config file", zap.String("path", absPath), zap.Error(err))
+			continue
+		}
+		w.files = append(w.files, f)
+		zap.L().Info("watching the config file", zap.String("path", absPath))
+	}
+}
+
+func (w *watcherImpl) unwatch() {
+	for _, f := range w.files {
+		_ = f.Unwatch()
+	}
+	w.files = nil
+}
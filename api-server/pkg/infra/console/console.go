@@ -0,0 +1,145 @@
+package console
+
+import (
+	"errors"
+	"go.uber.org/zap"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	indexFile = "index.html"
+	// assetsDir the assets bundled by vite, their names contain the hashes of the contents
+	assetsDir = "assets/"
+	// apiPrefix the paths served by the rest server rather than the console
+	apiPrefix = "/api"
+
+	immutableCacheControl = "public, max-age=31536000, immutable"
+	// the pages and the unhashed files are revalidated so that the new version is loaded once it's deployed
+	revalidateCacheControl = "no-cache"
+)
+
+// encodings the precompressed variants of the assets in the order of preference, e.g. index-5f3a.js.br
+var encodings = []struct {
+	name      string
+	extension string
+}{
+	{name: "br", extension: ".br"},
+	{name: "gzip", extension: ".gz"},
+}
+
+// Assets the built console, i.e. the content of console/dist, embedded into the binary
+type Assets struct {
+	fs.FS
+}
+
+// Handler serves the console from the assets and forwards the api requests to next. The paths of the console routes
+// aren't files, they're answered with index.html so that the router of the console renders them.
+func Handler(assets fs.FS, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if (req.Method != http.MethodGet && req.Method != http.MethodHead) ||
+			req.URL.Path == apiPrefix || strings.HasPrefix(req.URL.Path, apiPrefix+"/") {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		name := strings.TrimPrefix(path.Clean(req.URL.Path), "/")
+		if name == "" {
+			name = indexFile
+		}
+		if !isFile(assets, name) {
+			// the missing files are reported rather than answered with the page
+			if path.Ext(name) != "" {
+				http.NotFound(w, req)
+				return
+			}
+			name = indexFile
+		}
+		serveFile(w, req, assets, name)
+	})
+}
+
+// Load returns the assets in dir if it's set, otherwise the embedded ones. Nil is returned if there's no index.html,
+// e.g. the binary is built without the console.
+func Load(embedded Assets, dir string) fs.FS {
+	var assets fs.FS = embedded.FS
+	if dir != "" {
+		assets = os.DirFS(dir)
+	}
+	if assets == nil || !isFile(assets, indexFile) {
+		zap.L().Warn("the console isn't served since its assets are missing", zap.String("dir", dir))
+		return nil
+	}
+	return assets
+}
+
+// serveFile serves the precompressed variant of the file accepted by the client if there's one
+func serveFile(w http.ResponseWriter, req *http.Request, assets fs.FS, name string) {
+	header := w.Header()
+	header.Add("Vary", "Accept-Encoding")
+	if strings.HasPrefix(name, assetsDir) {
+		header.Set("Cache-Control", immutableCacheControl)
+	} else {
+		header.Set("Cache-Control", revalidateCacheControl)
+	}
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+
+	file := name
+	for _, encoding := range encodings {
+		if accepts(req, encoding.name) && isFile(assets, name+encoding.extension) {
+			file = name + encoding.extension
+			header.Set("Content-Encoding", encoding.name)
+			break
+		}
+	}
+
+	f, err := assets.Open(file)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	var modTime time.Time
+	if info, err := f.Stat(); err == nil {
+		modTime = info.ModTime()
+	}
+	http.ServeContent(w, req, name, modTime, content)
+}
+
+func isFile(assets fs.FS, name string) bool {
+	info, err := fs.Stat(assets, name)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			zap.L().Warn("failed to stat the console asset", zap.String("name", name), zap.Error(err))
+		}
+		return false
+	}
+	return !info.IsDir()
+}
+
+// accepts returns whether the encoding is accepted by the client, the q-values other than 0 aren't compared
+func accepts(req *http.Request, encoding string) bool {
+	for _, value := range req.Header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(value, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			if strings.EqualFold(strings.TrimSpace(name), encoding) {
+				q := strings.ReplaceAll(params, " ", "")
+				return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+			}
+		}
+	}
+	return false
+}
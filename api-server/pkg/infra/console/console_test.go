@@ -0,0 +1,104 @@
+package console
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+var testAssets = fstest.MapFS{
+	"index.html":                  {Data: []byte("<html>console</html>")},
+	"favicon.svg":                 {Data: []byte("<svg/>")},
+	"assets/index-5f3a.js":        {Data: []byte("console.log('plain')")},
+	"assets/index-5f3a.js.gz":     {Data: []byte("gzipped")},
+	"assets/index-5f3a.js.br":     {Data: []byte("brotli")},
+	"assets/index-5f3a.css":       {Data: []byte("body{}")},
+	"assets/index-5f3a.css.gz":    {Data: []byte("gzipped css")},
+	"assets/images/logo-1b2c.png": {Data: []byte("png")},
+}
+
+func TestHandler(t *testing.T) {
+	api := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler := Handler(testAssets, api)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		acceptEncoding string
+		status         int
+		body           string
+		encoding       string
+		cacheControl   string
+		contentType    string
+	}{
+		{name: "index", path: "/", status: http.StatusOK, body: "<html>console</html>",
+			cacheControl: revalidateCacheControl, contentType: "text/html; charset=utf-8"},
+		{name: "spa route", path: "/vms/default/vm1", status: http.StatusOK, body: "<html>console</html>",
+			cacheControl: revalidateCacheControl},
+		{name: "missing asset", path: "/assets/missing-1a2b.js", status: http.StatusNotFound},
+		{name: "hashed asset", path: "/assets/index-5f3a.js", status: http.StatusOK, body: "console.log('plain')",
+			cacheControl: immutableCacheControl, contentType: "text/javascript; charset=utf-8"},
+		{name: "brotli preferred", path: "/assets/index-5f3a.js", acceptEncoding: "gzip, deflate, br",
+			status: http.StatusOK, body: "brotli", encoding: "br", contentType: "text/javascript; charset=utf-8"},
+		{name: "brotli refused", path: "/assets/index-5f3a.js", acceptEncoding: "gzip, br;q=0",
+			status: http.StatusOK, body: "gzipped", encoding: "gzip"},
+		{name: "gzip only", path: "/assets/index-5f3a.css", acceptEncoding: "br, gzip", status: http.StatusOK,
+			body: "gzipped css", encoding: "gzip", contentType: "text/css; charset=utf-8"},
+		{name: "unhashed file", path: "/favicon.svg", status: http.StatusOK, body: "<svg/>",
+			cacheControl: revalidateCacheControl},
+		{name: "api", path: "/api/v1/clusters", status: http.StatusTeapot},
+		{name: "api root", path: "/api", status: http.StatusTeapot},
+		{name: "mutation", method: http.MethodPost, path: "/vms", status: http.StatusTeapot},
+		{name: "api like page", path: "/apis", status: http.StatusOK, body: "<html>console</html>"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			method := test.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, test.path, nil)
+			if test.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", test.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != test.status {
+				t.Fatalf("expected status %d, got %d", test.status, rec.Code)
+			}
+			if test.body != "" && rec.Body.String() != test.body {
+				t.Errorf("expected body %q, got %q", test.body, rec.Body.String())
+			}
+			if got := rec.Header().Get("Content-Encoding"); got != test.encoding {
+				t.Errorf("expected encoding %q, got %q", test.encoding, got)
+			}
+			if test.cacheControl != "" && rec.Header().Get("Cache-Control") != test.cacheControl {
+				t.Errorf("expected cache control %q, got %q", test.cacheControl, rec.Header().Get("Cache-Control"))
+			}
+			if test.contentType != "" && rec.Header().Get("Content-Type") != test.contentType {
+				t.Errorf("expected content type %q, got %q", test.contentType, rec.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	if Load(Assets{FS: fstest.MapFS{".gitignore": {Data: []byte("*")}}}, "") != nil {
+		t.Error("expected no assets without index.html")
+	}
+	if Load(Assets{}, "") != nil {
+		t.Error("expected no assets while they aren't embedded")
+	}
+	if Load(Assets{FS: testAssets}, "") == nil {
+		t.Error("expected the embedded assets")
+	}
+	dir := t.TempDir()
+	if Load(Assets{FS: testAssets}, dir) != nil {
+		t.Error("expected the assets of the empty dir to take precedence")
+	}
+}
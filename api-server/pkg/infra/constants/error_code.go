@@ -12,7 +12,34 @@ const (
 	CodeInvalidData   = ErrorCode("PARAM.INVALID.DATA")
 
 	CodeInternalError            = ErrorCode("ERROR.INTERNAL")
+	CodeNotFound                 = ErrorCode("ERROR.NOT_FOUND")
+	CodeAlreadyExists            = ErrorCode("ERROR.ALREADY_EXISTS")
+	CodeConflict                 = ErrorCode("ERROR.CONFLICT")
+	CodeInvalid                  = ErrorCode("ERROR.INVALID")
+	CodeForbidden                = ErrorCode("ERROR.FORBIDDEN")
+	CodeUnauthorized             = ErrorCode("ERROR.UNAUTHORIZED")
+	CodeBadRequest               = ErrorCode("ERROR.BAD_REQUEST")
+	CodeTimeout                  = ErrorCode("ERROR.TIMEOUT")
+	CodeTooManyRequests          = ErrorCode("ERROR.TOO_MANY_REQUESTS")
+	CodeRequestTooLarge          = ErrorCode("ERROR.REQUEST_TOO_LARGE")
+	CodeServiceUnavailable       = ErrorCode("ERROR.SERVICE_UNAVAILABLE")
 	CodeBackingImageCreatedError = ErrorCode("ERROR.BACKINGIMAGE.CREATED.FAILED")
+	CodeLonghornNodeNotFound     = ErrorCode("ERROR.LONGHORN.NODE.NOT_FOUND")
+	CodeDiskNotFound             = ErrorCode("ERROR.LONGHORN.DISK.NOT_FOUND")
+	CodeSupportBundleFailed      = ErrorCode("ERROR.LONGHORN.SUPPORTBUNDLE.FAILED")
+	CodeSupportBundleNotReady    = ErrorCode("ERROR.LONGHORN.SUPPORTBUNDLE.NOT_READY")
+	CodeImageInUse               = ErrorCode("ERROR.IMAGE.IN_USE")
+	CodeTooManyUploads           = ErrorCode("ERROR.IMAGE.TOO_MANY_UPLOADS")
+	CodeAuditNotQueryable        = ErrorCode("ERROR.AUDIT.NOT_QUERYABLE")
+	CodeClusterNotFound          = ErrorCode("ERROR.CLUSTER.NOT_FOUND")
+	CodeClusterUnavailable       = ErrorCode("ERROR.CLUSTER.UNAVAILABLE")
+	CodeClusterReadOnly          = ErrorCode("ERROR.CLUSTER.READ_ONLY")
+	CodeProjectForbidden         = ErrorCode("ERROR.PROJECT.FORBIDDEN")
+	CodeProjectQuotaExceeded     = ErrorCode("ERROR.PROJECT.QUOTA_EXCEEDED")
+	CodePodForbidden             = ErrorCode("ERROR.POD.FORBIDDEN")
+	CodeLoggerForbidden          = ErrorCode("ERROR.LOGGER.FORBIDDEN")
+	CodeNamespaceForbidden       = ErrorCode("ERROR.NAMESPACE.FORBIDDEN")
+	CodeSettingsForbidden        = ErrorCode("ERROR.SETTINGS.FORBIDDEN")
 
 	CodeValidationFailed = ErrorCode("PARAM.VALIDATION.FAILED")
 )
@@ -0,0 +1,79 @@
+package constants
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+const bundleDir = "../../../cmd/server/resources/locales"
+
+// errorCodes parses the ErrorCode constants declared in error_code.go
+func errorCodes(t *testing.T) map[string]string {
+	file, err := parser.ParseFile(token.NewFileSet(), "error_code.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes := map[string]string{}
+	ast.Inspect(file, func(node ast.Node) bool {
+		spec, ok := node.(*ast.ValueSpec)
+		if !ok {
+			return true
+		}
+		for i, value := range spec.Values {
+			call, ok := value.(*ast.CallExpr)
+			if !ok || len(call.Args) != 1 {
+				continue
+			}
+			if fun, ok := call.Fun.(*ast.Ident); !ok || fun.Name != "ErrorCode" {
+				continue
+			}
+			lit, ok := call.Args[0].(*ast.BasicLit)
+			if !ok {
+				continue
+			}
+			code, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			codes[spec.Names[i].Name] = code
+		}
+		return false
+	})
+	return codes
+}
+
+func TestErrorCodesTranslated(t *testing.T) {
+	codes := errorCodes(t)
+	if len(codes) == 0 {
+		t.Fatal("no error code is found")
+	}
+
+	bundles, err := filepath.Glob(filepath.Join(bundleDir, "*."+ResourceBundleFormat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bundles) == 0 {
+		t.Fatalf("no bundle is found in %s", bundleDir)
+	}
+	for _, bundle := range bundles {
+		data, err := os.ReadFile(bundle)
+		if err != nil {
+			t.Fatal(err)
+		}
+		messages := map[string]any{}
+		if err = json.Unmarshal(data, &messages); err != nil {
+			t.Fatalf("invalid bundle %s: %v", bundle, err)
+		}
+		for name, code := range codes {
+			if message, ok := messages[code]; !ok || message == "" {
+				t.Errorf("%s lacks the translation of %s(%s)", filepath.Base(bundle), name, code)
+			}
+		}
+	}
+}
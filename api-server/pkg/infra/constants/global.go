@@ -1,5 +1,10 @@
 package constants
 
+import (
+	"net/http"
+	"time"
+)
+
 const (
 	NamespaceAll         = "all"
 	ResourceRootDir      = "./resources/locales/"
@@ -11,42 +16,168 @@ const (
 	SortByQueryField     = "sortBy"
 	SortOrderField       = "sortOrder"
 	FilterField          = "filter"
+	LangQueryField       = "lang"
+	LanguageKey          = "language"
+	RequestIdKey         = "requestId"
+	RequestIdHeader      = "X-Request-Id"
 	DefaultPage          = "1"
-	DefaultPageSize      = "10"
-
-	RootUri                = "/api/v1"
-	ClusterGroupUri        = RootUri + "/clusters"
-	NamespaceGroupUri      = RootUri + "/namespaces/:namespace"
-	ResourceUri            = "/:resource"
-	ResourceNameUri        = ResourceUri + "/:name"
-	ResourceImageUri       = "/images"
-	ResourceVmUri          = "/vms"
-	ResourceImageUploadUri = ResourceImageUri + "/:imageName/upload"
-	ResourceParam          = "resource"
-	ImageResourceParam     = "images"
+	DefaultPageSize      = 10
+
+	RootUri                          = "/api/v1"
+	ClustersUri                      = "/clusters"
+	ClusterNameUri                   = ClustersUri + "/:cluster"
+	ClusterGroupUri                  = RootUri + ClusterNameUri
+	NamespacesUri                    = "/namespaces"
+	NamespaceNameUri                 = NamespacesUri + "/:namespace"
+	NamespaceGroupUri                = ClusterGroupUri + NamespaceNameUri
+	ResourceUri                      = "/:resource"
+	ResourceNameUri                  = ResourceUri + "/:name"
+	ResourceEventsUri                = ResourceNameUri + "/events"
+	ResourceRelatedUri               = ResourceNameUri + "/related"
+	ResourceImageUri                 = "/images"
+	ResourceVmUri                    = "/vms"
+	ResourceImageNameUri             = ResourceImageUri + "/:name"
+	ResourceImageUploadUri           = ResourceImageNameUri + "/upload"
+	ResourceImageUsageUri            = ResourceImageNameUri + "/usage"
+	ResourcePodUri                   = "/pods"
+	ResourcePodNameUri               = ResourcePodUri + "/:name"
+	ResourcePodLogUri                = ResourcePodNameUri + "/log"
+	ResourcePodExecUri               = ResourcePodNameUri + "/exec"
+	ResourceNodeUri                  = "/nodes"
+	ResourceNodeNameUri              = ResourceNodeUri + "/:name"
+	ResourceNodeCordonUri            = ResourceNodeNameUri + "/cordon"
+	ResourceNodeUncordonUri          = ResourceNodeNameUri + "/uncordon"
+	ResourceNodeTagsUri              = ResourceNodeNameUri + "/tags"
+	ResourceNodeEvictUri             = ResourceNodeNameUri + "/eviction"
+	ResourceNodeEventsUri            = ResourceNodeNameUri + "/events"
+	ResourceNodeDiskUri              = ResourceNodeNameUri + "/disks/:disk"
+	ResourceDiskSchedulingUri        = ResourceNodeDiskUri + "/scheduling"
+	ResourceDiskTagsUri              = ResourceNodeDiskUri + "/tags"
+	ResourceSupportBundleUri         = "/supportbundles"
+	ResourceSupportBundleNameUri     = ResourceSupportBundleUri + "/:name"
+	ResourceSupportBundleDownloadUri = ResourceSupportBundleNameUri + "/download"
+	ResourceSystemBackupUri          = "/systembackups"
+	ResourceSystemRestoreUri         = "/systemrestores"
+	ResourceSettingsUri              = "/settings"
+	ResourceAuditUri                 = "/audits"
+	LoggersUri                       = "/loggers"
+	LoggerNameUri                    = LoggersUri + "/:name"
+	ResourceProjectUri               = "/projects"
+	ResourceProjectNameUri           = ResourceProjectUri + "/:name"
+	ResourceProjectUsageUri          = ResourceProjectNameUri + "/usage"
+	OpenApiUri                       = "/openapi.json"
+	SwaggerUiUri                     = "/docs"
+	SwaggerUiAssetsUri               = SwaggerUiUri + "/assets"
+	HealthzUri                       = "/healthz"
+	ReadyzUri                        = "/readyz"
+	ResourceParam                    = "resource"
+	ClusterParam                     = "cluster"
+	NamespaceParam                   = "namespace"
+	NamespaceResourceParam           = "namespaces"
+	ImageResourceParam               = "images"
+	ProjectResourceParam             = "projects"
+	NodeResourceParam                = "nodes"
+
+	// LocalClusterName the cluster which the api server is running in
+	LocalClusterName = "local"
+	// ClusterKey the key of the cluster resource selected by the request
+	ClusterKey = "clusterResource"
+	// LabelClusterKubeConfig marks the secrets storing the kubeconfig of the clusters
+	LabelClusterKubeConfig    = "kubeall.io/cluster"
+	ClusterKubeConfigKey      = "kubeconfig"
+	ClusterSecretPrefix       = "cluster-"
+	DefaultClusterNamespace   = "kubeall-system"
+	ClusterHealthCheckTimeout = 5 * time.Second
+	// ClusterConnectTimeout the timeout of loading the kubeconfig and creating the clients of a member cluster
+	ClusterConnectTimeout = 30 * time.Second
+
+	// DefaultUploadTimeout the timeout of uploading the content of an image to longhorn
+	DefaultUploadTimeout = 30 * time.Minute
+	// DefaultCacheSyncTimeout the duration waiting for the informers synced before the server accepts the requests
+	DefaultCacheSyncTimeout = 2 * time.Minute
+	// DefaultShutdownDelay the duration reporting not ready before the server stops accepting the connections
+	DefaultShutdownDelay = 5 * time.Second
+	// DefaultShutdownTimeout the deadline of the in-flight requests while the server is shutting down
+	DefaultShutdownTimeout = 2 * time.Minute
+	// DefaultMaxBodySize the max size of the json and yaml bodies while it's not configured
+	DefaultMaxBodySize = "4Mi"
+	// UploadRetryAfter the Retry-After of the uploads rejected since there're too many uploads in progress
+	UploadRetryAfter = 30 * time.Second
+	// DefaultLogLevel the log level while it's not configured
+	DefaultLogLevel = "INFO"
+	// ConfigEnvPrefix the prefix of the environment variables overriding the config
+	ConfigEnvPrefix = "KUBEALL_"
+
+	// DefaultShell the command run by the terminals of the pods while it isn't specified
+	DefaultShell = "/bin/sh"
+	// PodLogSubresource and PodExecSubresource the subresources of the pods checked by the SubjectAccessReviews
+	PodLogSubresource  = "log"
+	PodExecSubresource = "exec"
+
+	// DefaultUserHeader the header of the user name set by the authenticating proxy
+	DefaultUserHeader = "X-Remote-User"
 
 	JsonFormat                   = "json"
 	YamlFormat                   = "yaml"
 	DefaultBackingImageNamespace = "longhorn-system"
+	LonghornNamespace            = "longhorn-system"
 	BackingImagePrefix           = "bi-"
 	LonghornDriver               = "driver.longhorn.io"
 	ParamBiImageName             = "backingImage"
+	ParamNumberOfReplicas        = "numberOfReplicas"
+	ParamStaleReplicaTimeout     = "staleReplicaTimeout"
+
+	// the defaults of the global settings
+	DefaultNumberOfReplicas    = "3"
+	DefaultStaleReplicaTimeout = "30"
+	DefaultReclaimPolicy       = "Delete"
+	DefaultVolumeBindingMode   = "Immediate"
+	DefaultLonghornUploadUrl   = "http://longhorn-backend.longhorn-system:9500/v1/backingimages"
+	DefaultVmCpuCores          = 1
+	DefaultVmMemory            = "2Gi"
+	DefaultVmRunStrategy       = "Halted"
 
 	LabelImage          = "kubeall.io/image"
 	LabelImageNamespace = "kubeall.io/imageNamespace"
 	DefaultFinalizer    = "kubeall.io/finalizer"
 
+	// VarLonghornUploadUiPrefix the env var of the default upload url, the global setting takes precedence over it
 	VarLonghornUploadUiPrefix = "LONGHORN_UPLOAD_URL_PREFIX"
 
 	AnnotationPvcTemplates = "kubeall.io/pvcTemplates"
+	// AnnotationForceDelete the image is deleted even if it's used by pvcs
+	AnnotationForceDelete = "kubeall.io/forceDelete"
+	// AnnotationSchedulingBeforeEviction the scheduling of the longhorn node and its disks before their evictions are
+	// requested, it's restored once the evictions are cancelled
+	AnnotationSchedulingBeforeEviction = "kubeall.io/schedulingBeforeEviction"
 
 	MaxConcurrentReconciles = 2
+	// MaxRelatedNodes the nodes of a related graph are truncated beyond it
+	MaxRelatedNodes = 200
 
 	ValidateImageType = "required,oneof=iso disk"
+
+	LabelNodeRolePrefix = "node-role.kubernetes.io/"
+)
+
+// the route groups of the rate limits
+const (
+	RateLimitList    = "list"
+	RateLimitMutate  = "mutate"
+	RateLimitUpload  = "upload"
+	RateLimitConsole = "console"
 )
 
 var (
 	AvailablePageSizes = []int{10, 20, 50, 100}
-	//BackingImageUploadUri = "http://longhorn-backend.longhorn-system:9500/v1/backingimages"
-	BackingImageUploadUri = "http://192.168.1.66:31492/v1/backingimages"
+	RateLimitGroups    = []string{RateLimitList, RateLimitMutate, RateLimitUpload, RateLimitConsole}
+	// ConsoleUriSuffixes the interactive routes limited by the console rate limit, e.g. the logs and the terminals
+	ConsoleUriSuffixes = []string{"/log", "/exec", "/console", "/vnc"}
+	DefaultCorsMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete}
+	DefaultCorsHeaders = []string{"Accept", "Accept-Language", "Authorization", "Content-Type", RequestIdHeader}
+	// DefaultCorsExposedHeaders the response headers read by the console
+	DefaultCorsExposedHeaders = []string{RequestIdHeader, "Retry-After", "Content-Disposition"}
+	// DefaultLanguages the languages of the embedded bundles, the first one is the default language
+	DefaultLanguages = []string{"zh", "en"}
 )
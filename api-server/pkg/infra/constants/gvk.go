@@ -42,6 +42,7 @@ func (g GvkResource) initGvkResource() {
 
 	g.namespaceResource["images"] = &schema.GroupVersionKind{Group: "api.kubeall.io", Version: "v1", Kind: "Image"}
 	g.namespaceResource["globalsettings"] = &schema.GroupVersionKind{Group: "api.kubeall.io", Version: "v1", Kind: "GlobalSettings"}
+	g.namespaceResource["projects"] = &schema.GroupVersionKind{Group: "api.kubeall.io", Version: "v1", Kind: "Project"}
 
 	g.namespaceResource["vms"] = &schema.GroupVersionKind{Group: "kubevirt.io", Version: "v1", Kind: "VirtualMachine"}
 	g.namespaceResource["vminstances"] = &schema.GroupVersionKind{Group: "kubevirt.io", Version: "v1", Kind: "VirtualMachineInstance"}
@@ -74,3 +75,15 @@ func (g GvkResource) Get(key string) (*schema.GroupVersionKind, error) {
 	}
 	return nil, InvalidKind
 }
+
+// Resources returns all the resource keys and their GroupVersionKinds
+func (g GvkResource) Resources() map[string]*schema.GroupVersionKind {
+	resources := make(map[string]*schema.GroupVersionKind, len(g.namespaceResource)+len(g.clusterResource))
+	for key, gvk := range g.namespaceResource {
+		resources[key] = gvk
+	}
+	for key, gvk := range g.clusterResource {
+		resources[key] = gvk
+	}
+	return resources
+}
@@ -0,0 +1,150 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"kubeall.io/api-server/pkg/types"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// RootLogger the name of the global logger, the named loggers follow its level unless their levels are set
+	RootLogger = "root"
+	// RequestLogger the logger of the requests
+	RequestLogger = "request"
+	// ControllerLogger the logger of the reconciles
+	ControllerLogger = "controller"
+)
+
+// level the level of the global logger, it's changed by the admin api and while the config is reloaded
+var level = zap.NewAtomicLevel()
+
+var (
+	lock sync.RWMutex
+	// namedLevels the levels of the named loggers, they're registered by their first use
+	namedLevels = map[string]*namedLevel{
+		RequestLogger:    newNamedLevel(),
+		ControllerLogger: newNamedLevel(),
+	}
+)
+
+var (
+	ErrInvalidLevel   = errors.New("invalid log level")
+	ErrLoggerNotFound = errors.New("logger not found")
+)
+
+// namedLevel the level of a named logger, it follows the global level until it's set
+type namedLevel struct {
+	level zap.AtomicLevel
+	set   atomic.Bool
+}
+
+func newNamedLevel() *namedLevel {
+	return &namedLevel{level: zap.NewAtomicLevel()}
+}
+
+func (l *namedLevel) Enabled(lvl zapcore.Level) bool {
+	if l.set.Load() {
+		return l.level.Enabled(lvl)
+	}
+	return level.Enabled(lvl)
+}
+
+func (l *namedLevel) Level() zapcore.Level {
+	if l.set.Load() {
+		return l.level.Level()
+	}
+	return level.Level()
+}
+
+// levelCore filters the entries by the level of the logger, the cores built by InitLog accept all levels so that the
+// named loggers can be more verbose than the global one
+type levelCore struct {
+	zapcore.Core
+	level zapcore.LevelEnabler
+}
+
+func (c *levelCore) Enabled(lvl zapcore.Level) bool {
+	return c.level.Enabled(lvl)
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), level: c.level}
+}
+
+func (c *levelCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.level.Enabled(entry.Level) {
+		return checked
+	}
+	return c.Core.Check(entry, checked)
+}
+
+// Named returns the named child of the global logger, its level can be set apart from the global one by SetLevel
+func Named(name string) *zap.Logger {
+	lock.Lock()
+	l, ok := namedLevels[name]
+	if !ok {
+		l = newNamedLevel()
+		namedLevels[name] = l
+	}
+	lock.Unlock()
+
+	return zap.L().Named(name).WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		if c, ok := core.(*levelCore); ok {
+			core = c.Core
+		}
+		return &levelCore{Core: core, level: l}
+	}))
+}
+
+// Levels returns the levels of the global logger and the named loggers
+func Levels() []types.LoggerLevel {
+	lock.RLock()
+	defer lock.RUnlock()
+	levels := []types.LoggerLevel{{Name: RootLogger, Level: level.Level().CapitalString()}}
+	for name, l := range namedLevels {
+		levels = append(levels, types.LoggerLevel{Name: name, Level: l.Level().CapitalString(), Inherited: !l.set.Load()})
+	}
+	sort.Slice(levels[1:], func(i, j int) bool {
+		return levels[i+1].Name < levels[j+1].Name
+	})
+	return levels
+}
+
+// SetLevel sets the level of the global logger or a named logger, the named logger follows the global level again if
+// the level is empty
+func SetLevel(name, lvl string) (types.LoggerLevel, error) {
+	lvl = strings.ToUpper(lvl)
+	var parsed zapcore.Level
+	if lvl != "" || name == RootLogger {
+		var ok bool
+		if parsed, ok = logLevelMap[lvl]; !ok {
+			return types.LoggerLevel{}, fmt.Errorf("%w: %s", ErrInvalidLevel, lvl)
+		}
+	}
+	if name == RootLogger {
+		level.SetLevel(parsed)
+		zap.L().Info("log level is changed", zap.String("logger", name), zap.Stringer("level", parsed))
+		return types.LoggerLevel{Name: name, Level: parsed.CapitalString()}, nil
+	}
+
+	lock.RLock()
+	l, ok := namedLevels[name]
+	lock.RUnlock()
+	if !ok {
+		return types.LoggerLevel{}, fmt.Errorf("%w: %s", ErrLoggerNotFound, name)
+	}
+	if lvl == "" {
+		l.set.Store(false)
+	} else {
+		l.level.SetLevel(parsed)
+		l.set.Store(true)
+	}
+	zap.L().Info("log level is changed", zap.String("logger", name), zap.String("level", lvl))
+	return types.LoggerLevel{Name: name, Level: l.Level().CapitalString(), Inherited: !l.set.Load()}, nil
+}
@@ -0,0 +1,43 @@
+package logger
+
+import (
+	"errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"testing"
+)
+
+func TestSetLevel(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	defer zap.ReplaceGlobals(zap.L())
+	zap.ReplaceGlobals(zap.New(&levelCore{Core: core, level: level}))
+	level.SetLevel(zapcore.InfoLevel)
+
+	request := Named(RequestLogger)
+	request.Debug("hidden")
+	if _, err := SetLevel(RequestLogger, "debug"); err != nil {
+		t.Fatal(err)
+	}
+	request.Debug("shown")
+	zap.L().Debug("hidden")
+	if logs.FilterMessage("shown").Len() != 1 || logs.FilterMessage("hidden").Len() != 0 {
+		t.Errorf("got logs %v", logs.All())
+	}
+
+	// the named logger follows the root logger again
+	got, err := SetLevel(RequestLogger, "")
+	if err != nil || !got.Inherited || got.Level != "INFO" {
+		t.Errorf("got level %+v, %v", got, err)
+	}
+	if _, err = SetLevel(RootLogger, ""); !errors.Is(err, ErrInvalidLevel) {
+		t.Errorf("got error %v", err)
+	}
+	if _, err = SetLevel("unknown", "info"); !errors.Is(err, ErrLoggerNotFound) {
+		t.Errorf("got error %v", err)
+	}
+	levels := Levels()
+	if levels[0].Name != RootLogger || len(levels) < 3 {
+		t.Errorf("got levels %+v", levels)
+	}
+}
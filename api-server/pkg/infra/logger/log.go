@@ -4,6 +4,7 @@ import (
 	"github.com/natefinch/lumberjack"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	kaconfig "kubeall.io/api-server/pkg/infra/config"
 	"kubeall.io/api-server/pkg/types"
 	"os"
 )
@@ -18,20 +19,32 @@ var logLevelMap = map[string]zapcore.Level{
 	"FATAL":  zapcore.FatalLevel,
 }
 
-func NewLogger(config types.Config) *zap.Logger {
-	return InitLog(config)
+func NewLogger(config types.Config, watcher kaconfig.Watcher) *zap.Logger {
+	lg := InitLog(config)
+	// the level set by the admin api is kept until the level in the config is changed
+	configured := config.(*types.ServerConfig).LogSetting.LogLevel
+	watcher.Subscribe(func(cfg *types.ServerConfig) {
+		if cfg.LogSetting.LogLevel == configured {
+			return
+		}
+		configured = cfg.LogSetting.LogLevel
+		if _, err := SetLevel(RootLogger, configured); err != nil {
+			zap.L().Warn("failed to change the log level", zap.Error(err))
+		}
+	})
+	return lg
 }
 
 // InitLog 日志初始化
 func InitLog(config types.Config) *zap.Logger {
 	serverCfg := config.(*types.ServerConfig)
 	cfg := serverCfg.LogSetting
-	level, ok := logLevelMap[cfg.LogLevel]
+	l, ok := logLevelMap[cfg.LogLevel]
 	if !ok {
 		panic("the log_level is invalid, it only supports: DEBUG,INFO,WARN, ERROR,DPANIC,PANIC,FATAL.  ")
 	}
 
-	atomicLevel := zap.NewAtomicLevelAt(level)
+	level.SetLevel(l)
 
 	encoderConfig := zapcore.EncoderConfig{
 		TimeKey:        "time",
@@ -50,20 +63,7 @@ func InitLog(config types.Config) *zap.Logger {
 	}
 
 	// 日志轮转
-	writer := &lumberjack.Logger{
-		// 日志名称
-		Filename: cfg.FileName,
-		// 日志大小限制，单位MB
-		MaxSize: cfg.MaxSizeInMB,
-		// 历史日志文件保留天数
-		MaxAge: cfg.MaxAgeInDays,
-		// 最大保留历史日志数量
-		MaxBackups: cfg.MaxBackups,
-		// 本地时区
-		LocalTime: true,
-		// 历史日志文件压缩
-		Compress: cfg.Compress,
-	}
+	writer := NewRotatingWriter(cfg.FileName, cfg.MaxSizeInMB, cfg.MaxAgeInDays, cfg.MaxBackups, cfg.Compress)
 
 	syncers := []zapcore.WriteSyncer{zapcore.AddSync(writer)}
 	if cfg.OutputConsole {
@@ -71,11 +71,15 @@ func InitLog(config types.Config) *zap.Logger {
 		syncers = append(syncers, zapcore.AddSync(os.Stdout))
 	}
 
-	zapCore := zapcore.NewCore(
-		zapcore.NewJSONEncoder(encoderConfig),
-		zapcore.NewMultiWriteSyncer(syncers...),
-		atomicLevel,
-	)
+	// all levels are accepted by the core, the entries are filtered by the levels of the loggers
+	zapCore := &levelCore{
+		Core: zapcore.NewCore(
+			zapcore.NewJSONEncoder(encoderConfig),
+			zapcore.NewMultiWriteSyncer(syncers...),
+			zapcore.DebugLevel,
+		),
+		level: level,
+	}
 
 	// 开启开发模式，堆栈跟踪
 	options := []zap.Option{zap.AddCaller()}
@@ -95,3 +99,21 @@ func InitLog(config types.Config) *zap.Logger {
 
 	return lg
 }
+
+// NewRotatingWriter 创建按大小轮转的文件, 日志和审计日志共用
+func NewRotatingWriter(fileName string, maxSizeInMB, maxAgeInDays, maxBackups int, compress bool) *lumberjack.Logger {
+	return &lumberjack.Logger{
+		// 日志名称
+		Filename: fileName,
+		// 日志大小限制，单位MB
+		MaxSize: maxSizeInMB,
+		// 历史日志文件保留天数
+		MaxAge: maxAgeInDays,
+		// 最大保留历史日志数量
+		MaxBackups: maxBackups,
+		// 本地时区
+		LocalTime: true,
+		// 历史日志文件压缩
+		Compress: compress,
+	}
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+	"time"
+)
+
+const cacheListTimeout = 5 * time.Second
+
+var cacheObjectsDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "informer", "cache_objects"),
+	"Number of objects in the informer cache by resource.",
+	[]string{"resource"}, nil,
+)
+
+// cacheCollector reports the number of objects in the informer cache while metrics are scraped. The cache is
+// resolved lazily, since the controller manager replaces the cluster after the collector is registered.
+type cacheCollector struct {
+	cache     func() cache.Cache
+	resources map[string]func() client.ObjectList
+}
+
+// RegisterCacheCollector registers a collector reporting the size of the resources' informers
+func RegisterCacheCollector(c func() cache.Cache, resources map[string]func() client.ObjectList) error {
+	return ctrlmetrics.Registry.Register(&cacheCollector{cache: c, resources: resources})
+}
+
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheObjectsDesc
+}
+
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	informerCache := c.cache()
+	if informerCache == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cacheListTimeout)
+	defer cancel()
+	for resource, newList := range c.resources {
+		list := newList()
+		if err := informerCache.List(ctx, list); err != nil {
+			zap.L().Warn("failed to list objects from cache", zap.String("resource", resource), zap.Error(err))
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(cacheObjectsDesc, prometheus.GaugeValue,
+			float64(meta.LenList(list)), resource)
+	}
+}
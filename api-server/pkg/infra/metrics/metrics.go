@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+	"time"
+)
+
+// the metrics are registered to the registry of controller runtime, so that the controller manager exposes them
+// with the reconcile metrics of controller runtime, and the api server exposes the same registry by its own server
+const namespace = "kubeall"
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Total number of HTTP requests by method, resource and status code.",
+	}, []string{"method", "resource", "code"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of HTTP requests by method, resource and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "resource", "code"})
+
+	imageUploadBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "image",
+		Name:      "upload_bytes_total",
+		Help:      "Total bytes of image content uploaded to backing images.",
+	})
+
+	imageUploadDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "image",
+		Name:      "upload_duration_seconds",
+		Help:      "Duration of uploading image content.",
+		// from 1 second to about 4.5 hours
+		Buckets: prometheus.ExponentialBuckets(1, 2, 15),
+	})
+
+	imageUploadThroughput = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "image",
+		Name:      "upload_throughput_bytes_per_second",
+		Help:      "Throughput of the successful image uploads.",
+		// from 1MB/s to about 1GB/s
+		Buckets: prometheus.ExponentialBuckets(1<<20, 2, 11),
+	})
+
+	imageUploadFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "image",
+		Name:      "upload_failures_total",
+		Help:      "Total number of failed image uploads.",
+	})
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(
+		httpRequests,
+		httpRequestDuration,
+		imageUploadBytes,
+		imageUploadDuration,
+		imageUploadThroughput,
+		imageUploadFailures,
+	)
+}
+
+// ObserveImageUpload records an upload of image content, the bytes are counted even if the upload failed
+func ObserveImageUpload(bytes int64, duration time.Duration, err error) {
+	imageUploadBytes.Add(float64(bytes))
+	imageUploadDuration.Observe(duration.Seconds())
+	if err != nil {
+		imageUploadFailures.Inc()
+		return
+	}
+	if seconds := duration.Seconds(); seconds > 0 {
+		imageUploadThroughput.Observe(float64(bytes) / seconds)
+	}
+}
@@ -0,0 +1,37 @@
+package metrics
+
+import (
+	"github.com/gin-gonic/gin"
+	"strconv"
+	"time"
+)
+
+// unmatchedResource is the resource of requests not matching any route, the paths aren't used as labels
+// to keep the cardinality bounded
+const unmatchedResource = "unmatched"
+
+// GinMiddleware records the count and latency of requests per resource and status code
+func GinMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+
+		code := strconv.Itoa(ctx.Writer.Status())
+		resource := requestResource(ctx)
+		httpRequests.WithLabelValues(ctx.Request.Method, resource, code).Inc()
+		httpRequestDuration.WithLabelValues(ctx.Request.Method, resource, code).Observe(time.Since(start).Seconds())
+	}
+}
+
+// requestResource returns the resource of the generic routes, or the template of the other routes
+func requestResource(ctx *gin.Context) string {
+	route := ctx.FullPath()
+	if route == "" {
+		return unmatchedResource
+	}
+	// the resources unknown are rejected, the route is used instead of the values sent by clients
+	if resource := ctx.Param("resource"); resource != "" && ctx.Writer.Status() < 400 {
+		return resource
+	}
+	return route
+}
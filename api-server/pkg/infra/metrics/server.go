@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+	"net/http"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// DisabledBindAddress disables the metrics server, the same as controller runtime
+const DisabledBindAddress = "0"
+
+const metricsPath = "/metrics"
+
+// Serve exposes the metrics at /metrics on the bind address in the background, the returned server is shut down by
+// the caller, it's nil if the metrics server is disabled
+func Serve(bindAddress string) *http.Server {
+	if bindAddress == "" || bindAddress == DisabledBindAddress {
+		zap.L().Info("metrics server is disabled")
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, promhttp.HandlerFor(ctrlmetrics.Registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Addr: bindAddress, Handler: mux}
+	go func() {
+		zap.L().Info("metrics server started", zap.String("address", bindAddress))
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			zap.L().Error("failed to run metrics server", zap.Error(err))
+		}
+	}()
+	return server
+}
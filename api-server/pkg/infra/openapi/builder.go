@@ -0,0 +1,412 @@
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/openapi"
+	"kubeall.io/api-server/pkg/infra/apiserver"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	openApiVersion  = "3.0.3"
+	schemaRefPrefix = "#/components/schemas/"
+	resultSchema    = "Result"
+	pageSchema      = "PageResult"
+	// gvkExtension the extension of the kubernetes schemas telling the kinds they describe
+	gvkExtension = "x-kubernetes-group-version-kind"
+)
+
+// Document an OpenAPI 3 document
+type Document map[string]any
+
+// Builder assembles the OpenAPI document from the registered routes, the generic /:resource routes are expanded for
+// every resource of GvkResource with the schemas discovered from the local cluster
+type Builder interface {
+	// Build returns the cached document, it's rebuilt if refresh is true
+	Build(ctx context.Context, routes gin.RoutesInfo, refresh bool) (Document, error)
+}
+
+type builderImpl struct {
+	clusterResource apiserver.ClusterResource
+	gvkResource     *constants.GvkResource
+
+	lock     sync.Mutex
+	document Document
+}
+
+func NewBuilder(clusterResource apiserver.ClusterResource, gvkResource *constants.GvkResource) Builder {
+	return &builderImpl{clusterResource: clusterResource, gvkResource: gvkResource}
+}
+
+// resourceSchema the scope and the schema name of a resource
+type resourceSchema struct {
+	key        string
+	namespaced bool
+	schemaName string
+}
+
+func (b *builderImpl) Build(_ context.Context, routes gin.RoutesInfo, refresh bool) (Document, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.document != nil && !refresh {
+		return b.document, nil
+	}
+
+	schemas := map[string]any{
+		resultSchema: resultSchemaOf(),
+		pageSchema:   pageSchemaOf(),
+	}
+	resources, err := b.discoverSchemas(schemas)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := map[string]map[string]any{}
+	// the explicit routes take precedence over the generic ones
+	sort.SliceStable(routes, func(i, j int) bool {
+		return !isGeneric(routes[i].Path) && isGeneric(routes[j].Path)
+	})
+	for _, route := range routes {
+		if !strings.HasPrefix(route.Path, constants.RootUri) {
+			continue
+		}
+		if isGeneric(route.Path) {
+			for _, resource := range resources {
+				addGenericOperation(paths, route, resource)
+			}
+			continue
+		}
+		addOperation(paths, openApiPath(route.Path), strings.ToLower(route.Method), explicitOperation(route))
+	}
+
+	b.document = Document{
+		"openapi": openApiVersion,
+		"info": map[string]any{
+			"title":   "kubeall api-server",
+			"version": path.Base(constants.RootUri),
+		},
+		"paths":      paths,
+		"components": map[string]any{"schemas": schemas},
+	}
+	zap.L().Info("the openapi document is built", zap.Int("paths", len(paths)), zap.Int("schemas", len(schemas)))
+	return b.document, nil
+}
+
+// discoverSchemas resolves the scope of the resources by the rest mapper, and adds their schemas and the referenced
+// ones from the OpenAPI v3 discovery of the cluster. The resources not served by the cluster are skipped.
+func (b *builderImpl) discoverSchemas(schemas map[string]any) ([]resourceSchema, error) {
+	discovery := b.clusterResource.Client().K8sClient().Discovery().OpenAPIV3()
+	gvPaths, err := discovery.Paths()
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover the openapi paths: %w", err)
+	}
+
+	mapper := b.clusterResource.RuntimeClient().RESTMapper()
+	gvSchemas := map[schema.GroupVersion]map[string]any{}
+	var resources []resourceSchema
+	for key, gvk := range b.gvkResource.Resources() {
+		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			zap.L().Debug("skip the resource not served by the cluster", zap.String("resource", key), zap.Error(err))
+			continue
+		}
+
+		gv := gvk.GroupVersion()
+		components, ok := gvSchemas[gv]
+		if !ok {
+			components, err = fetchSchemas(gvPaths, gv)
+			if err != nil {
+				zap.L().Warn("failed to fetch the schemas", zap.Any("groupVersion", gv), zap.Error(err))
+			}
+			gvSchemas[gv] = components
+		}
+		name := schemaNameOf(components, *gvk)
+		if name != "" {
+			copySchema(components, schemas, name)
+		}
+		resources = append(resources, resourceSchema{
+			key:        key,
+			namespaced: mapping.Scope.Name() == meta.RESTScopeNameNamespace,
+			schemaName: name,
+		})
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].key < resources[j].key
+	})
+	return resources, nil
+}
+
+// fetchSchemas returns the components.schemas of the group version's document, the core group is served at api/v1
+func fetchSchemas(gvPaths map[string]openapi.GroupVersion, gv schema.GroupVersion) (map[string]any, error) {
+	key := "apis/" + gv.String()
+	if gv.Group == "" {
+		key = "api/" + gv.Version
+	}
+	gvPath, ok := gvPaths[key]
+	if !ok {
+		return nil, fmt.Errorf("%s isn't served", key)
+	}
+	data, err := gvPath.Schema(runtime.ContentTypeJSON)
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Components struct {
+			Schemas map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	if err = json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return doc.Components.Schemas, nil
+}
+
+// schemaNameOf finds the schema of the kind by its x-kubernetes-group-version-kind extension
+func schemaNameOf(components map[string]any, gvk schema.GroupVersionKind) string {
+	for name, s := range components {
+		kinds, _ := s.(map[string]any)[gvkExtension].([]any)
+		for _, kind := range kinds {
+			k, _ := kind.(map[string]any)
+			if k["group"] == gvk.Group && k["version"] == gvk.Version && k["kind"] == gvk.Kind {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// copySchema copies the schema and the ones referenced by it recursively
+func copySchema(from, to map[string]any, name string) {
+	if _, ok := to[name]; ok {
+		return
+	}
+	s, ok := from[name]
+	if !ok {
+		return
+	}
+	to[name] = s
+	for _, ref := range refsOf(s) {
+		copySchema(from, to, ref)
+	}
+}
+
+// refsOf returns the names of the schemas referenced by the value
+func refsOf(value any) []string {
+	var refs []string
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			if ref, ok := child.(string); ok && key == "$ref" {
+				refs = append(refs, strings.TrimPrefix(ref, schemaRefPrefix))
+				continue
+			}
+			refs = append(refs, refsOf(child)...)
+		}
+	case []any:
+		for _, child := range v {
+			refs = append(refs, refsOf(child)...)
+		}
+	}
+	return refs
+}
+
+// isGeneric returns true if the route serves any resource by the :resource param
+func isGeneric(ginPath string) bool {
+	return strings.Contains(ginPath, "/:"+constants.ResourceParam)
+}
+
+// openApiPath converts the params of gin, e.g. /:name and /*path, to the ones of OpenAPI
+func openApiPath(ginPath string) string {
+	segments := strings.Split(ginPath, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func pathParams(openApiPath string) []any {
+	var params []any
+	for _, segment := range strings.Split(openApiPath, "/") {
+		if strings.HasPrefix(segment, "{") {
+			params = append(params, map[string]any{
+				"name":     strings.Trim(segment, "{}"),
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]any{"type": "string"},
+			})
+		}
+	}
+	return params
+}
+
+// addOperation adds the operation to the path if the method isn't described yet
+func addOperation(paths map[string]map[string]any, openApiPath, method string, operation map[string]any) {
+	item, ok := paths[openApiPath]
+	if !ok {
+		item = map[string]any{"parameters": pathParams(openApiPath)}
+		paths[openApiPath] = item
+	}
+	if _, ok = item[method]; !ok {
+		item[method] = operation
+	}
+}
+
+// explicitOperation describes the route by its handler, e.g. image.imageHandlerImpl.Upload-fm is described as Upload
+func explicitOperation(route gin.RouteInfo) map[string]any {
+	handler := path.Base(route.Handler)
+	pkg, _, _ := strings.Cut(handler, ".")
+	name := strings.TrimSuffix(handler[strings.LastIndex(handler, ".")+1:], "-fm")
+	return map[string]any{
+		"tags":        []string{pkg},
+		"summary":     name,
+		"operationId": pkg + "." + name + "." + strings.ToLower(route.Method),
+		"responses": map[string]any{
+			"200":     map[string]any{"description": "OK"},
+			"default": resultResponse(),
+		},
+	}
+}
+
+// addGenericOperation expands the generic route for the resource, the namespaced resources are served by the
+// namespaced routes and the others by the cluster routes
+func addGenericOperation(paths map[string]map[string]any, route gin.RouteInfo, resource resourceSchema) {
+	namespacedRoute := strings.Contains(route.Path, "/:"+constants.NamespaceParam+"/")
+	if namespacedRoute != resource.namespaced {
+		return
+	}
+	openApiPath := openApiPath(strings.Replace(route.Path, ":"+constants.ResourceParam, resource.key, 1))
+	isItem := strings.HasSuffix(route.Path, "/:name")
+	method := strings.ToLower(route.Method)
+
+	operation := map[string]any{
+		"tags":        []string{resource.key},
+		"operationId": resource.key + "." + genericAction(method, isItem) + "." + scopeOf(namespacedRoute),
+		"summary":     genericAction(method, isItem) + " " + resource.key,
+		"responses":   map[string]any{"default": resultResponse()},
+	}
+	responses := operation["responses"].(map[string]any)
+	switch {
+	case method == "get" && !isItem:
+		operation["parameters"] = listParams()
+		responses["200"] = jsonResponse(pageSchemaFor(resource.schemaName))
+	case method == "get":
+		responses["200"] = jsonResponse(refOrObject(resource.schemaName))
+	case method == "post" || method == "put":
+		operation["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"application/json": map[string]any{"schema": refOrObject(resource.schemaName)}},
+		}
+		responses["200"] = map[string]any{"description": "OK"}
+	default:
+		responses["200"] = map[string]any{"description": "OK"}
+	}
+	addOperation(paths, openApiPath, method, operation)
+}
+
+func genericAction(method string, isItem bool) string {
+	switch method {
+	case "get":
+		if isItem {
+			return "get"
+		}
+		return "list"
+	case "post":
+		return "create"
+	case "put":
+		return "update"
+	}
+	return method
+}
+
+func scopeOf(namespaced bool) string {
+	if namespaced {
+		return "namespaced"
+	}
+	return "cluster"
+}
+
+func listParams() []any {
+	query := func(name, description, typ string) map[string]any {
+		return map[string]any{"name": name, "in": "query", "description": description, "schema": map[string]any{"type": typ}}
+	}
+	return []any{
+		query(constants.PageQueryField, "starts from 1", "integer"),
+		query(constants.PageSizeQueryField, "the default page size of the global settings is used if it's not set", "integer"),
+		query(constants.SortByQueryField, "the field to sort by, e.g. metadata.name", "string"),
+		query(constants.SortOrderField, "asc or desc", "string"),
+		query(constants.FilterField, "the json object of the fields to filter by", "string"),
+	}
+}
+
+func refOrObject(schemaName string) map[string]any {
+	if schemaName == "" {
+		return map[string]any{"type": "object"}
+	}
+	return map[string]any{"$ref": schemaRefPrefix + schemaName}
+}
+
+func jsonResponse(s map[string]any) map[string]any {
+	return map[string]any{
+		"description": "OK",
+		"content":     map[string]any{"application/json": map[string]any{"schema": s}},
+	}
+}
+
+func resultResponse() map[string]any {
+	response := jsonResponse(refOrObject(resultSchema))
+	response["description"] = "the error"
+	return response
+}
+
+// pageSchemaFor narrows the items of the page to the resource
+func pageSchemaFor(schemaName string) map[string]any {
+	return map[string]any{
+		"allOf": []any{
+			refOrObject(pageSchema),
+			map[string]any{"properties": map[string]any{
+				"items": map[string]any{"type": "array", "items": refOrObject(schemaName)},
+			}},
+		},
+	}
+}
+
+// resultSchemaOf describes types.Result
+func resultSchemaOf() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"code":        map[string]any{"type": "string", "description": "the error code, the message is localized by it"},
+			"payload":     map[string]any{"description": "the details of the error"},
+			"message":     map[string]any{"type": "string"},
+			"fieldErrors": map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}},
+			"statusCode":  map[string]any{"type": "integer"},
+		},
+	}
+}
+
+// pageSchemaOf describes types.PageResult
+func pageSchemaOf() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"page":       map[string]any{"type": "integer"},
+			"pageSize":   map[string]any{"type": "integer"},
+			"totalItems": map[string]any{"type": "integer"},
+			"totalPages": map[string]any{"type": "integer"},
+			"items":      map[string]any{"type": "array", "items": map[string]any{"type": "object"}},
+		},
+	}
+}
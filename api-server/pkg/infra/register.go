@@ -4,9 +4,12 @@ import (
 	"embed"
 	"go.uber.org/fx"
 	"kubeall.io/api-server/pkg/infra/apiserver"
+	"kubeall.io/api-server/pkg/infra/audit"
 	"kubeall.io/api-server/pkg/infra/clients"
 	"kubeall.io/api-server/pkg/infra/config"
 	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/openapi"
+	"kubeall.io/api-server/pkg/infra/tracing"
 	"kubeall.io/api-server/pkg/infra/validator_resource"
 	"kubeall.io/api-server/pkg/types"
 
@@ -19,13 +22,18 @@ func NewInfraModule(params *types.StartupParams, localeFs embed.FS, schemeType t
 		fx.Supply(params, localeFs, schemeType),
 		fx.Provide(
 			config.NewServerConfig,
+			config.NewWatcher,
 			logger.NewLogger,
 			clients.NewClients,
 			apiserver.NewClusterResource,
+			apiserver.NewClusterRegistry,
+			audit.NewAuditor,
 			apiserver.NewRestServer,
+			openapi.NewBuilder,
 			constants.NewGvkResource,
 			validator_resource.NewValidatorTranslator,
 		),
+		fx.Invoke(tracing.Setup),
 	)
 }
 
@@ -35,11 +43,13 @@ func NewInfraModuleForCm(params *types.StartupParams, localeFs embed.FS, schemeT
 		fx.Supply(params, localeFs, schemeType),
 		fx.Provide(
 			config.NewServerConfig,
+			config.NewWatcher,
 			logger.NewLogger,
 			clients.NewClients,
 			apiserver.NewClusterResourceForCm,
 			constants.NewGvkResource,
 			validator_resource.NewValidatorTranslator,
 		),
+		fx.Invoke(tracing.Setup),
 	)
 }
@@ -0,0 +1,122 @@
+package tracing
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"k8s.io/client-go/rest"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+	"net/url"
+)
+
+const (
+	instrumentationName = "kubeall.io/api-server"
+	defaultTracesPath   = "/v1/traces"
+)
+
+// Setup installs the global tracer provider exporting the spans by OTLP over HTTP, the spans are dropped if the
+// tracing isn't enabled. The tracers created before it, e.g. by the transports of the clients, are delegated to the
+// provider once it's installed.
+func Setup(config types.Config, logger *zap.Logger, lifecycle fx.Lifecycle) error {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	cfg := config.(*types.ServerConfig)
+	if cfg.Tracing == nil || !cfg.Tracing.Enabled {
+		return nil
+	}
+	provider, err := NewTracerProvider(context.Background(), cfg.ApplicationName, cfg.Tracing)
+	if err != nil {
+		return err
+	}
+	otel.SetTracerProvider(provider)
+	logger.Info("tracing is enabled", zap.String("endpoint", cfg.Tracing.Endpoint))
+
+	lifecycle.Append(fx.StopHook(func(ctx context.Context) error {
+		// flush the spans in the batch
+		return provider.Shutdown(ctx)
+	}))
+	return nil
+}
+
+// NewTracerProvider creates the provider exporting the spans of the service to the OTLP endpoint
+func NewTracerProvider(ctx context.Context, serviceName string, config *types.TracingConfig) (*sdktrace.TracerProvider, error) {
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Path == "" || endpoint.Path == "/" {
+		endpoint.Path = defaultTracesPath
+	}
+	exporter, err := otlptracehttp.New(ctx,
+		otlptracehttp.WithEndpointURL(endpoint.String()),
+		otlptracehttp.WithHeaders(config.Headers),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.ServiceName != "" {
+		serviceName = config.ServiceName
+	}
+	ratio := config.SampleRatio
+	if ratio <= 0 {
+		ratio = 1
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	), nil
+}
+
+// GinMiddleware creates the server spans of the requests, the spans of the upstream are continued
+func GinMiddleware(serviceName string) gin.HandlerFunc {
+	return otelgin.Middleware(serviceName)
+}
+
+// WrapConfig instruments the transport of the clients created by the rest config, the watches are skipped since
+// their spans would last as long as the watches
+func WrapConfig(config *rest.Config) {
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return otelhttp.NewTransport(rt, otelhttp.WithFilter(func(request *http.Request) bool {
+			return request.URL.Query().Get("watch") != "true"
+		}))
+	})
+}
+
+// NewTransport instruments the transport, the default transport is used if it's nil
+func NewTransport(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return otelhttp.NewTransport(rt)
+}
+
+// Start starts a span as the child of the one in the context. The gin context isn't changed, the returned context
+// wraps it so that the services can still read the request by gin.ContextKey, and the parent span of the request is
+// found since the values of the gin context fall back to the request's.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records the error to the span and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
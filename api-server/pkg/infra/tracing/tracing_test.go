@@ -0,0 +1,136 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracev1 "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// collector receives the spans exported by OTLP over HTTP
+type collector struct {
+	sync.Mutex
+	path    string
+	headers http.Header
+	spans   []*tracev1.Span
+	service string
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	request := &collectortrace.ExportTraceServiceRequest{}
+	if err = proto.Unmarshal(body, request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	c.path = r.URL.Path
+	c.headers = r.Header
+	for _, resourceSpans := range request.ResourceSpans {
+		for _, attr := range resourceSpans.Resource.Attributes {
+			if attr.Key == "service.name" {
+				c.service = attr.Value.GetStringValue()
+			}
+		}
+		for _, scopeSpans := range resourceSpans.ScopeSpans {
+			c.spans = append(c.spans, scopeSpans.Spans...)
+		}
+	}
+
+	data, _ := proto.Marshal(&collectortrace.ExportTraceServiceResponse{})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	_, _ = w.Write(data)
+}
+
+func TestNewTracerProvider(t *testing.T) {
+	c := &collector{}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	ctx := context.Background()
+	provider, err := NewTracerProvider(ctx, "api-server", &types.TracingConfig{
+		Enabled:  true,
+		Endpoint: server.URL,
+		Headers:  map[string]string{"Authorization": "Bearer token"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tracer := provider.Tracer(instrumentationName)
+	parentCtx, parent := tracer.Start(ctx, "parent")
+	_, child := tracer.Start(parentCtx, "child", trace.WithAttributes(attribute.String("name", "vm1")))
+	End(child, errors.New("boom"))
+	End(parent, nil)
+	if err = provider.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if c.path != defaultTracesPath {
+		t.Errorf("got path %s, want %s", c.path, defaultTracesPath)
+	}
+	if c.headers.Get("Authorization") != "Bearer token" {
+		t.Errorf("got headers %v", c.headers)
+	}
+	if c.service != "api-server" {
+		t.Errorf("got service %s", c.service)
+	}
+	spans := map[string]*tracev1.Span{}
+	for _, span := range c.spans {
+		spans[span.Name] = span
+	}
+	if len(spans) != 2 || spans["parent"] == nil || spans["child"] == nil {
+		t.Fatalf("got spans %v", spans)
+	}
+	if string(spans["child"].ParentSpanId) != string(spans["parent"].SpanId) {
+		t.Errorf("the child isn't the child of the parent")
+	}
+	if spans["child"].Status.Code != tracev1.Status_STATUS_CODE_ERROR || spans["child"].Status.Message != "boom" {
+		t.Errorf("got status %v, want %s", spans["child"].Status, codes.Error)
+	}
+}
+
+func TestStartOfGinContext(t *testing.T) {
+	provider := sdktrace.NewTracerProvider()
+	defer func() { _ = provider.Shutdown(context.Background()) }()
+	parentCtx, parent := provider.Tracer(instrumentationName).Start(context.Background(), "request")
+	defer parent.End()
+
+	engine := gin.New()
+	engine.ContextWithFallback = true
+	ginCtx := gin.CreateTestContextOnly(httptest.NewRecorder(), engine)
+	request := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(parentCtx)
+	ginCtx.Request = request
+
+	ctx, span := Start(ginCtx, "child")
+	End(span, nil)
+	if ginCtx.Request != request {
+		t.Error("the request of the gin context is changed")
+	}
+	if c, ok := types.GinContext(ctx); !ok || c != ginCtx {
+		t.Error("the gin context isn't found in the context of the span")
+	}
+	if trace.SpanContextFromContext(ctx).TraceID() != parent.SpanContext().TraceID() {
+		t.Error("the span isn't the child of the request's")
+	}
+}
@@ -15,3 +15,15 @@ func IsFileExists(file string) (bool, error) {
 	}
 	return true, err
 }
+
+// IsDirExists returns true if the path is an existing directory
+func IsDirExists(dir string) (bool, error) {
+	stat, err := os.Stat(dir)
+	if err != nil {
+		return false, err
+	}
+	if !stat.IsDir() {
+		return false, errors.New("the path isn't a directory")
+	}
+	return true, nil
+}
@@ -14,10 +14,13 @@ import (
 type ValidatorTranslator interface {
 	Zh() ut.Translator
 	En() ut.Translator
+	// Find returns the translator of the first supported language, the Chinese one is returned if none is supported
+	Find(languages ...string) ut.Translator
 }
 
 type validatorTranslatorImpl struct {
 	validator    *validator.Validate
+	uni          *ut.UniversalTranslator
 	zhTranslator ut.Translator
 	enTranslator ut.Translator
 }
@@ -36,6 +39,7 @@ func (v *validatorTranslatorImpl) initTranslators() {
 	// uni := ut.New(en, en)
 	// uni := ut.New(en, zh, tw)
 	uni := ut.New(zh, zh, enLang)
+	v.uni = uni
 
 	if val, ok := binding.Validator.Engine().(*validator.Validate); ok {
 		if zhTranslator, found := uni.GetTranslator("zh"); found {
@@ -63,3 +67,8 @@ func (v *validatorTranslatorImpl) Zh() ut.Translator {
 func (v *validatorTranslatorImpl) En() ut.Translator {
 	return v.enTranslator
 }
+
+func (v *validatorTranslatorImpl) Find(languages ...string) ut.Translator {
+	translator, _ := v.uni.FindTranslator(languages...)
+	return translator
+}
@@ -7,12 +7,14 @@ import (
 	"kubeall.io/api-server/pkg/infra"
 	"kubeall.io/api-server/pkg/service"
 	"kubeall.io/api-server/pkg/types"
+	"kubeall.io/api-server/pkg/webhook"
 )
 
 func RegisterControllerManagerModules(params *types.StartupParams, localeFs embed.FS) {
 	fx.New(
 		infra.NewInfraModuleForCm(params, localeFs, types.CmScheme),
 		service.Module,
+		webhook.Module,
 		controller.CtrlModule,
 		//fx.WithLogger(
 		//	func() fxevent.Logger {
@@ -2,51 +2,215 @@ package server
 
 import (
 	"context"
-	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"go.uber.org/fx"
 	"go.uber.org/zap"
+	"io/fs"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	kav1 "kubeall.io/api-server/pkg/generated/kubeall.io/v1"
+	lhv1beta2 "kubeall.io/api-server/pkg/generated/longhorn/apis/longhorn/v1beta2"
 	"kubeall.io/api-server/pkg/infra/apiserver"
+	"kubeall.io/api-server/pkg/infra/certs"
+	"kubeall.io/api-server/pkg/infra/console"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/metrics"
 	"kubeall.io/api-server/pkg/types"
+	kv1 "kubevirt.io/api/core/v1"
 	"log"
+	"net"
+	"net/http"
+	"os"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sync/atomic"
+	"time"
 )
 
+// Server serves the rest api, it's started and stopped with the app
 type Server interface {
-	Start(context.Context, embed.FS) error
+	// Start waits for the informers synced, then accepts the requests
+	Start(ctx context.Context) error
+	// Stop reports not ready, then waits for the in-flight requests, e.g. the uploads, completed until the shutdown
+	// timeout
+	Stop(ctx context.Context) error
+	// Ready reports whether the server accepts the requests, it's reported by /readyz
+	Ready() bool
+}
+
+// syncedObjects the informers synced before the server accepts the requests, the ones of the CRDs not installed are
+// skipped
+var syncedObjects = []client.Object{
+	&corev1.Node{},
+	&kav1.Image{},
+	&kv1.VirtualMachine{},
+	&kv1.VirtualMachineInstance{},
+	&lhv1beta2.BackingImage{},
 }
 
 type serverImpl struct {
-	restServer apiserver.RestServer
-	config     *types.ServerConfig
-}
-
-func NewServer(cfg types.Config,
-	restServer apiserver.RestServer) Server {
-	return &serverImpl{
-		config:     cfg.(*types.ServerConfig),
-		restServer: restServer,
-	}
-}
-
-// Start initializes and runs the server.
-// It sets up a cancellable context, prints the configuration,
-// initializes the cluster, and starts the REST server.
-//
-// Parameters:
-//   - ctx: A context.Context for controlling the lifecycle of the server.
-//   - fs: An embed.FS containing embedded files required for the server.
-//
-// Returns:
-//   - error: An error if the server fails to start or encounters any issues during initialization.
-//     Returns nil if the server starts successfully.
-func (s *serverImpl) Start(ctx context.Context, fs embed.FS) error {
+	restServer      apiserver.RestServer
+	clusterResource apiserver.ClusterResource
+	config          *types.ServerConfig
+	shutdowner      fx.Shutdowner
+	// consoleAssets the assets of the console, it's nil while the console isn't served
+	consoleAssets fs.FS
+
+	ready         atomic.Bool
+	httpServer    *http.Server
+	metricsServer *http.Server
+}
+
+func NewServer(cfg types.Config, lifecycle fx.Lifecycle, shutdowner fx.Shutdowner,
+	restServer apiserver.RestServer, clusterResource apiserver.ClusterResource, consoleAssets console.Assets) Server {
+	s := &serverImpl{
+		config:          cfg.(*types.ServerConfig),
+		restServer:      restServer,
+		clusterResource: clusterResource,
+		shutdowner:      shutdowner,
+	}
+	if consoleConfig := s.config.Console; consoleConfig != nil && consoleConfig.Enabled {
+		s.consoleAssets = console.Load(consoleAssets, consoleConfig.Dir)
+	}
+	lifecycle.Append(fx.Hook{OnStart: s.Start, OnStop: s.Stop})
+	return s
+}
+
+func (s *serverImpl) Start(ctx context.Context) error {
 	s.printConfig()
+	s.startMetricsServer()
+
+	if err := s.waitForInformers(ctx); err != nil {
+		return err
+	}
 
-	zap.L().Info("server started")
-	err := s.restServer.GetEngine().Run(fmt.Sprintf("%s:%d", s.config.Http.Address, s.config.Http.Port))
+	httpServer, err := s.newHttpServer()
 	if err != nil {
 		return err
 	}
+	address := fmt.Sprintf("%s:%d", s.config.Http.Address, s.config.Http.Port)
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	s.httpServer = httpServer
+	go func() {
+		var err error
+		if httpServer.TLSConfig != nil {
+			// the certificate is provided by the tls config
+			err = httpServer.ServeTLS(listener, "", "")
+		} else {
+			err = httpServer.Serve(listener)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			zap.L().Error("failed to run server", zap.Error(err))
+			_ = s.shutdowner.Shutdown(fx.ExitCode(1))
+		}
+	}()
+	s.ready.Store(true)
+	zap.L().Info("server started", zap.String("address", address), zap.Bool("tls", httpServer.TLSConfig != nil),
+		zap.Bool("http2", s.config.Http.Http2))
+	return nil
+}
+
+// newHttpServer configures the protocols and the tls of the server, HTTP/2 is h2c with prior knowledge while the tls
+// is disabled
+func (s *serverImpl) newHttpServer() (*http.Server, error) {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(s.config.Http.Http2)
+	protocols.SetUnencryptedHTTP2(s.config.Http.Http2)
+	httpServer := &http.Server{Handler: s.handler(), Protocols: protocols}
+
+	tlsConfig := s.config.Http.Tls
+	if tlsConfig == nil || !tlsConfig.Enabled {
+		return httpServer, nil
+	}
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if hostname, err := os.Hostname(); err == nil {
+		hosts = append(hosts, hostname)
+	}
+	if ip := net.ParseIP(s.config.Http.Address); ip == nil || !ip.IsUnspecified() {
+		hosts = append(hosts, s.config.Http.Address)
+	}
+	var err error
+	if httpServer.TLSConfig, err = certs.NewTlsConfig(tlsConfig, s.config.Http.Http2, hosts...); err != nil {
+		return nil, fmt.Errorf("failed to configure tls: %w", err)
+	}
+	return httpServer, nil
+}
+
+func (s *serverImpl) Stop(ctx context.Context) error {
+	s.ready.Store(false)
+	zap.L().Info("server is shutting down", zap.Duration("delay", s.config.Http.ShutdownDelay),
+		zap.Duration("timeout", s.config.Http.ShutdownTimeout))
+
+	// keep accepting the requests until the server is removed from the endpoints
+	select {
+	case <-time.After(s.config.Http.ShutdownDelay):
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, s.config.Http.ShutdownTimeout)
+	defer cancel()
+	if err := s.httpServer.Shutdown(shutdownCtx); err != nil {
+		zap.L().Warn("the in-flight requests are aborted since they aren't completed in time", zap.Error(err))
+		_ = s.httpServer.Close()
+	}
+	if s.metricsServer != nil {
+		_ = s.metricsServer.Close()
+	}
+	zap.L().Info("server stopped")
+	return nil
+}
+
+func (s *serverImpl) Ready() bool {
+	return s.ready.Load()
+}
+
+// handler serves the probes apart from the engine, so that they're neither logged nor traced
+func (s *serverImpl) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(constants.HealthzUri, func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc(constants.ReadyzUri, func(w http.ResponseWriter, _ *http.Request) {
+		if !s.Ready() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	})
+	handler := s.restServer.Handler()
+	if tlsConfig := s.config.Http.Tls; tlsConfig != nil && tlsConfig.Enabled && tlsConfig.ClientAuth != nil &&
+		tlsConfig.ClientAuth.Enabled {
+		handler = certs.ClientCertAuth(handler, s.config.UserHeaders(), tlsConfig.ClientAuth.TrustedProxies)
+	}
+	if s.consoleAssets != nil {
+		handler = console.Handler(s.consoleAssets, handler)
+	}
+	mux.Handle("/", handler)
+	return mux
+}
+
+// waitForInformers starts the informers of the watched resources and waits for them synced in the cache sync timeout
+func (s *serverImpl) waitForInformers(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, s.config.Http.CacheSyncTimeout)
+	defer cancel()
+
+	start := time.Now()
+	for _, obj := range syncedObjects {
+		_, err := s.clusterResource.ClusterCache().GetInformer(ctx, obj)
+		if meta.IsNoMatchError(err) {
+			zap.L().Warn("the resource isn't installed, its informer is skipped", zap.Error(err))
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to sync informer of %T: %w", obj, err)
+		}
+	}
+	zap.L().Info("informers are synced", zap.Duration("elapsed", time.Since(start)))
 	return nil
 }
 
@@ -57,3 +221,18 @@ func (s *serverImpl) printConfig() {
 		zap.L().Info("the config takes effect", zap.String("config", string(cfgString)))
 	}
 }
+
+// startMetricsServer exposes the metrics of requests, uploads and the informers watched by the api server
+func (s *serverImpl) startMetricsServer() {
+	err := metrics.RegisterCacheCollector(s.clusterResource.ClusterCache, map[string]func() client.ObjectList{
+		"nodes":                   func() client.ObjectList { return &corev1.NodeList{} },
+		"images":                  func() client.ObjectList { return &kav1.ImageList{} },
+		"virtualmachines":         func() client.ObjectList { return &kv1.VirtualMachineList{} },
+		"virtualmachineinstances": func() client.ObjectList { return &kv1.VirtualMachineInstanceList{} },
+		"backingimages":           func() client.ObjectList { return &lhv1beta2.BackingImageList{} },
+	})
+	if err != nil {
+		zap.L().Warn("failed to register metrics of informer cache", zap.Error(err))
+	}
+	s.metricsServer = metrics.Serve(s.config.MetricsBindAddress())
+}
@@ -3,33 +3,37 @@ package server
 import (
 	"context"
 	"embed"
+	"fmt"
 	"go.uber.org/fx"
 	"go.uber.org/fx/fxevent"
 	"go.uber.org/zap"
 	"kubeall.io/api-server/pkg/handler"
 	"kubeall.io/api-server/pkg/infra"
+	"kubeall.io/api-server/pkg/infra/console"
 	"kubeall.io/api-server/pkg/service"
 	"kubeall.io/api-server/pkg/types"
+	"os"
 )
 
-func NewServerModule() fx.Option {
+func NewServerModule(consoleAssets console.Assets) fx.Option {
 	return fx.Options(
-		// 暂时没有传递的参数
+		fx.Supply(consoleAssets),
 		fx.Provide(
 			NewServer,
 		),
 	)
 }
 
-func RegisterModules(params *types.StartupParams, localeFs embed.FS) {
-	fx.New(
+func RegisterModules(params *types.StartupParams, localeFs embed.FS, consoleAssets console.Assets) {
+	var config types.Config
+	app := fx.New(
 		infra.NewInfraModule(params, localeFs, types.ApiServerScheme),
-		NewServerModule(),
+		NewServerModule(consoleAssets),
 		service.Module,
 		handler.Module,
-		fx.Invoke(func(lifecycle fx.Lifecycle, logger *zap.Logger, server Server) error {
-			return server.Start(context.Background(), localeFs)
-		}),
+		// the server is started and stopped by its lifecycle hooks
+		fx.Invoke(func(Server) {}),
+		fx.Populate(&config),
 		fx.WithLogger(
 			func() fxevent.Logger {
 				return fxevent.NopLogger
@@ -38,5 +42,37 @@ func RegisterModules(params *types.StartupParams, localeFs embed.FS) {
 		fx.WithLogger(func(log *zap.Logger) fxevent.Logger {
 			return &fxevent.ZapLogger{Logger: log}
 		}),
-	).Run()
+	)
+	os.Exit(run(app, config))
+}
+
+// run starts the app and stops it once it's signaled like fx.App.Run, but the timeouts cover waiting for the
+// informers synced and the in-flight requests completed
+func run(app *fx.App, config types.Config) int {
+	// the global logger isn't installed if the app isn't built, e.g. the config is invalid
+	if err := app.Err(); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "failed to build the server: %v\n", err)
+		return 1
+	}
+	startTimeout, stopTimeout := app.StartTimeout(), app.StopTimeout()
+	if cfg, ok := config.(*types.ServerConfig); ok && cfg.Http != nil {
+		startTimeout += cfg.Http.CacheSyncTimeout
+		stopTimeout += cfg.Http.ShutdownDelay + cfg.Http.ShutdownTimeout
+	}
+
+	startCtx, cancel := context.WithTimeout(context.Background(), startTimeout)
+	defer cancel()
+	if err := app.Start(startCtx); err != nil {
+		zap.L().Error("failed to start the server", zap.Error(err))
+		return 1
+	}
+
+	signal := <-app.Wait()
+	stopCtx, cancel := context.WithTimeout(context.Background(), stopTimeout)
+	defer cancel()
+	if err := app.Stop(stopCtx); err != nil {
+		zap.L().Error("failed to stop the server", zap.Error(err))
+		return 1
+	}
+	return signal.ExitCode
 }
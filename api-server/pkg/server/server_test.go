@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"io"
+	"kubeall.io/api-server/pkg/infra/apiserver"
+	"kubeall.io/api-server/pkg/types"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// slowRestServer serves the requests until they're released
+type slowRestServer struct {
+	apiserver.RestServer
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *slowRestServer) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(s.started)
+		<-s.release
+		_, _ = w.Write([]byte("uploaded"))
+	})
+}
+
+func TestServerStop(t *testing.T) {
+	restServer := &slowRestServer{started: make(chan struct{}), release: make(chan struct{})}
+	s := &serverImpl{
+		restServer: restServer,
+		config: &types.ServerConfig{Http: &types.HttpSetting{
+			ShutdownDelay:   50 * time.Millisecond,
+			ShutdownTimeout: 5 * time.Second,
+		}},
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.httpServer = &http.Server{Handler: s.handler()}
+	go func() { _ = s.httpServer.Serve(listener) }()
+	s.ready.Store(true)
+	url := "http://" + listener.Addr().String()
+
+	// an in-flight upload
+	uploaded := make(chan string)
+	go func() {
+		resp, err := http.Post(url+"/api/v1/images/upload", "application/octet-stream", nil)
+		if err != nil {
+			uploaded <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		uploaded <- string(body)
+	}()
+	<-restServer.started
+
+	stopped := make(chan error)
+	go func() {
+		stopped <- s.Stop(context.Background())
+	}()
+
+	recorder := httptest.NewRecorder()
+	time.Sleep(10 * time.Millisecond)
+	s.handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("got readiness %d while shutting down", recorder.Code)
+	}
+
+	// the server waits for the upload completed
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case <-stopped:
+		t.Fatal("the server is stopped before the upload is completed")
+	default:
+	}
+	close(restServer.release)
+	if body := <-uploaded; body != "uploaded" {
+		t.Errorf("got upload response %s", body)
+	}
+	if err = <-stopped; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRunFailedToStart(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	defer zap.ReplaceGlobals(zap.L())
+	zap.ReplaceGlobals(zap.New(core))
+
+	app := fx.New(fx.NopLogger, fx.Invoke(func(lifecycle fx.Lifecycle) {
+		lifecycle.Append(fx.StartHook(func() error { return errors.New("port in use") }))
+	}))
+	if code := run(app, &types.ServerConfig{}); code != 1 {
+		t.Errorf("got exit code %d", code)
+	}
+	entries := logs.FilterMessage("failed to start the server").All()
+	if len(entries) != 1 || entries[0].ContextMap()["error"] != "port in use" {
+		t.Errorf("expected the error logged, got %v", logs.All())
+	}
+}
@@ -2,18 +2,23 @@ package service
 
 import (
 	"context"
-	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"kubeall.io/api-server/pkg/infra/apiserver"
 	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/logger"
+	"kubeall.io/api-server/pkg/infra/tracing"
 	"kubeall.io/api-server/pkg/types"
 	"net/http"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"slices"
 )
 
 // BaseService defines the interface for basic service operations.
@@ -26,32 +31,65 @@ type BaseService interface {
 	CreateObject(gvk schema.GroupVersionKind) (client.Object, error)
 }
 
+// NamespaceScope restricts the namespaces whose objects are listed by namespaces/all
+type NamespaceScope interface {
+	// AccessibleNamespaces returns the namespaces the caller can access, all is true if it isn't restricted
+	AccessibleNamespaces(ctx context.Context) (namespaces []string, all bool, err error)
+}
+
+// Admission checks the objects before they are created or updated, e.g. the quotas of the projects
+type Admission interface {
+	// Admit returns an error if the object can't be created or updated, old is nil while it's created
+	Admit(ctx context.Context, obj client.Object, old client.Object) error
+}
+
 // baseServiceImpl is an implementation of the BaseService interface.
 type baseServiceImpl struct {
-	clusterCache  cache.Cache
-	runtimeClient client.Client
-	fieldSorter   FieldSorter
-	fieldFilter   FieldFilter
+	clusterRes  apiserver.ClusterResource
+	fieldSorter FieldSorter
+	fieldFilter FieldFilter
+	scope       NamespaceScope
+	admission   Admission
 }
 
-func NewBaseService(clusterRes apiserver.ClusterResource, sorter FieldSorter, fieldFilter FieldFilter) BaseService {
+func NewBaseService(clusterRes apiserver.ClusterResource, sorter FieldSorter, fieldFilter FieldFilter,
+	scope NamespaceScope, admission Admission) BaseService {
 	baseSvcImpl := &baseServiceImpl{
-		clusterCache:  clusterRes.ClusterCache(),
-		runtimeClient: clusterRes.RuntimeClient(),
-		fieldSorter:   sorter,
-		fieldFilter:   fieldFilter,
+		clusterRes:  clusterRes,
+		fieldSorter: sorter,
+		fieldFilter: fieldFilter,
+		scope:       scope,
+		admission:   admission,
 	}
 	return baseSvcImpl
 }
 
+// clusterCache returns the cache of the cluster selected by the request
+func (b baseServiceImpl) clusterCache(ctx context.Context) cache.Cache {
+	return apiserver.ClusterFrom(ctx, b.clusterRes).ClusterCache()
+}
+
+// runtimeClient returns the client of the cluster selected by the request
+func (b baseServiceImpl) runtimeClient(ctx context.Context) client.Client {
+	return apiserver.ClusterFrom(ctx, b.clusterRes).RuntimeClient()
+}
+
+// scheme all the clusters share the same scheme
+func (b baseServiceImpl) scheme() *runtime.Scheme {
+	return b.clusterRes.RuntimeClient().Scheme()
+}
+
 func (b baseServiceImpl) List(ctx context.Context, gvk schema.GroupVersionKind,
-	resType types.ResourceType, query types.Query, isPaginated bool) (*types.PageResult, error) {
-	var err error
+	resType types.ResourceType, query types.Query, isPaginated bool) (_ *types.PageResult, err error) {
+	ctx, span := tracing.Start(ctx, "BaseService.List", attribute.String("gvk", gvk.String()),
+		attribute.String("namespace", resType.Namespace()))
+	defer func() { tracing.End(span, err) }()
+
 	var listOpts = &client.ListOptions{}
 
 	listGvk := gvk
 	listGvk.Kind = listGvk.Kind + "List"
-	objList, err := CreateObjectList(b.runtimeClient.Scheme(), listGvk)
+	objList, err := CreateObjectList(b.scheme(), listGvk)
 	if err != nil {
 		return nil, err
 	}
@@ -63,34 +101,39 @@ func (b baseServiceImpl) List(ctx context.Context, gvk schema.GroupVersionKind,
 		}
 		listOpts.Namespace = ns
 	}
-	err = b.clusterCache.List(ctx, objList, listOpts)
+	err = b.clusterCache(ctx).List(ctx, objList, listOpts)
 	if err != nil {
-		zap.L().Warn("failed to list objects", zap.Any("gvk", gvk),
+		logger.FromContext(ctx).Warn("failed to list objects", zap.Any("gvk", gvk),
 			zap.Any("resourceType", resType),
 			zap.Error(err))
-		return nil, types.FailWithErrorCode(ctx.(*gin.Context),
+		return nil, types.FailWithErrorCode(ctx,
 			constants.CodeInternalError, map[string]string{"error": err.Error()})
 	}
 
 	list, err := meta.ExtractList(objList)
 	if err != nil {
-		zap.L().Warn("failed to extract list objects", zap.Any("gvk", gvk),
+		logger.FromContext(ctx).Warn("failed to extract list objects", zap.Any("gvk", gvk),
 			zap.Any("resourceType", resType),
 			zap.Error(err))
-		return nil, types.FailWithErrorCode(ctx.(*gin.Context),
+		return nil, types.FailWithErrorCode(ctx,
 			constants.CodeInternalError, map[string]string{"error": err.Error()})
 	}
 
+	if list, err = b.filterByScope(ctx, gvk, resType, list); err != nil {
+		logger.FromContext(ctx).Warn("failed to get the accessible namespaces", zap.Error(err))
+		return nil, err
+	}
+
 	//filter
 	if list, err = b.fieldFilter.FilterBy(ctx, list, query.Filters); err != nil {
-		zap.L().Warn("failed to filter by field(s)", zap.Any("filters", query.Filters),
+		logger.FromContext(ctx).Warn("failed to filter by field(s)", zap.Any("filters", query.Filters),
 			zap.Error(err))
 		return nil, err
 	}
 
 	//sort
 	if err = b.fieldSorter.SortByField(ctx, list, query.SortBy, string(query.SortOrder)); err != nil {
-		zap.L().Warn("failed to sort list by this field", zap.String("sortBy", query.SortBy),
+		logger.FromContext(ctx).Warn("failed to sort list by this field", zap.String("sortBy", query.SortBy),
 			zap.String("sortOrder", string(query.SortOrder)), zap.Error(err))
 		return nil, err
 	}
@@ -109,19 +152,23 @@ func (b baseServiceImpl) List(ctx context.Context, gvk schema.GroupVersionKind,
 }
 
 func (b baseServiceImpl) Get(ctx context.Context, gvk schema.GroupVersionKind,
-	resType types.ResourceType, name string) (client.Object, error) {
+	resType types.ResourceType, name string) (_ client.Object, err error) {
+	ctx, span := tracing.Start(ctx, "BaseService.Get", attribute.String("gvk", gvk.String()),
+		attribute.String("namespace", resType.Namespace()), attribute.String("name", name))
+	defer func() { tracing.End(span, err) }()
+
 	objKey := b.createObjectKey(resType, name)
-	obj, err := CreateObject(b.runtimeClient.Scheme(), gvk)
+	obj, err := CreateObject(b.scheme(), gvk)
 	if err != nil {
 		return nil, err
 	}
-	if err = b.clusterCache.Get(ctx, objKey, obj); err != nil {
+	if err = b.clusterCache(ctx).Get(ctx, objKey, obj); err != nil {
 		if k8serrors.IsNotFound(err) {
-			zap.L().Warn("no resource hit for deleting", zap.String("name", name),
+			logger.FromContext(ctx).Warn("no resource hit for deleting", zap.String("name", name),
 				zap.Any("resourceType", resType), zap.Error(err))
 			return nil, types.FailWithStatusCode(http.StatusNotFound)
 		}
-		zap.L().Warn("failed to get resource", zap.String("name", name),
+		logger.FromContext(ctx).Warn("failed to get resource", zap.String("name", name),
 			zap.Any("resourceType", resType), zap.Error(err))
 		return nil, err
 	}
@@ -129,43 +176,103 @@ func (b baseServiceImpl) Get(ctx context.Context, gvk schema.GroupVersionKind,
 }
 
 func (b baseServiceImpl) Delete(ctx context.Context, gvk schema.GroupVersionKind,
-	resType types.ResourceType, name string) error {
-	obj, err := CreateObject(b.runtimeClient.Scheme(), gvk)
+	resType types.ResourceType, name string) (err error) {
+	ctx, span := tracing.Start(ctx, "BaseService.Delete", attribute.String("gvk", gvk.String()),
+		attribute.String("namespace", resType.Namespace()), attribute.String("name", name))
+	defer func() { tracing.End(span, err) }()
+
+	obj, err := CreateObject(b.scheme(), gvk)
 	if err != nil {
 		return err
 	}
 	obj.SetNamespace(resType.Namespace())
 	obj.SetName(name)
-	if err = b.runtimeClient.Delete(ctx, obj); err != nil {
+	if err = b.runtimeClient(ctx).Delete(ctx, obj); err != nil {
 		if k8serrors.IsNotFound(err) {
-			zap.L().Warn("no resource found for deleting", zap.String("name", name),
+			logger.FromContext(ctx).Warn("no resource found for deleting", zap.String("name", name),
 				zap.Any("resourceType", resType), zap.Error(err))
 			return types.FailWithStatusCode(http.StatusNotFound)
 		}
 	}
-	zap.L().Warn("failed to delete resource", zap.String("name", name),
+	logger.FromContext(ctx).Warn("failed to delete resource", zap.String("name", name),
 		zap.Any("resourceType", resType), zap.Error(err))
 	return err
 }
 
-func (b baseServiceImpl) Create(ctx context.Context, obj client.Object) error {
-	if err := b.runtimeClient.Create(ctx, obj); err != nil {
-		zap.L().Warn("failed to create resource", zap.Any("error", err))
+func (b baseServiceImpl) Create(ctx context.Context, obj client.Object) (err error) {
+	ctx, span := tracing.Start(ctx, "BaseService.Create", objectAttributes(obj)...)
+	defer func() { tracing.End(span, err) }()
+
+	if err = b.admission.Admit(ctx, obj, nil); err != nil {
+		logger.FromContext(ctx).Warn("the resource isn't admitted", zap.String("namespace", obj.GetNamespace()),
+			zap.String("name", obj.GetName()), zap.Error(err))
+		return err
+	}
+	if err = b.runtimeClient(ctx).Create(ctx, obj); err != nil {
+		logger.FromContext(ctx).Warn("failed to create resource", zap.Any("error", err))
 		return err
 	}
 	return nil
 }
 
-func (b baseServiceImpl) Update(ctx context.Context, obj client.Object) error {
-	if err := b.runtimeClient.Update(ctx, obj); err != nil {
-		zap.L().Warn("failed to update resource", zap.Any("error", err))
+// Update replaces the object, it's admitted against the current one so that only the resources it adds are counted
+func (b baseServiceImpl) Update(ctx context.Context, obj client.Object) (err error) {
+	ctx, span := tracing.Start(ctx, "BaseService.Update", objectAttributes(obj)...)
+	defer func() { tracing.End(span, err) }()
+
+	gvk, err := apiutil.GVKForObject(obj, b.scheme())
+	if err != nil {
+		return err
+	}
+	old, err := CreateObject(b.scheme(), gvk)
+	if err != nil {
+		return err
+	}
+	if err = b.clusterCache(ctx).Get(ctx, client.ObjectKeyFromObject(obj), old); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return types.FailWithStatusCode(http.StatusNotFound)
+		}
+		return err
+	}
+	if err = b.admission.Admit(ctx, obj, old); err != nil {
+		logger.FromContext(ctx).Warn("the resource isn't admitted", zap.String("namespace", obj.GetNamespace()),
+			zap.String("name", obj.GetName()), zap.Error(err))
+		return err
+	}
+	if err = b.runtimeClient(ctx).Update(ctx, obj); err != nil {
+		logger.FromContext(ctx).Warn("failed to update resource", zap.Any("error", err))
 		return err
 	}
 	return nil
 }
 
 func (b baseServiceImpl) CreateObject(gvk schema.GroupVersionKind) (client.Object, error) {
-	return CreateObject(b.runtimeClient.Scheme(), gvk)
+	return CreateObject(b.scheme(), gvk)
+}
+
+// filterByScope keeps the objects in the accessible namespaces while listing namespaces/all, and the accessible
+// namespaces themselves while listing the namespaces
+func (b baseServiceImpl) filterByScope(ctx context.Context, gvk schema.GroupVersionKind, resType types.ResourceType,
+	list []runtime.Object) ([]runtime.Object, error) {
+	isNamespaceList := resType.ClusterResource() && gvk.Group == "" && gvk.Kind == "Namespace"
+	if !isNamespaceList && (resType.ClusterResource() || resType.Namespace() != constants.NamespaceAll) {
+		return list, nil
+	}
+	namespaces, all, err := b.scope.AccessibleNamespaces(ctx)
+	if err != nil || all {
+		return list, err
+	}
+	return slices.DeleteFunc(list, func(obj runtime.Object) bool {
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return true
+		}
+		namespace := accessor.GetNamespace()
+		if isNamespaceList {
+			namespace = accessor.GetName()
+		}
+		return !slices.Contains(namespaces, namespace)
+	}), nil
 }
 
 // createObjectKey constructs an ObjectKey for the given resource type and name
@@ -176,3 +283,12 @@ func (b baseServiceImpl) createObjectKey(resType types.ResourceType, name string
 	}
 	return objKey
 }
+
+// objectAttributes returns the attributes of the spans identifying the object
+func objectAttributes(obj client.Object) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("kind", obj.GetObjectKind().GroupVersionKind().Kind),
+		attribute.String("namespace", obj.GetNamespace()),
+		attribute.String("name", obj.GetName()),
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"go.uber.org/zap"
 	"k8s.io/apimachinery/pkg/runtime"
 	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/logger"
 	"kubeall.io/api-server/pkg/types"
 	"slices"
 	"sort"
@@ -37,11 +38,11 @@ func (f fieldSorterImpl) SortByField(ctx context.Context, list []runtime.Object,
 		realSortOrder = constants.Desc
 	}
 	if !slices.Contains(constants.SupportedSortFields, realField) {
-		zap.L().Warn("unsupported sort field", zap.String("field", field))
+		logger.FromContext(ctx).Warn("unsupported sort field", zap.String("field", field))
 		return types.FailWithErrorCode(ctx, constants.CodeInvalidParam, map[string]string{"name": "field"})
 	}
 	if !slices.Contains(constants.SupportedSortOrders, realSortOrder) {
-		zap.L().Warn("unsupported sort order", zap.String("order", order))
+		logger.FromContext(ctx).Warn("unsupported sort order", zap.String("order", order))
 		return types.FailWithErrorCode(ctx, constants.CodeInvalidParam, map[string]string{"name": "order"})
 	}
 
@@ -50,7 +51,7 @@ func (f fieldSorterImpl) SortByField(ctx context.Context, list []runtime.Object,
 			return comparator.Compare(list[i], list[j], realSortOrder)
 		})
 	} else {
-		zap.L().Warn("unknown field to sort the list", zap.String("field", field),
+		logger.FromContext(ctx).Warn("unknown field to sort the list", zap.String("field", field),
 			zap.String("order", order))
 	}
 	return nil
@@ -0,0 +1,363 @@
+package service
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	kav1 "kubeall.io/api-server/pkg/generated/kubeall.io/v1"
+	"kubeall.io/api-server/pkg/infra/apiserver"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/logger"
+	"kubeall.io/api-server/pkg/infra/tracing"
+	"kubeall.io/api-server/pkg/types"
+	kv1 "kubevirt.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventService aggregates the events of a resource and its children, e.g. the vmi, the virt-launcher pods and the
+// pvcs of a vm, or the backing image and the storage class of an image
+type EventService interface {
+	// List returns the events of the object and its children, the latest ones come first
+	List(ctx context.Context, gvk schema.GroupVersionKind, obj client.Object) ([]types.ResourceEvent, error)
+	// Watch returns the events like List, and the events added or modified later until the context is done. The
+	// children are resolved once the watch starts, the channel is closed once the watches are closed by the api server.
+	Watch(ctx context.Context, gvk schema.GroupVersionKind, obj client.Object) ([]types.ResourceEvent,
+		<-chan types.WatchedEvent, error)
+}
+
+type eventServiceImpl struct {
+	clusterResource apiserver.ClusterResource
+}
+
+func NewEventService(clusterResource apiserver.ClusterResource) EventService {
+	return &eventServiceImpl{clusterResource: clusterResource}
+}
+
+func (e eventServiceImpl) List(ctx context.Context, gvk schema.GroupVersionKind,
+	obj client.Object) (_ []types.ResourceEvent, err error) {
+	ctx, span := tracing.Start(ctx, "EventService.List", eventAttributes(gvk, obj)...)
+	defer func() { tracing.End(span, err) }()
+
+	events, _, err := e.list(ctx, gvk, obj)
+	return events, err
+}
+
+func (e eventServiceImpl) Watch(ctx context.Context, gvk schema.GroupVersionKind,
+	obj client.Object) ([]types.ResourceEvent, <-chan types.WatchedEvent, error) {
+	events, versions, err := e.list(ctx, gvk, obj)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	k8sClient := apiserver.ClusterFrom(ctx, e.clusterResource).Client().K8sClient()
+	changes := make(chan types.WatchedEvent)
+	var wg sync.WaitGroup
+	for ref, version := range versions {
+		watcher, err := k8sClient.CoreV1().Events(ref.Namespace).Watch(ctx, metav1.ListOptions{
+			FieldSelector:   coreEventSelector(ref),
+			ResourceVersion: version,
+		})
+		if err != nil {
+			logger.FromContext(ctx).Warn("failed to watch the events", zap.String("kind", ref.Kind),
+				zap.String("namespace", ref.Namespace), zap.String("name", ref.Name), zap.Error(err))
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer watcher.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case change, ok := <-watcher.ResultChan():
+					if !ok {
+						return
+					}
+					event, isEvent := change.Object.(*corev1.Event)
+					if !isEvent || (change.Type != watch.Added && change.Type != watch.Modified) {
+						continue
+					}
+					select {
+					case changes <- types.WatchedEvent{Type: strings.ToLower(string(change.Type)), Event: fromCoreEvent(event)}:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(changes)
+	}()
+	return events, changes, nil
+}
+
+// list returns the merged events, and the resource versions of the core events of the objects to watch from
+func (e eventServiceImpl) list(ctx context.Context, gvk schema.GroupVersionKind,
+	obj client.Object) ([]types.ResourceEvent, map[types.EventObjectRef]string, error) {
+	refs, err := e.involvedObjects(ctx, gvk, obj)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	k8sClient := apiserver.ClusterFrom(ctx, e.clusterResource).Client().K8sClient()
+	var events []types.ResourceEvent
+	versions := make(map[types.EventObjectRef]string, len(refs))
+	for _, ref := range refs {
+		coreEvents, version, err := listCoreEvents(ctx, k8sClient, ref)
+		if err != nil {
+			return nil, nil, err
+		}
+		versions[ref] = version
+		events = append(events, coreEvents...)
+		// the events recorded by events.k8s.io are served by core/v1 as well, they're deduplicated by their uids
+		newEvents, err := listEvents(ctx, k8sClient, ref)
+		if err != nil {
+			logger.FromContext(ctx).Debug("failed to list the events of events.k8s.io", zap.String("kind", ref.Kind),
+				zap.String("name", ref.Name), zap.Error(err))
+		}
+		events = append(events, newEvents...)
+	}
+	return MergeEvents(events), versions, nil
+}
+
+// involvedObjects returns the object and its children whose events are aggregated
+func (e eventServiceImpl) involvedObjects(ctx context.Context, gvk schema.GroupVersionKind,
+	obj client.Object) ([]types.EventObjectRef, error) {
+	namespace := obj.GetNamespace()
+	refs := []types.EventObjectRef{{Kind: gvk.Kind, Namespace: namespace, Name: obj.GetName()}}
+	add := func(kind, namespace, name string) {
+		ref := types.EventObjectRef{Kind: kind, Namespace: namespace, Name: name}
+		for _, existing := range refs {
+			if existing == ref {
+				return
+			}
+		}
+		refs = append(refs, ref)
+	}
+	addVolumes := func(volumes []kv1.Volume) {
+		for _, volume := range volumes {
+			if volume.PersistentVolumeClaim != nil {
+				add("PersistentVolumeClaim", namespace, volume.PersistentVolumeClaim.ClaimName)
+			}
+			if volume.DataVolume != nil {
+				add("DataVolume", namespace, volume.DataVolume.Name)
+				add("PersistentVolumeClaim", namespace, volume.DataVolume.Name)
+			}
+		}
+	}
+	addPods := func(labels client.MatchingLabels) error {
+		var pods corev1.PodList
+		reader := apiserver.ClusterFrom(ctx, e.clusterResource).ClusterCache()
+		if err := reader.List(ctx, &pods, client.InNamespace(namespace), labels); err != nil {
+			return err
+		}
+		for _, pod := range pods.Items {
+			add("Pod", namespace, pod.Name)
+		}
+		return nil
+	}
+
+	switch o := obj.(type) {
+	case *kv1.VirtualMachine:
+		add("VirtualMachineInstance", namespace, o.Name)
+		if err := addPods(client.MatchingLabels{kv1.VirtualMachineNameLabel: o.Name}); err != nil {
+			return nil, err
+		}
+		if o.Spec.Template != nil {
+			addVolumes(o.Spec.Template.Spec.Volumes)
+		}
+		for _, template := range o.Spec.DataVolumeTemplates {
+			add("DataVolume", namespace, template.Name)
+		}
+		// the pvcs created from the templates of the api server
+		if _, ok := o.Annotations[constants.AnnotationPvcTemplates]; ok {
+			pvcs, _ := unmarshallPvcs(ctx, o)
+			for _, pvc := range pvcs {
+				add("PersistentVolumeClaim", namespace, pvc.Name)
+			}
+		}
+	case *kv1.VirtualMachineInstance:
+		if err := addPods(client.MatchingLabels{kv1.CreatedByLabel: string(o.UID)}); err != nil {
+			return nil, err
+		}
+		addVolumes(o.Spec.Volumes)
+	case *kav1.Image:
+		add("BackingImage", constants.DefaultBackingImageNamespace, BackingImageName(o.Name))
+		add("BackingImageDataSource", constants.DefaultBackingImageNamespace, BackingImageName(o.Name))
+		add("StorageClass", "", ImageStorageClassName(o))
+	}
+	return refs, nil
+}
+
+// MergeEvents deduplicates the events by their uids, then merges the identical events of the same object, the
+// latest ones come first
+func MergeEvents(events []types.ResourceEvent) []types.ResourceEvent {
+	type identity struct {
+		object                 types.EventObjectRef
+		eventType, reason, msg string
+	}
+	seen := make(map[string]bool, len(events))
+	indexes := make(map[identity]int, len(events))
+	merged := make([]types.ResourceEvent, 0, len(events))
+	for _, event := range events {
+		if event.Uid != "" {
+			if seen[event.Uid] {
+				continue
+			}
+			seen[event.Uid] = true
+		}
+		key := identity{object: event.Object, eventType: event.Type, reason: event.Reason, msg: event.Message}
+		i, ok := indexes[key]
+		if !ok {
+			indexes[key] = len(merged)
+			merged = append(merged, event)
+			continue
+		}
+		existing := &merged[i]
+		existing.Count += event.Count
+		if event.FirstTimestamp.Before(existing.FirstTimestamp) {
+			existing.FirstTimestamp = event.FirstTimestamp
+		}
+		if event.LastTimestamp.After(existing.LastTimestamp) {
+			existing.Uid, existing.Source, existing.LastTimestamp = event.Uid, event.Source, event.LastTimestamp
+		}
+	}
+	sort.SliceStable(merged, func(a, b int) bool {
+		return merged[a].LastTimestamp.After(merged[b].LastTimestamp)
+	})
+	return merged
+}
+
+func listCoreEvents(ctx context.Context, k8sClient kubernetes.Interface,
+	ref types.EventObjectRef) ([]types.ResourceEvent, string, error) {
+	list, err := k8sClient.CoreV1().Events(ref.Namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: coreEventSelector(ref),
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	events := make([]types.ResourceEvent, 0, len(list.Items))
+	for i := range list.Items {
+		events = append(events, fromCoreEvent(&list.Items[i]))
+	}
+	return events, list.ResourceVersion, nil
+}
+
+func listEvents(ctx context.Context, k8sClient kubernetes.Interface,
+	ref types.EventObjectRef) ([]types.ResourceEvent, error) {
+	list, err := k8sClient.EventsV1().Events(ref.Namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.SelectorFromSet(fields.Set{
+			"regarding.kind":      ref.Kind,
+			"regarding.namespace": ref.Namespace,
+			"regarding.name":      ref.Name,
+		}).String(),
+	})
+	if k8serrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	events := make([]types.ResourceEvent, 0, len(list.Items))
+	for i := range list.Items {
+		events = append(events, fromEvent(&list.Items[i]))
+	}
+	return events, nil
+}
+
+// coreEventSelector selects the events of the object by its kind and name rather than its uid, so that the events of
+// the objects recreated with the same name, e.g. the vmi of a restarted vm, are included
+func coreEventSelector(ref types.EventObjectRef) string {
+	return fields.SelectorFromSet(fields.Set{
+		"involvedObject.kind":      ref.Kind,
+		"involvedObject.namespace": ref.Namespace,
+		"involvedObject.name":      ref.Name,
+	}).String()
+}
+
+func fromCoreEvent(event *corev1.Event) types.ResourceEvent {
+	result := types.ResourceEvent{
+		Uid:     string(event.UID),
+		Type:    event.Type,
+		Reason:  event.Reason,
+		Message: event.Message,
+		Object: types.EventObjectRef{Kind: event.InvolvedObject.Kind, Namespace: event.InvolvedObject.Namespace,
+			Name: event.InvolvedObject.Name},
+		Count:          event.Count,
+		FirstTimestamp: firstTime(event.FirstTimestamp.Time, event.EventTime.Time, event.CreationTimestamp.Time),
+		LastTimestamp:  firstTime(event.LastTimestamp.Time, event.EventTime.Time, event.CreationTimestamp.Time),
+		Source:         event.ReportingController,
+	}
+	if event.Series != nil {
+		result.Count = event.Series.Count
+		result.LastTimestamp = firstTime(event.Series.LastObservedTime.Time, result.LastTimestamp)
+	}
+	if result.Source == "" {
+		result.Source = event.Source.Component
+	}
+	if result.Count == 0 {
+		result.Count = 1
+	}
+	return result
+}
+
+func fromEvent(event *eventsv1.Event) types.ResourceEvent {
+	result := types.ResourceEvent{
+		Uid:     string(event.UID),
+		Type:    event.Type,
+		Reason:  event.Reason,
+		Message: event.Note,
+		Object: types.EventObjectRef{Kind: event.Regarding.Kind, Namespace: event.Regarding.Namespace,
+			Name: event.Regarding.Name},
+		Count: event.DeprecatedCount,
+		FirstTimestamp: firstTime(event.DeprecatedFirstTimestamp.Time, event.EventTime.Time,
+			event.CreationTimestamp.Time),
+		LastTimestamp: firstTime(event.DeprecatedLastTimestamp.Time, event.EventTime.Time,
+			event.CreationTimestamp.Time),
+		Source: event.ReportingController,
+	}
+	if event.Series != nil {
+		result.Count = event.Series.Count
+		result.LastTimestamp = firstTime(event.Series.LastObservedTime.Time, result.LastTimestamp)
+	}
+	if result.Source == "" {
+		result.Source = event.DeprecatedSource.Component
+	}
+	if result.Count == 0 {
+		result.Count = 1
+	}
+	return result
+}
+
+// firstTime returns the first time which isn't zero
+func firstTime(times ...time.Time) time.Time {
+	for _, t := range times {
+		if !t.IsZero() {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func eventAttributes(gvk schema.GroupVersionKind, obj client.Object) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("kind", gvk.Kind),
+		attribute.String("namespace", obj.GetNamespace()),
+		attribute.String("name", obj.GetName()),
+	}
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"kubeall.io/api-server/pkg/types"
+	"testing"
+	"time"
+)
+
+func TestMergeEvents(t *testing.T) {
+	now := time.Now()
+	vm := types.EventObjectRef{Kind: "VirtualMachine", Namespace: "default", Name: "vm"}
+	pod := types.EventObjectRef{Kind: "Pod", Namespace: "default", Name: "virt-launcher-vm-x"}
+	events := MergeEvents([]types.ResourceEvent{
+		{Uid: "1", Type: "Normal", Reason: "Started", Object: vm, Count: 1,
+			FirstTimestamp: now.Add(-time.Hour), LastTimestamp: now.Add(-time.Hour)},
+		{Uid: "2", Type: "Warning", Reason: "BackOff", Object: pod, Count: 2,
+			FirstTimestamp: now.Add(-time.Minute), LastTimestamp: now.Add(-time.Minute)},
+		// the same event served by core/v1 and events.k8s.io/v1
+		{Uid: "2", Type: "Warning", Reason: "BackOff", Object: pod, Count: 2,
+			FirstTimestamp: now.Add(-time.Minute), LastTimestamp: now.Add(-time.Minute)},
+		{Uid: "3", Type: "Warning", Reason: "BackOff", Object: pod, Count: 3,
+			FirstTimestamp: now.Add(-2 * time.Minute), LastTimestamp: now},
+	})
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %v", events)
+	}
+	backOff := events[0]
+	if backOff.Reason != "BackOff" || backOff.Count != 5 || backOff.Uid != "3" ||
+		!backOff.FirstTimestamp.Equal(now.Add(-2*time.Minute)) || !backOff.LastTimestamp.Equal(now) {
+		t.Errorf("unexpected merged event %v", backOff)
+	}
+	if events[1].Reason != "Started" {
+		t.Errorf("expected the earlier event to be the last, got %v", events[1])
+	}
+}
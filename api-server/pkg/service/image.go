@@ -2,8 +2,8 @@ package service
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 	"io"
 	corev1 "k8s.io/api/core/v1"
@@ -14,13 +14,18 @@ import (
 	kav1 "kubeall.io/api-server/pkg/generated/kubeall.io/v1"
 	lhv1beta2 "kubeall.io/api-server/pkg/generated/longhorn/apis/longhorn/v1beta2"
 	"kubeall.io/api-server/pkg/infra/apiserver"
+	"kubeall.io/api-server/pkg/infra/config"
 	"kubeall.io/api-server/pkg/infra/constants"
-	"kubeall.io/api-server/pkg/infra/utils"
+	"kubeall.io/api-server/pkg/infra/logger"
+	"kubeall.io/api-server/pkg/infra/metrics"
+	"kubeall.io/api-server/pkg/infra/tracing"
 	baseservice "kubeall.io/api-server/pkg/service/base"
 	"kubeall.io/api-server/pkg/types"
 	"mime/multipart"
 	"net/http"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"strconv"
+	"sync"
 	"time"
 )
 
@@ -29,80 +34,129 @@ const biImagePrefix = "bi"
 const bufferSize = 32 * 1024 * 1024 // 32MB buffer cache
 const NameMaximumLength = 40        // the max length of backing image's name
 
-var (
-	reclaimPolicy        = corev1.PersistentVolumeReclaimDelete
-	allowVolumeExpansion = true
-	volumeBindingMode    = storagev1.VolumeBindingImmediate
-)
+// ImageNameMaximumLength the max length of image's name, so that its backing image's name isn't truncated
+const ImageNameMaximumLength = NameMaximumLength - len(biImagePrefix) - 1
 
 type ImageService interface {
+	// AcquireUpload reserves a slot of the concurrent uploads before the content is received, the slot is released
+	// by the returned func
+	AcquireUpload(ctx context.Context) (release func(), err error)
 	Upload(ctx context.Context, imageName string, req multipart.File, fileSize int64, request *http.Request) error
-	EnsureImageResources(ctx context.Context, image *kav1.Image) error
+	EnsureBackingImage(ctx context.Context, image *kav1.Image) (*lhv1beta2.BackingImage, error)
+	EnsureStorageClass(ctx context.Context, image *kav1.Image, biImage *lhv1beta2.BackingImage) error
 	DeleteImageResources(ctx context.Context, image *kav1.Image) error
-	UpdateStatus(ctx context.Context, imgStatus *kav1.ImageStatus, biImage *lhv1beta2.BackingImage) error
 	ListImagesByType(ctx context.Context, namespace, imageType string) ([]kav1.Image, error)
+	GetUsage(ctx context.Context, namespace, name string) (*types.ImageUsage, error)
+	ComputeUsage(ctx context.Context, image *kav1.Image) (*types.ImageUsage, error)
+	Delete(ctx context.Context, namespace, name string, force bool) error
 }
 
 type imageServiceImpl struct {
 	clusterResource apiserver.ClusterResource
 	storageClass    StorageClass
 	baseService     baseservice.BaseService
+	settingsService SettingsService
+	watcher         config.Watcher
 	imageGvk        *schema.GroupVersionKind
+	uploads         *uploadSlots
+}
+
+// uploadSlots counts the uploads in progress, the limit is read from the current config so that it's reloadable
+type uploadSlots struct {
+	lock  sync.Mutex
+	count int
 }
 
 func NewImageService(clusterResource apiserver.ClusterResource, sc StorageClass, baseService baseservice.BaseService,
-	gvkResource *constants.GvkResource) (ImageService, error) {
+	settingsService SettingsService, watcher config.Watcher, gvkResource *constants.GvkResource) (ImageService, error) {
 	imageGvk, err := gvkResource.Get(constants.ImageResourceParam)
 	if err != nil {
-		zap.L().Fatal("no gvk resource defined", zap.Error(err))
 		return nil, err
 	}
 	return &imageServiceImpl{
 		clusterResource: clusterResource,
 		storageClass:    sc,
 		baseService:     baseService,
+		settingsService: settingsService,
+		watcher:         watcher,
 		imageGvk:        imageGvk,
+		uploads:         &uploadSlots{},
 	}, err
 }
 
-func (i imageServiceImpl) Upload(ctx context.Context, imageName string, file multipart.File, fileSize int64, request *http.Request) error {
-	err := i.waitImage(ctx, imageName)
+func (i imageServiceImpl) AcquireUpload(ctx context.Context) (func(), error) {
+	limit := i.watcher.Current().Limits.MaxConcurrentUploads
+	i.uploads.lock.Lock()
+	defer i.uploads.lock.Unlock()
+	if limit > 0 && i.uploads.count >= limit {
+		return nil, types.FailWithErrorCode(ctx, constants.CodeTooManyUploads,
+			map[string]string{"limit": strconv.Itoa(limit)})
+	}
+	i.uploads.count++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			i.uploads.lock.Lock()
+			defer i.uploads.lock.Unlock()
+			i.uploads.count--
+		})
+	}, nil
+}
+
+func (i imageServiceImpl) Upload(ctx context.Context, imageName string, file multipart.File, fileSize int64, request *http.Request) (err error) {
+	ctx, span := tracing.Start(ctx, "ImageService.Upload", attribute.String("name", imageName),
+		attribute.Int64("size", fileSize))
+	defer func() { tracing.End(span, err) }()
+
+	err = i.waitImage(ctx, imageName)
 	if err != nil {
 		return err
 	}
 
 	//upload the image
-	err = i.uploadImageContent(imageName, file, fileSize, request)
+	err = i.uploadImageContent(ctx, imageName, file, fileSize, request)
 	if err != nil {
 		return err
 	}
 
-	zap.L().Info("image upload successfully", zap.String("imageName", imageName))
+	logger.FromContext(ctx).Info("image upload successfully", zap.String("imageName", imageName))
 	return nil
 }
 
-func (i imageServiceImpl) EnsureImageResources(ctx context.Context, image *kav1.Image) error {
+// EnsureBackingImage creates the backing image of the image if it doesn't exist
+func (i imageServiceImpl) EnsureBackingImage(ctx context.Context, image *kav1.Image) (_ *lhv1beta2.BackingImage, err error) {
+	ctx, span := tracing.Start(ctx, "ImageService.EnsureBackingImage", imageAttributes(image)...)
+	defer func() { tracing.End(span, err) }()
+
 	biImage, err := i.ensureBackingImage(ctx, image)
 	if err != nil {
-		zap.L().Warn("failed to ensure backingimage to be created", zap.String("imageName", image.Name), zap.Error(err))
-		return err
+		logger.FromContext(ctx).Warn("failed to ensure backingimage to be created", zap.String("imageName", image.Name), zap.Error(err))
+		return nil, err
 	}
-	zap.L().Info("backing image existed", zap.String("biImage", biImage.Name))
-	err = i.ensureStorageClass(ctx, image, biImage)
-	if err != nil {
-		zap.L().Warn("failed to ensure storageClass to be created", zap.String("imageName", image.Name), zap.Error(err))
+	logger.FromContext(ctx).Info("backing image existed", zap.String("biImage", biImage.Name))
+	return biImage, nil
+}
+
+// EnsureStorageClass creates the storage class provisioning volumes from the backing image if it doesn't exist
+func (i imageServiceImpl) EnsureStorageClass(ctx context.Context, image *kav1.Image, biImage *lhv1beta2.BackingImage) (err error) {
+	ctx, span := tracing.Start(ctx, "ImageService.EnsureStorageClass", imageAttributes(image)...)
+	defer func() { tracing.End(span, err) }()
+
+	if err = i.ensureStorageClass(ctx, image, biImage); err != nil {
+		logger.FromContext(ctx).Warn("failed to ensure storageClass to be created", zap.String("imageName", image.Name), zap.Error(err))
 		return err
 	}
-	zap.L().Info("backing image existed", zap.String("biImage", biImage.Name))
+	logger.FromContext(ctx).Info("storage class existed", zap.String("imageName", image.Name))
 	return nil
 }
 
 func (i imageServiceImpl) ensureBackingImage(ctx context.Context, image *kav1.Image) (*lhv1beta2.BackingImage, error) {
 	imageName := image.Name
-	biName := i.buildBackingImageName(imageName)
+	biName := BackingImageName(imageName)
 
 	var biImage = &lhv1beta2.BackingImage{}
-	err := i.clusterResource.ClusterCache().Get(ctx, client.ObjectKey{
+	err := apiserver.ClusterFrom(ctx, i.clusterResource).ClusterCache().Get(ctx, client.ObjectKey{
 		Namespace: constants.DefaultBackingImageNamespace,
 		Name:      biName,
 	}, biImage)
@@ -123,7 +177,12 @@ func (i imageServiceImpl) ensureBackingImage(ctx context.Context, image *kav1.Im
 					SourceType: lhv1beta2.BackingImageDataSourceType(image.Spec.ImageFrom),
 				},
 			}
-			lhClient := i.clusterResource.Client().LonghornClient().LonghornV1beta2()
+			if image.Spec.ImageFrom == kav1.ImageSourceTypeDownload {
+				biImage.Spec.SourceParameters = map[string]string{
+					lhv1beta2.DataSourceTypeDownloadParameterURL: image.Spec.Url,
+				}
+			}
+			lhClient := apiserver.ClusterFrom(ctx, i.clusterResource).Client().LonghornClient().LonghornV1beta2()
 			return lhClient.BackingImages(constants.DefaultBackingImageNamespace).
 				Create(ctx, biImage, v1.CreateOptions{})
 		} else {
@@ -133,7 +192,8 @@ func (i imageServiceImpl) ensureBackingImage(ctx context.Context, image *kav1.Im
 	return biImage, nil
 }
 
-func (i imageServiceImpl) buildBackingImageName(imageName string) string {
+// BackingImageName returns the name of the image's backing image, it's truncated to NameMaximumLength
+func BackingImageName(imageName string) string {
 	name := fmt.Sprintf("%s-%s", biImagePrefix, imageName)
 	if len(name) > NameMaximumLength {
 		name = name[:NameMaximumLength]
@@ -141,45 +201,66 @@ func (i imageServiceImpl) buildBackingImageName(imageName string) string {
 	return name
 }
 
-func (i imageServiceImpl) uploadImageContent(imageName string, file multipart.File, fileSize int64, request *http.Request) error {
+func (i imageServiceImpl) uploadImageContent(ctx context.Context, imageName string, file multipart.File, fileSize int64, request *http.Request) error {
+	settings, err := i.settingsService.Get(ctx)
+	if err != nil {
+		return err
+	}
+
 	// 4. 创建管道
 	pr, pw := io.Pipe()
 	defer pr.Close()
 
 	bodyWriter := multipart.NewWriter(pw)
 
-	// 5. 启动goroutine将上传文件写入管道
+	// 5. 启动goroutine将上传文件写入管道, the bytes copied are sent once it's done
+	uploaded := make(chan int64, 1)
 	go func() {
+		var n int64
+		defer func() { uploaded <- n }()
 		defer func() { _ = pw.Close() }()
 		defer func() { _ = bodyWriter.Close() }()
 		part, err := bodyWriter.CreateFormFile("chunk", "blob")
 		if err != nil {
 			return
 		}
-		if _, err = io.Copy(part, file); err != nil {
-			return
-		}
+		n, _ = io.Copy(part, file)
 	}()
 
 	//bi image name is invlalid todo
-	imageName = i.buildBackingImageName(imageName)
-	uploadUrl := fmt.Sprintf("%s/%s?action=upload&size=%d",
-		utils.GetEnv(constants.VarLonghornUploadUiPrefix, &constants.BackingImageUploadUri), imageName, fileSize)
+	imageName = BackingImageName(imageName)
+	uploadUrl := fmt.Sprintf("%s/%s?action=upload&size=%d", settings.LonghornUploadUrl, imageName, fileSize)
+
+	start := time.Now()
+	timeout := i.watcher.Current().Limits.UploadTimeout
+	err = postImageContent(ctx, uploadUrl, bodyWriter.FormDataContentType(), pr, timeout)
+	// the copy stops writing once the pipe is closed if the upload failed before reading all the content
+	_ = pr.Close()
+	metrics.ObserveImageUpload(<-uploaded, time.Since(start), err)
+	return err
+}
 
-	httpClient := &http.Client{Timeout: time.Minute * 30}
-	resp, err := httpClient.Post(uploadUrl, bodyWriter.FormDataContentType(), pr)
+func postImageContent(ctx context.Context, uploadUrl, contentType string, body io.Reader, timeout time.Duration) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uploadUrl, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	httpClient := &http.Client{Timeout: timeout, Transport: tracing.NewTransport(nil)}
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return err
 	}
 	defer func() { _ = resp.Body.Close() }()
 
 	// get response
-	body, err := io.ReadAll(resp.Body)
+	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return fmt.Errorf("failed to get response body: %w", err)
 	}
 	if resp.StatusCode >= http.StatusBadRequest {
-		return fmt.Errorf("failed to upload image's content: %d %s", resp.StatusCode, string(body))
+		return fmt.Errorf("failed to upload image's content: %d %s", resp.StatusCode, string(respBody))
 	}
 	return nil
 }
@@ -199,11 +280,11 @@ func (i imageServiceImpl) waitImage(ctx context.Context, imageName string) error
 
 			// ready to upload while the status is pending
 			if biImage.Status.CurrentState == lhv1beta2.BackingImageStatePending {
-				zap.L().Info("the backing image's state is pending, upload later", zap.String("imageName", imageName))
+				logger.FromContext(ctx).Info("the backing image's state is pending, upload later", zap.String("imageName", imageName))
 				break
 			}
 			if biImage.Status.CurrentState == lhv1beta2.BackingImageStateFailed {
-				zap.L().Warn("the backing image's state is failed", zap.String("imageName", imageName),
+				logger.FromContext(ctx).Warn("the backing image's state is failed", zap.String("imageName", imageName),
 					zap.Any("state", biImage.Status.CurrentState))
 				return types.FailWithErrorCode(ctx, constants.CodeBackingImageCreatedError, nil)
 			}
@@ -215,13 +296,13 @@ func (i imageServiceImpl) waitImage(ctx context.Context, imageName string) error
 
 func (i imageServiceImpl) GetBackingImage(ctx context.Context, imageName string) (*lhv1beta2.BackingImage, error) {
 	var bi lhv1beta2.BackingImage
-	err := i.clusterResource.ClusterCache().Get(ctx, client.ObjectKey{
+	err := apiserver.ClusterFrom(ctx, i.clusterResource).ClusterCache().Get(ctx, client.ObjectKey{
 		Namespace: constants.DefaultBackingImageNamespace,
 		Name:      constants.BackingImagePrefix + imageName,
 	}, &bi)
 	if err != nil {
 		if k8serrors.IsNotFound(err) {
-			zap.L().Warn("no backing image found", zap.String("name", imageName), zap.Error(err))
+			logger.FromContext(ctx).Warn("no backing image found", zap.String("name", imageName), zap.Error(err))
 			return nil, nil
 		}
 		return nil, err
@@ -231,13 +312,13 @@ func (i imageServiceImpl) GetBackingImage(ctx context.Context, imageName string)
 
 func (i imageServiceImpl) GetBackingImageDataSource(ctx context.Context, imageName string) (*lhv1beta2.BackingImageDataSource, error) {
 	var bi lhv1beta2.BackingImageDataSource
-	err := i.clusterResource.ClusterCache().Get(ctx, client.ObjectKey{
+	err := apiserver.ClusterFrom(ctx, i.clusterResource).ClusterCache().Get(ctx, client.ObjectKey{
 		Namespace: constants.DefaultBackingImageNamespace,
-		Name:      i.buildBackingImageName(imageName),
+		Name:      BackingImageName(imageName),
 	}, &bi)
 	if err != nil {
 		if k8serrors.IsNotFound(err) {
-			zap.L().Warn("no backing image datasource found", zap.String("name", imageName), zap.Error(err))
+			logger.FromContext(ctx).Warn("no backing image datasource found", zap.String("name", imageName), zap.Error(err))
 			return nil, nil
 		}
 		return nil, err
@@ -245,17 +326,44 @@ func (i imageServiceImpl) GetBackingImageDataSource(ctx context.Context, imageNa
 	return &bi, nil
 }
 
-func (i imageServiceImpl) ensureStorageClass(ctx context.Context, image *kav1.Image, biImage *lhv1beta2.BackingImage) error {
-	scName := image.Spec.StorageClassName
-	if scName == "" {
-		scName = image.Name
+// ImageStorageClassName returns the name of the storage class provisioning volumes from the image
+func ImageStorageClassName(image *kav1.Image) string {
+	if image.Spec.ImageStorageClassName != "" {
+		return image.Spec.ImageStorageClassName
 	}
+	return image.Name
+}
 
-	sc, err := i.storageClass.Get(ctx, image.Name)
+func (i imageServiceImpl) ensureStorageClass(ctx context.Context, image *kav1.Image, biImage *lhv1beta2.BackingImage) error {
+	scName := ImageStorageClassName(image)
+
+	sc, err := i.storageClass.Get(ctx, scName)
 	if err != nil {
 		if k8serrors.IsNotFound(err) {
-			// create if not exist
-			params := map[string]string{constants.ParamBiImageName: biImage.Name}
+			settings, err := i.settingsService.Get(ctx)
+			if err != nil {
+				return err
+			}
+			scSettings := settings.StorageClass
+
+			// create if not exist, the parameters of the base storage class are inherited
+			params := map[string]string{
+				constants.ParamNumberOfReplicas:    scSettings.NumberOfReplicas,
+				constants.ParamStaleReplicaTimeout: scSettings.StaleReplicaTimeout,
+			}
+			for k, v := range scSettings.Parameters {
+				params[k] = v
+			}
+			if image.Spec.StorageClassName != "" {
+				baseSc, err := i.storageClass.Get(ctx, image.Spec.StorageClassName)
+				if err != nil {
+					return err
+				}
+				for k, v := range baseSc.Parameters {
+					params[k] = v
+				}
+			}
+			params[constants.ParamBiImageName] = biImage.Name
 			imageParams := image.Spec.StorageClassParameters
 			if imageParams != nil {
 				for k, v := range imageParams {
@@ -263,6 +371,8 @@ func (i imageServiceImpl) ensureStorageClass(ctx context.Context, image *kav1.Im
 				}
 			}
 
+			reclaimPolicy := corev1.PersistentVolumeReclaimPolicy(scSettings.ReclaimPolicy)
+			volumeBindingMode := storagev1.VolumeBindingMode(scSettings.VolumeBindingMode)
 			sc = &storagev1.StorageClass{
 				ObjectMeta: v1.ObjectMeta{
 					Name: scName,
@@ -270,7 +380,7 @@ func (i imageServiceImpl) ensureStorageClass(ctx context.Context, image *kav1.Im
 				Provisioner:          constants.LonghornDriver,
 				Parameters:           params,
 				ReclaimPolicy:        &reclaimPolicy,
-				AllowVolumeExpansion: &allowVolumeExpansion,
+				AllowVolumeExpansion: scSettings.AllowVolumeExpansion,
 				VolumeBindingMode:    &volumeBindingMode,
 			}
 			_, err = i.storageClass.Create(ctx, sc)
@@ -281,11 +391,14 @@ func (i imageServiceImpl) ensureStorageClass(ctx context.Context, image *kav1.Im
 	return nil
 }
 
-func (i imageServiceImpl) DeleteImageResources(ctx context.Context, image *kav1.Image) error {
+func (i imageServiceImpl) DeleteImageResources(ctx context.Context, image *kav1.Image) (err error) {
+	ctx, span := tracing.Start(ctx, "ImageService.DeleteImageResources", imageAttributes(image)...)
+	defer func() { tracing.End(span, err) }()
+
 	// delete backing image
-	lhClient := i.clusterResource.Client().LonghornClient()
-	biName := i.buildBackingImageName(image.Name)
-	err := lhClient.LonghornV1beta2().BackingImages(constants.DefaultBackingImageNamespace).Delete(ctx, biName, v1.DeleteOptions{})
+	lhClient := apiserver.ClusterFrom(ctx, i.clusterResource).Client().LonghornClient()
+	biName := BackingImageName(image.Name)
+	err = lhClient.LonghornV1beta2().BackingImages(constants.DefaultBackingImageNamespace).Delete(ctx, biName, v1.DeleteOptions{})
 	if err != nil {
 		if !k8serrors.IsNotFound(err) {
 			return err
@@ -293,7 +406,7 @@ func (i imageServiceImpl) DeleteImageResources(ctx context.Context, image *kav1.
 	}
 
 	// delete storage class
-	err = i.clusterResource.Client().K8sClient().StorageV1().StorageClasses().Delete(ctx, image.Name, v1.DeleteOptions{})
+	err = apiserver.ClusterFrom(ctx, i.clusterResource).Client().K8sClient().StorageV1().StorageClasses().Delete(ctx, ImageStorageClassName(image), v1.DeleteOptions{})
 	if err != nil {
 		if !k8serrors.IsNotFound(err) {
 			return err
@@ -302,37 +415,16 @@ func (i imageServiceImpl) DeleteImageResources(ctx context.Context, image *kav1.
 	return nil
 }
 
-func (i imageServiceImpl) UpdateStatus(ctx context.Context, imgStatus *kav1.ImageStatus, biImage *lhv1beta2.BackingImage) error {
-	// if backing image associated to an image
-	imageName, imgOk := biImage.Labels[constants.LabelImage]
-	imageNamespace, nsOk := biImage.Labels[constants.LabelImageNamespace]
-	if imgOk && nsOk {
-		image := &kav1.Image{}
-		err := i.clusterResource.ClusterCache().Get(ctx, client.ObjectKey{
-			Name:      imageName,
-			Namespace: imageNamespace,
-		}, image)
-
-		if err != nil {
-			return err
-		}
-
-		//update its status to track the uploading progress of backing image
-		newImage := image.DeepCopy()
-		newImage.Status = *imgStatus
-		patch, _ := json.Marshal(newImage)
-		if err = i.clusterResource.RuntimeClient().Status().
-			Patch(ctx, newImage, client.RawPatch(client.Merge.Type(), patch)); err != nil {
-			zap.L().Warn("failed to patch image's status",
-				zap.String("name", newImage.Name), zap.Error(err))
-			return nil
-		}
-	}
-	zap.L().Info("image's status is updated", zap.String("image", imageName), zap.Any("status", imgStatus))
-	return nil
+// imageAttributes returns the span attributes identifying the image
+func imageAttributes(image *kav1.Image) []attribute.KeyValue {
+	return []attribute.KeyValue{attribute.String("namespace", image.Namespace), attribute.String("name", image.Name)}
 }
 
-func (i imageServiceImpl) ListImagesByType(ctx context.Context, namespace, imageType string) ([]kav1.Image, error) {
+func (i imageServiceImpl) ListImagesByType(ctx context.Context, namespace, imageType string) (_ []kav1.Image, err error) {
+	ctx, span := tracing.Start(ctx, "ImageService.ListImagesByType", attribute.String("namespace", namespace),
+		attribute.String("type", imageType))
+	defer func() { tracing.End(span, err) }()
+
 	resType := types.NewResourceType(false, namespace)
 	query := types.Query{}
 	result, err := i.baseService.List(ctx, *i.imageGvk, resType, query, false)
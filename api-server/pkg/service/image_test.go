@@ -1,19 +1,109 @@
 package service
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
+	kav1 "kubeall.io/api-server/pkg/generated/kubeall.io/v1"
+	"kubeall.io/api-server/pkg/infra/config"
 	"kubeall.io/api-server/pkg/infra/constants"
 	"kubeall.io/api-server/pkg/infra/utils"
+	"kubeall.io/api-server/pkg/types"
 	"net/http"
+	"net/http/httptest"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 	"testing"
 )
 
 func TestRequest(t *testing.T) {
+	defaultUploadUrl := constants.DefaultLonghornUploadUrl
 	uploadUrl := fmt.Sprintf("%s/%s?action=upload&",
-		utils.GetEnv(constants.VarLonghornUploadUiPrefix, &constants.BackingImageUploadUri), "bi-win")
+		utils.GetEnv(constants.VarLonghornUploadUiPrefix, &defaultUploadUrl), "bi-win")
 	reqUpload, err := http.NewRequest(uploadUrl, http.MethodPost, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 	println(reqUpload)
 }
+
+// fakeSettingsService returns the settings uploading to the url
+type fakeSettingsService struct {
+	SettingsService
+	uploadUrl string
+}
+
+func (f fakeSettingsService) Get(context.Context) (*kav1.GlobalSettingsSpec, error) {
+	return &kav1.GlobalSettingsSpec{LonghornUploadUrl: f.uploadUrl}, nil
+}
+
+// fakeWatcher returns the config with the default limits
+type fakeWatcher struct {
+	config.Watcher
+}
+
+func (f fakeWatcher) Current() *types.ServerConfig {
+	cfg := &types.ServerConfig{}
+	_ = cfg.Complete()
+	return cfg
+}
+
+// memoryFile is the multipart file of the content in memory
+type memoryFile struct {
+	*bytes.Reader
+}
+
+func (memoryFile) Close() error {
+	return nil
+}
+
+// uploadedBytes returns the bytes of the image content uploaded so far
+func uploadedBytes(t *testing.T) float64 {
+	families, err := ctrlmetrics.Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() == "kubeall_image_upload_bytes_total" {
+			return family.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	t.Fatal("no metric of the uploaded bytes")
+	return 0
+}
+
+func TestUploadImageContent(t *testing.T) {
+	content := bytes.Repeat([]byte("kubeall"), 1<<16)
+	tests := map[string]struct {
+		handler http.HandlerFunc
+		failed  bool
+	}{
+		"uploaded": {handler: func(w http.ResponseWriter, req *http.Request) {
+			_, _ = io.Copy(io.Discard, req.Body)
+		}},
+		// longhorn rejects the upload without reading the content
+		"rejected": {handler: func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}, failed: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(test.handler)
+			defer server.Close()
+			imageService := imageServiceImpl{settingsService: fakeSettingsService{uploadUrl: server.URL},
+				watcher: fakeWatcher{}}
+
+			before := uploadedBytes(t)
+			err := imageService.uploadImageContent(context.Background(), "win10",
+				memoryFile{bytes.NewReader(content)}, int64(len(content)), nil)
+			if (err != nil) != test.failed {
+				t.Fatalf("expected failed %t, got %v", test.failed, err)
+			}
+			// all the content copied is counted once the upload returns
+			if uploaded := uploadedBytes(t) - before; (!test.failed && uploaded != float64(len(content))) ||
+				uploaded > float64(len(content)) {
+				t.Errorf("unexpected uploaded bytes %f of %d", uploaded, len(content))
+			}
+		})
+	}
+}
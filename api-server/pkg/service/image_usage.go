@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	kav1 "kubeall.io/api-server/pkg/generated/kubeall.io/v1"
+	lhv1beta2 "kubeall.io/api-server/pkg/generated/longhorn/apis/longhorn/v1beta2"
+	"kubeall.io/api-server/pkg/infra/apiserver"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/logger"
+	"kubeall.io/api-server/pkg/infra/tracing"
+	"kubeall.io/api-server/pkg/types"
+	kv1 "kubevirt.io/api/core/v1"
+	"net/http"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GetUsage returns the pvcs and vms provisioned from the image
+func (i imageServiceImpl) GetUsage(ctx context.Context, namespace, name string) (_ *types.ImageUsage, err error) {
+	ctx, span := tracing.Start(ctx, "ImageService.GetUsage", attribute.String("namespace", namespace),
+		attribute.String("name", name))
+	defer func() { tracing.End(span, err) }()
+
+	image, err := i.getImage(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	return i.ComputeUsage(ctx, image)
+}
+
+// ComputeUsage finds the pvcs whose storage class is the image's, and the ones bound to the longhorn volumes
+// created from the image's backing image. The vms are resolved by the pvcs in their volumes. They're all looked up
+// by the indexes of the informers.
+func (i imageServiceImpl) ComputeUsage(ctx context.Context, image *kav1.Image) (_ *types.ImageUsage, err error) {
+	ctx, span := tracing.Start(ctx, "ImageService.ComputeUsage", imageAttributes(image)...)
+	defer func() { tracing.End(span, err) }()
+
+	usage := &types.ImageUsage{
+		Namespace:        image.Namespace,
+		Name:             image.Name,
+		StorageClassName: ImageStorageClassName(image),
+		BackingImageName: BackingImageName(image.Name),
+		Consumers:        []types.ImageConsumer{},
+	}
+	clusterCache := apiserver.ClusterFrom(ctx, i.clusterResource).ClusterCache()
+
+	consumers := map[client.ObjectKey]*types.ImageConsumer{}
+	var pvcs corev1.PersistentVolumeClaimList
+	if err := clusterCache.List(ctx, &pvcs,
+		client.MatchingFields{apiserver.IndexPvcStorageClass: usage.StorageClassName}); err != nil {
+		return nil, err
+	}
+	for _, pvc := range pvcs.Items {
+		consumers[client.ObjectKeyFromObject(&pvc)] = &types.ImageConsumer{
+			Namespace:  pvc.Namespace,
+			PvcName:    pvc.Name,
+			VolumeName: pvc.Spec.VolumeName,
+		}
+	}
+
+	var volumes lhv1beta2.VolumeList
+	if err := clusterCache.List(ctx, &volumes, client.InNamespace(constants.LonghornNamespace),
+		client.MatchingFields{apiserver.IndexVolumeBackingImage: usage.BackingImageName}); err != nil {
+		return nil, err
+	}
+	for _, volume := range volumes.Items {
+		pvcStatus := volume.Status.KubernetesStatus
+		if pvcStatus.PVCName == "" {
+			continue
+		}
+		key := client.ObjectKey{Namespace: pvcStatus.Namespace, Name: pvcStatus.PVCName}
+		if _, ok := consumers[key]; !ok {
+			consumers[key] = &types.ImageConsumer{
+				Namespace:  pvcStatus.Namespace,
+				PvcName:    pvcStatus.PVCName,
+				VolumeName: volume.Name,
+			}
+		}
+	}
+
+	if err := i.resolveVms(ctx, consumers); err != nil {
+		return nil, err
+	}
+	for _, consumer := range consumers {
+		usage.Consumers = append(usage.Consumers, *consumer)
+	}
+	sort.Slice(usage.Consumers, func(a, b int) bool {
+		if usage.Consumers[a].Namespace != usage.Consumers[b].Namespace {
+			return usage.Consumers[a].Namespace < usage.Consumers[b].Namespace
+		}
+		return usage.Consumers[a].PvcName < usage.Consumers[b].PvcName
+	})
+	usage.InUse = len(usage.Consumers) > 0
+	return usage, nil
+}
+
+// resolveVms fills the vms using the pvcs, the vms are found by the index of their claims
+func (i imageServiceImpl) resolveVms(ctx context.Context, consumers map[client.ObjectKey]*types.ImageConsumer) error {
+	clusterCache := apiserver.ClusterFrom(ctx, i.clusterResource).ClusterCache()
+	for key, consumer := range consumers {
+		var vms kv1.VirtualMachineList
+		if err := clusterCache.List(ctx, &vms, client.InNamespace(key.Namespace),
+			client.MatchingFields{apiserver.IndexVmClaimName: key.Name}); err != nil {
+			return err
+		}
+		if len(vms.Items) > 0 {
+			consumer.VmName = vms.Items[0].Name
+		}
+	}
+	return nil
+}
+
+// Delete deletes the image if it isn't in use, the image is marked as forced to delete if force is true, so that
+// the controller deletes its backing image and storage class regardless of the consumers
+func (i imageServiceImpl) Delete(ctx context.Context, namespace, name string, force bool) (err error) {
+	ctx, span := tracing.Start(ctx, "ImageService.Delete", attribute.String("namespace", namespace),
+		attribute.String("name", name), attribute.Bool("force", force))
+	defer func() { tracing.End(span, err) }()
+
+	image, err := i.getImage(ctx, namespace, name)
+	if err != nil {
+		return err
+	}
+
+	runtimeClient := apiserver.ClusterFrom(ctx, i.clusterResource).RuntimeClient()
+	if force {
+		newImage := image.DeepCopy()
+		if newImage.Annotations == nil {
+			newImage.Annotations = map[string]string{}
+		}
+		newImage.Annotations[constants.AnnotationForceDelete] = strconv.FormatBool(true)
+		if err = runtimeClient.Patch(ctx, newImage, client.MergeFrom(image)); err != nil {
+			return err
+		}
+		logger.FromContext(ctx).Warn("the image is forced to delete", zap.String("namespace", namespace), zap.String("name", name))
+	} else {
+		usage, err := i.ComputeUsage(ctx, image)
+		if err != nil {
+			return err
+		}
+		if usage.InUse {
+			return imageInUseError(ctx, usage)
+		}
+	}
+
+	if err = runtimeClient.Delete(ctx, image); err != nil && !k8serrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func (i imageServiceImpl) getImage(ctx context.Context, namespace, name string) (*kav1.Image, error) {
+	image := &kav1.Image{}
+	err := apiserver.ClusterFrom(ctx, i.clusterResource).ClusterCache().Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, image)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil, types.FailWithStatusCode(http.StatusNotFound)
+		}
+		return nil, err
+	}
+	return image, nil
+}
+
+// IsForceDeleted returns true if the image is deleted regardless of its consumers
+func IsForceDeleted(image *kav1.Image) bool {
+	force, _ := strconv.ParseBool(image.Annotations[constants.AnnotationForceDelete])
+	return force
+}
+
+// imageInUseError returns the error with the usage as its payload
+func imageInUseError(ctx context.Context, usage *types.ImageUsage) error {
+	result := types.FailWithPayLoad(usage, types.FailWithErrorCode(ctx, constants.CodeImageInUse,
+		map[string]string{"name": usage.Name, "consumers": DescribeConsumers(usage.Consumers)}))
+	result.StatusCode = http.StatusConflict
+	return result
+}
+
+// DescribeConsumers describes the consumers as namespace/pvc(vm) in a line
+func DescribeConsumers(consumers []types.ImageConsumer) string {
+	descriptions := make([]string, 0, len(consumers))
+	for _, consumer := range consumers {
+		description := consumer.Namespace + "/" + consumer.PvcName
+		if consumer.VmName != "" {
+			description = fmt.Sprintf("%s(vm %s)", description, consumer.VmName)
+		}
+		descriptions = append(descriptions, description)
+	}
+	return strings.Join(descriptions, ", ")
+}
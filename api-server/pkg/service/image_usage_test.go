@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kav1 "kubeall.io/api-server/pkg/generated/kubeall.io/v1"
+	lhv1beta2 "kubeall.io/api-server/pkg/generated/longhorn/apis/longhorn/v1beta2"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/types"
+	kv1 "kubevirt.io/api/core/v1"
+	"net/http"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"testing"
+)
+
+// imageConsumers are the objects provisioned from the image win10, and the ones of another image
+func imageConsumers() []client.Object {
+	pvc := func(namespace, name, storageClass string) *corev1.PersistentVolumeClaim {
+		return &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Spec: corev1.PersistentVolumeClaimSpec{StorageClassName: &storageClass, VolumeName: "pv-" + name}}
+	}
+	volume := func(name, backingImage, namespace, pvcName string) *lhv1beta2.Volume {
+		return &lhv1beta2.Volume{ObjectMeta: metav1.ObjectMeta{Namespace: constants.LonghornNamespace, Name: name},
+			Spec: lhv1beta2.VolumeSpec{BackingImage: backingImage},
+			Status: lhv1beta2.VolumeStatus{KubernetesStatus: lhv1beta2.KubernetesStatus{Namespace: namespace,
+				PVCName: pvcName}}}
+	}
+	vm := func(namespace, name string, volume kv1.Volume) *kv1.VirtualMachine {
+		return &kv1.VirtualMachine{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Spec: kv1.VirtualMachineSpec{Template: &kv1.VirtualMachineInstanceTemplateSpec{
+				Spec: kv1.VirtualMachineInstanceSpec{Volumes: []kv1.Volume{volume}}}}}
+	}
+	return []client.Object{
+		pvc("ns1", "disk1", "win10"),
+		pvc("ns2", "disk2", "win10"),
+		pvc("ns1", "other", "ubuntu"),
+		// a pvc cloned from the image's volume has another storage class
+		volume("pv-clone", BackingImageName("win10"), "ns1", "clone"),
+		volume("pv-detached", BackingImageName("win10"), "", ""),
+		volume("pv-other", BackingImageName("ubuntu"), "ns1", "other"),
+		vm("ns1", "vm1", kv1.Volume{Name: "root", VolumeSource: kv1.VolumeSource{
+			PersistentVolumeClaim: &kv1.PersistentVolumeClaimVolumeSource{
+				PersistentVolumeClaimVolumeSource: corev1.PersistentVolumeClaimVolumeSource{ClaimName: "disk1"}}}}),
+		vm("ns1", "vm2", kv1.Volume{Name: "root", VolumeSource: kv1.VolumeSource{
+			DataVolume: &kv1.DataVolumeSource{Name: "clone"}}}),
+		// the vm in another namespace doesn't use the pvc of the same name
+		vm("ns3", "vm3", kv1.Volume{Name: "root", VolumeSource: kv1.VolumeSource{
+			DataVolume: &kv1.DataVolumeSource{Name: "disk2"}}}),
+	}
+}
+
+func TestComputeUsage(t *testing.T) {
+	cluster := newFakeCluster(imageConsumers()...)
+	imageService := imageServiceImpl{clusterResource: cluster}
+
+	usage, err := imageService.ComputeUsage(context.Background(),
+		&kav1.Image{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "win10"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []types.ImageConsumer{
+		{Namespace: "ns1", PvcName: "clone", VolumeName: "pv-clone", VmName: "vm2"},
+		{Namespace: "ns1", PvcName: "disk1", VolumeName: "pv-disk1", VmName: "vm1"},
+		{Namespace: "ns2", PvcName: "disk2", VolumeName: "pv-disk2"},
+	}
+	if !usage.InUse || len(usage.Consumers) != len(expected) {
+		t.Fatalf("expected the consumers %v, got %+v", expected, usage)
+	}
+	for i, consumer := range usage.Consumers {
+		if consumer != expected[i] {
+			t.Errorf("expected the consumer %+v, got %+v", expected[i], consumer)
+		}
+	}
+
+	usage, err = imageService.ComputeUsage(context.Background(),
+		&kav1.Image{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "centos"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.InUse || len(usage.Consumers) != 0 {
+		t.Errorf("expected the image not in use, got %+v", usage)
+	}
+}
+
+func TestDeleteImage(t *testing.T) {
+	tests := map[string]struct {
+		image   string
+		force   bool
+		inUse   bool
+		deleted bool
+	}{
+		"in use":     {image: "win10", inUse: true},
+		"not in use": {image: "centos", deleted: true},
+		"forced":     {image: "win10", force: true, deleted: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			image := &kav1.Image{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: test.image,
+				Finalizers: []string{constants.DefaultFinalizer}}}
+			cluster := newFakeCluster(append(imageConsumers(), image)...)
+			imageService := imageServiceImpl{clusterResource: cluster}
+
+			err := imageService.Delete(requestContext("admin"), image.Namespace, image.Name, test.force)
+			var result *types.Result
+			switch {
+			case test.inUse && (!errors.As(err, &result) || result.StatusCode != http.StatusConflict ||
+				result.ErrorCode != constants.CodeImageInUse):
+				t.Fatalf("expected the image in use, got %v", err)
+			case test.inUse && len(result.Payload.(*types.ImageUsage).Consumers) != 3:
+				t.Errorf("expected the consumers in the payload, got %+v", result.Payload)
+			case !test.inUse && err != nil:
+				t.Fatal(err)
+			}
+
+			// the image is kept by its finalizer, the controller deletes its resources once it's marked as deleted
+			latest := &kav1.Image{}
+			if err = cluster.client.Get(context.Background(), client.ObjectKeyFromObject(image), latest); err != nil {
+				t.Fatal(err)
+			}
+			if deleted := latest.DeletionTimestamp != nil; deleted != test.deleted {
+				t.Errorf("expected the image deleted %t, got %t", test.deleted, deleted)
+			}
+			if IsForceDeleted(latest) != test.force {
+				t.Errorf("expected the image forced to delete %t, got %v", test.force, latest.Annotations)
+			}
+		})
+	}
+
+	imageService := imageServiceImpl{clusterResource: newFakeCluster()}
+	err := imageService.Delete(requestContext("admin"), "ns1", "missing", false)
+	var result *types.Result
+	if !errors.As(err, &result) || result.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404, got %v", err)
+	}
+}
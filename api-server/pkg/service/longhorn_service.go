@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	lhv1beta2 "kubeall.io/api-server/pkg/generated/longhorn/apis/longhorn/v1beta2"
+	lhtyped "kubeall.io/api-server/pkg/generated/longhorn/clientset/versioned/typed/longhorn/v1beta2"
+	"kubeall.io/api-server/pkg/infra/apiserver"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/logger"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+)
+
+const (
+	supportBundlePrefix = "support-bundle-"
+	// the support bundle manager serves the generated archive on this port and path
+	supportBundleManagerPort = 8080
+	supportBundleManagerPath = "bundle"
+)
+
+// SupportBundleArchive is the archive generated by a support bundle, the caller must close the content
+type SupportBundleArchive struct {
+	FileName string
+	Size     int64
+	Content  io.ReadCloser
+}
+
+type LonghornService interface {
+	CreateSupportBundle(ctx context.Context, request types.SupportBundleRequest) (*lhv1beta2.SupportBundle, error)
+	GetSupportBundle(ctx context.Context, name string) (*lhv1beta2.SupportBundle, error)
+	DownloadSupportBundle(ctx context.Context, name string) (*SupportBundleArchive, error)
+	DeleteSupportBundle(ctx context.Context, name string) error
+
+	ListSystemBackups(ctx context.Context) ([]lhv1beta2.SystemBackup, error)
+	CreateSystemBackup(ctx context.Context, request types.SystemBackupRequest) (*lhv1beta2.SystemBackup, error)
+	ListSystemRestores(ctx context.Context) ([]lhv1beta2.SystemRestore, error)
+	CreateSystemRestore(ctx context.Context, request types.SystemRestoreRequest) (*lhv1beta2.SystemRestore, error)
+}
+
+type longhornServiceImpl struct {
+	clusterResource apiserver.ClusterResource
+}
+
+func NewLonghornService(clusterResource apiserver.ClusterResource) LonghornService {
+	return &longhornServiceImpl{clusterResource: clusterResource}
+}
+
+func (l longhornServiceImpl) lhClient(ctx context.Context) lhtyped.LonghornV1beta2Interface {
+	return apiserver.ClusterFrom(ctx, l.clusterResource).Client().LonghornClient().LonghornV1beta2()
+}
+
+func (l longhornServiceImpl) CreateSupportBundle(ctx context.Context, request types.SupportBundleRequest) (*lhv1beta2.SupportBundle, error) {
+	bundle := &lhv1beta2.SupportBundle{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: supportBundlePrefix,
+			Namespace:    constants.LonghornNamespace,
+		},
+		Spec: lhv1beta2.SupportBundleSpec{
+			NodeID:      request.NodeID,
+			IssueURL:    request.IssueURL,
+			Description: request.Description,
+		},
+	}
+	bundle, err := l.lhClient(ctx).SupportBundles(constants.LonghornNamespace).Create(ctx, bundle, metav1.CreateOptions{})
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to create support bundle", zap.Error(err))
+		return nil, err
+	}
+	logger.FromContext(ctx).Info("support bundle is created", zap.String("name", bundle.Name))
+	return bundle, nil
+}
+
+func (l longhornServiceImpl) GetSupportBundle(ctx context.Context, name string) (*lhv1beta2.SupportBundle, error) {
+	bundle, err := l.lhClient(ctx).SupportBundles(constants.LonghornNamespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			logger.FromContext(ctx).Warn("no support bundle found", zap.String("name", name))
+			return nil, types.FailWithStatusCode(http.StatusNotFound)
+		}
+		return nil, err
+	}
+	return bundle, nil
+}
+
+// readySupportBundle returns the support bundle if its archive is generated, the caller polls the bundle until then
+func (l longhornServiceImpl) readySupportBundle(ctx context.Context, name string) (*lhv1beta2.SupportBundle, error) {
+	bundle, err := l.GetSupportBundle(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	switch bundle.Status.State {
+	case lhv1beta2.SupportBundleStateReady:
+		return bundle, nil
+	case lhv1beta2.SupportBundleStateError:
+		logger.FromContext(ctx).Warn("failed to generate support bundle", zap.String("name", name),
+			zap.Any("conditions", bundle.Status.Conditions))
+		result := types.FailWithErrorCode(ctx, constants.CodeSupportBundleFailed, map[string]string{"name": name})
+		result.StatusCode = http.StatusUnprocessableEntity
+		return nil, result
+	}
+	logger.FromContext(ctx).Debug("support bundle is being generated", zap.String("name", name),
+		zap.Int("progress", bundle.Status.Progress))
+	result := types.FailWithErrorCode(ctx, constants.CodeSupportBundleNotReady, map[string]string{"name": name,
+		"progress": strconv.Itoa(bundle.Status.Progress)})
+	result.StatusCode = http.StatusConflict
+	return nil, result
+}
+
+// DownloadSupportBundle opens the archive of a generated support bundle, it's served by the support bundle manager
+// and proxied by the api server of the cluster, so the pod doesn't have to be reachable from the api server
+func (l longhornServiceImpl) DownloadSupportBundle(ctx context.Context, name string) (*SupportBundleArchive, error) {
+	bundle, err := l.readySupportBundle(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	pods := apiserver.ClusterFrom(ctx, l.clusterResource).Client().K8sClient().CoreV1().Pods(constants.LonghornNamespace)
+	list, err := pods.List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("status.podIP", bundle.Status.IP).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	index := slices.IndexFunc(list.Items, func(pod corev1.Pod) bool {
+		return pod.Status.PodIP == bundle.Status.IP && pod.Status.Phase == corev1.PodRunning
+	})
+	if index < 0 {
+		logger.FromContext(ctx).Warn("no support bundle manager found", zap.String("name", name),
+			zap.String("ip", bundle.Status.IP))
+		return nil, fmt.Errorf("the support bundle manager of %s isn't running", name)
+	}
+
+	content, err := pods.ProxyGet("http", list.Items[index].Name, strconv.Itoa(supportBundleManagerPort),
+		supportBundleManagerPath, nil).Stream(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to download support bundle", zap.String("name", name), zap.Error(err))
+		return nil, err
+	}
+	return &SupportBundleArchive{
+		FileName: bundle.Status.Filename,
+		Size:     bundle.Status.Filesize,
+		Content:  content,
+	}, nil
+}
+
+func (l longhornServiceImpl) DeleteSupportBundle(ctx context.Context, name string) error {
+	err := l.lhClient(ctx).SupportBundles(constants.LonghornNamespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && k8serrors.IsNotFound(err) {
+		return types.FailWithStatusCode(http.StatusNotFound)
+	}
+	return err
+}
+
+func (l longhornServiceImpl) ListSystemBackups(ctx context.Context) ([]lhv1beta2.SystemBackup, error) {
+	list, err := l.lhClient(ctx).SystemBackups(constants.LonghornNamespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(list.Items, func(i, j int) bool {
+		return list.Items[j].CreationTimestamp.Before(&list.Items[i].CreationTimestamp)
+	})
+	return list.Items, nil
+}
+
+func (l longhornServiceImpl) CreateSystemBackup(ctx context.Context, request types.SystemBackupRequest) (*lhv1beta2.SystemBackup, error) {
+	policy := request.VolumeBackupPolicy
+	if policy == "" {
+		policy = lhv1beta2.SystemBackupCreateVolumeBackupPolicyIfNotPresent
+	}
+	backup := &lhv1beta2.SystemBackup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      request.Name,
+			Namespace: constants.LonghornNamespace,
+		},
+		Spec: lhv1beta2.SystemBackupSpec{
+			VolumeBackupPolicy: policy,
+		},
+	}
+	backup, err := l.lhClient(ctx).SystemBackups(constants.LonghornNamespace).Create(ctx, backup, metav1.CreateOptions{})
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to create system backup", zap.String("name", request.Name), zap.Error(err))
+		return nil, err
+	}
+	logger.FromContext(ctx).Info("system backup is created", zap.String("name", backup.Name))
+	return backup, nil
+}
+
+func (l longhornServiceImpl) ListSystemRestores(ctx context.Context) ([]lhv1beta2.SystemRestore, error) {
+	list, err := l.lhClient(ctx).SystemRestores(constants.LonghornNamespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(list.Items, func(i, j int) bool {
+		return list.Items[j].CreationTimestamp.Before(&list.Items[i].CreationTimestamp)
+	})
+	return list.Items, nil
+}
+
+func (l longhornServiceImpl) CreateSystemRestore(ctx context.Context, request types.SystemRestoreRequest) (*lhv1beta2.SystemRestore, error) {
+	// the system backup must exist before restoring
+	_, err := l.lhClient(ctx).SystemBackups(constants.LonghornNamespace).Get(ctx, request.SystemBackup, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil, types.FailWithErrorCode(ctx, constants.CodeInvalidParam, map[string]string{"name": "systemBackup"})
+		}
+		return nil, err
+	}
+
+	restore := &lhv1beta2.SystemRestore{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      request.Name,
+			Namespace: constants.LonghornNamespace,
+		},
+		Spec: lhv1beta2.SystemRestoreSpec{
+			SystemBackup: request.SystemBackup,
+		},
+	}
+	restore, err = l.lhClient(ctx).SystemRestores(constants.LonghornNamespace).Create(ctx, restore, metav1.CreateOptions{})
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to create system restore", zap.String("name", request.Name), zap.Error(err))
+		return nil, err
+	}
+	logger.FromContext(ctx).Info("system restore is created", zap.String("name", restore.Name),
+		zap.String("systemBackup", request.SystemBackup))
+	return restore, nil
+}
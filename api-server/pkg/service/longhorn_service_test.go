@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+	lhv1beta2 "kubeall.io/api-server/pkg/generated/longhorn/apis/longhorn/v1beta2"
+	lhclient "kubeall.io/api-server/pkg/generated/longhorn/clientset/versioned"
+	lhfake "kubeall.io/api-server/pkg/generated/longhorn/clientset/versioned/fake"
+	"kubeall.io/api-server/pkg/infra/clients"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeClients serves the requests of the clients by the fake clientsets
+type fakeClients struct {
+	clients.ApiClient
+	k8sClient      *k8sfake.Clientset
+	longhornClient *lhfake.Clientset
+}
+
+func (f fakeClients) K8sClient() kubernetes.Interface {
+	return f.k8sClient
+}
+
+func (f fakeClients) LonghornClient() lhclient.Interface {
+	return f.longhornClient
+}
+
+// proxiedContent is the response of the requests proxied by the fake clientset
+type proxiedContent string
+
+func (p proxiedContent) DoRaw(context.Context) ([]byte, error) {
+	return []byte(p), nil
+}
+
+func (p proxiedContent) Stream(context.Context) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(string(p))), nil
+}
+
+func TestDownloadSupportBundle(t *testing.T) {
+	bundle := func(name string, state lhv1beta2.SupportBundleState) *lhv1beta2.SupportBundle {
+		return &lhv1beta2.SupportBundle{
+			ObjectMeta: metav1.ObjectMeta{Namespace: constants.LonghornNamespace, Name: name},
+			Status: lhv1beta2.SupportBundleStatus{State: state, Progress: 40, IP: "10.0.0.2",
+				Filename: name + ".zip", Filesize: 7},
+		}
+	}
+	pod := func(name, ip string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: constants.LonghornNamespace, Name: name},
+			Status: corev1.PodStatus{PodIP: ip, Phase: corev1.PodRunning}}
+	}
+	k8sClient := k8sfake.NewClientset(pod("longhorn-manager", "10.0.0.1"), pod("supportbundle-manager", "10.0.0.2"))
+	var proxied []k8stesting.ProxyGetAction
+	k8sClient.AddProxyReactor("pods", func(action k8stesting.Action) (bool, rest.ResponseWrapper, error) {
+		proxied = append(proxied, action.(k8stesting.ProxyGetAction))
+		return true, proxiedContent("archive"), nil
+	})
+	gone := bundle("gone", lhv1beta2.SupportBundleStateReady)
+	gone.Status.IP = "10.0.0.3"
+	member := apiCluster{client: fakeClients{k8sClient: k8sClient, longhornClient: lhfake.NewSimpleClientset(
+		bundle("generating", lhv1beta2.SupportBundleStateGenerating),
+		bundle("failed", lhv1beta2.SupportBundleStateError),
+		bundle("ready", lhv1beta2.SupportBundleStateReady),
+		gone,
+	)}}
+	// the bundles are downloaded from the cluster selected by the request rather than the local one
+	longhornService := NewLonghornService(apiCluster{})
+
+	tests := map[string]struct {
+		name       string
+		statusCode int
+		errorCode  constants.ErrorCode
+		// the download fails without a result
+		failed bool
+	}{
+		"generating": {name: "generating", statusCode: http.StatusConflict,
+			errorCode: constants.CodeSupportBundleNotReady},
+		"failed":       {name: "failed", statusCode: http.StatusUnprocessableEntity, errorCode: constants.CodeSupportBundleFailed},
+		"not found":    {name: "missing", statusCode: http.StatusNotFound},
+		"manager gone": {name: "gone", failed: true},
+		"ready":        {name: "ready"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			proxied = nil
+			ctx := requestContext("admin")
+			ctx.Set(constants.ClusterKey, member)
+
+			archive, err := longhornService.DownloadSupportBundle(ctx, test.name)
+			if test.failed {
+				if err == nil || len(proxied) > 0 {
+					t.Fatalf("expected the download failed, got %v %v", err, proxied)
+				}
+				return
+			}
+			if test.statusCode != 0 {
+				var result *types.Result
+				if !errors.As(err, &result) || result.StatusCode != test.statusCode || result.ErrorCode != test.errorCode {
+					t.Fatalf("expected %d %s, got %v", test.statusCode, test.errorCode, err)
+				}
+				if len(proxied) > 0 {
+					t.Errorf("expected nothing downloaded, got %v", proxied)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = archive.Content.Close() }()
+			content, err := io.ReadAll(archive.Content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != "archive" || archive.FileName != "ready.zip" || archive.Size != 7 {
+				t.Errorf("unexpected archive %+v %s", archive, content)
+			}
+			if len(proxied) != 1 || proxied[0].GetName() != "supportbundle-manager" || proxied[0].GetPort() != "8080" ||
+				proxied[0].GetPath() != "bundle" {
+				t.Errorf("expected the archive proxied from the support bundle manager, got %v", proxied)
+			}
+		})
+	}
+}
+
+func TestSupportBundleProgress(t *testing.T) {
+	longhornClient := lhfake.NewSimpleClientset(&lhv1beta2.SupportBundle{
+		ObjectMeta: metav1.ObjectMeta{Namespace: constants.LonghornNamespace, Name: "bundle"},
+		Status:     lhv1beta2.SupportBundleStatus{State: lhv1beta2.SupportBundleStateStarted},
+	})
+	k8sClient := k8sfake.NewClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: constants.LonghornNamespace, Name: "supportbundle-manager"},
+		Status:     corev1.PodStatus{PodIP: "10.0.0.2", Phase: corev1.PodRunning},
+	})
+	k8sClient.AddProxyReactor("pods", func(k8stesting.Action) (bool, rest.ResponseWrapper, error) {
+		return true, proxiedContent("archive"), nil
+	})
+	longhornService := NewLonghornService(apiCluster{client: fakeClients{k8sClient: k8sClient,
+		longhornClient: longhornClient}})
+
+	// the bundle is polled while it's being generated until it's ready for downloading
+	for _, status := range []lhv1beta2.SupportBundleStatus{
+		{State: lhv1beta2.SupportBundleStateGenerating, Progress: 30},
+		{State: lhv1beta2.SupportBundleStateGenerating, Progress: 90},
+		{State: lhv1beta2.SupportBundleStateReady, Progress: 100, IP: "10.0.0.2"},
+	} {
+		ctx := requestContext("admin")
+		bundle, err := longhornService.GetSupportBundle(ctx, "bundle")
+		if err != nil {
+			t.Fatal(err)
+		}
+		bundle.Status = status
+		if _, err = longhornClient.LonghornV1beta2().SupportBundles(constants.LonghornNamespace).
+			UpdateStatus(ctx, bundle, metav1.UpdateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+
+		archive, err := longhornService.DownloadSupportBundle(ctx, "bundle")
+		var result *types.Result
+		switch {
+		case status.State == lhv1beta2.SupportBundleStateReady && err != nil:
+			t.Fatalf("expected the bundle downloaded, got %v", err)
+		case status.State == lhv1beta2.SupportBundleStateReady:
+			_ = archive.Content.Close()
+		case !errors.As(err, &result) || result.ErrorCode != constants.CodeSupportBundleNotReady:
+			t.Fatalf("expected the bundle not ready, got %v", err)
+		case !strings.Contains(result.Message, strconv.Itoa(status.Progress)):
+			t.Errorf("expected the progress %d in %s", status.Progress, result.Message)
+		}
+	}
+}
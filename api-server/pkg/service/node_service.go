@@ -0,0 +1,380 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	lhv1beta2 "kubeall.io/api-server/pkg/generated/longhorn/apis/longhorn/v1beta2"
+	"kubeall.io/api-server/pkg/infra/apiserver"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/logger"
+	"kubeall.io/api-server/pkg/types"
+	kv1 "kubevirt.io/api/core/v1"
+	"net/http"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"slices"
+	"sort"
+	"strings"
+)
+
+type NodeService interface {
+	List(ctx context.Context) ([]types.NodeView, error)
+	Get(ctx context.Context, name string) (*types.NodeView, error)
+	Cordon(ctx context.Context, name string, unschedulable bool) error
+	SetDiskScheduling(ctx context.Context, nodeName, diskName string, allowScheduling bool) error
+	SetNodeTags(ctx context.Context, nodeName string, tags []string) error
+	SetDiskTags(ctx context.Context, nodeName, diskName string, tags []string) error
+	RequestEviction(ctx context.Context, nodeName string, request types.EvictionRequest) error
+}
+
+type nodeServiceImpl struct {
+	clusterResource apiserver.ClusterResource
+}
+
+func NewNodeService(clusterResource apiserver.ClusterResource) NodeService {
+	return &nodeServiceImpl{clusterResource: clusterResource}
+}
+
+// List returns all nodes of the cluster joined with their longhorn nodes and vm instances
+func (n nodeServiceImpl) List(ctx context.Context) ([]types.NodeView, error) {
+	var nodeList corev1.NodeList
+	if err := apiserver.ClusterFrom(ctx, n.clusterResource).ClusterCache().List(ctx, &nodeList); err != nil {
+		return nil, err
+	}
+
+	var lhNodeList lhv1beta2.NodeList
+	if err := apiserver.ClusterFrom(ctx, n.clusterResource).ClusterCache().List(ctx, &lhNodeList,
+		client.InNamespace(constants.LonghornNamespace)); err != nil {
+		return nil, err
+	}
+	lhNodes := make(map[string]*lhv1beta2.Node, len(lhNodeList.Items))
+	for i := range lhNodeList.Items {
+		lhNodes[lhNodeList.Items[i].Name] = &lhNodeList.Items[i]
+	}
+
+	vmis, err := n.listVmInstances(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	views := make([]types.NodeView, 0, len(nodeList.Items))
+	for i := range nodeList.Items {
+		node := &nodeList.Items[i]
+		views = append(views, n.buildNodeView(node, lhNodes[node.Name], vmis[node.Name]))
+	}
+	sort.Slice(views, func(i, j int) bool {
+		return views[i].Name < views[j].Name
+	})
+	return views, nil
+}
+
+func (n nodeServiceImpl) Get(ctx context.Context, name string) (*types.NodeView, error) {
+	var node corev1.Node
+	if err := apiserver.ClusterFrom(ctx, n.clusterResource).ClusterCache().Get(ctx, client.ObjectKey{Name: name}, &node); err != nil {
+		if k8serrors.IsNotFound(err) {
+			logger.FromContext(ctx).Warn("no node found", zap.String("name", name))
+			return nil, types.FailWithStatusCode(http.StatusNotFound)
+		}
+		return nil, err
+	}
+
+	var lhNode *lhv1beta2.Node
+	var cachedLhNode lhv1beta2.Node
+	err := apiserver.ClusterFrom(ctx, n.clusterResource).ClusterCache().Get(ctx, client.ObjectKey{
+		Namespace: constants.LonghornNamespace,
+		Name:      name,
+	}, &cachedLhNode)
+	if err == nil {
+		lhNode = &cachedLhNode
+	} else if !k8serrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	vmis, err := n.listVmInstances(ctx)
+	if err != nil {
+		return nil, err
+	}
+	view := n.buildNodeView(&node, lhNode, vmis[name])
+	return &view, nil
+}
+
+// Cordon marks the kubernetes node as unschedulable, or schedulable again while unschedulable is false
+func (n nodeServiceImpl) Cordon(ctx context.Context, name string, unschedulable bool) error {
+	patch := []byte(`{"spec":{"unschedulable":false}}`)
+	if unschedulable {
+		patch = []byte(`{"spec":{"unschedulable":true}}`)
+	}
+	_, err := apiserver.ClusterFrom(ctx, n.clusterResource).Client().K8sClient().CoreV1().Nodes().
+		Patch(ctx, name, k8stypes.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return types.FailWithStatusCode(http.StatusNotFound)
+		}
+		return err
+	}
+	logger.FromContext(ctx).Info("node's scheduling is changed", zap.String("node", name),
+		zap.Bool("unschedulable", unschedulable))
+	return nil
+}
+
+func (n nodeServiceImpl) SetDiskScheduling(ctx context.Context, nodeName, diskName string, allowScheduling bool) error {
+	return n.updateLonghornNode(ctx, nodeName, func(lhNode *lhv1beta2.Node) error {
+		disk, ok := lhNode.Spec.Disks[diskName]
+		if !ok {
+			return n.diskNotFound(ctx, nodeName, diskName)
+		}
+		disk.AllowScheduling = allowScheduling
+		lhNode.Spec.Disks[diskName] = disk
+		return nil
+	})
+}
+
+func (n nodeServiceImpl) SetNodeTags(ctx context.Context, nodeName string, tags []string) error {
+	return n.updateLonghornNode(ctx, nodeName, func(lhNode *lhv1beta2.Node) error {
+		lhNode.Spec.Tags = normalizeTags(tags)
+		return nil
+	})
+}
+
+func (n nodeServiceImpl) SetDiskTags(ctx context.Context, nodeName, diskName string, tags []string) error {
+	return n.updateLonghornNode(ctx, nodeName, func(lhNode *lhv1beta2.Node) error {
+		disk, ok := lhNode.Spec.Disks[diskName]
+		if !ok {
+			return n.diskNotFound(ctx, nodeName, diskName)
+		}
+		disk.Tags = normalizeTags(tags)
+		lhNode.Spec.Disks[diskName] = disk
+		return nil
+	})
+}
+
+// schedulingBeforeEviction the scheduling of the longhorn node and its disks before their evictions are requested
+type schedulingBeforeEviction struct {
+	Node  *bool           `json:"node,omitempty"`
+	Disks map[string]bool `json:"disks,omitempty"`
+}
+
+// RequestEviction asks longhorn to move the replicas away from the node (or one of its disks) before maintenance.
+// Longhorn only evicts replicas from a node or disk whose scheduling is disabled, so the scheduling is turned off
+// while requesting the eviction. The prior scheduling is kept by an annotation and restored once the eviction is
+// cancelled, the scheduling is left alone if there's none, e.g. the eviction was requested by longhorn's UI.
+func (n nodeServiceImpl) RequestEviction(ctx context.Context, nodeName string, request types.EvictionRequest) error {
+	evictionRequested := *request.EvictionRequested
+	return n.updateLonghornNode(ctx, nodeName, func(lhNode *lhv1beta2.Node) error {
+		var prior schedulingBeforeEviction
+		if value, ok := lhNode.Annotations[constants.AnnotationSchedulingBeforeEviction]; ok {
+			if err := json.Unmarshal([]byte(value), &prior); err != nil {
+				logger.FromContext(ctx).Warn("invalid scheduling before eviction, it's ignored",
+					zap.String("node", nodeName), zap.String("value", value), zap.Error(err))
+			}
+		}
+
+		if request.Disk == "" {
+			switch {
+			case evictionRequested && !lhNode.Spec.EvictionRequested:
+				allowScheduling := lhNode.Spec.AllowScheduling
+				prior.Node = &allowScheduling
+				lhNode.Spec.AllowScheduling = false
+			case !evictionRequested && prior.Node != nil:
+				lhNode.Spec.AllowScheduling = *prior.Node
+				prior.Node = nil
+			}
+			lhNode.Spec.EvictionRequested = evictionRequested
+			return setSchedulingBeforeEviction(lhNode, &prior)
+		}
+
+		disk, ok := lhNode.Spec.Disks[request.Disk]
+		if !ok {
+			return n.diskNotFound(ctx, nodeName, request.Disk)
+		}
+		allowScheduling, saved := prior.Disks[request.Disk]
+		switch {
+		case evictionRequested && !disk.EvictionRequested:
+			if prior.Disks == nil {
+				prior.Disks = map[string]bool{}
+			}
+			prior.Disks[request.Disk] = disk.AllowScheduling
+			disk.AllowScheduling = false
+		case !evictionRequested && saved:
+			disk.AllowScheduling = allowScheduling
+			delete(prior.Disks, request.Disk)
+		}
+		disk.EvictionRequested = evictionRequested
+		lhNode.Spec.Disks[request.Disk] = disk
+		return setSchedulingBeforeEviction(lhNode, &prior)
+	})
+}
+
+// setSchedulingBeforeEviction keeps the prior scheduling by the annotation, it's removed once there's none
+func setSchedulingBeforeEviction(lhNode *lhv1beta2.Node, prior *schedulingBeforeEviction) error {
+	if prior.Node == nil && len(prior.Disks) == 0 {
+		delete(lhNode.Annotations, constants.AnnotationSchedulingBeforeEviction)
+		return nil
+	}
+	value, err := json.Marshal(prior)
+	if err != nil {
+		return err
+	}
+	if lhNode.Annotations == nil {
+		lhNode.Annotations = map[string]string{}
+	}
+	lhNode.Annotations[constants.AnnotationSchedulingBeforeEviction] = string(value)
+	return nil
+}
+
+// updateLonghornNode fetches the latest longhorn node, applies the mutation and retries while conflicts occur
+func (n nodeServiceImpl) updateLonghornNode(ctx context.Context, nodeName string, mutate func(*lhv1beta2.Node) error) error {
+	lhClient := apiserver.ClusterFrom(ctx, n.clusterResource).Client().LonghornClient().LonghornV1beta2().Nodes(constants.LonghornNamespace)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		lhNode, err := lhClient.Get(ctx, nodeName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if err = mutate(lhNode); err != nil {
+			return err
+		}
+		_, err = lhClient.Update(ctx, lhNode, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			logger.FromContext(ctx).Warn("no longhorn node found", zap.String("node", nodeName))
+			return types.FailWithErrorCode(ctx, constants.CodeLonghornNodeNotFound, map[string]string{"name": nodeName})
+		}
+		logger.FromContext(ctx).Warn("failed to update longhorn node", zap.String("node", nodeName), zap.Error(err))
+		return err
+	}
+	logger.FromContext(ctx).Info("longhorn node is updated", zap.String("node", nodeName))
+	return nil
+}
+
+func (n nodeServiceImpl) diskNotFound(ctx context.Context, nodeName, diskName string) error {
+	logger.FromContext(ctx).Warn("no disk found on longhorn node", zap.String("node", nodeName), zap.String("disk", diskName))
+	result := types.FailWithErrorCode(ctx, constants.CodeDiskNotFound, map[string]string{"node": nodeName, "disk": diskName})
+	result.StatusCode = http.StatusNotFound
+	return result
+}
+
+// listVmInstances groups the vm instances by the node they're running on
+func (n nodeServiceImpl) listVmInstances(ctx context.Context) (map[string][]types.NodeVmInstanceReference, error) {
+	var vmiList kv1.VirtualMachineInstanceList
+	if err := apiserver.ClusterFrom(ctx, n.clusterResource).ClusterCache().List(ctx, &vmiList); err != nil {
+		return nil, err
+	}
+	vmis := make(map[string][]types.NodeVmInstanceReference)
+	for _, vmi := range vmiList.Items {
+		if vmi.Status.NodeName == "" || vmi.IsFinal() {
+			continue
+		}
+		vmis[vmi.Status.NodeName] = append(vmis[vmi.Status.NodeName], types.NodeVmInstanceReference{
+			Name:      vmi.Name,
+			Namespace: vmi.Namespace,
+			Phase:     string(vmi.Status.Phase),
+		})
+	}
+	return vmis, nil
+}
+
+func (n nodeServiceImpl) buildNodeView(node *corev1.Node, lhNode *lhv1beta2.Node,
+	vmis []types.NodeVmInstanceReference) types.NodeView {
+	view := types.NodeView{
+		Name:              node.Name,
+		Labels:            node.Labels,
+		CreationTimestamp: node.CreationTimestamp,
+		Unschedulable:     node.Spec.Unschedulable,
+		Addresses:         node.Status.Addresses,
+		Capacity:          node.Status.Capacity,
+		Allocatable:       node.Status.Allocatable,
+		NodeInfo:          node.Status.NodeInfo,
+		VmInstances:       vmis,
+	}
+	if view.VmInstances == nil {
+		view.VmInstances = []types.NodeVmInstanceReference{}
+	}
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			view.Ready = cond.Status == corev1.ConditionTrue
+		}
+	}
+	for label := range node.Labels {
+		if role, ok := strings.CutPrefix(label, constants.LabelNodeRolePrefix); ok && role != "" {
+			view.Roles = append(view.Roles, role)
+		}
+	}
+	slices.Sort(view.Roles)
+
+	if lhNode != nil {
+		view.Storage = n.buildStorageView(lhNode)
+	}
+	return view
+}
+
+func (n nodeServiceImpl) buildStorageView(lhNode *lhv1beta2.Node) *types.NodeStorageView {
+	storage := &types.NodeStorageView{
+		AllowScheduling:   lhNode.Spec.AllowScheduling,
+		EvictionRequested: lhNode.Spec.EvictionRequested,
+		AutoEvicting:      lhNode.Status.AutoEvicting,
+		Ready:             isConditionTrue(lhNode.Status.Conditions, lhv1beta2.NodeConditionTypeReady),
+		Schedulable:       isConditionTrue(lhNode.Status.Conditions, lhv1beta2.NodeConditionTypeSchedulable),
+		Tags:              normalizeTags(lhNode.Spec.Tags),
+		Region:            lhNode.Status.Region,
+		Zone:              lhNode.Status.Zone,
+		Disks:             make([]types.DiskView, 0, len(lhNode.Spec.Disks)),
+	}
+
+	for name, spec := range lhNode.Spec.Disks {
+		disk := types.DiskView{
+			Name:              name,
+			Path:              spec.Path,
+			DiskType:          string(spec.Type),
+			AllowScheduling:   spec.AllowScheduling,
+			EvictionRequested: spec.EvictionRequested,
+			Tags:              normalizeTags(spec.Tags),
+			StorageReserved:   spec.StorageReserved,
+		}
+		if status, ok := lhNode.Status.DiskStatus[name]; ok && status != nil {
+			disk.Ready = isConditionTrue(status.Conditions, lhv1beta2.DiskConditionTypeReady)
+			disk.Schedulable = isConditionTrue(status.Conditions, lhv1beta2.DiskConditionTypeSchedulable)
+			disk.StorageMaximum = status.StorageMaximum
+			disk.StorageAvailable = status.StorageAvailable
+			disk.StorageScheduled = status.StorageScheduled
+			disk.ReplicaCount = len(status.ScheduledReplica)
+		}
+		storage.StorageMaximum += disk.StorageMaximum
+		storage.StorageAvailable += disk.StorageAvailable
+		storage.StorageScheduled += disk.StorageScheduled
+		storage.StorageReserved += disk.StorageReserved
+		storage.Disks = append(storage.Disks, disk)
+	}
+	sort.Slice(storage.Disks, func(i, j int) bool {
+		return storage.Disks[i].Name < storage.Disks[j].Name
+	})
+	return storage
+}
+
+func isConditionTrue(conditions []lhv1beta2.Condition, conditionType string) bool {
+	for _, cond := range conditions {
+		if cond.Type == conditionType {
+			return cond.Status == lhv1beta2.ConditionStatusTrue
+		}
+	}
+	return false
+}
+
+// normalizeTags removes the empty and duplicated tags, longhorn rejects them
+func normalizeTags(tags []string) []string {
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !slices.Contains(result, tag) {
+			result = append(result, tag)
+		}
+	}
+	slices.Sort(result)
+	return result
+}
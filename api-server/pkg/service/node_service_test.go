@@ -0,0 +1,153 @@
+package service
+
+import (
+	"encoding/json"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	lhv1beta2 "kubeall.io/api-server/pkg/generated/longhorn/apis/longhorn/v1beta2"
+	"kubeall.io/api-server/pkg/infra/clients"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// longhornNodeServer serves the longhorn node, it's replaced by the updates
+type longhornNodeServer struct {
+	lock sync.Mutex
+	node lhv1beta2.Node
+}
+
+func (l *longhornNodeServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if req.URL.Path != "/apis/longhorn.io/v1beta2/namespaces/"+constants.LonghornNamespace+"/nodes/"+l.node.Name {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var node lhv1beta2.Node
+		if err := json.NewDecoder(req.Body).Decode(&node); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		l.node = node
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(&l.node)
+}
+
+func TestRequestEviction(t *testing.T) {
+	server := &longhornNodeServer{}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	apiClient, err := clients.NewClientsForConfig(&rest.Config{Host: httpServer.URL, QPS: 100, Burst: 100,
+		ContentConfig: rest.ContentConfig{ContentType: runtime.ContentTypeJSON}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeService := NewNodeService(apiCluster{client: apiClient, fakeCluster: newFakeCluster()})
+
+	tests := map[string]struct {
+		disk            string
+		allowScheduling bool
+		// restored the scheduling after the eviction is cancelled
+		restored bool
+	}{
+		"node": {
+			allowScheduling: true,
+			restored:        true,
+		},
+		"node not schedulable": {
+			allowScheduling: false,
+			restored:        false,
+		},
+		"disk": {
+			disk:            "disk1",
+			allowScheduling: true,
+			restored:        true,
+		},
+		"disk not schedulable": {
+			disk:            "disk1",
+			allowScheduling: false,
+			restored:        false,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server.lock.Lock()
+			server.node = lhv1beta2.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "node1", Namespace: constants.LonghornNamespace},
+				Spec: lhv1beta2.NodeSpec{AllowScheduling: true, Disks: map[string]lhv1beta2.DiskSpec{
+					"disk1": {AllowScheduling: true}, "disk2": {AllowScheduling: true}}},
+			}
+			if test.disk == "" {
+				server.node.Spec.AllowScheduling = test.allowScheduling
+			} else {
+				server.node.Spec.Disks[test.disk] = lhv1beta2.DiskSpec{AllowScheduling: test.allowScheduling}
+			}
+			server.lock.Unlock()
+			scheduling := func() (bool, bool) {
+				server.lock.Lock()
+				defer server.lock.Unlock()
+				if test.disk == "" {
+					return server.node.Spec.AllowScheduling, server.node.Spec.EvictionRequested
+				}
+				disk := server.node.Spec.Disks[test.disk]
+				return disk.AllowScheduling, disk.EvictionRequested
+			}
+
+			for _, requested := range []bool{true, true} {
+				if err := nodeService.RequestEviction(requestContext("admin"), "node1",
+					types.EvictionRequest{Disk: test.disk, EvictionRequested: &requested}); err != nil {
+					t.Fatal(err)
+				}
+				if allowScheduling, evictionRequested := scheduling(); allowScheduling || !evictionRequested {
+					t.Fatalf("expected the scheduling disabled while evicting, got %t %t", allowScheduling,
+						evictionRequested)
+				}
+			}
+
+			cancelled := false
+			if err := nodeService.RequestEviction(requestContext("admin"), "node1",
+				types.EvictionRequest{Disk: test.disk, EvictionRequested: &cancelled}); err != nil {
+				t.Fatal(err)
+			}
+			if allowScheduling, evictionRequested := scheduling(); allowScheduling != test.restored ||
+				evictionRequested {
+				t.Errorf("expected the scheduling %t after cancelling, got %t %t", test.restored, allowScheduling,
+					evictionRequested)
+			}
+			server.lock.Lock()
+			defer server.lock.Unlock()
+			if _, ok := server.node.Annotations[constants.AnnotationSchedulingBeforeEviction]; ok {
+				t.Errorf("expected the prior scheduling removed, got %v", server.node.Annotations)
+			}
+			if test.disk != "" && !server.node.Spec.Disks["disk2"].AllowScheduling {
+				t.Error("the other disk isn't schedulable")
+			}
+		})
+	}
+
+	// the scheduling is left alone if the eviction isn't requested by the api server, e.g. by longhorn's UI
+	server.lock.Lock()
+	server.node.Spec.EvictionRequested = true
+	server.node.Spec.AllowScheduling = false
+	server.lock.Unlock()
+	cancelled := false
+	if err = nodeService.RequestEviction(requestContext("admin"), "node1",
+		types.EvictionRequest{EvictionRequested: &cancelled}); err != nil {
+		t.Fatal(err)
+	}
+	if server.node.Spec.AllowScheduling || server.node.Spec.EvictionRequested {
+		t.Errorf("unexpected node spec %+v", server.node.Spec)
+	}
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+	"io"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+	"kubeall.io/api-server/pkg/infra/apiserver"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/logger"
+	"kubeall.io/api-server/pkg/infra/tracing"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+	"slices"
+)
+
+// PodService streams the logs of the pods and runs the commands in their containers
+type PodService interface {
+	// Authorize returns an error if the caller can't access the subresource of the pod, i.e. log or exec
+	Authorize(ctx context.Context, namespace, name, subresource string) error
+	// Logs returns the stream of the logs, it's closed by the caller
+	Logs(ctx context.Context, namespace, name string, options *corev1.PodLogOptions) (io.ReadCloser, error)
+	// Exec runs the command in the container until it exits or the context is done
+	Exec(ctx context.Context, namespace, name string, options *corev1.PodExecOptions,
+		streams remotecommand.StreamOptions) error
+	// Shell returns the command run by the terminals while it isn't specified
+	Shell() []string
+}
+
+type podServiceImpl struct {
+	clusterResource apiserver.ClusterResource
+	projectService  ProjectService
+	authorize       bool
+	shell           []string
+	userHeader      string
+}
+
+func NewPodService(config types.Config, clusterResource apiserver.ClusterResource,
+	projectService ProjectService) PodService {
+	cfg := config.(*types.ServerConfig)
+	p := &podServiceImpl{
+		clusterResource: clusterResource,
+		projectService:  projectService,
+		shell:           []string{constants.DefaultShell},
+		userHeader:      constants.DefaultUserHeader,
+	}
+	if cfg.Pods != nil {
+		p.authorize = cfg.Pods.Authorize
+		if len(cfg.Pods.Shell) > 0 {
+			p.shell = cfg.Pods.Shell
+		}
+	}
+	// the users are identified like the projects
+	if cfg.Project != nil && cfg.Project.UserHeader != "" {
+		p.userHeader = cfg.Project.UserHeader
+	}
+	return p
+}
+
+// Authorize checks the namespace is in the caller's projects, and the caller's RBAC permission of the subresource by
+// a SubjectAccessReview if it's enabled
+func (p podServiceImpl) Authorize(ctx context.Context, namespace, name, subresource string) (err error) {
+	ctx, span := tracing.Start(ctx, "PodService.Authorize", podAttributes(namespace, name,
+		attribute.String("subresource", subresource))...)
+	defer func() { tracing.End(span, err) }()
+
+	var user string
+	if ginCtx, ok := types.GinContext(ctx); ok {
+		user = ginCtx.GetHeader(p.userHeader)
+	}
+	forbidden := func() error {
+		result := types.FailWithErrorCode(ctx, constants.CodePodForbidden, map[string]string{
+			"user": user, "namespace": namespace, "name": name, "subresource": subresource})
+		result.StatusCode = http.StatusForbidden
+		return result
+	}
+
+	namespaces, all, err := p.projectService.AccessibleNamespaces(ctx)
+	if err != nil {
+		return err
+	}
+	if !all && !slices.Contains(namespaces, namespace) {
+		return forbidden()
+	}
+	if !p.authorize {
+		return nil
+	}
+	// the anonymous requests aren't allowed since the permissions of the api server are used by them otherwise
+	if user == "" {
+		return forbidden()
+	}
+
+	review := &authorizationv1.SubjectAccessReview{Spec: authorizationv1.SubjectAccessReviewSpec{
+		User: user,
+		ResourceAttributes: &authorizationv1.ResourceAttributes{
+			Namespace:   namespace,
+			Verb:        verbOf(subresource),
+			Resource:    "pods",
+			Subresource: subresource,
+			Name:        name,
+		},
+	}}
+	review, err = apiserver.ClusterFrom(ctx, p.clusterResource).Client().K8sClient().AuthorizationV1().
+		SubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+	if !review.Status.Allowed {
+		logger.FromContext(ctx).Info("the access to the pod is denied", zap.String("namespace", namespace),
+			zap.String("name", name), zap.String("subresource", subresource), zap.String("reason", review.Status.Reason))
+		return forbidden()
+	}
+	return nil
+}
+
+func (p podServiceImpl) Logs(ctx context.Context, namespace, name string,
+	options *corev1.PodLogOptions) (io.ReadCloser, error) {
+	return apiserver.ClusterFrom(ctx, p.clusterResource).Client().K8sClient().CoreV1().Pods(namespace).
+		GetLogs(name, options).Stream(ctx)
+}
+
+// Exec runs the command by the websocket executor, it falls back to the spdy executor while the cluster doesn't
+// support the websockets
+func (p podServiceImpl) Exec(ctx context.Context, namespace, name string, options *corev1.PodExecOptions,
+	streams remotecommand.StreamOptions) (err error) {
+	ctx, span := tracing.Start(ctx, "PodService.Exec", podAttributes(namespace, name,
+		attribute.String("container", options.Container))...)
+	defer func() { tracing.End(span, err) }()
+
+	cls := apiserver.ClusterFrom(ctx, p.clusterResource)
+	url := cls.Client().K8sClient().CoreV1().RESTClient().Post().
+		Resource("pods").Namespace(namespace).Name(name).SubResource("exec").
+		VersionedParams(options, scheme.ParameterCodec).URL()
+
+	spdyExecutor, err := remotecommand.NewSPDYExecutor(cls.RestConfig(), http.MethodPost, url)
+	if err != nil {
+		return err
+	}
+	websocketExecutor, err := remotecommand.NewWebSocketExecutor(cls.RestConfig(), http.MethodGet, url.String())
+	if err != nil {
+		return err
+	}
+	executor, err := remotecommand.NewFallbackExecutor(websocketExecutor, spdyExecutor, func(err error) bool {
+		return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+	})
+	if err != nil {
+		return err
+	}
+	return executor.StreamWithContext(ctx, streams)
+}
+
+func (p podServiceImpl) Shell() []string {
+	return p.shell
+}
+
+// verbOf returns the verb of the subresource authorized by RBAC, e.g. kubectl exec creates pods/exec
+func verbOf(subresource string) string {
+	if subresource == constants.PodExecSubresource {
+		return "create"
+	}
+	return "get"
+}
+
+func podAttributes(namespace, name string, attributes ...attribute.KeyValue) []attribute.KeyValue {
+	return append([]attribute.KeyValue{
+		attribute.String("namespace", namespace),
+		attribute.String("name", name),
+	}, attributes...)
+}
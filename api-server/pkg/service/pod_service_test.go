@@ -0,0 +1,151 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	kav1 "kubeall.io/api-server/pkg/generated/kubeall.io/v1"
+	"kubeall.io/api-server/pkg/infra/clients"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/types"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// apiCluster serves the requests of the clients by the fake api server
+type apiCluster struct {
+	fakeCluster
+	client clients.ApiClient
+}
+
+func (a apiCluster) Client() clients.ApiClient {
+	return a.client
+}
+
+// reviewServer allows the SubjectAccessReviews of the allowed users, the reviews are kept
+type reviewServer struct {
+	lock    sync.Mutex
+	allowed map[string]bool
+	reviews []authorizationv1.SubjectAccessReview
+}
+
+func (r *reviewServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost || req.URL.Path != "/apis/authorization.k8s.io/v1/subjectaccessreviews" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	var review authorizationv1.SubjectAccessReview
+	if err := json.NewDecoder(req.Body).Decode(&review); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.lock.Lock()
+	r.reviews = append(r.reviews, review)
+	review.Status.Allowed = r.allowed[review.Spec.User]
+	r.lock.Unlock()
+	if !review.Status.Allowed {
+		review.Status.Reason = "no RBAC policy matched"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(&review)
+}
+
+func TestAuthorize(t *testing.T) {
+	reviews := &reviewServer{allowed: map[string]bool{"alice": true}}
+	server := httptest.NewServer(reviews)
+	defer server.Close()
+	apiClient, err := clients.NewClientsForConfig(&rest.Config{Host: server.URL,
+		ContentConfig: rest.ContentConfig{ContentType: runtime.ContentTypeJSON}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cluster := apiCluster{client: apiClient, fakeCluster: newFakeCluster(
+		&kav1.Project{ObjectMeta: metav1.ObjectMeta{Name: "p1"}, Spec: kav1.ProjectSpec{
+			Namespaces: []string{"ns1"},
+			Members:    []kav1.ProjectMember{{Name: "alice"}, {Name: "carol"}},
+		}},
+	)}
+	projects := &projectServiceImpl{clusterResource: cluster, enabled: true, userHeader: constants.DefaultUserHeader}
+	newPodService := func(projectService ProjectService, authorize bool) PodService {
+		return &podServiceImpl{clusterResource: cluster, projectService: projectService, authorize: authorize,
+			userHeader: constants.DefaultUserHeader}
+	}
+
+	tests := map[string]struct {
+		podService PodService
+		user       string
+		namespace  string
+		forbidden  bool
+		reviewed   bool
+	}{
+		"allowed": {
+			podService: newPodService(projects, true),
+			user:       "alice",
+			namespace:  "ns1",
+			reviewed:   true,
+		},
+		"not in the project": {
+			podService: newPodService(projects, true),
+			user:       "bob",
+			namespace:  "ns1",
+			forbidden:  true,
+		},
+		"not in the namespace": {
+			podService: newPodService(projects, true),
+			user:       "alice",
+			namespace:  "ns2",
+			forbidden:  true,
+		},
+		"anonymous": {
+			podService: newPodService(&projectServiceImpl{clusterResource: cluster}, true),
+			namespace:  "ns2",
+			forbidden:  true,
+		},
+		"denied by RBAC": {
+			podService: newPodService(projects, true),
+			user:       "carol",
+			namespace:  "ns1",
+			forbidden:  true,
+			reviewed:   true,
+		},
+		"RBAC not checked": {
+			podService: newPodService(projects, false),
+			user:       "carol",
+			namespace:  "ns1",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			reviews.lock.Lock()
+			reviews.reviews = nil
+			reviews.lock.Unlock()
+
+			err := test.podService.Authorize(requestContext(test.user), test.namespace, "web",
+				constants.PodExecSubresource)
+			var result *types.Result
+			if forbidden := errors.As(err, &result) && result.ErrorCode == constants.CodePodForbidden &&
+				result.StatusCode == http.StatusForbidden; forbidden != test.forbidden || (!forbidden && err != nil) {
+				t.Fatalf("expected forbidden %t, got %v", test.forbidden, err)
+			}
+
+			reviews.lock.Lock()
+			defer reviews.lock.Unlock()
+			if reviewed := len(reviews.reviews) > 0; reviewed != test.reviewed {
+				t.Fatalf("expected reviewed %t, got %v", test.reviewed, reviews.reviews)
+			}
+			if test.reviewed {
+				attributes := reviews.reviews[0].Spec.ResourceAttributes
+				if reviews.reviews[0].Spec.User != test.user || attributes.Namespace != test.namespace ||
+					attributes.Name != "web" || attributes.Resource != "pods" || attributes.Verb != "create" ||
+					attributes.Subresource != constants.PodExecSubresource {
+					t.Errorf("unexpected review %+v", reviews.reviews[0].Spec)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,354 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	kav1 "kubeall.io/api-server/pkg/generated/kubeall.io/v1"
+	"kubeall.io/api-server/pkg/infra/apiserver"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/logger"
+	"kubeall.io/api-server/pkg/types"
+	kv1 "kubevirt.io/api/core/v1"
+	"net/http"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ProjectService restricts the users to the namespaces of their projects and enforces the quotas of the projects
+type ProjectService interface {
+	// AccessibleNamespaces returns the namespaces of the caller's projects, all is true if the caller isn't restricted
+	AccessibleNamespaces(ctx context.Context) (namespaces []string, all bool, err error)
+	// List returns the projects which the caller is a member of, all the projects are returned if it isn't restricted
+	List(ctx context.Context) ([]kav1.Project, error)
+	Get(ctx context.Context, name string) (*kav1.Project, error)
+	Usage(ctx context.Context, name string) (*types.ProjectUsage, error)
+	// CheckVm returns an error if the caller can't create the vm or the vm exceeds the quota of its project
+	CheckVm(ctx context.Context, vm *kv1.VirtualMachine) error
+	// CheckImage returns an error if the caller can't create the image or the image exceeds the quota of its project
+	CheckImage(ctx context.Context, image *kav1.Image) error
+	// Admit checks the vms and the images created or updated by the base service, the other objects are always
+	// admitted. Only the resources added to the old object are counted while it's updated.
+	Admit(ctx context.Context, obj client.Object, old client.Object) error
+	// IsAdmin returns true if the caller is a cluster admin, i.e. it isn't restricted, or the owner of any project
+	IsAdmin(ctx context.Context) (bool, error)
+	// User returns the user of the request, it's empty if the context isn't a request
+	User(ctx context.Context) string
+}
+
+type projectServiceImpl struct {
+	clusterResource apiserver.ClusterResource
+	enabled         bool
+	userHeader      string
+	admins          []string
+}
+
+func NewProjectService(config types.Config, clusterResource apiserver.ClusterResource) ProjectService {
+	p := &projectServiceImpl{clusterResource: clusterResource, userHeader: constants.DefaultUserHeader}
+	if cfg := config.(*types.ServerConfig).Project; cfg != nil {
+		p.enabled = cfg.Enabled
+		p.admins = cfg.Admins
+		if cfg.UserHeader != "" {
+			p.userHeader = cfg.UserHeader
+		}
+	}
+	return p
+}
+
+// restricted returns true if the user can only access the namespaces of its projects
+func (p projectServiceImpl) restricted(user string) bool {
+	return p.enabled && !slices.Contains(p.admins, user)
+}
+
+func (p projectServiceImpl) AccessibleNamespaces(ctx context.Context) ([]string, bool, error) {
+	if !p.restricted(p.User(ctx)) {
+		return nil, true, nil
+	}
+	projects, err := p.List(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	var namespaces []string
+	for _, project := range projects {
+		namespaces = append(namespaces, project.Spec.Namespaces...)
+	}
+	return namespaces, false, nil
+}
+
+func (p projectServiceImpl) List(ctx context.Context) ([]kav1.Project, error) {
+	var projects kav1.ProjectList
+	if err := apiserver.ClusterFrom(ctx, p.clusterResource).ClusterCache().List(ctx, &projects); err != nil {
+		return nil, err
+	}
+	user := p.User(ctx)
+	if !p.restricted(user) {
+		return projects.Items, nil
+	}
+	return slices.DeleteFunc(projects.Items, func(project kav1.Project) bool {
+		return MemberRole(&project, user) == ""
+	}), nil
+}
+
+// Get returns the project if the caller can access it, the inaccessible projects are reported as not found
+func (p projectServiceImpl) Get(ctx context.Context, name string) (*kav1.Project, error) {
+	project := &kav1.Project{}
+	err := apiserver.ClusterFrom(ctx, p.clusterResource).ClusterCache().Get(ctx, client.ObjectKey{Name: name}, project)
+	if k8serrors.IsNotFound(err) {
+		return nil, types.FailWithStatusCode(http.StatusNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user := p.User(ctx); p.restricted(user) && MemberRole(project, user) == "" {
+		return nil, types.FailWithStatusCode(http.StatusNotFound)
+	}
+	return project, nil
+}
+
+func (p projectServiceImpl) Usage(ctx context.Context, name string) (*types.ProjectUsage, error) {
+	project, err := p.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	used, err := ComputeProjectUsage(ctx, apiserver.ClusterFrom(ctx, p.clusterResource).ClusterCache(), project)
+	if err != nil {
+		return nil, err
+	}
+	return &types.ProjectUsage{
+		Name:       project.Name,
+		Namespaces: project.Spec.Namespaces,
+		Quota:      project.Spec.Quota,
+		Used:       *used,
+	}, nil
+}
+
+func (p projectServiceImpl) CheckVm(ctx context.Context, vm *kv1.VirtualMachine) error {
+	request, err := vmRequest(ctx, vm)
+	if err != nil {
+		return err
+	}
+	return p.check(ctx, vm.Namespace, request)
+}
+
+func (p projectServiceImpl) CheckImage(ctx context.Context, image *kav1.Image) error {
+	return p.check(ctx, image.Namespace, types.ProjectResources{Images: 1})
+}
+
+func (p projectServiceImpl) Admit(ctx context.Context, obj client.Object, old client.Object) error {
+	switch o := obj.(type) {
+	case *kv1.VirtualMachine:
+		oldVm, ok := old.(*kv1.VirtualMachine)
+		if !ok {
+			return p.CheckVm(ctx, o)
+		}
+		request, err := vmRequest(ctx, o)
+		if err != nil {
+			return err
+		}
+		// the old vm is counted in the usage already
+		oldRequest, err := vmRequest(ctx, oldVm)
+		if err != nil {
+			return err
+		}
+		request.Sub(oldRequest)
+		return p.check(ctx, o.Namespace, request)
+	case *kav1.Image:
+		if old == nil {
+			return p.CheckImage(ctx, o)
+		}
+		return p.check(ctx, o.Namespace, types.ProjectResources{})
+	}
+	return nil
+}
+
+// vmRequest returns the resources of the vm including the pvcs in its annotation
+func vmRequest(ctx context.Context, vm *kv1.VirtualMachine) (types.ProjectResources, error) {
+	pvcs, err := unmarshallPvcs(ctx, vm)
+	if err != nil {
+		return types.ProjectResources{}, err
+	}
+	request := VmResources(vm)
+	for _, pvc := range pvcs {
+		request.Storage.Add(pvcStorage(&pvc))
+	}
+	return request, nil
+}
+
+func (p projectServiceImpl) IsAdmin(ctx context.Context) (bool, error) {
+	user := p.User(ctx)
+	if !p.restricted(user) {
+		return true, nil
+	}
+	projects, err := p.List(ctx)
+	if err != nil {
+		return false, err
+	}
+	return slices.ContainsFunc(projects, func(project kav1.Project) bool {
+		return MemberRole(&project, user) == kav1.ProjectRoleOwner
+	}), nil
+}
+
+func (p projectServiceImpl) User(ctx context.Context) string {
+	if ginCtx, ok := types.GinContext(ctx); ok {
+		return ginCtx.GetHeader(p.userHeader)
+	}
+	return ""
+}
+
+// check makes sure the caller is the owner or a member of the namespace's project, and the quota of the project
+// isn't exceeded after the requested resources are created
+func (p projectServiceImpl) check(ctx context.Context, namespace string, request types.ProjectResources) error {
+	reader := apiserver.ClusterFrom(ctx, p.clusterResource).ClusterCache()
+	project, err := ProjectOfNamespace(ctx, reader, namespace)
+	if err != nil {
+		return err
+	}
+
+	if user := p.User(ctx); p.restricted(user) {
+		if role := MemberRole(project, user); role != kav1.ProjectRoleOwner && role != kav1.ProjectRoleMember {
+			result := types.FailWithErrorCode(ctx, constants.CodeProjectForbidden,
+				map[string]string{"user": user, "namespace": namespace})
+			result.StatusCode = http.StatusForbidden
+			return result
+		}
+	}
+	if project == nil {
+		return nil
+	}
+
+	exceeded, err := CheckProjectQuota(ctx, reader, project, request)
+	if err != nil || len(exceeded) == 0 {
+		return err
+	}
+	logger.FromContext(ctx).Info("the quota of the project is exceeded", zap.String("project", project.Name),
+		zap.String("namespace", namespace), zap.Strings("resources", exceeded))
+	result := types.FailWithErrorCode(ctx, constants.CodeProjectQuotaExceeded,
+		map[string]string{"name": project.Name, "resources": strings.Join(exceeded, ", ")})
+	result.StatusCode = http.StatusForbidden
+	return result
+}
+
+// MemberRole returns the role of the user in the project, it's empty if the user isn't a member
+func MemberRole(project *kav1.Project, user string) kav1.ProjectRole {
+	if project == nil || user == "" {
+		return ""
+	}
+	for _, member := range project.Spec.Members {
+		if member.Name == user {
+			if member.Role == "" {
+				return kav1.ProjectRoleMember
+			}
+			return member.Role
+		}
+	}
+	return ""
+}
+
+// ProjectOfNamespace returns the project grouping the namespace, it's nil if the namespace isn't in any project
+func ProjectOfNamespace(ctx context.Context, reader client.Reader, namespace string) (*kav1.Project, error) {
+	var projects kav1.ProjectList
+	if err := reader.List(ctx, &projects); err != nil {
+		return nil, err
+	}
+	// the oldest project wins while a namespace is grouped by more than one project
+	sort.Slice(projects.Items, func(i, j int) bool {
+		return projects.Items[i].CreationTimestamp.Before(&projects.Items[j].CreationTimestamp)
+	})
+	for _, project := range projects.Items {
+		if slices.Contains(project.Spec.Namespaces, namespace) {
+			return &project, nil
+		}
+	}
+	return nil, nil
+}
+
+// CheckProjectQuota returns the resources whose quota is exceeded after the requested resources are created, the
+// resources which aren't requested or are reduced are skipped, so that the projects already over quota can still create
+// the others and shrink the existing ones
+func CheckProjectQuota(ctx context.Context, reader client.Reader, project *kav1.Project,
+	request types.ProjectResources) ([]string, error) {
+	used, err := ComputeProjectUsage(ctx, reader, project)
+	if err != nil {
+		return nil, err
+	}
+	used.Add(request)
+
+	var exceeded []string
+	quota := project.Spec.Quota
+	checkCount := func(name string, requested, used int32, limit *int32) {
+		if requested > 0 && limit != nil && used > *limit {
+			exceeded = append(exceeded, fmt.Sprintf("%s %d/%d", name, used, *limit))
+		}
+	}
+	checkQuantity := func(name string, requested, used resource.Quantity, limit *resource.Quantity) {
+		if requested.Sign() > 0 && limit != nil && used.Cmp(*limit) > 0 {
+			exceeded = append(exceeded, fmt.Sprintf("%s %s/%s", name, used.String(), limit.String()))
+		}
+	}
+	checkCount("vms", request.Vms, used.Vms, quota.Vms)
+	checkCount("cpu", request.Cpu, used.Cpu, quota.Cpu)
+	checkQuantity("memory", request.Memory, used.Memory, quota.Memory)
+	checkQuantity("storage", request.Storage, used.Storage, quota.Storage)
+	checkCount("images", request.Images, used.Images, quota.Images)
+	return exceeded, nil
+}
+
+// ComputeProjectUsage sums the vms, pvcs and images in the namespaces of the project
+func ComputeProjectUsage(ctx context.Context, reader client.Reader, project *kav1.Project) (*types.ProjectResources, error) {
+	used := &types.ProjectResources{}
+	for _, namespace := range project.Spec.Namespaces {
+		// the vms are skipped if kubevirt isn't installed
+		var vms kv1.VirtualMachineList
+		if err := reader.List(ctx, &vms, client.InNamespace(namespace)); err != nil && !meta.IsNoMatchError(err) {
+			return nil, err
+		}
+		for _, vm := range vms.Items {
+			used.Add(VmResources(&vm))
+		}
+
+		var pvcs corev1.PersistentVolumeClaimList
+		if err := reader.List(ctx, &pvcs, client.InNamespace(namespace)); err != nil {
+			return nil, err
+		}
+		for _, pvc := range pvcs.Items {
+			used.Storage.Add(pvcStorage(&pvc))
+		}
+
+		var images kav1.ImageList
+		if err := reader.List(ctx, &images, client.InNamespace(namespace)); err != nil {
+			return nil, err
+		}
+		used.Images += int32(len(images.Items))
+	}
+	return used, nil
+}
+
+// VmResources returns the cpu cores and the guest memory of the vm, the disks are counted by their pvcs
+func VmResources(vm *kv1.VirtualMachine) types.ProjectResources {
+	resources := types.ProjectResources{Vms: 1, Cpu: 1}
+	if vm.Spec.Template == nil {
+		return resources
+	}
+	domain := vm.Spec.Template.Spec.Domain
+	if cpu := domain.CPU; cpu != nil {
+		resources.Cpu = int32(max(cpu.Cores, 1) * max(cpu.Sockets, 1) * max(cpu.Threads, 1))
+	} else if request, ok := domain.Resources.Requests[corev1.ResourceCPU]; ok {
+		resources.Cpu = int32(max(request.Value(), 1))
+	}
+	if domain.Memory != nil && domain.Memory.Guest != nil {
+		resources.Memory = domain.Memory.Guest.DeepCopy()
+	} else if request, ok := domain.Resources.Requests[corev1.ResourceMemory]; ok {
+		resources.Memory = request.DeepCopy()
+	}
+	return resources
+}
+
+func pvcStorage(pvc *corev1.PersistentVolumeClaim) resource.Quantity {
+	return pvc.Spec.Resources.Requests.Storage().DeepCopy()
+}
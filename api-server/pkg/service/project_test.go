@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	ginI18n "github.com/gin-contrib/i18n"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kav1 "kubeall.io/api-server/pkg/generated/kubeall.io/v1"
+	"kubeall.io/api-server/pkg/infra/apiserver"
+	"kubeall.io/api-server/pkg/infra/constants"
+	baseservice "kubeall.io/api-server/pkg/service/base"
+	"kubeall.io/api-server/pkg/types"
+	kv1 "kubevirt.io/api/core/v1"
+	"net/http"
+	"net/http/httptest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"testing"
+)
+
+// fakeCluster serves the objects of the fake client as both the client and the cache of the cluster
+type fakeCluster struct {
+	apiserver.ClusterResource
+	client client.Client
+}
+
+type fakeCache struct {
+	cache.Cache
+	reader client.Reader
+}
+
+func (f fakeCache) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	return f.reader.Get(ctx, key, obj, opts...)
+}
+
+func (f fakeCache) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	return f.reader.List(ctx, list, opts...)
+}
+
+func (f fakeCluster) ClusterCache() cache.Cache {
+	return fakeCache{reader: f.client}
+}
+
+func (f fakeCluster) RuntimeClient() client.Client {
+	return f.client
+}
+
+func newFakeCluster(objects ...client.Object) fakeCluster {
+	builder := fake.NewClientBuilder().WithScheme(apiserver.ServerScheme).WithObjects(objects...)
+	for _, index := range apiserver.Indexes {
+		builder = builder.WithIndex(index.Object, index.Field, index.Extract)
+	}
+	return fakeCluster{client: builder.Build()}
+}
+
+// requestContext returns the context of a localized request of the user
+func requestContext(user string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	if user != "" {
+		ctx.Request.Header.Set(constants.DefaultUserHeader, user)
+	}
+	ginI18n.Localize(ginI18n.WithBundle(&ginI18n.BundleCfg{
+		DefaultLanguage:  language.English,
+		FormatBundleFile: constants.ResourceBundleFormat,
+		AcceptLanguage:   []language.Tag{language.English},
+		RootPath:         "../../cmd/server/resources/locales",
+		UnmarshalFunc:    json.Unmarshal,
+	}))(ctx)
+	return ctx
+}
+
+func TestProjectAdmission(t *testing.T) {
+	one := int32(1)
+	cluster := newFakeCluster(
+		&kav1.Project{ObjectMeta: metav1.ObjectMeta{Name: "p1"}, Spec: kav1.ProjectSpec{
+			Namespaces: []string{"ns1"},
+			Members:    []kav1.ProjectMember{{Name: "alice"}},
+			Quota:      kav1.ProjectQuota{Images: &one},
+		}},
+		&kav1.Image{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "win10"}},
+	)
+	projectService := &projectServiceImpl{clusterResource: cluster, enabled: true,
+		userHeader: constants.DefaultUserHeader}
+	baseService := baseservice.NewBaseService(cluster, nil, nil, projectService, projectService)
+
+	tests := map[string]struct {
+		user string
+		obj  client.Object
+		code constants.ErrorCode
+	}{
+		"quota exceeded": {
+			user: "alice",
+			obj:  &kav1.Image{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "win11"}},
+			code: constants.CodeProjectQuotaExceeded,
+		},
+		"not a member": {
+			user: "bob",
+			obj:  &kv1.VirtualMachine{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "vm2"}},
+			code: constants.CodeProjectForbidden,
+		},
+		"vm admitted": {
+			user: "alice",
+			obj:  &kv1.VirtualMachine{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "vm1"}},
+		},
+		"other resources admitted": {
+			user: "bob",
+			obj:  &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "cm1"}},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := baseService.Create(requestContext(test.user), test.obj)
+			if test.code == "" {
+				if err != nil {
+					t.Fatalf("expected the object created, got %v", err)
+				}
+				return
+			}
+			var result *types.Result
+			if !errors.As(err, &result) || result.ErrorCode != test.code || result.StatusCode != http.StatusForbidden {
+				t.Fatalf("expected %s, got %v", test.code, err)
+			}
+			if cluster.client.Get(context.Background(), client.ObjectKeyFromObject(test.obj), test.obj) == nil {
+				t.Error("expected the object not created")
+			}
+		})
+	}
+}
+
+func TestProjectAdmissionUpdate(t *testing.T) {
+	one, four := int32(1), int32(4)
+	memory := resource.MustParse("4Gi")
+	vm := func(name string, cores uint32, memory string) *kv1.VirtualMachine {
+		guest := resource.MustParse(memory)
+		return &kv1.VirtualMachine{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: name},
+			Spec: kv1.VirtualMachineSpec{Template: &kv1.VirtualMachineInstanceTemplateSpec{
+				Spec: kv1.VirtualMachineInstanceSpec{Domain: kv1.DomainSpec{
+					CPU: &kv1.CPU{Cores: cores}, Memory: &kv1.Memory{Guest: &guest}}}}}}
+	}
+	tests := map[string]struct {
+		user   string
+		obj    client.Object
+		update func(obj client.Object)
+		code   constants.ErrorCode
+	}{
+		"cpu exceeded": {
+			user: "alice",
+			obj:  vm("vm1", 2, "2Gi"),
+			update: func(obj client.Object) {
+				obj.(*kv1.VirtualMachine).Spec.Template.Spec.Domain.CPU.Cores = 4
+			},
+			code: constants.CodeProjectQuotaExceeded,
+		},
+		// the old vm is counted in the usage, so it's not counted twice
+		"unchanged at quota": {
+			user:   "alice",
+			obj:    vm("vm1", 2, "2Gi"),
+			update: func(obj client.Object) { obj.SetLabels(map[string]string{"os": "windows"}) },
+		},
+		"shrunk over quota": {
+			user: "alice",
+			obj:  vm("vm2", 2, "3Gi"),
+			update: func(obj client.Object) {
+				guest := resource.MustParse("1Gi")
+				obj.(*kv1.VirtualMachine).Spec.Template.Spec.Domain.Memory.Guest = &guest
+			},
+		},
+		"not a member": {
+			user:   "bob",
+			obj:    vm("vm1", 2, "2Gi"),
+			update: func(obj client.Object) { obj.SetLabels(map[string]string{"os": "windows"}) },
+			code:   constants.CodeProjectForbidden,
+		},
+		"image at quota": {
+			user:   "alice",
+			obj:    &kav1.Image{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "win10"}},
+			update: func(obj client.Object) { obj.(*kav1.Image).Spec.OsVersion = "22H2" },
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// the project uses all its 4 cpus, and 5Gi memory which is over its quota
+			cluster := newFakeCluster(
+				&kav1.Project{ObjectMeta: metav1.ObjectMeta{Name: "p1"}, Spec: kav1.ProjectSpec{
+					Namespaces: []string{"ns1"},
+					Members:    []kav1.ProjectMember{{Name: "alice"}},
+					Quota:      kav1.ProjectQuota{Cpu: &four, Memory: &memory, Images: &one},
+				}},
+				vm("vm1", 2, "2Gi"), vm("vm2", 2, "3Gi"),
+				&kav1.Image{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "win10"}},
+			)
+			projectService := &projectServiceImpl{clusterResource: cluster, enabled: true,
+				userHeader: constants.DefaultUserHeader}
+			baseService := baseservice.NewBaseService(cluster, nil, nil, projectService, projectService)
+
+			if err := cluster.client.Get(context.Background(), client.ObjectKeyFromObject(test.obj), test.obj); err != nil {
+				t.Fatal(err)
+			}
+			updated := test.obj.DeepCopyObject().(client.Object)
+			test.update(updated)
+			err := baseService.Update(requestContext(test.user), updated)
+			if test.code == "" {
+				if err != nil {
+					t.Fatalf("expected the object updated, got %v", err)
+				}
+				return
+			}
+			var result *types.Result
+			if !errors.As(err, &result) || result.ErrorCode != test.code || result.StatusCode != http.StatusForbidden {
+				t.Fatalf("expected %s, got %v", test.code, err)
+			}
+			latest := test.obj.DeepCopyObject().(client.Object)
+			if err = cluster.client.Get(context.Background(), client.ObjectKeyFromObject(test.obj), latest); err != nil {
+				t.Fatal(err)
+			}
+			if latest.GetResourceVersion() != test.obj.GetResourceVersion() {
+				t.Error("expected the object not updated")
+			}
+		})
+	}
+}
@@ -13,5 +13,16 @@ var Module = fx.Module("service",
 		NewImageService,
 		NewStorageClass,
 		NewVmService,
+		NewNodeService,
+		NewLonghornService,
+		NewSettingsService,
+		NewProjectService,
+		NewPodService,
+		NewEventService,
+		NewRelatedService,
+		// the namespaces/all listings are restricted to the caller's projects
+		func(projectService ProjectService) baseservice.NamespaceScope { return projectService },
+		// the vms and the images created by the generic handlers are checked against the quotas of the projects
+		func(projectService ProjectService) baseservice.Admission { return projectService },
 	),
 )
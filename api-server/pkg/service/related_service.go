@@ -0,0 +1,600 @@
+package service
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kav1 "kubeall.io/api-server/pkg/generated/kubeall.io/v1"
+	lhv1beta2 "kubeall.io/api-server/pkg/generated/longhorn/apis/longhorn/v1beta2"
+	"kubeall.io/api-server/pkg/infra/apiserver"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/tracing"
+	"kubeall.io/api-server/pkg/types"
+	kv1 "kubevirt.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"slices"
+	"sort"
+)
+
+// RelatedService resolves the topology of the vms, disks, images and services
+type RelatedService interface {
+	// Graph returns the dependencies of the object and their dependencies, e.g. vm -> vmi -> pod -> service and
+	// pvc -> pv -> longhorn volume -> backing image -> image, and its consumers and their consumers, e.g. the pvcs
+	// and the vms provisioned from an image. The objects of the namespaces the caller can't access are left out
+	Graph(ctx context.Context, gvk schema.GroupVersionKind, obj client.Object) (*types.RelatedGraph, error)
+}
+
+type relatedServiceImpl struct {
+	clusterResource apiserver.ClusterResource
+	projectService  ProjectService
+}
+
+func NewRelatedService(clusterResource apiserver.ClusterResource, projectService ProjectService) RelatedService {
+	return &relatedServiceImpl{clusterResource: clusterResource, projectService: projectService}
+}
+
+// Graph walks from the object in both directions, the dependencies are only walked forward and the consumers only
+// backward, so that the vms sharing an image with the vm aren't included in its graph
+func (r relatedServiceImpl) Graph(ctx context.Context, gvk schema.GroupVersionKind,
+	obj client.Object) (_ *types.RelatedGraph, err error) {
+	ctx, span := tracing.Start(ctx, "RelatedService.Graph", attribute.String("kind", gvk.Kind),
+		attribute.String("namespace", obj.GetNamespace()), attribute.String("name", obj.GetName()))
+	defer func() { tracing.End(span, err) }()
+
+	namespaces, all, err := r.projectService.AccessibleNamespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var accessible func(namespace string) bool
+	if !all {
+		accessible = func(namespace string) bool { return slices.Contains(namespaces, namespace) }
+	}
+	return buildGraph(ctx, apiserver.ClusterFrom(ctx, r.clusterResource).ClusterCache(), accessible, gvk.Kind, obj)
+}
+
+// buildGraph walks the graph of the object, the objects of the namespaces which aren't accessible are left out, all
+// the namespaces are accessible if accessible is nil
+func buildGraph(ctx context.Context, reader client.Reader, accessible func(namespace string) bool, kind string,
+	obj client.Object) (*types.RelatedGraph, error) {
+	g := &graphBuilder{
+		ctx:        ctx,
+		reader:     reader,
+		accessible: accessible,
+		graph:      &types.RelatedGraph{Nodes: []types.RelatedNode{}, Edges: []types.RelatedEdge{}},
+		nodes:      map[string]bool{},
+		edges:      map[types.RelatedEdge]bool{},
+	}
+	g.graph.Root = nodeId(kind, obj.GetNamespace(), obj.GetName())
+	g.addNode(kind, obj, true, true)
+	for len(g.queue) > 0 {
+		item := g.queue[0]
+		g.queue = g.queue[1:]
+		if item.forward {
+			if err := g.dependencies(item.id, item.obj); err != nil {
+				return nil, err
+			}
+		}
+		if item.backward {
+			if err := g.consumers(item.id, item.obj); err != nil {
+				return nil, err
+			}
+		}
+	}
+	g.sort()
+	return g.graph, nil
+}
+
+type graphItem struct {
+	id                string
+	obj               client.Object
+	forward, backward bool
+}
+
+type graphBuilder struct {
+	ctx        context.Context
+	reader     client.Reader
+	accessible func(namespace string) bool
+	graph      *types.RelatedGraph
+	nodes      map[string]bool
+	edges      map[types.RelatedEdge]bool
+	queue      []graphItem
+}
+
+// dependencies adds the objects which obj depends on
+func (g *graphBuilder) dependencies(id string, obj client.Object) error {
+	switch o := obj.(type) {
+	case *kv1.VirtualMachine:
+		// the vmi exists only while the vm is running
+		vmi := &kv1.VirtualMachineInstance{}
+		if found, err := g.get(vmi, o.Namespace, o.Name); err != nil {
+			return err
+		} else if found {
+			g.dependency(id, vmi, types.RelationOwns)
+		}
+		return g.claims(id, o.Namespace, vmClaimNames(g.ctx, o))
+	case *kv1.VirtualMachineInstance:
+		var pods corev1.PodList
+		if err := g.reader.List(g.ctx, &pods, client.InNamespace(o.Namespace),
+			client.MatchingLabels{kv1.CreatedByLabel: string(o.UID)}); err != nil {
+			return err
+		}
+		for i := range pods.Items {
+			g.dependency(id, &pods.Items[i], types.RelationOwns)
+		}
+		return g.claims(id, o.Namespace, volumeClaimNames(o.Spec.Volumes))
+	case *corev1.Pod:
+		var services corev1.ServiceList
+		if err := g.reader.List(g.ctx, &services, client.InNamespace(o.Namespace)); err != nil {
+			return err
+		}
+		for i := range services.Items {
+			if selects(&services.Items[i], o) {
+				g.dependency(id, &services.Items[i], types.RelationExposedBy)
+			}
+		}
+		return g.claims(id, o.Namespace, podClaimNames(o))
+	case *corev1.PersistentVolumeClaim:
+		if o.Spec.VolumeName != "" {
+			if err := g.dependencyByName(id, &corev1.PersistentVolume{}, "", o.Spec.VolumeName,
+				types.RelationBoundTo); err != nil {
+				return err
+			}
+		}
+		if o.Spec.StorageClassName != nil && *o.Spec.StorageClassName != "" {
+			return g.dependencyByName(id, &storagev1.StorageClass{}, "", *o.Spec.StorageClassName,
+				types.RelationProvisionedBy)
+		}
+	case *corev1.PersistentVolume:
+		if o.Spec.CSI != nil && o.Spec.CSI.Driver == constants.LonghornDriver {
+			return g.dependencyByName(id, &lhv1beta2.Volume{}, constants.LonghornNamespace, o.Spec.CSI.VolumeHandle,
+				types.RelationBackedBy)
+		}
+	case *storagev1.StorageClass:
+		if name := o.Parameters[constants.ParamBiImageName]; name != "" {
+			return g.dependencyByName(id, &lhv1beta2.BackingImage{}, constants.DefaultBackingImageNamespace, name,
+				types.RelationBackingImage)
+		}
+	case *lhv1beta2.Volume:
+		if o.Spec.BackingImage != "" {
+			return g.dependencyByName(id, &lhv1beta2.BackingImage{}, constants.DefaultBackingImageNamespace,
+				o.Spec.BackingImage, types.RelationBackingImage)
+		}
+	case *lhv1beta2.BackingImage:
+		name, namespace := o.Labels[constants.LabelImage], o.Labels[constants.LabelImageNamespace]
+		if name != "" && namespace != "" {
+			return g.dependencyByName(id, &kav1.Image{}, namespace, name, types.RelationCreatedFrom)
+		}
+	}
+	return nil
+}
+
+// consumers adds the objects depending on obj, the owners of any object are its consumers
+func (g *graphBuilder) consumers(id string, obj client.Object) error {
+	for _, ref := range obj.GetOwnerReferences() {
+		owner := newRelatedObject(ref.Kind)
+		if owner == nil {
+			g.addMissing(ref.Kind, obj.GetNamespace(), ref.Name, false)
+			g.link(nodeId(ref.Kind, obj.GetNamespace(), ref.Name), id, types.RelationOwns)
+			continue
+		}
+		if found, err := g.get(owner, obj.GetNamespace(), ref.Name); err != nil {
+			return err
+		} else if found {
+			g.consumer(id, owner, types.RelationOwns)
+		}
+	}
+
+	switch o := obj.(type) {
+	case *kav1.Image:
+		var backingImages lhv1beta2.BackingImageList
+		if err := g.reader.List(g.ctx, &backingImages, client.InNamespace(constants.DefaultBackingImageNamespace),
+			client.MatchingLabels{constants.LabelImage: o.Name, constants.LabelImageNamespace: o.Namespace}); err != nil {
+			return err
+		}
+		for i := range backingImages.Items {
+			g.consumer(id, &backingImages.Items[i], types.RelationCreatedFrom)
+		}
+	case *lhv1beta2.BackingImage:
+		var storageClasses storagev1.StorageClassList
+		if err := g.reader.List(g.ctx, &storageClasses); err != nil {
+			return err
+		}
+		for i := range storageClasses.Items {
+			if storageClasses.Items[i].Parameters[constants.ParamBiImageName] == o.Name {
+				g.consumer(id, &storageClasses.Items[i], types.RelationBackingImage)
+			}
+		}
+		var volumes lhv1beta2.VolumeList
+		if err := g.reader.List(g.ctx, &volumes, client.InNamespace(constants.LonghornNamespace)); err != nil {
+			return err
+		}
+		for i := range volumes.Items {
+			if volumes.Items[i].Spec.BackingImage == o.Name {
+				g.consumer(id, &volumes.Items[i], types.RelationBackingImage)
+			}
+		}
+	case *storagev1.StorageClass:
+		var pvcs corev1.PersistentVolumeClaimList
+		if err := g.reader.List(g.ctx, &pvcs); err != nil {
+			return err
+		}
+		for i := range pvcs.Items {
+			if name := pvcs.Items[i].Spec.StorageClassName; name != nil && *name == o.Name {
+				g.consumer(id, &pvcs.Items[i], types.RelationProvisionedBy)
+			}
+		}
+	case *lhv1beta2.Volume:
+		var pvs corev1.PersistentVolumeList
+		if err := g.reader.List(g.ctx, &pvs); err != nil {
+			return err
+		}
+		for i := range pvs.Items {
+			csi := pvs.Items[i].Spec.CSI
+			if csi != nil && csi.Driver == constants.LonghornDriver && csi.VolumeHandle == o.Name {
+				g.consumer(id, &pvs.Items[i], types.RelationBackedBy)
+			}
+		}
+	case *corev1.PersistentVolume:
+		if o.Spec.ClaimRef == nil {
+			return nil
+		}
+		pvc := &corev1.PersistentVolumeClaim{}
+		if found, err := g.get(pvc, o.Spec.ClaimRef.Namespace, o.Spec.ClaimRef.Name); err != nil {
+			return err
+		} else if found {
+			g.consumer(id, pvc, types.RelationBoundTo)
+		}
+	case *corev1.PersistentVolumeClaim:
+		// the stopped vms have no pods, so the vms are resolved as well as the pods
+		var vms kv1.VirtualMachineList
+		if err := g.reader.List(g.ctx, &vms, client.InNamespace(o.Namespace)); err != nil {
+			return err
+		}
+		for i := range vms.Items {
+			if slices.Contains(vmClaimNames(g.ctx, &vms.Items[i]), o.Name) {
+				g.consumer(id, &vms.Items[i], types.RelationMounts)
+			}
+		}
+		var pods corev1.PodList
+		if err := g.reader.List(g.ctx, &pods, client.InNamespace(o.Namespace)); err != nil {
+			return err
+		}
+		for i := range pods.Items {
+			if slices.Contains(podClaimNames(&pods.Items[i]), o.Name) {
+				g.consumer(id, &pods.Items[i], types.RelationMounts)
+			}
+		}
+	case *corev1.Service:
+		if len(o.Spec.Selector) == 0 {
+			return nil
+		}
+		var pods corev1.PodList
+		if err := g.reader.List(g.ctx, &pods, client.InNamespace(o.Namespace),
+			client.MatchingLabels(o.Spec.Selector)); err != nil {
+			return err
+		}
+		for i := range pods.Items {
+			g.consumer(id, &pods.Items[i], types.RelationExposedBy)
+		}
+	}
+	return nil
+}
+
+// claims adds the pvcs mounted by the object, the ones not provisioned yet are added as missing
+func (g *graphBuilder) claims(id, namespace string, names []string) error {
+	for _, name := range names {
+		if err := g.dependencyByName(id, &corev1.PersistentVolumeClaim{}, namespace, name,
+			types.RelationMounts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *graphBuilder) dependency(source string, obj client.Object, relation string) {
+	if target := g.addNode(relatedKind(obj), obj, true, false); target != "" {
+		g.link(source, target, relation)
+	}
+}
+
+func (g *graphBuilder) consumer(target string, obj client.Object, relation string) {
+	if source := g.addNode(relatedKind(obj), obj, false, true); source != "" {
+		g.link(source, target, relation)
+	}
+}
+
+// dependencyByName adds the dependency referenced by its name, it's added as missing if it doesn't exist
+func (g *graphBuilder) dependencyByName(source string, obj client.Object, namespace, name, relation string) error {
+	found, err := g.get(obj, namespace, name)
+	if err != nil {
+		return err
+	}
+	if found {
+		g.dependency(source, obj, relation)
+		return nil
+	}
+	if target := g.addMissing(relatedKind(obj), namespace, name, true); target != "" {
+		g.link(source, target, relation)
+	}
+	return nil
+}
+
+func (g *graphBuilder) get(obj client.Object, namespace, name string) (bool, error) {
+	err := g.reader.Get(g.ctx, client.ObjectKey{Namespace: namespace, Name: name}, obj)
+	if k8serrors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// visible returns true if the namespace is accessible, the cluster scoped objects are always visible
+func (g *graphBuilder) visible(namespace string) bool {
+	return g.accessible == nil || namespace == "" || g.accessible(namespace)
+}
+
+// ownerNamespace returns the namespace whose project the object belongs to, the pvs, the longhorn volumes and the
+// backing images belong to the namespaces of their pvcs and images
+func ownerNamespace(obj client.Object) string {
+	switch o := obj.(type) {
+	case *corev1.PersistentVolume:
+		if o.Spec.ClaimRef != nil {
+			return o.Spec.ClaimRef.Namespace
+		}
+		return ""
+	case *lhv1beta2.Volume:
+		return o.Status.KubernetesStatus.Namespace
+	case *lhv1beta2.BackingImage:
+		return o.Labels[constants.LabelImageNamespace]
+	}
+	return obj.GetNamespace()
+}
+
+// addNode adds the object and queues it to walk, the id is returned if it's in the graph. The objects of the
+// namespaces which aren't accessible are neither added nor walked, so that the other projects don't leak
+func (g *graphBuilder) addNode(kind string, obj client.Object, forward, backward bool) string {
+	id := nodeId(kind, obj.GetNamespace(), obj.GetName())
+	if g.nodes[id] {
+		return id
+	}
+	if id != g.graph.Root && !g.visible(ownerNamespace(obj)) {
+		return ""
+	}
+	if len(g.nodes) >= constants.MaxRelatedNodes {
+		g.graph.Truncated = true
+		return ""
+	}
+	g.nodes[id] = true
+	g.graph.Nodes = append(g.graph.Nodes, types.RelatedNode{
+		Id:        id,
+		Kind:      kind,
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+		Status:    relatedStatus(obj),
+	})
+	g.queue = append(g.queue, graphItem{id: id, obj: obj, forward: forward, backward: backward})
+	return id
+}
+
+// addMissing adds the object which isn't walked, i.e. the ones missing or of the kinds unknown
+func (g *graphBuilder) addMissing(kind, namespace, name string, missing bool) string {
+	id := nodeId(kind, namespace, name)
+	if g.nodes[id] {
+		return id
+	}
+	// the longhorn objects are shared by the projects, the owners of their pvcs and images are unknown once missing
+	if namespace != constants.LonghornNamespace && namespace != constants.DefaultBackingImageNamespace &&
+		!g.visible(namespace) {
+		return ""
+	}
+	if len(g.nodes) >= constants.MaxRelatedNodes {
+		g.graph.Truncated = true
+		return ""
+	}
+	g.nodes[id] = true
+	g.graph.Nodes = append(g.graph.Nodes, types.RelatedNode{
+		Id:        id,
+		Kind:      kind,
+		Namespace: namespace,
+		Name:      name,
+		Missing:   missing,
+	})
+	return id
+}
+
+func (g *graphBuilder) link(source, target, relation string) {
+	if !g.nodes[source] || !g.nodes[target] {
+		return
+	}
+	edge := types.RelatedEdge{Source: source, Target: target, Type: relation}
+	if !g.edges[edge] {
+		g.edges[edge] = true
+		g.graph.Edges = append(g.graph.Edges, edge)
+	}
+}
+
+// sort keeps the root first and sorts the others, so that the graphs are stable across the requests
+func (g *graphBuilder) sort() {
+	nodes := g.graph.Nodes
+	sort.SliceStable(nodes, func(a, b int) bool {
+		if nodes[a].Id == g.graph.Root || nodes[b].Id == g.graph.Root {
+			return nodes[a].Id == g.graph.Root
+		}
+		return nodes[a].Id < nodes[b].Id
+	})
+	edges := g.graph.Edges
+	sort.Slice(edges, func(a, b int) bool {
+		if edges[a].Source != edges[b].Source {
+			return edges[a].Source < edges[b].Source
+		}
+		if edges[a].Target != edges[b].Target {
+			return edges[a].Target < edges[b].Target
+		}
+		return edges[a].Type < edges[b].Type
+	})
+}
+
+func nodeId(kind, namespace, name string) string {
+	if namespace == "" {
+		return kind + "/" + name
+	}
+	return kind + "/" + namespace + "/" + name
+}
+
+// newRelatedObject returns an empty object of the kinds walked by the graph, nil is returned for the others
+func newRelatedObject(kind string) client.Object {
+	switch kind {
+	case "VirtualMachine":
+		return &kv1.VirtualMachine{}
+	case "VirtualMachineInstance":
+		return &kv1.VirtualMachineInstance{}
+	case "Pod":
+		return &corev1.Pod{}
+	case "Service":
+		return &corev1.Service{}
+	case "PersistentVolumeClaim":
+		return &corev1.PersistentVolumeClaim{}
+	case "Image":
+		return &kav1.Image{}
+	}
+	return nil
+}
+
+// relatedKind returns the kind of the typed objects, their TypeMeta is empty once they're read from the cache
+func relatedKind(obj client.Object) string {
+	switch obj.(type) {
+	case *kv1.VirtualMachine:
+		return "VirtualMachine"
+	case *kv1.VirtualMachineInstance:
+		return "VirtualMachineInstance"
+	case *corev1.Pod:
+		return "Pod"
+	case *corev1.Service:
+		return "Service"
+	case *corev1.PersistentVolumeClaim:
+		return "PersistentVolumeClaim"
+	case *corev1.PersistentVolume:
+		return "PersistentVolume"
+	case *storagev1.StorageClass:
+		return "StorageClass"
+	case *lhv1beta2.Volume:
+		return "Volume"
+	case *lhv1beta2.BackingImage:
+		return "BackingImage"
+	case *kav1.Image:
+		return "Image"
+	}
+	return obj.GetObjectKind().GroupVersionKind().Kind
+}
+
+func relatedStatus(obj client.Object) string {
+	switch o := obj.(type) {
+	case *kv1.VirtualMachine:
+		return string(o.Status.PrintableStatus)
+	case *kv1.VirtualMachineInstance:
+		return string(o.Status.Phase)
+	case *corev1.Pod:
+		return string(o.Status.Phase)
+	case *corev1.Service:
+		return string(o.Spec.Type)
+	case *corev1.PersistentVolumeClaim:
+		return string(o.Status.Phase)
+	case *corev1.PersistentVolume:
+		return string(o.Status.Phase)
+	case *lhv1beta2.Volume:
+		// the robustness matters more than the state once the volume is degraded
+		if o.Status.Robustness == lhv1beta2.VolumeRobustnessDegraded ||
+			o.Status.Robustness == lhv1beta2.VolumeRobustnessFaulted {
+			return string(o.Status.Robustness)
+		}
+		return string(o.Status.State)
+	case *lhv1beta2.BackingImage:
+		return backingImageState(o)
+	case *kav1.Image:
+		return o.Status.State
+	}
+	return ""
+}
+
+// backingImageState returns the failed state of any disk, or the state of a disk not ready yet, or ready
+func backingImageState(bi *lhv1beta2.BackingImage) string {
+	var pending lhv1beta2.BackingImageState
+	for _, status := range bi.Status.DiskFileStatusMap {
+		if status == nil {
+			continue
+		}
+		switch status.State {
+		case lhv1beta2.BackingImageStateFailed, lhv1beta2.BackingImageStateFailedAndCleanUp:
+			return string(status.State)
+		case lhv1beta2.BackingImageStateReady:
+		default:
+			pending = status.State
+		}
+	}
+	if pending != "" {
+		return string(pending)
+	}
+	if len(bi.Status.DiskFileStatusMap) > 0 {
+		return string(lhv1beta2.BackingImageStateReady)
+	}
+	return ""
+}
+
+// selects returns true if the service selects the pod
+func selects(service *corev1.Service, pod *corev1.Pod) bool {
+	return len(service.Spec.Selector) > 0 &&
+		labels.SelectorFromSet(service.Spec.Selector).Matches(labels.Set(pod.Labels))
+}
+
+// vmClaimNames returns the pvcs mounted by the vm, including the ones of its data volume templates and the ones
+// created from the pvc templates of the api server
+func vmClaimNames(ctx context.Context, vm *kv1.VirtualMachine) []string {
+	var names []string
+	if vm.Spec.Template != nil {
+		names = volumeClaimNames(vm.Spec.Template.Spec.Volumes)
+	}
+	for _, template := range vm.Spec.DataVolumeTemplates {
+		names = appendName(names, template.Name)
+	}
+	if _, ok := vm.Annotations[constants.AnnotationPvcTemplates]; ok {
+		pvcs, _ := unmarshallPvcs(ctx, vm)
+		for _, pvc := range pvcs {
+			names = appendName(names, pvc.Name)
+		}
+	}
+	return names
+}
+
+// volumeClaimNames returns the pvcs of the volumes, the pvc of a data volume is named after it
+func volumeClaimNames(volumes []kv1.Volume) []string {
+	var names []string
+	for _, volume := range volumes {
+		switch {
+		case volume.PersistentVolumeClaim != nil:
+			names = appendName(names, volume.PersistentVolumeClaim.ClaimName)
+		case volume.DataVolume != nil:
+			names = appendName(names, volume.DataVolume.Name)
+		}
+	}
+	return names
+}
+
+func podClaimNames(pod *corev1.Pod) []string {
+	var names []string
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil {
+			names = appendName(names, volume.PersistentVolumeClaim.ClaimName)
+		}
+	}
+	return names
+}
+
+func appendName(names []string, name string) []string {
+	if name == "" || slices.Contains(names, name) {
+		return names
+	}
+	return append(names, name)
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kav1 "kubeall.io/api-server/pkg/generated/kubeall.io/v1"
+	lhv1beta2 "kubeall.io/api-server/pkg/generated/longhorn/apis/longhorn/v1beta2"
+	"kubeall.io/api-server/pkg/infra/apiserver"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/types"
+	kv1 "kubevirt.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"testing"
+)
+
+// relatedObjects two vms with a disk provisioned from the same image, only the first one is running
+func relatedObjects() []client.Object {
+	scName := "win10"
+	objects := []client.Object{
+		&kav1.Image{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "win10"}},
+		&lhv1beta2.BackingImage{ObjectMeta: metav1.ObjectMeta{Namespace: constants.DefaultBackingImageNamespace,
+			Name: "bi-win10", Labels: map[string]string{constants.LabelImage: "win10",
+				constants.LabelImageNamespace: "default"}}},
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: scName}, Provisioner: constants.LonghornDriver,
+			Parameters: map[string]string{constants.ParamBiImageName: "bi-win10"}},
+		&kv1.VirtualMachineInstance{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "vm1", UID: "vmi-1",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "VirtualMachine", Name: "vm1"}}}},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "virt-launcher-vm1",
+				Labels:          map[string]string{kv1.CreatedByLabel: "vmi-1", "app": "vm1"},
+				OwnerReferences: []metav1.OwnerReference{{Kind: "VirtualMachineInstance", Name: "vm1"}}},
+			Spec: corev1.PodSpec{Volumes: []corev1.Volume{{Name: "disk", VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "disk1"}}}}},
+		},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "vm1-rdp"},
+			Spec: corev1.ServiceSpec{Selector: map[string]string{"app": "vm1"}}},
+	}
+	for _, vm := range []string{"vm1", "vm2"} {
+		disk, volume := "disk"+vm[2:], "pvc-"+vm
+		objects = append(objects,
+			&kv1.VirtualMachine{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: vm},
+				Spec: kv1.VirtualMachineSpec{Template: &kv1.VirtualMachineInstanceTemplateSpec{
+					Spec: kv1.VirtualMachineInstanceSpec{Volumes: []kv1.Volume{{Name: "disk", VolumeSource: kv1.VolumeSource{
+						PersistentVolumeClaim: &kv1.PersistentVolumeClaimVolumeSource{
+							PersistentVolumeClaimVolumeSource: corev1.PersistentVolumeClaimVolumeSource{ClaimName: disk}}}}}},
+				}}},
+			&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: disk},
+				Spec: corev1.PersistentVolumeClaimSpec{StorageClassName: &scName, VolumeName: volume}},
+			&corev1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: volume},
+				Spec: corev1.PersistentVolumeSpec{
+					ClaimRef: &corev1.ObjectReference{Namespace: "default", Name: disk},
+					PersistentVolumeSource: corev1.PersistentVolumeSource{CSI: &corev1.CSIPersistentVolumeSource{
+						Driver: constants.LonghornDriver, VolumeHandle: volume}},
+				}},
+			&lhv1beta2.Volume{ObjectMeta: metav1.ObjectMeta{Namespace: constants.LonghornNamespace, Name: volume},
+				Spec: lhv1beta2.VolumeSpec{BackingImage: "bi-win10"}},
+		)
+	}
+	return objects
+}
+
+func TestBuildGraph(t *testing.T) {
+	objects := relatedObjects()
+	reader := fake.NewClientBuilder().WithScheme(apiserver.ServerScheme).WithObjects(objects...).Build()
+	vm := &kv1.VirtualMachine{}
+	image := &kav1.Image{}
+	_ = reader.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "vm1"}, vm)
+	_ = reader.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "win10"}, image)
+
+	tests := map[string]struct {
+		kind     string
+		obj      client.Object
+		expected []types.RelatedEdge
+		excluded []string
+	}{
+		"vm": {
+			kind: "VirtualMachine",
+			obj:  vm,
+			expected: []types.RelatedEdge{
+				{Source: "VirtualMachine/default/vm1", Target: "VirtualMachineInstance/default/vm1", Type: types.RelationOwns},
+				{Source: "VirtualMachineInstance/default/vm1", Target: "Pod/default/virt-launcher-vm1", Type: types.RelationOwns},
+				{Source: "Pod/default/virt-launcher-vm1", Target: "Service/default/vm1-rdp", Type: types.RelationExposedBy},
+				{Source: "VirtualMachine/default/vm1", Target: "PersistentVolumeClaim/default/disk1", Type: types.RelationMounts},
+				{Source: "PersistentVolumeClaim/default/disk1", Target: "PersistentVolume/pvc-vm1", Type: types.RelationBoundTo},
+				{Source: "PersistentVolume/pvc-vm1", Target: "Volume/longhorn-system/pvc-vm1", Type: types.RelationBackedBy},
+				{Source: "Volume/longhorn-system/pvc-vm1", Target: "BackingImage/longhorn-system/bi-win10", Type: types.RelationBackingImage},
+				{Source: "StorageClass/win10", Target: "BackingImage/longhorn-system/bi-win10", Type: types.RelationBackingImage},
+				{Source: "BackingImage/longhorn-system/bi-win10", Target: "Image/default/win10", Type: types.RelationCreatedFrom},
+			},
+			excluded: []string{"VirtualMachine/default/vm2", "PersistentVolumeClaim/default/disk2"},
+		},
+		"image": {
+			kind: "Image",
+			obj:  image,
+			expected: []types.RelatedEdge{
+				{Source: "PersistentVolumeClaim/default/disk2", Target: "StorageClass/win10", Type: types.RelationProvisionedBy},
+				{Source: "VirtualMachine/default/vm2", Target: "PersistentVolumeClaim/default/disk2", Type: types.RelationMounts},
+				{Source: "Pod/default/virt-launcher-vm1", Target: "PersistentVolumeClaim/default/disk1", Type: types.RelationMounts},
+				{Source: "VirtualMachine/default/vm1", Target: "VirtualMachineInstance/default/vm1", Type: types.RelationOwns},
+			},
+			excluded: []string{"Service/default/vm1-rdp"},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			graph, err := buildGraph(context.Background(), reader, nil, test.kind, test.obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if graph.Nodes[0].Id != graph.Root {
+				t.Errorf("expected the root %s first, got %s", graph.Root, graph.Nodes[0].Id)
+			}
+			edges := map[types.RelatedEdge]bool{}
+			for _, edge := range graph.Edges {
+				edges[edge] = true
+			}
+			for _, edge := range test.expected {
+				if !edges[edge] {
+					t.Errorf("expected the edge %v in %v", edge, graph.Edges)
+				}
+			}
+			for _, node := range graph.Nodes {
+				for _, excluded := range test.excluded {
+					if node.Id == excluded {
+						t.Errorf("unexpected node %s", excluded)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestGraphOfProjects(t *testing.T) {
+	scName := "win10"
+	objects := append(relatedObjects(),
+		&kav1.Project{ObjectMeta: metav1.ObjectMeta{Name: "p1"}, Spec: kav1.ProjectSpec{
+			Namespaces: []string{"default"}, Members: []kav1.ProjectMember{{Name: "alice"}}}},
+		&kav1.Project{ObjectMeta: metav1.ObjectMeta{Name: "p2"}, Spec: kav1.ProjectSpec{
+			Namespaces: []string{"other"}, Members: []kav1.ProjectMember{{Name: "bob"}}}},
+		// the vm of the other project provisioned from the same image
+		&kv1.VirtualMachine{ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "vm3"},
+			Spec: kv1.VirtualMachineSpec{Template: &kv1.VirtualMachineInstanceTemplateSpec{
+				Spec: kv1.VirtualMachineInstanceSpec{Volumes: []kv1.Volume{{Name: "disk", VolumeSource: kv1.VolumeSource{
+					PersistentVolumeClaim: &kv1.PersistentVolumeClaimVolumeSource{
+						PersistentVolumeClaimVolumeSource: corev1.PersistentVolumeClaimVolumeSource{ClaimName: "disk3"}}}}}},
+			}}},
+		&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "disk3"},
+			Spec: corev1.PersistentVolumeClaimSpec{StorageClassName: &scName, VolumeName: "pvc-vm3"}},
+		&corev1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "pvc-vm3"},
+			Spec: corev1.PersistentVolumeSpec{
+				ClaimRef: &corev1.ObjectReference{Namespace: "other", Name: "disk3"},
+				PersistentVolumeSource: corev1.PersistentVolumeSource{CSI: &corev1.CSIPersistentVolumeSource{
+					Driver: constants.LonghornDriver, VolumeHandle: "pvc-vm3"}},
+			}},
+		&lhv1beta2.Volume{ObjectMeta: metav1.ObjectMeta{Namespace: constants.LonghornNamespace, Name: "pvc-vm3"},
+			Spec:   lhv1beta2.VolumeSpec{BackingImage: "bi-win10"},
+			Status: lhv1beta2.VolumeStatus{KubernetesStatus: lhv1beta2.KubernetesStatus{Namespace: "other"}}},
+	)
+	cluster := newFakeCluster(objects...)
+	projectService := &projectServiceImpl{clusterResource: cluster, enabled: true, admins: []string{"admin"},
+		userHeader: constants.DefaultUserHeader}
+	relatedService := NewRelatedService(cluster, projectService)
+	image := &kav1.Image{}
+	_ = cluster.client.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "win10"}, image)
+
+	hidden := []string{"VirtualMachine/other/vm3", "PersistentVolumeClaim/other/disk3", "PersistentVolume/pvc-vm3",
+		"Volume/longhorn-system/pvc-vm3"}
+	tests := map[string]struct {
+		user    string
+		visible []string
+		hidden  []string
+	}{
+		"member": {
+			user:    "alice",
+			visible: []string{"VirtualMachine/default/vm2", "PersistentVolume/pvc-vm2", "StorageClass/win10"},
+			hidden:  hidden,
+		},
+		"admin": {
+			user:    "admin",
+			visible: append([]string{"VirtualMachine/default/vm2"}, hidden...),
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			graph, err := relatedService.Graph(requestContext(test.user),
+				kav1.GroupVersion.WithKind("Image"), image)
+			if err != nil {
+				t.Fatal(err)
+			}
+			nodes := map[string]bool{}
+			for _, node := range graph.Nodes {
+				nodes[node.Id] = true
+			}
+			for _, edge := range graph.Edges {
+				if !nodes[edge.Source] || !nodes[edge.Target] {
+					t.Errorf("unexpected edge %v of the nodes not in the graph", edge)
+				}
+			}
+			for _, id := range test.visible {
+				if !nodes[id] {
+					t.Errorf("expected the node %s in %v", id, graph.Nodes)
+				}
+			}
+			for _, id := range test.hidden {
+				if nodes[id] {
+					t.Errorf("unexpected node %s of the other project", id)
+				}
+			}
+		})
+	}
+}
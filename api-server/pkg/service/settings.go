@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kav1 "kubeall.io/api-server/pkg/generated/kubeall.io/v1"
+	"kubeall.io/api-server/pkg/infra/apiserver"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/utils"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// defaultLonghornUploadUrl the upload url used while the setting isn't set, the env var is read once at startup so
+// that the setting always takes precedence over it
+var defaultLonghornUploadUrl = defaultUploadUrl()
+
+func defaultUploadUrl() string {
+	url := constants.DefaultLonghornUploadUrl
+	return utils.GetEnv(constants.VarLonghornUploadUiPrefix, &url)
+}
+
+// SettingsService reads the global settings from the informer, so the changes take effect without restarting
+type SettingsService interface {
+	// Get returns the global settings whose missing fields are set to the defaults
+	Get(ctx context.Context) (*kav1.GlobalSettingsSpec, error)
+	// Update replaces the spec of the global settings, it's created if not exist
+	Update(ctx context.Context, spec *kav1.GlobalSettingsSpec) (*kav1.GlobalSettingsSpec, error)
+}
+
+type settingsServiceImpl struct {
+	clusterResource apiserver.ClusterResource
+}
+
+func NewSettingsService(clusterResource apiserver.ClusterResource) SettingsService {
+	return &settingsServiceImpl{clusterResource: clusterResource}
+}
+
+func (s settingsServiceImpl) Get(ctx context.Context) (*kav1.GlobalSettingsSpec, error) {
+	return GetGlobalSettings(ctx, apiserver.ClusterFrom(ctx, s.clusterResource).ClusterCache())
+}
+
+func (s settingsServiceImpl) Update(ctx context.Context, spec *kav1.GlobalSettingsSpec) (*kav1.GlobalSettingsSpec, error) {
+	cls := apiserver.ClusterFrom(ctx, s.clusterResource)
+	settings := &kav1.GlobalSettings{}
+	err := cls.ClusterCache().Get(ctx, client.ObjectKey{Name: kav1.GlobalSettingsName}, settings)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	runtimeClient := cls.RuntimeClient()
+	if k8serrors.IsNotFound(err) {
+		settings = &kav1.GlobalSettings{
+			ObjectMeta: v1.ObjectMeta{Name: kav1.GlobalSettingsName},
+			Spec:       *spec,
+		}
+		err = runtimeClient.Create(ctx, settings)
+	} else {
+		settings = settings.DeepCopy()
+		settings.Spec = *spec
+		err = runtimeClient.Update(ctx, settings)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return CompleteSettings(&settings.Spec), nil
+}
+
+// GetGlobalSettings reads the global settings by the reader, the defaults are returned if it doesn't exist
+func GetGlobalSettings(ctx context.Context, reader client.Reader) (*kav1.GlobalSettingsSpec, error) {
+	settings := &kav1.GlobalSettings{}
+	err := reader.Get(ctx, client.ObjectKey{Name: kav1.GlobalSettingsName}, settings)
+	if k8serrors.IsNotFound(err) {
+		return CompleteSettings(&kav1.GlobalSettingsSpec{}), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return CompleteSettings(&settings.Spec), nil
+}
+
+// CompleteSettings returns a copy of the spec whose missing fields are set to the defaults
+func CompleteSettings(spec *kav1.GlobalSettingsSpec) *kav1.GlobalSettingsSpec {
+	spec = spec.DeepCopy()
+	sc := &spec.StorageClass
+	if sc.NumberOfReplicas == "" {
+		sc.NumberOfReplicas = constants.DefaultNumberOfReplicas
+	}
+	if sc.StaleReplicaTimeout == "" {
+		sc.StaleReplicaTimeout = constants.DefaultStaleReplicaTimeout
+	}
+	if sc.ReclaimPolicy == "" {
+		sc.ReclaimPolicy = constants.DefaultReclaimPolicy
+	}
+	if sc.AllowVolumeExpansion == nil {
+		allowVolumeExpansion := true
+		sc.AllowVolumeExpansion = &allowVolumeExpansion
+	}
+	if sc.VolumeBindingMode == "" {
+		sc.VolumeBindingMode = constants.DefaultVolumeBindingMode
+	}
+	if spec.LonghornUploadUrl == "" {
+		spec.LonghornUploadUrl = defaultLonghornUploadUrl
+	}
+	if spec.DefaultPageSize == 0 {
+		spec.DefaultPageSize = constants.DefaultPageSize
+	}
+	if len(spec.AllowedImageSources) == 0 {
+		spec.AllowedImageSources = []kav1.ImageSourceType{kav1.ImageSourceTypeUpload, kav1.ImageSourceTypeDownload,
+			kav1.ImageSourceTypeRestore, kav1.ImageSourceTypeClone, kav1.ImageSourceTypeExportVolume}
+	}
+	vmDefaults := &spec.VmDefaults
+	if vmDefaults.CpuCores == 0 {
+		vmDefaults.CpuCores = constants.DefaultVmCpuCores
+	}
+	if vmDefaults.Memory == "" {
+		vmDefaults.Memory = constants.DefaultVmMemory
+	}
+	if vmDefaults.RunStrategy == "" {
+		vmDefaults.RunStrategy = constants.DefaultVmRunStrategy
+	}
+	return spec
+}
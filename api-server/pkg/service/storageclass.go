@@ -23,14 +23,14 @@ func NewStorageClass(clusterResource apiserver.ClusterResource) StorageClass {
 
 func (s storageClassImpl) Get(ctx context.Context, name string) (*storagev1.StorageClass, error) {
 	var sc = &storagev1.StorageClass{}
-	err := s.clusterResource.ClusterCache().Get(ctx, client.ObjectKey{
+	err := apiserver.ClusterFrom(ctx, s.clusterResource).ClusterCache().Get(ctx, client.ObjectKey{
 		Name: name,
 	}, sc)
 	return sc, err
 }
 
 func (s storageClassImpl) Create(ctx context.Context, storageClass *storagev1.StorageClass) (*storagev1.StorageClass, error) {
-	sc, err := s.clusterResource.Client().K8sClient().StorageV1().StorageClasses().
+	sc, err := apiserver.ClusterFrom(ctx, s.clusterResource).Client().K8sClient().StorageV1().StorageClasses().
 		Create(ctx, storageClass, v1.CreateOptions{})
 	return sc, err
 }
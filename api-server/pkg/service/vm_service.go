@@ -3,35 +3,60 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 	corev1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kav1 "kubeall.io/api-server/pkg/generated/kubeall.io/v1"
 	"kubeall.io/api-server/pkg/infra/apiserver"
 	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/logger"
+	"kubeall.io/api-server/pkg/infra/tracing"
 	kv1 "kubevirt.io/api/core/v1"
 )
 
 type VmService interface {
 	Create(ctx context.Context, vm *kv1.VirtualMachine) error
 	DeleteDisks(ctx context.Context, vm *kv1.VirtualMachine) error
-	CreateDisks(ctx context.Context, vm *kv1.VirtualMachine) error
+	// CreateDisks creates the pvcs in the annotation of the vm, created is false if all of them exist already
+	CreateDisks(ctx context.Context, vm *kv1.VirtualMachine) (created bool, err error)
 }
 
 type vmServiceImpl struct {
 	clusterResource apiserver.ClusterResource
+	settingsService SettingsService
+	projectService  ProjectService
 }
 
-func NewVmService(clusterResource apiserver.ClusterResource) VmService {
+func NewVmService(clusterResource apiserver.ClusterResource, settingsService SettingsService,
+	projectService ProjectService) VmService {
 	return &vmServiceImpl{
 		clusterResource: clusterResource,
+		settingsService: settingsService,
+		projectService:  projectService,
 	}
 }
 
-func (v vmServiceImpl) Create(ctx context.Context, vm *kv1.VirtualMachine) error {
-	kvClient := v.clusterResource.Client().KubevirtClient().KubevirtV1()
+func (v vmServiceImpl) Create(ctx context.Context, vm *kv1.VirtualMachine) (err error) {
+	ctx, span := tracing.Start(ctx, "VmService.Create", vmAttributes(vm)...)
+	defer func() { tracing.End(span, err) }()
 
-	_, err := kvClient.VirtualMachines(vm.Namespace).Create(ctx, vm, metav1.CreateOptions{})
+	kvClient := apiserver.ClusterFrom(ctx, v.clusterResource).Client().KubevirtClient().KubevirtV1()
+
+	settings, err := v.settingsService.Get(ctx)
+	if err != nil {
+		return err
+	}
+	if err = applyVmDefaults(vm, settings.VmDefaults); err != nil {
+		return err
+	}
+	if err = v.projectService.CheckVm(ctx, vm); err != nil {
+		return err
+	}
+
+	_, err = kvClient.VirtualMachines(vm.Namespace).Create(ctx, vm, metav1.CreateOptions{})
 	if err != nil {
 
 		return err
@@ -39,14 +64,40 @@ func (v vmServiceImpl) Create(ctx context.Context, vm *kv1.VirtualMachine) error
 	return nil
 }
 
-func (v vmServiceImpl) DeleteDisks(ctx context.Context, vm *kv1.VirtualMachine) error {
-	pvcs, err := v.marshallPvcs(vm)
+// applyVmDefaults sets the run strategy, cpu and memory of the vm if they're not specified
+func applyVmDefaults(vm *kv1.VirtualMachine, defaults kav1.VmDefaults) error {
+	if vm.Spec.RunStrategy == nil && vm.Spec.Running == nil {
+		runStrategy := kv1.VirtualMachineRunStrategy(defaults.RunStrategy)
+		vm.Spec.RunStrategy = &runStrategy
+	}
+	if vm.Spec.Template == nil {
+		return nil
+	}
+	domain := &vm.Spec.Template.Spec.Domain
+	if domain.CPU == nil {
+		domain.CPU = &kv1.CPU{Cores: defaults.CpuCores}
+	}
+	if _, ok := domain.Resources.Requests[corev1.ResourceMemory]; !ok && domain.Memory == nil {
+		memory, err := resource.ParseQuantity(defaults.Memory)
+		if err != nil {
+			return err
+		}
+		domain.Memory = &kv1.Memory{Guest: &memory}
+	}
+	return nil
+}
+
+func (v vmServiceImpl) DeleteDisks(ctx context.Context, vm *kv1.VirtualMachine) (err error) {
+	ctx, span := tracing.Start(ctx, "VmService.DeleteDisks", vmAttributes(vm)...)
+	defer func() { tracing.End(span, err) }()
+
+	pvcs, err := unmarshallPvcs(ctx, vm)
 	if err != nil || pvcs == nil {
 		return err
 	}
 
 	for _, pvcName := range pvcs {
-		err = v.clusterResource.Client().K8sClient().CoreV1().PersistentVolumeClaims(vm.Namespace).
+		err = apiserver.ClusterFrom(ctx, v.clusterResource).Client().K8sClient().CoreV1().PersistentVolumeClaims(vm.Namespace).
 			Delete(ctx, pvcName.Name, metav1.DeleteOptions{})
 
 		if err != nil {
@@ -54,25 +105,28 @@ func (v vmServiceImpl) DeleteDisks(ctx context.Context, vm *kv1.VirtualMachine)
 				continue
 			}
 
-			zap.L().Warn("failed to delete pvc",
+			logger.FromContext(ctx).Warn("failed to delete pvc",
 				zap.String("namespace", vm.Namespace),
 				zap.String("name", vm.Name), zap.Error(err))
 		}
 	}
-	zap.L().Info("vm's pvcs are ensured to be deleted",
+	logger.FromContext(ctx).Info("vm's pvcs are ensured to be deleted",
 		zap.String("namespace", vm.Namespace),
 		zap.String("name", vm.Name))
 	return nil
 }
 
-func (v vmServiceImpl) CreateDisks(ctx context.Context, vm *kv1.VirtualMachine) error {
-	pvcs, err := v.marshallPvcs(vm)
+func (v vmServiceImpl) CreateDisks(ctx context.Context, vm *kv1.VirtualMachine) (created bool, err error) {
+	ctx, span := tracing.Start(ctx, "VmService.CreateDisks", vmAttributes(vm)...)
+	defer func() { tracing.End(span, err) }()
+
+	pvcs, err := unmarshallPvcs(ctx, vm)
 	if err != nil || pvcs == nil {
-		return err
+		return false, err
 	}
 
 	for _, pvc := range pvcs {
-		_, err = v.clusterResource.Client().K8sClient().CoreV1().PersistentVolumeClaims(vm.Namespace).
+		_, err = apiserver.ClusterFrom(ctx, v.clusterResource).Client().K8sClient().CoreV1().PersistentVolumeClaims(vm.Namespace).
 			Create(ctx, &pvc, metav1.CreateOptions{})
 
 		if err != nil {
@@ -80,31 +134,38 @@ func (v vmServiceImpl) CreateDisks(ctx context.Context, vm *kv1.VirtualMachine)
 				continue
 			}
 
-			zap.L().Warn("failed to create pvc",
+			logger.FromContext(ctx).Warn("failed to create pvc",
 				zap.String("namespace", vm.Namespace),
 				zap.String("name", vm.Name), zap.Error(err))
-			return err
+			return created, err
 		}
+		created = true
 	}
-	zap.L().Info("vm's pvcs are ensured to be created",
+	logger.FromContext(ctx).Info("vm's pvcs are ensured to be created",
 		zap.String("namespace", vm.Namespace),
-		zap.String("name", vm.Name))
-	return nil
+		zap.String("name", vm.Name), zap.Bool("created", created))
+	return created, nil
 }
 
-func (v vmServiceImpl) marshallPvcs(vm *kv1.VirtualMachine) ([]corev1.PersistentVolumeClaim, error) {
+// unmarshallPvcs returns the pvcs in the annotation of the vm, which are created along with the vm
+func unmarshallPvcs(ctx context.Context, vm *kv1.VirtualMachine) ([]corev1.PersistentVolumeClaim, error) {
 	pvcTemplate, ok := vm.Annotations[constants.AnnotationPvcTemplates]
 	if ok {
 		var pvcs []corev1.PersistentVolumeClaim
 		if err := json.Unmarshal([]byte(pvcTemplate), &pvcs); err != nil {
-			zap.L().Warn("failed to Unmarshal pvcs from vm's annotation",
+			logger.FromContext(ctx).Warn("failed to Unmarshal pvcs from vm's annotation",
 				zap.String("namespace", vm.Namespace),
 				zap.String("name", vm.Name), zap.Error(err))
 			return nil, err
 		}
 		return pvcs, nil
 	}
-	zap.L().Info("no pvcs found form vm's annotations, ignored", zap.String("namespace", vm.Namespace),
+	logger.FromContext(ctx).Info("no pvcs found form vm's annotations, ignored", zap.String("namespace", vm.Namespace),
 		zap.String("name", vm.Name))
 	return nil, nil
 }
+
+// vmAttributes returns the span attributes identifying the vm
+func vmAttributes(vm *kv1.VirtualMachine) []attribute.KeyValue {
+	return []attribute.KeyValue{attribute.String("namespace", vm.Namespace), attribute.String("name", vm.Name)}
+}
@@ -0,0 +1,51 @@
+package types
+
+import "time"
+
+const (
+	// AuditStageStarted the interactive session is started, it's recorded again once it's completed
+	AuditStageStarted = "Started"
+	// AuditStageCompleted the request is handled or the interactive session is closed
+	AuditStageCompleted = "Completed"
+)
+
+// AuditEvent is a mutating request or an interactive session, e.g. a terminal, recorded by the audit log
+type AuditEvent struct {
+	Time          time.Time `json:"time"`
+	Stage         string    `json:"stage"`
+	RequestId     string    `json:"requestId,omitempty"`
+	User          string    `json:"user"`
+	SourceIP      string    `json:"sourceIP"`
+	Verb          string    `json:"verb"`
+	Cluster       string    `json:"cluster,omitempty"`
+	Resource      string    `json:"resource"`
+	Namespace     string    `json:"namespace,omitempty"`
+	Name          string    `json:"name,omitempty"`
+	Path          string    `json:"path"`
+	Query         string    `json:"query,omitempty"`
+	RequestDigest string    `json:"requestDigest,omitempty"`
+	Status        int       `json:"status"`
+	LatencyMs     int64     `json:"latencyMs"`
+}
+
+// AuditQuery filters the audit events, the zero values match all events
+type AuditQuery struct {
+	User  string    `form:"user"`
+	From  time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To    time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit int       `form:"limit" binding:"omitempty,min=1,max=1000"`
+}
+
+// Match returns true if the event is in the time range and made by the user
+func (q AuditQuery) Match(event *AuditEvent) bool {
+	if q.User != "" && q.User != event.User {
+		return false
+	}
+	if !q.From.IsZero() && event.Time.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && event.Time.After(q.To) {
+		return false
+	}
+	return true
+}
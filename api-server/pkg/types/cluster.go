@@ -0,0 +1,31 @@
+package types
+
+// ClusterSource where the kubeconfig of the cluster is from
+type ClusterSource string
+
+const (
+	ClusterSourceLocal  ClusterSource = "local"
+	ClusterSourceConfig ClusterSource = "config"
+	ClusterSourceSecret ClusterSource = "secret"
+)
+
+// ClusterInfo a cluster managed by the api server, Connected is true once its clients and cache are created
+type ClusterInfo struct {
+	Name      string         `json:"name"`
+	Source    ClusterSource  `json:"source"`
+	Connected bool           `json:"connected"`
+	Health    *ClusterHealth `json:"health,omitempty"`
+}
+
+// ClusterHealth the result of the health check of a cluster
+type ClusterHealth struct {
+	Healthy bool   `json:"healthy"`
+	Version string `json:"version,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// ClusterRequest adds a member cluster by its kubeconfig
+type ClusterRequest struct {
+	Name       string `json:"name" binding:"required,hostname_rfc1123,max=53"`
+	KubeConfig string `json:"kubeConfig" binding:"required"`
+}
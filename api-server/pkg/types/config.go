@@ -1,5 +1,22 @@
 package types
 
+import (
+	"crypto/tls"
+	"fmt"
+	"go.uber.org/zap/zapcore"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"kubeall.io/api-server/pkg/infra/utils"
+	"math"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
 type StartupParams struct {
 	InternalConfig   []byte
 	CustomConfigPath string
@@ -28,32 +45,562 @@ type LogConfig struct {
 type HttpSetting struct {
 	Address string `koanf:"address" yaml:"address"`
 	Port    uint   `koanf:"port" yaml:"port"`
+	// CacheSyncTimeout the server accepts the requests once the informers are synced, it fails to start if they
+	// aren't synced in time
+	CacheSyncTimeout time.Duration `koanf:"cacheSyncTimeout" yaml:"cacheSyncTimeout"`
+	// ShutdownDelay the duration reporting not ready before the server stops accepting the connections, so that it's
+	// removed from the endpoints in time
+	ShutdownDelay time.Duration `koanf:"shutdownDelay" yaml:"shutdownDelay"`
+	// ShutdownTimeout the deadline of the in-flight requests, e.g. the uploads, to be completed while shutting down
+	ShutdownTimeout time.Duration `koanf:"shutdownTimeout" yaml:"shutdownTimeout"`
+	// Http2 accepts HTTP/2 besides HTTP/1.1, it's h2c while the tls is disabled
+	Http2 bool       `koanf:"http2" yaml:"http2"`
+	Tls   *TlsConfig `koanf:"tls" yaml:"tls"`
+	// Cors allows the console hosted apart from the api server to call it
+	Cors *CorsConfig `koanf:"cors" yaml:"cors"`
+}
+
+// CorsConfig the cross-origin requests allowed, "*" allows all origins but it can't be used with the credentials
+type CorsConfig struct {
+	Enabled          bool          `koanf:"enabled" yaml:"enabled"`
+	AllowedOrigins   []string      `koanf:"allowedOrigins" yaml:"allowedOrigins"`
+	AllowedMethods   []string      `koanf:"allowedMethods" yaml:"allowedMethods"`
+	AllowedHeaders   []string      `koanf:"allowedHeaders" yaml:"allowedHeaders"`
+	ExposedHeaders   []string      `koanf:"exposedHeaders" yaml:"exposedHeaders"`
+	AllowCredentials bool          `koanf:"allowCredentials" yaml:"allowCredentials"`
+	MaxAge           time.Duration `koanf:"maxAge" yaml:"maxAge"`
+}
+
+// TlsConfig serves https, the certificate is reloaded once its files are changed. A self-signed certificate is
+// generated while the certificate isn't configured, it's for development only.
+type TlsConfig struct {
+	Enabled  bool   `koanf:"enabled" yaml:"enabled"`
+	CertFile string `koanf:"certFile" yaml:"certFile"`
+	KeyFile  string `koanf:"keyFile" yaml:"keyFile"`
+	// MinVersion 1.2 or 1.3, it's 1.2 by default
+	MinVersion string `koanf:"minVersion" yaml:"minVersion"`
+	// CipherSuites the names of the cipher suites of tls 1.2, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, the ones of
+	// tls 1.3 aren't configurable
+	CipherSuites []string          `koanf:"cipherSuites" yaml:"cipherSuites"`
+	ClientAuth   *ClientAuthConfig `koanf:"clientAuth" yaml:"clientAuth"`
+}
+
+// ClientAuthConfig authenticates the clients by their certificates signed by the CA, the common name of the
+// certificate is the user, which overrides the user headers
+type ClientAuthConfig struct {
+	Enabled bool   `koanf:"enabled" yaml:"enabled"`
+	CaFile  string `koanf:"caFile" yaml:"caFile"`
+	// Required rejects the connections without a certificate, otherwise such requests are anonymous, their user
+	// headers are removed
+	Required bool `koanf:"required" yaml:"required"`
+	// TrustedProxies the common names of the authenticating proxies, the user headers set by them are kept
+	TrustedProxies []string `koanf:"trustedProxies" yaml:"trustedProxies"`
+}
+
+// TlsMinVersion returns the minimum tls version, it's tls 1.2 by default
+func (t *TlsConfig) TlsMinVersion() (uint16, error) {
+	switch t.MinVersion {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported tls version %s", t.MinVersion)
+}
+
+// CipherSuiteIDs returns the ids of the cipher suites, the insecure ones aren't supported
+func (t *TlsConfig) CipherSuiteIDs() ([]uint16, error) {
+	var ids []uint16
+	for _, name := range t.CipherSuites {
+		i := slices.IndexFunc(tls.CipherSuites(), func(suite *tls.CipherSuite) bool {
+			return suite.Name == name
+		})
+		if i < 0 {
+			return nil, fmt.Errorf("unsupported cipher suite %s", name)
+		}
+		ids = append(ids, tls.CipherSuites()[i].ID)
+	}
+	return ids, nil
+}
+
+// MetricsConfig the metrics server, "0" disables it
+type MetricsConfig struct {
+	BindAddress string `koanf:"bindAddress" yaml:"bindAddress"`
+}
+
+// LeaderElectionConfig the leader election of controller manager, only the leader runs the controllers
+type LeaderElectionConfig struct {
+	Enabled       bool          `koanf:"enabled" yaml:"enabled"`
+	Namespace     string        `koanf:"namespace" yaml:"namespace"`
+	ID            string        `koanf:"id" yaml:"id"`
+	LeaseDuration time.Duration `koanf:"leaseDuration" yaml:"leaseDuration"`
+	RenewDeadline time.Duration `koanf:"renewDeadline" yaml:"renewDeadline"`
+	RetryPeriod   time.Duration `koanf:"retryPeriod" yaml:"retryPeriod"`
+}
+
+// WebhookConfig the webhook server of controller manager, the certificate is tls.crt and tls.key under CertDir
+type WebhookConfig struct {
+	Enabled bool   `koanf:"enabled" yaml:"enabled"`
+	Host    string `koanf:"host" yaml:"host"`
+	Port    int    `koanf:"port" yaml:"port"`
+	CertDir string `koanf:"certDir" yaml:"certDir"`
+}
+
+// AuditConfig the audit log of the mutating requests, the user is read from the header set by the authenticating proxy
+type AuditConfig struct {
+	Enabled    bool                `koanf:"enabled" yaml:"enabled"`
+	UserHeader string              `koanf:"userHeader" yaml:"userHeader"`
+	File       *AuditFileConfig    `koanf:"file" yaml:"file"`
+	Webhook    *AuditWebhookConfig `koanf:"webhook" yaml:"webhook"`
+}
+
+// AuditFileConfig the rotating json file of the audit events, the events are queried from it
+type AuditFileConfig struct {
+	Enabled      bool   `koanf:"enabled" yaml:"enabled"`
+	FileName     string `koanf:"fileName" yaml:"fileName"`
+	MaxSizeInMB  int    `koanf:"maxSizeInMB" yaml:"maxSizeInMB"`
+	MaxAgeInDays int    `koanf:"maxAgeInDays" yaml:"maxAgeInDays"`
+	MaxBackups   int    `koanf:"maxBackups" yaml:"maxBackups"`
+	Compress     bool   `koanf:"compress" yaml:"compress"`
+}
+
+// AuditWebhookConfig posts the audit events to the url one by one, the events are dropped while the queue is full
+type AuditWebhookConfig struct {
+	Enabled   bool          `koanf:"enabled" yaml:"enabled"`
+	Url       string        `koanf:"url" yaml:"url"`
+	Timeout   time.Duration `koanf:"timeout" yaml:"timeout"`
+	QueueSize int           `koanf:"queueSize" yaml:"queueSize"`
+}
+
+// MultiClusterConfig the member clusters managed besides the local one, the clusters added at runtime are stored in
+// the secrets of SecretNamespace
+type MultiClusterConfig struct {
+	SecretNamespace string          `koanf:"secretNamespace" yaml:"secretNamespace"`
+	Clusters        []ClusterConfig `koanf:"clusters" yaml:"clusters"`
+}
+
+// ClusterConfig a member cluster defined in the config file
+type ClusterConfig struct {
+	Name       string `koanf:"name" yaml:"name"`
+	KubeConfig string `koanf:"kubeConfig" yaml:"kubeConfig"`
 }
 
-type StorageClassConfig struct {
-	NumberOfReplicas     string `koanf:"numberOfReplicas"`
-	StaleReplicaTimeout  string `koanf:"staleReplicaTimeout"`
-	AllowVolumeExpansion bool   `koanf:"allowVolumeExpansion"`
-	ReclaimPolicy        string `koanf:"reclaimPolicy"`
-	Provisioner          string `koanf:"provisioner"`
+// ProjectConfig restricts the users to the namespaces of their projects, the user is read from the header set by the
+// authenticating proxy. The admins and all users while it's disabled access all namespaces, the quotas of the projects
+// are enforced regardless of it.
+type ProjectConfig struct {
+	Enabled    bool     `koanf:"enabled" yaml:"enabled"`
+	UserHeader string   `koanf:"userHeader" yaml:"userHeader"`
+	Admins     []string `koanf:"admins" yaml:"admins"`
+}
+
+// OpenApiConfig the OpenAPI document and the Swagger UI, the assets of swagger-ui-dist are served from SwaggerUiDir if
+// it's mounted, or loaded from SwaggerUiUrl if it's set, otherwise the embedded ones are served
+type OpenApiConfig struct {
+	Enabled      bool   `koanf:"enabled" yaml:"enabled"`
+	SwaggerUiUrl string `koanf:"swaggerUiUrl" yaml:"swaggerUiUrl"`
+	SwaggerUiDir string `koanf:"swaggerUiDir" yaml:"swaggerUiDir"`
+}
+
+// I18nConfig the languages of the messages, a language is enabled by adding its bundle, e.g. fr.json, to the
+// locales or to BundleDir, and adding it to Languages. The first language is the default one.
+type I18nConfig struct {
+	Languages []string `koanf:"languages" yaml:"languages"`
+	// BundleDir the bundles in the directory take precedence over the embedded ones
+	BundleDir string `koanf:"bundleDir" yaml:"bundleDir"`
+}
+
+// TracingConfig exports the spans by OTLP over HTTP, e.g. http://otel-collector:4318, the path defaults to /v1/traces.
+// SampleRatio is the ratio of the traces started by the server, the ones continued from the upstream follow its
+// decision, and all traces are sampled if it's not set.
+type TracingConfig struct {
+	Enabled     bool              `koanf:"enabled" yaml:"enabled"`
+	Endpoint    string            `koanf:"endpoint" yaml:"endpoint"`
+	Headers     map[string]string `koanf:"headers" yaml:"headers"`
+	SampleRatio float64           `koanf:"sampleRatio" yaml:"sampleRatio"`
+	// ServiceName defaults to the application name
+	ServiceName string `koanf:"serviceName" yaml:"serviceName"`
+}
+
+// LimitsConfig the limits of the requests, they're reloaded at runtime while the config files are changed
+type LimitsConfig struct {
+	// PageSizes the page sizes accepted by the lists
+	PageSizes []int `koanf:"pageSizes" yaml:"pageSizes"`
+	// UploadTimeout the timeout of uploading the content of an image to longhorn
+	UploadTimeout time.Duration `koanf:"uploadTimeout" yaml:"uploadTimeout"`
+	// MaxConcurrentUploads the uploads in progress of all the users, 0 means unlimited
+	MaxConcurrentUploads int `koanf:"maxConcurrentUploads" yaml:"maxConcurrentUploads"`
+	// MaxBodySize the max size of the json and yaml bodies, e.g. 4Mi
+	MaxBodySize string `koanf:"maxBodySize" yaml:"maxBodySize"`
+	// RateLimits the token buckets of the route groups, i.e. list, mutate, upload and console, per user or client ip.
+	// The route groups without a rate aren't limited.
+	RateLimits map[string]RateLimit `koanf:"rateLimits" yaml:"rateLimits"`
+}
+
+// RateLimit the token bucket refilled at Rate tokens per second, Burst is the size of the bucket
+type RateLimit struct {
+	Rate  float64 `koanf:"rate" yaml:"rate"`
+	Burst int     `koanf:"burst" yaml:"burst"`
+}
+
+// MaxBodyBytes returns the max size of the json and yaml bodies in bytes
+func (l *LimitsConfig) MaxBodyBytes() int64 {
+	size, err := resource.ParseQuantity(l.MaxBodySize)
+	if err != nil {
+		size = resource.MustParse(constants.DefaultMaxBodySize)
+	}
+	return size.Value()
+}
+
+// PodsConfig the logs and the terminals of the pods, the callers are restricted to the namespaces of their projects.
+// The callers' permissions of pods/log and pods/exec are checked by the SubjectAccessReviews as well if Authorize is
+// true, the user is read from the header set by the authenticating proxy like the projects.
+type PodsConfig struct {
+	Authorize bool `koanf:"authorize" yaml:"authorize"`
+	// Shell the command run by the terminals while it isn't specified, e.g. [/bin/bash]
+	Shell []string `koanf:"shell" yaml:"shell"`
+}
+
+// ConsoleConfig the web console served by the api server, the paths other than /api are answered with its assets.
+// The assets are embedded while the binary is built with them, the ones in Dir take precedence over them.
+type ConsoleConfig struct {
+	Enabled bool   `koanf:"enabled" yaml:"enabled"`
+	Dir     string `koanf:"dir" yaml:"dir"`
+}
+
+// ControllerManagerConfig the settings only used by the cm binary
+type ControllerManagerConfig struct {
+	LeaderElection         *LeaderElectionConfig `koanf:"leaderElection" yaml:"leaderElection"`
+	HealthProbeBindAddress string                `koanf:"healthProbeBindAddress" yaml:"healthProbeBindAddress"`
+	Webhook                *WebhookConfig        `koanf:"webhook" yaml:"webhook"`
 }
 
 type ServerConfig struct {
-	ApplicationName    string              `koanf:"applicationName"`
-	LogSetting         *LogConfig          `koanf:"logConfig"`
-	Http               *HttpSetting        `koanf:"http" yaml:"http"`
-	KubeConfig         string              `koanf:"kubeConfig"`
-	StorageClassConfig *StorageClassConfig `koanf:"storeClass"`
+	ApplicationName   string                   `koanf:"applicationName"`
+	LogSetting        *LogConfig               `koanf:"logConfig"`
+	Http              *HttpSetting             `koanf:"http" yaml:"http"`
+	KubeConfig        string                   `koanf:"kubeConfig"`
+	Metrics           *MetricsConfig           `koanf:"metrics" yaml:"metrics"`
+	Audit             *AuditConfig             `koanf:"audit" yaml:"audit"`
+	MultiCluster      *MultiClusterConfig      `koanf:"multiCluster" yaml:"multiCluster"`
+	Project           *ProjectConfig           `koanf:"project" yaml:"project"`
+	OpenApi           *OpenApiConfig           `koanf:"openApi" yaml:"openApi"`
+	I18n              *I18nConfig              `koanf:"i18n" yaml:"i18n"`
+	Tracing           *TracingConfig           `koanf:"tracing" yaml:"tracing"`
+	Limits            *LimitsConfig            `koanf:"limits" yaml:"limits"`
+	Console           *ConsoleConfig           `koanf:"console" yaml:"console"`
+	Pods              *PodsConfig              `koanf:"pods" yaml:"pods"`
+	ControllerManager *ControllerManagerConfig `koanf:"controllerManager" yaml:"controllerManager"`
+}
+
+// MetricsBindAddress returns the bind address of the metrics server, the server is disabled if it's not configured
+func (s ServerConfig) MetricsBindAddress() string {
+	if s.Metrics == nil || s.Metrics.BindAddress == "" {
+		return "0"
+	}
+	return s.Metrics.BindAddress
+}
+
+// UserHeaders returns the headers of the user set by the authenticating proxy, which are read by the audit and the
+// projects
+func (s ServerConfig) UserHeaders() []string {
+	auditHeader, projectHeader := constants.DefaultUserHeader, constants.DefaultUserHeader
+	if s.Audit != nil && s.Audit.UserHeader != "" {
+		auditHeader = s.Audit.UserHeader
+	}
+	if s.Project != nil && s.Project.UserHeader != "" {
+		projectHeader = s.Project.UserHeader
+	}
+	if auditHeader == projectHeader {
+		return []string{auditHeader}
+	}
+	return []string{auditHeader, projectHeader}
 }
 
 func (s ServerConfig) GetServerConfig() *ServerConfig {
 	return &s
 }
 
-func (s ServerConfig) Validate() error {
+// Complete fills the defaults of the settings which are reloaded at runtime and the lifecycle of the server
+func (s *ServerConfig) Complete() error {
+	if s.Http != nil {
+		if s.Http.CacheSyncTimeout == 0 {
+			s.Http.CacheSyncTimeout = constants.DefaultCacheSyncTimeout
+		}
+		if s.Http.ShutdownDelay == 0 {
+			s.Http.ShutdownDelay = constants.DefaultShutdownDelay
+		}
+		if s.Http.ShutdownTimeout == 0 {
+			s.Http.ShutdownTimeout = constants.DefaultShutdownTimeout
+		}
+		if cors := s.Http.Cors; cors != nil {
+			if len(cors.AllowedMethods) == 0 {
+				cors.AllowedMethods = constants.DefaultCorsMethods
+			}
+			if len(cors.AllowedHeaders) == 0 {
+				cors.AllowedHeaders = constants.DefaultCorsHeaders
+			}
+			if len(cors.ExposedHeaders) == 0 {
+				cors.ExposedHeaders = constants.DefaultCorsExposedHeaders
+			}
+		}
+	}
+
+	if s.LogSetting == nil {
+		s.LogSetting = &LogConfig{}
+	}
+	s.LogSetting.LogLevel = strings.ToUpper(s.LogSetting.LogLevel)
+	if s.LogSetting.LogLevel == "" {
+		s.LogSetting.LogLevel = constants.DefaultLogLevel
+	}
+
+	if s.Limits == nil {
+		s.Limits = &LimitsConfig{}
+	}
+	if len(s.Limits.PageSizes) == 0 {
+		s.Limits.PageSizes = constants.AvailablePageSizes
+	}
+	if s.Limits.UploadTimeout == 0 {
+		s.Limits.UploadTimeout = constants.DefaultUploadTimeout
+	}
+	if s.Limits.MaxBodySize == "" {
+		s.Limits.MaxBodySize = constants.DefaultMaxBodySize
+	}
+	for group, limit := range s.Limits.RateLimits {
+		// the requests are rejected by a bucket without any token
+		if limit.Rate > 0 && limit.Burst == 0 {
+			limit.Burst = int(math.Ceil(limit.Rate))
+			s.Limits.RateLimits[group] = limit
+		}
+	}
 	return nil
 }
 
-func (s ServerConfig) Complete() error {
+// Validate checks the settings, the invalid ones are reported all together
+func (s *ServerConfig) Validate() error {
+	var errs field.ErrorList
+	if s.ApplicationName == "" {
+		errs = append(errs, field.Required(field.NewPath("applicationName"), ""))
+	}
+	if s.Http != nil && (s.Http.Port == 0 || s.Http.Port > 65535) {
+		errs = append(errs, field.Invalid(field.NewPath("http", "port"), s.Http.Port, "must be between 1 and 65535"))
+	}
+	if s.Http != nil {
+		path := field.NewPath("http")
+		errs = append(errs, validateDuration(path.Child("cacheSyncTimeout"), s.Http.CacheSyncTimeout)...)
+		errs = append(errs, validateDuration(path.Child("shutdownDelay"), s.Http.ShutdownDelay)...)
+		errs = append(errs, validateDuration(path.Child("shutdownTimeout"), s.Http.ShutdownTimeout)...)
+		if s.Http.Tls != nil && s.Http.Tls.Enabled {
+			errs = append(errs, validateTls(path.Child("tls"), s.Http.Tls)...)
+		}
+		if s.Http.Cors != nil && s.Http.Cors.Enabled {
+			errs = append(errs, validateCors(path.Child("cors"), s.Http.Cors)...)
+		}
+	}
+	if s.LogSetting != nil {
+		path := field.NewPath("logConfig")
+		if _, err := zapcore.ParseLevel(s.LogSetting.LogLevel); err != nil {
+			errs = append(errs, field.NotSupported(path.Child("logLevel"), s.LogSetting.LogLevel,
+				[]string{"DEBUG", "INFO", "WARN", "ERROR", "DPANIC", "PANIC", "FATAL"}))
+		}
+		errs = append(errs, validateDir(path.Child("logPath"), s.LogSetting.LogPath)...)
+	}
+	if s.Metrics != nil && s.Metrics.BindAddress != "0" {
+		errs = append(errs, validateAddress(field.NewPath("metrics", "bindAddress"), s.Metrics.BindAddress)...)
+	}
+	// the in-cluster config is used while the kubeconfig is empty
+	errs = append(errs, validateFile(field.NewPath("kubeConfig"), s.KubeConfig)...)
+	if s.MultiCluster != nil {
+		for i, cluster := range s.MultiCluster.Clusters {
+			path := field.NewPath("multiCluster", "clusters").Index(i)
+			if cluster.Name == "" {
+				errs = append(errs, field.Required(path.Child("name"), ""))
+			}
+			if cluster.KubeConfig == "" {
+				errs = append(errs, field.Required(path.Child("kubeConfig"), ""))
+			}
+			errs = append(errs, validateFile(path.Child("kubeConfig"), cluster.KubeConfig)...)
+		}
+	}
+	if s.Audit != nil && s.Audit.Enabled {
+		path := field.NewPath("audit")
+		if s.Audit.File != nil && s.Audit.File.Enabled && s.Audit.File.FileName == "" {
+			errs = append(errs, field.Required(path.Child("file", "fileName"), ""))
+		}
+		if s.Audit.Webhook != nil && s.Audit.Webhook.Enabled {
+			errs = append(errs, validateUrl(path.Child("webhook", "url"), s.Audit.Webhook.Url)...)
+		}
+	}
+	if s.OpenApi != nil {
+		errs = append(errs, validateDir(field.NewPath("openApi", "swaggerUiDir"), s.OpenApi.SwaggerUiDir)...)
+	}
+	if s.Console != nil && s.Console.Enabled {
+		errs = append(errs, validateDir(field.NewPath("console", "dir"), s.Console.Dir)...)
+	}
+	if s.I18n != nil {
+		errs = append(errs, validateDir(field.NewPath("i18n", "bundleDir"), s.I18n.BundleDir)...)
+	}
+	if s.Tracing != nil && s.Tracing.Enabled {
+		path := field.NewPath("tracing")
+		errs = append(errs, validateUrl(path.Child("endpoint"), s.Tracing.Endpoint)...)
+		if s.Tracing.SampleRatio < 0 || s.Tracing.SampleRatio > 1 {
+			errs = append(errs, field.Invalid(path.Child("sampleRatio"), s.Tracing.SampleRatio, "must be between 0 and 1"))
+		}
+	}
+	if s.Limits != nil {
+		path := field.NewPath("limits")
+		for i, size := range s.Limits.PageSizes {
+			if size <= 0 {
+				errs = append(errs, field.Invalid(path.Child("pageSizes").Index(i), size, "must be positive"))
+			}
+		}
+		errs = append(errs, validateDuration(path.Child("uploadTimeout"), s.Limits.UploadTimeout)...)
+		if s.Limits.MaxConcurrentUploads < 0 {
+			errs = append(errs, field.Invalid(path.Child("maxConcurrentUploads"), s.Limits.MaxConcurrentUploads,
+				"must not be negative"))
+		}
+		if size, err := resource.ParseQuantity(s.Limits.MaxBodySize); s.Limits.MaxBodySize != "" &&
+			(err != nil || size.Sign() <= 0) {
+			errs = append(errs, field.Invalid(path.Child("maxBodySize"), s.Limits.MaxBodySize, "must be a positive quantity"))
+		}
+		for group, limit := range s.Limits.RateLimits {
+			groupPath := path.Child("rateLimits").Key(group)
+			if !slices.Contains(constants.RateLimitGroups, group) {
+				errs = append(errs, field.NotSupported(groupPath, group, constants.RateLimitGroups))
+			}
+			if limit.Rate < 0 {
+				errs = append(errs, field.Invalid(groupPath.Child("rate"), limit.Rate, "must not be negative"))
+			}
+			if limit.Burst < 0 {
+				errs = append(errs, field.Invalid(groupPath.Child("burst"), limit.Burst, "must not be negative"))
+			}
+		}
+	}
+	if cm := s.ControllerManager; cm != nil {
+		path := field.NewPath("controllerManager")
+		if cm.HealthProbeBindAddress != "0" {
+			errs = append(errs, validateAddress(path.Child("healthProbeBindAddress"), cm.HealthProbeBindAddress)...)
+		}
+		if cm.Webhook != nil && cm.Webhook.Enabled && (cm.Webhook.Port <= 0 || cm.Webhook.Port > 65535) {
+			errs = append(errs, field.Invalid(path.Child("webhook", "port"), cm.Webhook.Port, "must be between 1 and 65535"))
+		}
+		if le := cm.LeaderElection; le != nil && le.Enabled && le.LeaseDuration > 0 && le.RenewDeadline >= le.LeaseDuration {
+			errs = append(errs, field.Invalid(path.Child("leaderElection", "renewDeadline"), le.RenewDeadline.String(),
+				"must be less than the lease duration"))
+		}
+	}
+	return errs.ToAggregate()
+}
+
+// Reload returns a copy of the config with the settings reloadable at runtime taken from the reloaded one, i.e. the
+// log level and the limits. The other settings take effect after restarting.
+func (s *ServerConfig) Reload(reloaded *ServerConfig) *ServerConfig {
+	config := *s
+	if s.LogSetting != nil && reloaded.LogSetting != nil {
+		logSetting := *s.LogSetting
+		logSetting.LogLevel = reloaded.LogSetting.LogLevel
+		config.LogSetting = &logSetting
+	}
+	config.Limits = reloaded.Limits
+	return &config
+}
+
+// validateFile checks the file exists if it's set
+func validateFile(path *field.Path, file string) field.ErrorList {
+	if file == "" {
+		return nil
+	}
+	if _, err := utils.IsFileExists(file); err != nil {
+		return field.ErrorList{field.Invalid(path, file, err.Error())}
+	}
+	return nil
+}
+
+// validateTls checks the certificate is configured with its key, and the versions and cipher suites are supported
+func validateTls(path *field.Path, t *TlsConfig) field.ErrorList {
+	var errs field.ErrorList
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		errs = append(errs, field.Required(path.Child("certFile"), "certFile and keyFile must be set together"))
+	}
+	errs = append(errs, validateFile(path.Child("certFile"), t.CertFile)...)
+	errs = append(errs, validateFile(path.Child("keyFile"), t.KeyFile)...)
+	if _, err := t.TlsMinVersion(); err != nil {
+		errs = append(errs, field.NotSupported(path.Child("minVersion"), t.MinVersion, []string{"1.2", "1.3"}))
+	}
+	if _, err := t.CipherSuiteIDs(); err != nil {
+		errs = append(errs, field.Invalid(path.Child("cipherSuites"), t.CipherSuites, err.Error()))
+	}
+	if t.ClientAuth != nil && t.ClientAuth.Enabled {
+		if t.ClientAuth.CaFile == "" {
+			errs = append(errs, field.Required(path.Child("clientAuth", "caFile"), ""))
+		}
+		errs = append(errs, validateFile(path.Child("clientAuth", "caFile"), t.ClientAuth.CaFile)...)
+	}
+	return errs
+}
+
+// validateDuration checks the duration isn't negative, zero means the default
+func validateDuration(path *field.Path, duration time.Duration) field.ErrorList {
+	if duration < 0 {
+		return field.ErrorList{field.Invalid(path, duration.String(), "must not be negative")}
+	}
+	return nil
+}
+
+// validateDir checks the directory exists if it's set
+func validateDir(path *field.Path, dir string) field.ErrorList {
+	if dir == "" {
+		return nil
+	}
+	if _, err := utils.IsDirExists(dir); err != nil {
+		return field.ErrorList{field.Invalid(path, dir, err.Error())}
+	}
+	return nil
+}
+
+// validateAddress checks the address is host:port if it's set
+func validateAddress(path *field.Path, address string) field.ErrorList {
+	if address == "" {
+		return nil
+	}
+	_, port, err := net.SplitHostPort(address)
+	if err == nil {
+		_, err = strconv.ParseUint(port, 10, 16)
+	}
+	if err != nil {
+		return field.ErrorList{field.Invalid(path, address, "must be host:port")}
+	}
+	return nil
+}
+
+// validateUrl checks the url is absolute
+func validateCors(path *field.Path, cors *CorsConfig) field.ErrorList {
+	var errs field.ErrorList
+	if len(cors.AllowedOrigins) == 0 {
+		errs = append(errs, field.Required(path.Child("allowedOrigins"), ""))
+	}
+	for i, origin := range cors.AllowedOrigins {
+		if origin == "*" {
+			if cors.AllowCredentials {
+				errs = append(errs, field.Invalid(path.Child("allowedOrigins").Index(i), origin,
+					"must be explicit while the credentials are allowed"))
+			}
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			errs = append(errs, field.Invalid(path.Child("allowedOrigins").Index(i), origin,
+				"must be a scheme and a host, e.g. https://console.example.com"))
+		}
+	}
+	return append(errs, validateDuration(path.Child("maxAge"), cors.MaxAge)...)
+}
+
+func validateUrl(path *field.Path, rawUrl string) field.ErrorList {
+	if rawUrl == "" {
+		return field.ErrorList{field.Required(path, "")}
+	}
+	if u, err := url.Parse(rawUrl); err != nil || u.Scheme == "" || u.Host == "" {
+		return field.ErrorList{field.Invalid(path, rawUrl, "must be an absolute url")}
+	}
 	return nil
 }
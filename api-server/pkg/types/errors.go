@@ -0,0 +1,138 @@
+package types
+
+import (
+	"context"
+	"errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"net/http"
+	"strings"
+)
+
+// reasonCodes maps the reasons of the kubernetes api errors to the error codes
+var reasonCodes = map[metav1.StatusReason]constants.ErrorCode{
+	metav1.StatusReasonNotFound:           constants.CodeNotFound,
+	metav1.StatusReasonAlreadyExists:      constants.CodeAlreadyExists,
+	metav1.StatusReasonConflict:           constants.CodeConflict,
+	metav1.StatusReasonInvalid:            constants.CodeInvalid,
+	metav1.StatusReasonForbidden:          constants.CodeForbidden,
+	metav1.StatusReasonUnauthorized:       constants.CodeUnauthorized,
+	metav1.StatusReasonBadRequest:         constants.CodeBadRequest,
+	metav1.StatusReasonTimeout:            constants.CodeTimeout,
+	metav1.StatusReasonServerTimeout:      constants.CodeTimeout,
+	metav1.StatusReasonTooManyRequests:    constants.CodeTooManyRequests,
+	metav1.StatusReasonServiceUnavailable: constants.CodeServiceUnavailable,
+}
+
+// statusCodes maps the status codes of the results without error codes, e.g. FailWithStatusCode(404), to the error codes
+var statusCodes = map[int]constants.ErrorCode{
+	http.StatusBadRequest:         constants.CodeBadRequest,
+	http.StatusUnauthorized:       constants.CodeUnauthorized,
+	http.StatusForbidden:          constants.CodeForbidden,
+	http.StatusNotFound:           constants.CodeNotFound,
+	http.StatusConflict:           constants.CodeConflict,
+	http.StatusTooManyRequests:    constants.CodeTooManyRequests,
+	http.StatusServiceUnavailable: constants.CodeServiceUnavailable,
+	http.StatusGatewayTimeout:     constants.CodeTimeout,
+}
+
+// ToResult translates the error into the body responded to the client, the status code is overridden by statusCode
+// if it's set. The errors of the kubernetes api are mapped by their reasons and causes and keep their status codes,
+// the bodies exceeding the size limit are 413, the other errors and the results without error codes are mapped by the
+// status codes, and the request id is attached to all of them.
+func ToResult(ctx context.Context, err error, statusCode int) *Result {
+	result := *Fail(err)
+	var statusErr k8serrors.APIStatus
+	var maxBytesErr *http.MaxBytesError
+	if result.cause != nil && errors.As(result.cause, &statusErr) {
+		payload := result.Payload
+		result = *fromStatus(ctx, statusErr.Status())
+		result.Payload = payload
+	} else if result.cause != nil && errors.As(result.cause, &maxBytesErr) {
+		// the body is cut off by the size limit while it's read
+		result = *FailWithErrorCode(ctx, constants.CodeRequestTooLarge,
+			map[string]string{"limit": resource.NewQuantity(maxBytesErr.Limit, resource.BinarySI).String()})
+		result.StatusCode = http.StatusRequestEntityTooLarge
+	} else {
+		if statusCode > 0 {
+			result.StatusCode = statusCode
+		}
+		if result.StatusCode == 0 {
+			result.StatusCode = http.StatusBadRequest
+		}
+		if result.ErrorCode == "" || result.cause != nil {
+			message := http.StatusText(result.StatusCode)
+			if result.cause != nil {
+				message = result.cause.Error()
+			}
+			result.ErrorCode = codeOf(result.StatusCode)
+			result.Message = GetI18nMessage(ctx, result.ErrorCode, map[string]string{"name": nameOf(ctx), "error": message})
+		}
+	}
+
+	if ginCtx, ok := GinContext(ctx); ok {
+		result.RequestId = ginCtx.GetString(constants.RequestIdKey)
+	}
+	return &result
+}
+
+// codeOf returns the error code of the status code, the client errors without specific codes are bad requests
+func codeOf(statusCode int) constants.ErrorCode {
+	if code, ok := statusCodes[statusCode]; ok {
+		return code
+	}
+	if statusCode < http.StatusInternalServerError {
+		return constants.CodeBadRequest
+	}
+	return constants.CodeInternalError
+}
+
+// fromStatus maps the status of a kubernetes api error, the causes with fields are returned as the field errors
+func fromStatus(ctx context.Context, status metav1.Status) *Result {
+	statusCode := int(status.Code)
+	if statusCode == 0 {
+		statusCode = http.StatusInternalServerError
+	}
+	code, ok := reasonCodes[status.Reason]
+	if !ok {
+		code = codeOf(statusCode)
+	}
+
+	name := nameOf(ctx)
+	var fieldErrors map[string]string
+	if details := status.Details; details != nil {
+		if details.Name != "" {
+			name = strings.TrimSpace(details.Kind + " " + details.Name)
+		}
+		for _, cause := range details.Causes {
+			if cause.Field == "" {
+				continue
+			}
+			if fieldErrors == nil {
+				fieldErrors = map[string]string{}
+			}
+			if message, ok := fieldErrors[cause.Field]; ok {
+				fieldErrors[cause.Field] = message + "; " + cause.Message
+				continue
+			}
+			fieldErrors[cause.Field] = cause.Message
+		}
+	}
+
+	return &Result{
+		ErrorCode:   code,
+		Message:     GetI18nMessage(ctx, code, map[string]string{"name": name, "error": status.Message}),
+		FieldErrors: fieldErrors,
+		StatusCode:  statusCode,
+	}
+}
+
+// nameOf returns the name param of the request
+func nameOf(ctx context.Context) string {
+	if ginCtx, ok := GinContext(ctx); ok {
+		return ginCtx.Param("name")
+	}
+	return ""
+}
@@ -0,0 +1,130 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	ginI18n "github.com/gin-contrib/i18n"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newContext returns the context of a request whose messages are the error codes followed by the name param
+func newContext() *gin.Context {
+	messages := map[string]string{}
+	for _, code := range []constants.ErrorCode{constants.CodeNotFound, constants.CodeInvalid, constants.CodeConflict,
+		constants.CodeBadRequest, constants.CodeInternalError} {
+		messages[string(code)] = string(code) + " {{ .name }}"
+	}
+	bundle, _ := json.Marshal(messages)
+
+	gin.SetMode(gin.TestMode)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	ginI18n.Localize(ginI18n.WithBundle(&ginI18n.BundleCfg{
+		DefaultLanguage:  language.English,
+		AcceptLanguage:   []language.Tag{language.English},
+		FormatBundleFile: "json",
+		RootPath:         "/",
+		UnmarshalFunc:    json.Unmarshal,
+		Loader:           ginI18n.LoaderFunc(func(string) ([]byte, error) { return bundle, nil }),
+	}))(ctx)
+	ctx.Set(constants.RequestIdKey, "req-1")
+	return ctx
+}
+
+func TestToResult(t *testing.T) {
+	gr := schema.GroupResource{Group: "kubevirt.io", Resource: "virtualmachines"}
+	tests := []struct {
+		name        string
+		err         error
+		statusCode  int
+		code        constants.ErrorCode
+		httpCode    int
+		message     string
+		fieldErrors map[string]string
+	}{
+		{
+			name:     "not found",
+			err:      k8serrors.NewNotFound(gr, "vm1"),
+			code:     constants.CodeNotFound,
+			httpCode: http.StatusNotFound,
+			message:  "ERROR.NOT_FOUND virtualmachines vm1",
+		},
+		{
+			name:       "the status of the kubernetes errors is kept",
+			err:        fmt.Errorf("failed to update: %w", k8serrors.NewConflict(gr, "vm1", errors.New("modified"))),
+			statusCode: http.StatusBadRequest,
+			code:       constants.CodeConflict,
+			httpCode:   http.StatusConflict,
+			message:    "ERROR.CONFLICT virtualmachines vm1",
+		},
+		{
+			name: "invalid",
+			err: k8serrors.NewInvalid(schema.GroupKind{Group: "kubevirt.io", Kind: "VirtualMachine"}, "vm1", field.ErrorList{
+				field.Required(field.NewPath("spec", "template"), ""),
+				field.Invalid(field.NewPath("spec", "running"), "x", "not a bool"),
+				field.Invalid(field.NewPath("spec", "running"), "x", "conflicts with runStrategy"),
+			}),
+			code:     constants.CodeInvalid,
+			httpCode: http.StatusUnprocessableEntity,
+			message:  "ERROR.INVALID VirtualMachine vm1",
+			fieldErrors: map[string]string{
+				"spec.template": "Required value",
+				"spec.running":  "Invalid value: \"x\": not a bool; Invalid value: \"x\": conflicts with runStrategy",
+			},
+		},
+		{
+			name:       "plain error of a bad request",
+			err:        errors.New("invalid json"),
+			statusCode: http.StatusBadRequest,
+			code:       constants.CodeBadRequest,
+			httpCode:   http.StatusBadRequest,
+			message:    "ERROR.BAD_REQUEST ",
+		},
+		{
+			name:     "plain error",
+			err:      errors.New("boom"),
+			code:     constants.CodeInternalError,
+			httpCode: http.StatusInternalServerError,
+			message:  "ERROR.INTERNAL ",
+		},
+		{
+			name:     "result without error code",
+			err:      FailWithStatusCode(http.StatusNotFound),
+			code:     constants.CodeNotFound,
+			httpCode: http.StatusNotFound,
+			message:  "ERROR.NOT_FOUND ",
+		},
+		{
+			name:     "result with error code",
+			err:      &Result{ErrorCode: constants.CodeImageInUse, Message: "in use", StatusCode: http.StatusConflict},
+			code:     constants.CodeImageInUse,
+			httpCode: http.StatusConflict,
+			message:  "in use",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ToResult(newContext(), tt.err, tt.statusCode)
+			if result.ErrorCode != tt.code || result.StatusCode != tt.httpCode || result.Message != tt.message {
+				t.Errorf("got %s %d %q, want %s %d %q", result.ErrorCode, result.StatusCode, result.Message,
+					tt.code, tt.httpCode, tt.message)
+			}
+			if fmt.Sprint(result.FieldErrors) != fmt.Sprint(tt.fieldErrors) {
+				t.Errorf("got field errors %v, want %v", result.FieldErrors, tt.fieldErrors)
+			}
+			if result.RequestId != "req-1" {
+				t.Errorf("got request id %q", result.RequestId)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package types
+
+import "time"
+
+// ResourceEvent an event of a resource or its children, e.g. the vmi and the virt-launcher pods of a vm. The events of
+// core/v1 and events.k8s.io/v1 are normalized to it.
+type ResourceEvent struct {
+	Uid     string         `json:"uid"`
+	Type    string         `json:"type"`
+	Reason  string         `json:"reason"`
+	Message string         `json:"message"`
+	Object  EventObjectRef `json:"object"`
+	// Count the times the event is observed, the identical events of the same object are merged
+	Count          int32     `json:"count"`
+	FirstTimestamp time.Time `json:"firstTimestamp"`
+	LastTimestamp  time.Time `json:"lastTimestamp"`
+	// Source the controller or the component reporting the event
+	Source string `json:"source,omitempty"`
+}
+
+// EventObjectRef the object which the event is about
+type EventObjectRef struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+// EventQuery filters the events of a resource, the events changed later are streamed as the server-sent events if
+// Watch is true
+type EventQuery struct {
+	Type  string `form:"type" binding:"omitempty,oneof=Normal Warning"`
+	Watch bool   `form:"watch"`
+}
+
+// WatchedEvent an event added or modified while watching, Type is added or modified
+type WatchedEvent struct {
+	Type  string        `json:"type"`
+	Event ResourceEvent `json:"event"`
+}
@@ -0,0 +1,19 @@
+package types
+
+// ImageUsage lists the consumers of an image, the image can't be deleted while it's in use unless it's forced
+type ImageUsage struct {
+	Namespace        string          `json:"namespace"`
+	Name             string          `json:"name"`
+	StorageClassName string          `json:"storageClassName"`
+	BackingImageName string          `json:"backingImageName"`
+	InUse            bool            `json:"inUse"`
+	Consumers        []ImageConsumer `json:"consumers"`
+}
+
+// ImageConsumer is a pvc provisioned from the image, VmName is empty if it isn't used by any vm
+type ImageConsumer struct {
+	Namespace  string `json:"namespace"`
+	PvcName    string `json:"pvcName"`
+	VolumeName string `json:"volumeName,omitempty"`
+	VmName     string `json:"vmName,omitempty"`
+}
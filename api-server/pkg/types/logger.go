@@ -0,0 +1,9 @@
+package types
+
+// LoggerLevel the level of a logger, the named loggers follow the level of the root logger unless their levels are set
+type LoggerLevel struct {
+	Name  string `json:"name"`
+	Level string `json:"level"`
+	// Inherited the level is the root logger's
+	Inherited bool `json:"inherited,omitempty"`
+}
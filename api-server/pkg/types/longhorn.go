@@ -0,0 +1,25 @@
+package types
+
+import (
+	lhv1beta2 "kubeall.io/api-server/pkg/generated/longhorn/apis/longhorn/v1beta2"
+)
+
+// SupportBundleRequest creates a longhorn support bundle
+type SupportBundleRequest struct {
+	// the node used to generate the bundle, longhorn chooses one if it's empty
+	NodeID      string `json:"nodeID"`
+	IssueURL    string `json:"issueURL"`
+	Description string `json:"description" binding:"required"`
+}
+
+// SystemBackupRequest creates a longhorn system backup
+type SystemBackupRequest struct {
+	Name               string                                         `json:"name" binding:"required"`
+	VolumeBackupPolicy lhv1beta2.SystemBackupCreateVolumeBackupPolicy `json:"volumeBackupPolicy" binding:"omitempty,oneof=always disabled if-not-present"`
+}
+
+// SystemRestoreRequest restores the longhorn system from an existing system backup
+type SystemRestoreRequest struct {
+	Name         string `json:"name" binding:"required"`
+	SystemBackup string `json:"systemBackup" binding:"required"`
+}
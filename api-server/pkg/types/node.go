@@ -0,0 +1,79 @@
+package types
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NodeView joins the kubernetes node, the longhorn node and the vm instances running on it
+type NodeView struct {
+	Name              string                    `json:"name"`
+	Labels            map[string]string         `json:"labels,omitempty"`
+	CreationTimestamp metav1.Time               `json:"creationTimestamp"`
+	Ready             bool                      `json:"ready"`
+	Unschedulable     bool                      `json:"unschedulable"`
+	Roles             []string                  `json:"roles,omitempty"`
+	Addresses         []corev1.NodeAddress      `json:"addresses,omitempty"`
+	Capacity          corev1.ResourceList       `json:"capacity,omitempty"`
+	Allocatable       corev1.ResourceList       `json:"allocatable,omitempty"`
+	NodeInfo          corev1.NodeSystemInfo     `json:"nodeInfo"`
+	Storage           *NodeStorageView          `json:"storage,omitempty"`
+	VmInstances       []NodeVmInstanceReference `json:"vmInstances"`
+}
+
+// NodeStorageView is the longhorn part of a node, it's nil if longhorn isn't deployed on the node
+type NodeStorageView struct {
+	AllowScheduling   bool       `json:"allowScheduling"`
+	EvictionRequested bool       `json:"evictionRequested"`
+	AutoEvicting      bool       `json:"autoEvicting"`
+	Ready             bool       `json:"ready"`
+	Schedulable       bool       `json:"schedulable"`
+	Tags              []string   `json:"tags"`
+	Region            string     `json:"region,omitempty"`
+	Zone              string     `json:"zone,omitempty"`
+	StorageMaximum    int64      `json:"storageMaximum"`
+	StorageAvailable  int64      `json:"storageAvailable"`
+	StorageScheduled  int64      `json:"storageScheduled"`
+	StorageReserved   int64      `json:"storageReserved"`
+	Disks             []DiskView `json:"disks"`
+}
+
+// DiskView describes a longhorn disk attached to a node
+type DiskView struct {
+	Name              string   `json:"name"`
+	Path              string   `json:"path"`
+	DiskType          string   `json:"diskType,omitempty"`
+	AllowScheduling   bool     `json:"allowScheduling"`
+	EvictionRequested bool     `json:"evictionRequested"`
+	Ready             bool     `json:"ready"`
+	Schedulable       bool     `json:"schedulable"`
+	Tags              []string `json:"tags"`
+	StorageMaximum    int64    `json:"storageMaximum"`
+	StorageAvailable  int64    `json:"storageAvailable"`
+	StorageScheduled  int64    `json:"storageScheduled"`
+	StorageReserved   int64    `json:"storageReserved"`
+	ReplicaCount      int      `json:"replicaCount"`
+}
+
+type NodeVmInstanceReference struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Phase     string `json:"phase"`
+}
+
+// SchedulingRequest toggles the longhorn scheduling of a node's disk
+type SchedulingRequest struct {
+	AllowScheduling *bool `json:"allowScheduling" binding:"required"`
+}
+
+// TagsRequest replaces the tags of a longhorn node or disk
+type TagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// EvictionRequest requests longhorn to evict the replicas from a node or one of its disks.
+// The scheduling is disabled as well while eviction is requested, otherwise longhorn refuses to evict the replicas.
+type EvictionRequest struct {
+	Disk              string `json:"disk,omitempty"`
+	EvictionRequested *bool  `json:"evictionRequested" binding:"required"`
+}
@@ -0,0 +1,52 @@
+package types
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"time"
+)
+
+// PodLogQuery selects the logs of a container of the pod, the logs are streamed until the container stops if Follow
+// is true
+type PodLogQuery struct {
+	// Container can be omitted if the pod has only one container
+	Container  string     `form:"container"`
+	Follow     bool       `form:"follow"`
+	TailLines  *int64     `form:"tailLines" binding:"omitempty,min=0"`
+	SinceTime  *time.Time `form:"sinceTime" time_format:"2006-01-02T15:04:05Z07:00"`
+	Previous   bool       `form:"previous"`
+	Timestamps bool       `form:"timestamps"`
+}
+
+// LogOptions returns the options of the pods/log subresource
+func (q PodLogQuery) LogOptions() *corev1.PodLogOptions {
+	options := &corev1.PodLogOptions{
+		Container:  q.Container,
+		Follow:     q.Follow,
+		TailLines:  q.TailLines,
+		Previous:   q.Previous,
+		Timestamps: q.Timestamps,
+	}
+	if q.SinceTime != nil {
+		options.SinceTime = &metav1.Time{Time: *q.SinceTime}
+	}
+	return options
+}
+
+// PodExecQuery the command run in a container of the pod, the shell of the config is run if the command is omitted
+type PodExecQuery struct {
+	Container string   `form:"container"`
+	Command   []string `form:"command"`
+	// Tty allocates a terminal, the stderr is merged into the stdout then
+	Tty *bool `form:"tty"`
+}
+
+// TerminalMessage the messages of the exec websocket sent by the console, the output of the command is sent back as
+// binary messages
+type TerminalMessage struct {
+	// Type is stdin, resize, or exit which is sent by the server once the command exits
+	Type string `json:"type"`
+	Data string `json:"data,omitempty"`
+	Cols uint16 `json:"cols,omitempty"`
+	Rows uint16 `json:"rows,omitempty"`
+}
@@ -0,0 +1,41 @@
+package types
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	kav1 "kubeall.io/api-server/pkg/generated/kubeall.io/v1"
+)
+
+// ProjectResources the resources limited by the quota of a project
+type ProjectResources struct {
+	Vms     int32             `json:"vms"`
+	Cpu     int32             `json:"cpu"`
+	Memory  resource.Quantity `json:"memory"`
+	Storage resource.Quantity `json:"storage"`
+	Images  int32             `json:"images"`
+}
+
+// Add adds the other resources to the resources
+func (r *ProjectResources) Add(other ProjectResources) {
+	r.Vms += other.Vms
+	r.Cpu += other.Cpu
+	r.Memory.Add(other.Memory)
+	r.Storage.Add(other.Storage)
+	r.Images += other.Images
+}
+
+// Sub subtracts the other resources from the resources
+func (r *ProjectResources) Sub(other ProjectResources) {
+	r.Vms -= other.Vms
+	r.Cpu -= other.Cpu
+	r.Memory.Sub(other.Memory)
+	r.Storage.Sub(other.Storage)
+	r.Images -= other.Images
+}
+
+// ProjectUsage the resources used in the namespaces of the project and its quota
+type ProjectUsage struct {
+	Name       string            `json:"name"`
+	Namespaces []string          `json:"namespaces"`
+	Quota      kav1.ProjectQuota `json:"quota"`
+	Used       ProjectResources  `json:"used"`
+}
@@ -0,0 +1,40 @@
+package types
+
+const (
+	// the edges point from the consumers to their dependencies
+	RelationOwns          = "owns"
+	RelationMounts        = "mounts"
+	RelationExposedBy     = "exposedBy"
+	RelationBoundTo       = "boundTo"
+	RelationProvisionedBy = "provisionedBy"
+	RelationBackedBy      = "backedBy"
+	RelationBackingImage  = "backingImage"
+	RelationCreatedFrom   = "createdFrom"
+)
+
+// RelatedGraph the topology of a resource, e.g. a vm with its vmi, virt-launcher pods, services, pvcs, pvs, longhorn
+// volumes, storage classes, backing images and images. Truncated is true if the nodes exceed the limit.
+type RelatedGraph struct {
+	Root      string        `json:"root"`
+	Nodes     []RelatedNode `json:"nodes"`
+	Edges     []RelatedEdge `json:"edges"`
+	Truncated bool          `json:"truncated,omitempty"`
+}
+
+// RelatedNode a resource of the graph, Id is kind/namespace/name or kind/name of the cluster resources. Missing is true
+// if the resource is referenced but doesn't exist.
+type RelatedNode struct {
+	Id        string `json:"id"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Status    string `json:"status,omitempty"`
+	Missing   bool   `json:"missing,omitempty"`
+}
+
+// RelatedEdge a relation from the consumer Source to the dependency Target, Type is one of the Relation constants
+type RelatedEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Type   string `json:"type"`
+}
@@ -6,6 +6,7 @@ import (
 	ginI18n "github.com/gin-contrib/i18n"
 	"github.com/gin-gonic/gin"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"go.uber.org/zap"
 	"kubeall.io/api-server/pkg/infra/constants"
 	"net/http"
 )
@@ -17,6 +18,10 @@ type Result struct {
 	Message     string              `json:"message,omitempty"`
 	FieldErrors map[string]string   `json:"fieldErrors,omitempty"`
 	StatusCode  int                 `json:"statusCode"`
+	RequestId   string              `json:"requestId,omitempty"`
+
+	// cause the error translated by Fail, ToResult maps it to the error code if it's a kubernetes api error
+	cause error
 }
 
 func (r Result) Error() string {
@@ -29,9 +34,10 @@ func Fail(err error) *Result {
 		return r
 	}
 	return &Result{
-		ErrorCode:  "UNEXPECTED_ERROR",
+		ErrorCode:  constants.CodeInternalError,
 		Message:    err.Error(),
 		StatusCode: http.StatusInternalServerError,
+		cause:      err,
 	}
 }
 
@@ -66,16 +72,26 @@ func IsResult(err error) (bool, *Result) {
 	return errors.As(err, &r), r
 }
 
+// GetI18nMessage localizes the message of the error code in the request's language, the code itself is returned if
+// no bundle has the message
 func GetI18nMessage(ctx context.Context, errorCode constants.ErrorCode, params map[string]string) string {
-	ginCtx := ctx.(*gin.Context)
-	var content string
-	if params != nil {
-		content = ginI18n.MustGetMessage(ginCtx, &i18n.LocalizeConfig{
-			MessageID:    string(errorCode),
-			TemplateData: params,
-		})
-	} else {
-		content = ginI18n.MustGetMessage(ginCtx, errorCode)
+	ginCtx, ok := GinContext(ctx)
+	if !ok {
+		return string(errorCode)
+	}
+	content, err := ginI18n.GetMessage(ginCtx, &i18n.LocalizeConfig{
+		MessageID:    string(errorCode),
+		TemplateData: params,
+	})
+	if err != nil || content == "" {
+		zap.L().Debug("the message isn't localized", zap.String("code", string(errorCode)), zap.Error(err))
+		return string(errorCode)
 	}
 	return content
 }
+
+// GinContext returns the gin context of the request, the context may wrap it, e.g. the context of a span
+func GinContext(ctx context.Context) (*gin.Context, bool) {
+	ginCtx, ok := ctx.Value(gin.ContextKey).(*gin.Context)
+	return ginCtx, ok
+}
@@ -0,0 +1,180 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	kav1 "kubeall.io/api-server/pkg/generated/kubeall.io/v1"
+	"kubeall.io/api-server/pkg/infra/config"
+	"kubeall.io/api-server/pkg/infra/constants"
+	"net/url"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// +kubebuilder:webhook:path=/mutate-api-kubeall-io-v1-globalsettings,mutating=true,failurePolicy=fail,sideEffects=None,groups=api.kubeall.io,resources=globalsettings,verbs=create;update,versions=v1,name=mglobalsettings.kubeall.io,admissionReviewVersions=v1
+// +kubebuilder:webhook:path=/validate-api-kubeall-io-v1-globalsettings,mutating=false,failurePolicy=fail,sideEffects=None,groups=api.kubeall.io,resources=globalsettings,verbs=create;update,versions=v1,name=vglobalsettings.kubeall.io,admissionReviewVersions=v1
+
+var globalSettingsGroupKind = kav1.GroupVersion.WithKind("GlobalSettings").GroupKind()
+
+// globalSettingsWebhook normalizes the global settings and makes sure there is only one in the cluster, which is
+// named kav1.GlobalSettingsName
+type globalSettingsWebhook struct {
+	watcher config.Watcher
+}
+
+func NewGlobalSettingsWebhook(watcher config.Watcher) Handler {
+	return &globalSettingsWebhook{watcher: watcher}
+}
+
+func (w *globalSettingsWebhook) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&kav1.GlobalSettings{}).
+		WithDefaulter(w).
+		WithValidator(w).
+		Complete()
+}
+
+// Default trims the os types and the upload url, the empty and duplicated os types and image sources are removed
+func (w *globalSettingsWebhook) Default(_ context.Context, obj runtime.Object) error {
+	settings, ok := obj.(*kav1.GlobalSettings)
+	if !ok {
+		return fmt.Errorf("expected a GlobalSettings but got %T", obj)
+	}
+	var osTypes []string
+	seen := map[string]bool{}
+	for _, osType := range settings.Spec.OsTypes {
+		osType = strings.TrimSpace(osType)
+		if osType == "" || seen[osType] {
+			continue
+		}
+		seen[osType] = true
+		osTypes = append(osTypes, osType)
+	}
+	settings.Spec.OsTypes = osTypes
+
+	var sources []kav1.ImageSourceType
+	for _, source := range settings.Spec.AllowedImageSources {
+		if !slices.Contains(sources, source) {
+			sources = append(sources, source)
+		}
+	}
+	settings.Spec.AllowedImageSources = sources
+	settings.Spec.LonghornUploadUrl = strings.TrimRight(strings.TrimSpace(settings.Spec.LonghornUploadUrl), "/")
+	return nil
+}
+
+func (w *globalSettingsWebhook) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	settings, ok := obj.(*kav1.GlobalSettings)
+	if !ok {
+		return nil, fmt.Errorf("expected a GlobalSettings but got %T", obj)
+	}
+
+	errs := validateGlobalSettings(settings, w.watcher.Current().Limits.PageSizes)
+	if settings.Name != kav1.GlobalSettingsName {
+		errs = append(errs, field.NotSupported(field.NewPath("metadata", "name"), settings.Name,
+			[]string{kav1.GlobalSettingsName}))
+	}
+	if len(errs) > 0 {
+		return nil, apierrors.NewInvalid(globalSettingsGroupKind, settings.Name, errs)
+	}
+	return nil, nil
+}
+
+func (w *globalSettingsWebhook) ValidateUpdate(_ context.Context, _, newObj runtime.Object) (admission.Warnings, error) {
+	settings, ok := newObj.(*kav1.GlobalSettings)
+	if !ok {
+		return nil, fmt.Errorf("expected a GlobalSettings but got %T", newObj)
+	}
+	if errs := validateGlobalSettings(settings, w.watcher.Current().Limits.PageSizes); len(errs) > 0 {
+		return nil, apierrors.NewInvalid(globalSettingsGroupKind, settings.Name, errs)
+	}
+	return nil, nil
+}
+
+func (w *globalSettingsWebhook) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validateGlobalSettings validates the settings, the default page size must be one of the page sizes accepted by the
+// lists
+func validateGlobalSettings(settings *kav1.GlobalSettings, pageSizes []int) field.ErrorList {
+	specPath := field.NewPath("spec")
+	spec := settings.Spec
+	errs := validateOsTypes(settings)
+
+	scPath := specPath.Child("storageClass")
+	for name, value := range map[string]string{
+		"numberOfReplicas":    spec.StorageClass.NumberOfReplicas,
+		"staleReplicaTimeout": spec.StorageClass.StaleReplicaTimeout,
+	} {
+		if n, err := strconv.Atoi(value); value != "" && (err != nil || n < 1) {
+			errs = append(errs, field.Invalid(scPath.Child(name), value, "must be a positive integer"))
+		}
+	}
+
+	if uploadUrl := spec.LonghornUploadUrl; uploadUrl != "" {
+		if u, err := url.Parse(uploadUrl); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, field.Invalid(specPath.Child("longhornUploadUrl"), uploadUrl, "must be a http or https url"))
+		} else if !isLonghornServiceHost(u.Hostname()) {
+			errs = append(errs, field.Invalid(specPath.Child("longhornUploadUrl"), uploadUrl,
+				"the host must be a service in the namespace "+constants.LonghornNamespace))
+		}
+	}
+
+	if spec.DefaultPageSize != 0 && !slices.Contains(pageSizes, spec.DefaultPageSize) {
+		var supported []string
+		for _, pageSize := range pageSizes {
+			supported = append(supported, strconv.Itoa(pageSize))
+		}
+		errs = append(errs, field.NotSupported(specPath.Child("defaultPageSize"), strconv.Itoa(spec.DefaultPageSize),
+			supported))
+	}
+
+	sources := []kav1.ImageSourceType{kav1.ImageSourceTypeUpload, kav1.ImageSourceTypeDownload,
+		kav1.ImageSourceTypeRestore, kav1.ImageSourceTypeClone, kav1.ImageSourceTypeExportVolume}
+	for i, source := range spec.AllowedImageSources {
+		if !slices.Contains(sources, source) {
+			errs = append(errs, field.NotSupported(specPath.Child("allowedImageSources").Index(i), source, sources))
+		}
+	}
+
+	if memory := spec.VmDefaults.Memory; memory != "" {
+		if q, err := resource.ParseQuantity(memory); err != nil || q.Sign() <= 0 {
+			errs = append(errs, field.Invalid(specPath.Child("vmDefaults", "memory"), memory, "must be a positive quantity"))
+		}
+	}
+	return errs
+}
+
+// isLonghornServiceHost returns true if the host is the dns name of a service in longhorn's namespace, e.g.
+// longhorn-backend.longhorn-system or longhorn-backend.longhorn-system.svc.cluster.local. The images' content is
+// uploaded to the url by the server, it mustn't be pointed to anywhere else.
+func isLonghornServiceHost(host string) bool {
+	labels := strings.Split(host, ".")
+	if len(labels) < 2 || labels[0] == "" || labels[1] != constants.LonghornNamespace {
+		return false
+	}
+	return len(labels) == 2 || labels[2] == "svc"
+}
+
+func validateOsTypes(settings *kav1.GlobalSettings) field.ErrorList {
+	var errs field.ErrorList
+	seen := map[string]bool{}
+	osTypesPath := field.NewPath("spec", "osTypes")
+	for i, osType := range settings.Spec.OsTypes {
+		if strings.TrimSpace(osType) == "" {
+			errs = append(errs, field.Required(osTypesPath.Index(i), "the os type can't be empty"))
+		} else if seen[osType] {
+			errs = append(errs, field.Duplicate(osTypesPath.Index(i), osType))
+		}
+		seen[osType] = true
+	}
+	return errs
+}
@@ -0,0 +1,212 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	kav1 "kubeall.io/api-server/pkg/generated/kubeall.io/v1"
+	"kubeall.io/api-server/pkg/service"
+	"kubeall.io/api-server/pkg/types"
+	"net/url"
+	"reflect"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"slices"
+	"strings"
+)
+
+// +kubebuilder:webhook:path=/mutate-api-kubeall-io-v1-image,mutating=true,failurePolicy=fail,sideEffects=None,groups=api.kubeall.io,resources=images,verbs=create;update,versions=v1,name=mimage.kubeall.io,admissionReviewVersions=v1
+// +kubebuilder:webhook:path=/validate-api-kubeall-io-v1-image,mutating=false,failurePolicy=fail,sideEffects=None,groups=api.kubeall.io,resources=images,verbs=create;update,versions=v1,name=vimage.kubeall.io,admissionReviewVersions=v1
+
+var imageGroupKind = kav1.GroupVersion.WithKind("Image").GroupKind()
+
+// imageWebhook defaults and validates images, so that invalid images are rejected before reconciling
+type imageWebhook struct {
+	client client.Client
+}
+
+func NewImageWebhook() Handler {
+	return &imageWebhook{}
+}
+
+func (w *imageWebhook) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	w.client = mgr.GetClient()
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&kav1.Image{}).
+		WithDefaulter(w).
+		WithValidator(w).
+		Complete()
+}
+
+// Default sets the os type to the first one of the global settings if it's not specified
+func (w *imageWebhook) Default(ctx context.Context, obj runtime.Object) error {
+	image, ok := obj.(*kav1.Image)
+	if !ok {
+		return fmt.Errorf("expected an Image but got %T", obj)
+	}
+	if image.Spec.OsType != "" {
+		return nil
+	}
+	settings, err := service.GetGlobalSettings(ctx, w.client)
+	if err != nil {
+		return err
+	}
+	if len(settings.OsTypes) > 0 {
+		image.Spec.OsType = settings.OsTypes[0]
+	}
+	return nil
+}
+
+func (w *imageWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	image, ok := obj.(*kav1.Image)
+	if !ok {
+		return nil, fmt.Errorf("expected an Image but got %T", obj)
+	}
+
+	errs, err := w.validateName(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	specErrs, err := w.validateSpec(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	errs = append(errs, specErrs...)
+
+	// the allowed sources only apply to new images, the existing ones are kept
+	settings, err := service.GetGlobalSettings(ctx, w.client)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(settings.AllowedImageSources, image.Spec.ImageFrom) {
+		errs = append(errs, field.NotSupported(field.NewPath("spec", "imageFrom"), image.Spec.ImageFrom,
+			settings.AllowedImageSources))
+	}
+	if len(errs) > 0 {
+		return nil, apierrors.NewInvalid(imageGroupKind, image.Name, errs)
+	}
+	return nil, w.checkProjectQuota(ctx, image)
+}
+
+// checkProjectQuota rejects the image if the image quota of the namespace's project is exceeded
+func (w *imageWebhook) checkProjectQuota(ctx context.Context, image *kav1.Image) error {
+	project, err := service.ProjectOfNamespace(ctx, w.client, image.Namespace)
+	if err != nil || project == nil {
+		return err
+	}
+	exceeded, err := service.CheckProjectQuota(ctx, w.client, project, types.ProjectResources{Images: 1})
+	if err != nil || len(exceeded) == 0 {
+		return err
+	}
+	return apierrors.NewForbidden(kav1.GroupVersion.WithResource("images").GroupResource(), image.Name,
+		fmt.Errorf("the quota of the project %s is exceeded: %s", project.Name, strings.Join(exceeded, ", ")))
+}
+
+func (w *imageWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldImage, ok := oldObj.(*kav1.Image)
+	if !ok {
+		return nil, fmt.Errorf("expected an Image but got %T", oldObj)
+	}
+	image, ok := newObj.(*kav1.Image)
+	if !ok {
+		return nil, fmt.Errorf("expected an Image but got %T", newObj)
+	}
+	// the image is being deleted, the finalizer must be removable
+	if !image.DeletionTimestamp.IsZero() {
+		return nil, nil
+	}
+
+	errs, err := w.validateSpec(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	if isContentReported(oldImage) && !immutableSpecEqual(oldImage.Spec, image.Spec) {
+		errs = append(errs, field.Forbidden(field.NewPath("spec"),
+			"only osType and osVersion can be changed after the content of the image is uploaded"))
+	}
+	if len(errs) > 0 {
+		return nil, apierrors.NewInvalid(imageGroupKind, image.Name, errs)
+	}
+	return nil, nil
+}
+
+func (w *imageWebhook) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validateName makes sure the backing image's name isn't truncated and isn't used by any other image, the backing
+// images of images in all namespaces are created in the namespace of longhorn
+func (w *imageWebhook) validateName(ctx context.Context, image *kav1.Image) (field.ErrorList, error) {
+	namePath := field.NewPath("metadata", "name")
+	if len(image.Name) > service.ImageNameMaximumLength {
+		return field.ErrorList{field.TooLong(namePath, image.Name, service.ImageNameMaximumLength)}, nil
+	}
+
+	var images kav1.ImageList
+	if err := w.client.List(ctx, &images); err != nil {
+		return nil, err
+	}
+	biName := service.BackingImageName(image.Name)
+	for _, other := range images.Items {
+		if other.Namespace == image.Namespace && other.Name == image.Name {
+			continue
+		}
+		if service.BackingImageName(other.Name) == biName {
+			return field.ErrorList{field.Duplicate(namePath,
+				fmt.Sprintf("%s is used by the image %s/%s", biName, other.Namespace, other.Name))}, nil
+		}
+	}
+	return nil, nil
+}
+
+func (w *imageWebhook) validateSpec(ctx context.Context, image *kav1.Image) (field.ErrorList, error) {
+	var errs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	if image.Spec.ImageFrom == kav1.ImageSourceTypeDownload {
+		if image.Spec.Url == "" {
+			errs = append(errs, field.Required(specPath.Child("url"), "the url is required to download the image"))
+		} else if u, err := url.Parse(image.Spec.Url); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, field.Invalid(specPath.Child("url"), image.Spec.Url, "must be a http or https url"))
+		}
+	}
+
+	if scName := image.Spec.StorageClassName; scName != "" {
+		err := w.client.Get(ctx, client.ObjectKey{Name: scName}, &storagev1.StorageClass{})
+		if apierrors.IsNotFound(err) {
+			errs = append(errs, field.NotFound(specPath.Child("storageClassName"), scName))
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	if image.Spec.OsType != "" {
+		settings, err := service.GetGlobalSettings(ctx, w.client)
+		if err != nil {
+			return nil, err
+		}
+		osTypes := settings.OsTypes
+		if len(osTypes) > 0 && !slices.Contains(osTypes, image.Spec.OsType) {
+			errs = append(errs, field.NotSupported(specPath.Child("osType"), image.Spec.OsType, osTypes))
+		}
+	}
+	return errs, nil
+}
+
+// isContentReported returns true once the content of the image starts to be uploaded
+func isContentReported(image *kav1.Image) bool {
+	cond := meta.FindStatusCondition(image.Status.Conditions, kav1.ImageConditionUploaded)
+	return cond != nil && cond.Reason != kav1.ImageReasonPending
+}
+
+// immutableSpecEqual compares the specs except the descriptive fields
+func immutableSpecEqual(oldSpec, newSpec kav1.ImageSpec) bool {
+	oldSpec.OsType, oldSpec.OsVersion = "", ""
+	newSpec.OsType, newSpec.OsVersion = "", ""
+	return reflect.DeepEqual(oldSpec, newSpec)
+}
@@ -0,0 +1,102 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	kav1 "kubeall.io/api-server/pkg/generated/kubeall.io/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"slices"
+)
+
+// +kubebuilder:webhook:path=/validate-api-kubeall-io-v1-project,mutating=false,failurePolicy=fail,sideEffects=None,groups=api.kubeall.io,resources=projects,verbs=create;update,versions=v1,name=vproject.kubeall.io,admissionReviewVersions=v1
+
+var projectGroupKind = kav1.GroupVersion.WithKind("Project").GroupKind()
+
+// projectWebhook makes sure a namespace belongs to one project at most, and the quotas aren't negative
+type projectWebhook struct {
+	client client.Client
+}
+
+func NewProjectWebhook() Handler {
+	return &projectWebhook{}
+}
+
+func (w *projectWebhook) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	w.client = mgr.GetClient()
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&kav1.Project{}).
+		WithValidator(w).
+		Complete()
+}
+
+func (w *projectWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	project, ok := obj.(*kav1.Project)
+	if !ok {
+		return nil, fmt.Errorf("expected a Project but got %T", obj)
+	}
+	return nil, w.validate(ctx, project)
+}
+
+func (w *projectWebhook) ValidateUpdate(ctx context.Context, _, newObj runtime.Object) (admission.Warnings, error) {
+	project, ok := newObj.(*kav1.Project)
+	if !ok {
+		return nil, fmt.Errorf("expected a Project but got %T", newObj)
+	}
+	return nil, w.validate(ctx, project)
+}
+
+func (w *projectWebhook) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (w *projectWebhook) validate(ctx context.Context, project *kav1.Project) error {
+	errs, err := w.validateNamespaces(ctx, project)
+	if err != nil {
+		return err
+	}
+	errs = append(errs, validateProjectQuota(project.Spec.Quota)...)
+	if len(errs) > 0 {
+		return apierrors.NewInvalid(projectGroupKind, project.Name, errs)
+	}
+	return nil
+}
+
+func (w *projectWebhook) validateNamespaces(ctx context.Context, project *kav1.Project) (field.ErrorList, error) {
+	var projects kav1.ProjectList
+	if err := w.client.List(ctx, &projects); err != nil {
+		return nil, err
+	}
+
+	var errs field.ErrorList
+	namespacesPath := field.NewPath("spec", "namespaces")
+	for i, namespace := range project.Spec.Namespaces {
+		for _, msg := range validation.IsDNS1123Label(namespace) {
+			errs = append(errs, field.Invalid(namespacesPath.Index(i), namespace, msg))
+		}
+		for _, other := range projects.Items {
+			if other.Name != project.Name && slices.Contains(other.Spec.Namespaces, namespace) {
+				errs = append(errs, field.Duplicate(namespacesPath.Index(i),
+					fmt.Sprintf("%s belongs to the project %s", namespace, other.Name)))
+			}
+		}
+	}
+	return errs, nil
+}
+
+func validateProjectQuota(quota kav1.ProjectQuota) field.ErrorList {
+	var errs field.ErrorList
+	quotaPath := field.NewPath("spec", "quota")
+	for name, quantity := range map[string]*resource.Quantity{"memory": quota.Memory, "storage": quota.Storage} {
+		if quantity != nil && quantity.Sign() < 0 {
+			errs = append(errs, field.Invalid(quotaPath.Child(name), quantity.String(), "must not be negative"))
+		}
+	}
+	return errs
+}
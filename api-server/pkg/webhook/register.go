@@ -0,0 +1,27 @@
+package webhook
+
+import (
+	"go.uber.org/fx"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// Handler registers the admission webhooks of a resource to the webhook server of the manager
+type Handler interface {
+	SetupWebhookWithManager(mgr ctrl.Manager) error
+}
+
+func AsWebhook(f any) any {
+	return fx.Annotate(
+		f,
+		fx.As(new(Handler)),
+		fx.ResultTags(`group:"webhooks"`),
+	)
+}
+
+var Module = fx.Module("webhooks",
+	fx.Provide(
+		AsWebhook(NewImageWebhook),
+		AsWebhook(NewGlobalSettingsWebhook),
+		AsWebhook(NewProjectWebhook),
+	),
+)
@@ -0,0 +1,362 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kav1 "kubeall.io/api-server/pkg/generated/kubeall.io/v1"
+	"kubeall.io/api-server/pkg/infra/apiserver"
+	"kubeall.io/api-server/pkg/infra/config"
+	"kubeall.io/api-server/pkg/types"
+	"os"
+	"path/filepath"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the webhooks are tested with envtest, which requires the binaries of etcd and kube-apiserver:
+//
+//	export KUBEBUILDER_ASSETS=$(setup-envtest use -p path)
+var k8sClient client.Client
+
+// staticWatcher returns the config as is
+type staticWatcher struct {
+	config.Watcher
+	config *types.ServerConfig
+}
+
+func (w staticWatcher) Current() *types.ServerConfig {
+	return w.config
+}
+
+func TestMain(m *testing.M) {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		fmt.Println("KUBEBUILDER_ASSETS is not set, the webhook tests are skipped")
+		os.Exit(0)
+	}
+	os.Exit(runWithEnv(m))
+}
+
+func runWithEnv(m *testing.M) int {
+	testEnv := &envtest.Environment{
+		CRDDirectoryPaths:     []string{filepath.Join("..", "..", "..", "apis", "config", "crd", "bases")},
+		ErrorIfCRDPathMissing: true,
+		WebhookInstallOptions: envtest.WebhookInstallOptions{
+			Paths: []string{filepath.Join("..", "..", "..", "apis", "config", "webhook", "manifests.yaml")},
+		},
+	}
+	cfg, err := testEnv.Start()
+	if err != nil {
+		fmt.Printf("failed to start test env: %s\n", err)
+		return 1
+	}
+	defer func() { _ = testEnv.Stop() }()
+
+	options := testEnv.WebhookInstallOptions
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+		Scheme:  apiserver.CmScheme,
+		Metrics: metricsserver.Options{BindAddress: "0"},
+		WebhookServer: webhook.NewServer(webhook.Options{
+			Host:    options.LocalServingHost,
+			Port:    options.LocalServingPort,
+			CertDir: options.LocalServingCertDir,
+		}),
+	})
+	if err != nil {
+		fmt.Printf("failed to create manager: %s\n", err)
+		return 1
+	}
+	watcher := staticWatcher{config: &types.ServerConfig{Limits: &types.LimitsConfig{PageSizes: []int{10, 20, 50}}}}
+	for _, h := range []Handler{NewImageWebhook(), NewGlobalSettingsWebhook(watcher), NewProjectWebhook()} {
+		if err = h.SetupWebhookWithManager(mgr); err != nil {
+			fmt.Printf("failed to set up webhook: %s\n", err)
+			return 1
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = mgr.Start(ctx) }()
+
+	if k8sClient, err = client.New(cfg, client.Options{Scheme: apiserver.CmScheme}); err != nil {
+		fmt.Printf("failed to create client: %s\n", err)
+		return 1
+	}
+	// wait until the webhook server serves
+	err = wait.PollUntilContextTimeout(ctx, 100*time.Millisecond, 10*time.Second, true,
+		func(ctx context.Context) (bool, error) {
+			return mgr.GetWebhookServer().StartedChecker()(nil) == nil, nil
+		})
+	if err != nil {
+		fmt.Printf("webhook server isn't started: %s\n", err)
+		return 1
+	}
+	return m.Run()
+}
+
+// eventually retries the assertion until it passes, the cache of the webhooks is synced asynchronously
+func eventually(t *testing.T, assertion func() error) {
+	t.Helper()
+	var lastErr error
+	err := wait.PollUntilContextTimeout(context.Background(), 100*time.Millisecond, 5*time.Second, true,
+		func(ctx context.Context) (bool, error) {
+			lastErr = assertion()
+			return lastErr == nil, nil
+		})
+	if err != nil {
+		t.Fatalf("assertion never passed: %v", lastErr)
+	}
+}
+
+func createNamespace(t *testing.T, name string) {
+	t.Helper()
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	if err := k8sClient.Create(context.Background(), ns); err != nil {
+		t.Fatalf("failed to create namespace %s: %v", name, err)
+	}
+}
+
+func newImage(namespace, name string) *kav1.Image {
+	return &kav1.Image{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: kav1.ImageSpec{
+			ImageType: kav1.ImageDisk,
+			ImageFrom: kav1.ImageSourceTypeUpload,
+		},
+	}
+}
+
+func expectRejected(t *testing.T, err error, message string) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("expected the request rejected with %q", message)
+	}
+	if !strings.Contains(err.Error(), message) {
+		t.Fatalf("expected the error containing %q, got %v", message, err)
+	}
+}
+
+func TestImageWebhookRejectsInvalidSpec(t *testing.T) {
+	ctx := context.Background()
+	createNamespace(t, "invalid-spec")
+
+	image := newImage("invalid-spec", "download")
+	image.Spec.ImageFrom = kav1.ImageSourceTypeDownload
+	expectRejected(t, k8sClient.Create(ctx, image), "spec.url: Required value")
+
+	image = newImage("invalid-spec", "bad-url")
+	image.Spec.ImageFrom = kav1.ImageSourceTypeDownload
+	image.Spec.Url = "ftp://example.com/disk.qcow2"
+	expectRejected(t, k8sClient.Create(ctx, image), "spec.url: Invalid value")
+
+	image = newImage("invalid-spec", "unknown-sc")
+	image.Spec.StorageClassName = "not-existed"
+	expectRejected(t, k8sClient.Create(ctx, image), "spec.storageClassName: Not found")
+
+	image = newImage("invalid-spec", strings.Repeat("a", 38))
+	expectRejected(t, k8sClient.Create(ctx, image), "metadata.name: Too long")
+
+	sc := &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "longhorn"}, Provisioner: "driver.longhorn.io"}
+	if err := k8sClient.Create(ctx, sc); err != nil {
+		t.Fatalf("failed to create storage class: %v", err)
+	}
+	eventually(t, func() error {
+		image = newImage("invalid-spec", "valid")
+		image.Spec.ImageFrom = kav1.ImageSourceTypeDownload
+		image.Spec.Url = "https://example.com/disk.qcow2"
+		image.Spec.StorageClassName = sc.Name
+		return k8sClient.Create(ctx, image)
+	})
+}
+
+func TestImageWebhookRejectsDuplicatedBackingImage(t *testing.T) {
+	ctx := context.Background()
+	createNamespace(t, "dup-a")
+	createNamespace(t, "dup-b")
+
+	if err := k8sClient.Create(ctx, newImage("dup-a", "ubuntu")); err != nil {
+		t.Fatalf("failed to create image: %v", err)
+	}
+	eventually(t, func() error {
+		err := k8sClient.Create(ctx, newImage("dup-b", "ubuntu"))
+		if err == nil {
+			return fmt.Errorf("the image with a duplicated backing image is accepted")
+		}
+		if !strings.Contains(err.Error(), "bi-ubuntu is used by the image dup-a/ubuntu") {
+			return err
+		}
+		return nil
+	})
+}
+
+func TestImageWebhookRejectsImmutableChanges(t *testing.T) {
+	ctx := context.Background()
+	createNamespace(t, "immutable")
+
+	image := newImage("immutable", "centos")
+	if err := k8sClient.Create(ctx, image); err != nil {
+		t.Fatalf("failed to create image: %v", err)
+	}
+
+	// the spec can be changed before uploading
+	image.Spec.ImageType = kav1.ImageIso
+	if err := k8sClient.Update(ctx, image); err != nil {
+		t.Fatalf("failed to update image before uploading: %v", err)
+	}
+
+	meta.SetStatusCondition(&image.Status.Conditions, metav1.Condition{
+		Type:    kav1.ImageConditionUploaded,
+		Status:  metav1.ConditionFalse,
+		Reason:  kav1.ImageReasonInProgress,
+		Message: "uploading",
+	})
+	if err := k8sClient.Status().Update(ctx, image); err != nil {
+		t.Fatalf("failed to update status: %v", err)
+	}
+
+	image.Spec.ImageFrom = kav1.ImageSourceTypeClone
+	expectRejected(t, k8sClient.Update(ctx, image), "only osType and osVersion can be changed")
+
+	if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(image), image); err != nil {
+		t.Fatalf("failed to get image: %v", err)
+	}
+	image.Spec.OsVersion = "9"
+	if err := k8sClient.Update(ctx, image); err != nil {
+		t.Fatalf("failed to update the os version: %v", err)
+	}
+}
+
+func TestGlobalSettingsWebhook(t *testing.T) {
+	ctx := context.Background()
+	createNamespace(t, "os-types")
+
+	settings := &kav1.GlobalSettings{
+		ObjectMeta: metav1.ObjectMeta{Name: "default"},
+		Spec:       kav1.GlobalSettingsSpec{OsTypes: []string{" Ubuntu ", "Windows", "Ubuntu", ""}},
+	}
+	if err := k8sClient.Create(ctx, settings); err != nil {
+		t.Fatalf("failed to create global settings: %v", err)
+	}
+	if got := strings.Join(settings.Spec.OsTypes, ","); got != "Ubuntu,Windows" {
+		t.Fatalf("expected the os types normalized, got %s", got)
+	}
+
+	second := &kav1.GlobalSettings{ObjectMeta: metav1.ObjectMeta{Name: "second"}}
+	expectRejected(t, k8sClient.Create(ctx, second), "metadata.name: Unsupported value")
+
+	invalid := settings.DeepCopy()
+	invalid.Spec.LonghornUploadUrl = "longhorn-backend:9500"
+	invalid.Spec.VmDefaults.Memory = "-1Gi"
+	// 100 is allowed by the crd but isn't one of the configured page sizes
+	invalid.Spec.DefaultPageSize = 100
+	err := k8sClient.Update(ctx, invalid)
+	expectRejected(t, err, "spec.longhornUploadUrl: Invalid value")
+	expectRejected(t, err, "spec.vmDefaults.memory: Invalid value")
+	expectRejected(t, err, "spec.defaultPageSize: Unsupported value: \"100\"")
+
+	// the content of the images can't be uploaded out of the cluster
+	for _, uploadUrl := range []string{"https://example.com/v1/backingimages", "http://10.0.0.1:9500/v1/backingimages",
+		"http://longhorn-backend.default:9500/v1/backingimages", "http://longhorn-system.example.com/v1/backingimages"} {
+		invalid = settings.DeepCopy()
+		invalid.Spec.LonghornUploadUrl = uploadUrl
+		expectRejected(t, k8sClient.Update(ctx, invalid), "the host must be a service in the namespace longhorn-system")
+	}
+	valid := settings.DeepCopy()
+	valid.Spec.LonghornUploadUrl = "http://longhorn-backend.longhorn-system.svc.cluster.local:9500/v1/backingimages/"
+	if err := k8sClient.Update(ctx, valid); err != nil {
+		t.Fatalf("failed to update the upload url: %v", err)
+	}
+	settings = valid
+
+	// the os type is defaulted from the global settings
+	image := newImage("os-types", "defaulted")
+	if err := k8sClient.Create(ctx, image); err != nil {
+		t.Fatalf("failed to create image: %v", err)
+	}
+	if image.Spec.OsType != "Ubuntu" {
+		t.Fatalf("expected the os type defaulted to Ubuntu, got %q", image.Spec.OsType)
+	}
+
+	image = newImage("os-types", "unsupported")
+	image.Spec.OsType = "Plan9"
+	expectRejected(t, k8sClient.Create(ctx, image), "spec.osType: Unsupported value")
+
+	// only the allowed sources can be used by new images
+	settings.Spec.AllowedImageSources = []kav1.ImageSourceType{kav1.ImageSourceTypeUpload}
+	if err := k8sClient.Update(ctx, settings); err != nil {
+		t.Fatalf("failed to update global settings: %v", err)
+	}
+	eventually(t, func() error {
+		image := newImage("os-types", "downloaded")
+		image.Spec.ImageFrom = kav1.ImageSourceTypeDownload
+		image.Spec.Url = "https://example.com/disk.qcow2"
+		err := k8sClient.Create(ctx, image)
+		if err == nil {
+			return fmt.Errorf("the image from a disallowed source is accepted")
+		}
+		if !strings.Contains(err.Error(), "spec.imageFrom: Unsupported value") {
+			return err
+		}
+		return nil
+	})
+}
+
+func TestProjectWebhook(t *testing.T) {
+	ctx := context.Background()
+	createNamespace(t, "team-a")
+
+	images := int32(1)
+	project := &kav1.Project{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a"},
+		Spec: kav1.ProjectSpec{
+			Namespaces: []string{"team-a"},
+			Members:    []kav1.ProjectMember{{Name: "alice", Role: kav1.ProjectRoleOwner}},
+			Quota:      kav1.ProjectQuota{Images: &images},
+		},
+	}
+	if err := k8sClient.Create(ctx, project); err != nil {
+		t.Fatalf("failed to create project: %v", err)
+	}
+
+	eventually(t, func() error {
+		other := &kav1.Project{
+			ObjectMeta: metav1.ObjectMeta{Name: "team-b"},
+			Spec:       kav1.ProjectSpec{Namespaces: []string{"team-a", "Team_B"}},
+		}
+		err := k8sClient.Create(ctx, other)
+		if err == nil {
+			return fmt.Errorf("the project with a namespace of another project is accepted")
+		}
+		for _, message := range []string{"team-a belongs to the project team-a", "spec.namespaces[1]: Invalid value"} {
+			if !strings.Contains(err.Error(), message) {
+				return err
+			}
+		}
+		return nil
+	})
+
+	// the image quota of the project is enforced
+	if err := k8sClient.Create(ctx, newImage("team-a", "first")); err != nil {
+		t.Fatalf("failed to create image: %v", err)
+	}
+	eventually(t, func() error {
+		err := k8sClient.Create(ctx, newImage("team-a", "second"))
+		if err == nil {
+			return fmt.Errorf("the image exceeding the quota is accepted")
+		}
+		if !strings.Contains(err.Error(), "the quota of the project team-a is exceeded: images 2/1") {
+			return err
+		}
+		return nil
+	})
+}
@@ -23,11 +23,75 @@ import (
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
+// GlobalSettingsName is the name of the only global settings in the cluster
+const GlobalSettingsName = "default"
+
+// StorageClassSettings the defaults of the storage classes created for images
+type StorageClassSettings struct {
+	// the number of replicas of the volumes provisioned by the storage class
+	// +optional
+	NumberOfReplicas string `json:"numberOfReplicas,omitempty"`
+
+	// the minutes to wait before cleaning up a failed replica
+	// +optional
+	StaleReplicaTimeout string `json:"staleReplicaTimeout,omitempty"`
+
+	// +optional
+	// +kubebuilder:validation:Enum=Delete;Retain
+	ReclaimPolicy string `json:"reclaimPolicy,omitempty"`
+
+	// +optional
+	AllowVolumeExpansion *bool `json:"allowVolumeExpansion,omitempty"`
+
+	// +optional
+	// +kubebuilder:validation:Enum=Immediate;WaitForFirstConsumer
+	VolumeBindingMode string `json:"volumeBindingMode,omitempty"`
+
+	// the extra parameters of the storage class, they're overridden by the image's parameters
+	// +optional
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// VmDefaults the defaults applied to the vms which don't specify them
+type VmDefaults struct {
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	CpuCores uint32 `json:"cpuCores,omitempty"`
+
+	// the guest memory, e.g. 2Gi
+	// +optional
+	Memory string `json:"memory,omitempty"`
+
+	// +optional
+	// +kubebuilder:validation:Enum=Always;RerunOnFailure;Once;Manual;Halted
+	RunStrategy string `json:"runStrategy,omitempty"`
+}
+
 // GlobalSettingsSpec defines the desired state of GlobalSettings.
 type GlobalSettingsSpec struct {
 	// +optional
 	// +kubebuilder:validation:Optional
 	OsTypes []string `json:"osTypes,omitempty"`
+
+	// +optional
+	StorageClass StorageClassSettings `json:"storageClass,omitempty"`
+
+	// the url of longhorn's backing images api which the images' content is uploaded to, its host must be a service
+	// in the longhorn-system namespace
+	// +optional
+	LonghornUploadUrl string `json:"longhornUploadUrl,omitempty"`
+
+	// the page size of the lists while it isn't specified by the request
+	// +optional
+	// +kubebuilder:validation:Enum=10;20;50;100
+	DefaultPageSize int `json:"defaultPageSize,omitempty"`
+
+	// the sources which images can be created from, all sources are allowed if it's empty
+	// +optional
+	AllowedImageSources []ImageSourceType `json:"allowedImageSources,omitempty"`
+
+	// +optional
+	VmDefaults VmDefaults `json:"vmDefaults,omitempty"`
 }
 
 // GlobalSettingsStatus defines the observed state of GlobalSettings.
@@ -3,7 +3,8 @@ import axios, {AxiosRequestConfig,} from 'axios';
 
 const createApiClient = () => {
     const instance = axios.create({
-        // baseURL: "",
+        // 控制台与 api server 分开部署时通过 VITE_API_SERVER_URL 指定 api server 地址（需开启 api server 的 cors），内嵌部署时为空
+        baseURL: import.meta.env.VITE_API_SERVER_URL || "",
         // timeout: 5 * 1000
     });
 
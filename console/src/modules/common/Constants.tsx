@@ -64,13 +64,13 @@ export const LAYOUT_SETTING = {
 };
 
 export const buildResourceUri = (scop: string, type: string) => {
-    return `/api/v1/${scop}/${type}`;
+    return scop === resourceType.clusterResources ? buildClusterUri(type) : `/api/v1/${scop}/${type}`;
 }
 
 export const buildNamespacedUri = (namespace: string, type: string) => {
-    return `/api/v1/namespaces/${namespace}/${type}`;
+    return `/api/v1/clusters/local/namespaces/${namespace}/${type}`;
 }
 
 export const buildClusterUri = (type: string) => {
-    return `/api/v1/clusters/${type}`;
+    return `/api/v1/clusters/local/${type}`;
 }
\ No newline at end of file
@@ -1,10 +1,42 @@
-import {defineConfig} from "vite";
+import {defineConfig, type Plugin} from "vite";
 import react from "@vitejs/plugin-react";
+import fs from "fs";
 import path from "path";
+import zlib from "zlib";
+
+// 为构建产物生成 .gz 与 .br 预压缩文件，api server 内嵌控制台时按 Accept-Encoding 直接返回
+const precompress = (): Plugin => {
+    let outDir = "dist";
+    const compressible = /\.(js|mjs|css|html|svg|json|txt|map)$/;
+    const walk = (dir: string): string[] => fs.readdirSync(dir, {withFileTypes: true}).flatMap((entry) => {
+        const file = path.join(dir, entry.name);
+        return entry.isDirectory() ? walk(file) : [file];
+    });
+    return {
+        name: "precompress",
+        apply: "build",
+        configResolved(config) {
+            outDir = path.resolve(config.root, config.build.outDir);
+        },
+        closeBundle() {
+            for (const file of walk(outDir)) {
+                const content = fs.readFileSync(file);
+                // 过小的文件压缩后收益不大
+                if (!compressible.test(file) || content.length < 1024) {
+                    continue;
+                }
+                fs.writeFileSync(`${file}.gz`, zlib.gzipSync(content, {level: 9}));
+                fs.writeFileSync(`${file}.br`, zlib.brotliCompressSync(content, {
+                    params: {[zlib.constants.BROTLI_PARAM_QUALITY]: zlib.constants.BROTLI_MAX_QUALITY}
+                }));
+            }
+        }
+    };
+};
 
 // https://vitejs.dev/config/
 export default defineConfig({
-    plugins: [react()],
+    plugins: [react(), precompress()],
     resolve: {
         alias: {
             "@": path.resolve(__dirname, "src"),